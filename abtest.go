@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// A/B 节点接纳实验：在同一进程中再运行一个身份 B（独立的私钥和端口），它与主身份 A 提供
+// 相同的协议、使用相同的引导节点和门控规则，唯一的区别是 -ab.name 指定的客户端名称和
+// -ab.enr 添加的 ENR 条目。两个身份互不连接，同时统计各自获得对等节点的速度，
+// 用来衡量网络中的其他节点如何对待不同的公告。B 的协议实例只在内存中保存状态，不共享文件。
+const abReportInterval = 10 * time.Minute
+
+var errABSibling = errors.New("不连接 A/B 实验中的另一个身份")
+
+// ENR 中由 p2p 库维护的条目，不能通过 -ab.enr 修改
+var abReservedENR = []string{"id", "secp256k1", "ip", "ip6", "tcp", "tcp6", "udp", "udp6", "eth", "snap"}
+
+// parseENREntries 解析 "key=value,..." 形式的 ENR 条目，值按字符串编码
+func parseENREntries(spec string) (map[string]string, error) {
+	entries := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("无效的 ENR 条目 %q，格式为 key=value", item)
+		}
+		if slices.Contains(abReservedENR, k) {
+			return nil, fmt.Errorf("ENR 条目 %q 由节点自己维护，不能修改", k)
+		}
+		entries[k] = v
+	}
+	return entries, nil
+}
+
+// abArmStats 是 admin_abTest 中单个身份的统计
+type abArmStats struct {
+	Label      string            `json:"label"`
+	ID         enode.ID          `json:"id"`
+	Name       string            `json:"name"`
+	ENR        map[string]string `json:"enr,omitempty"`
+	Peers      int               `json:"peers"`  // 当前连接数
+	Unique     int               `json:"unique"` // 连接过的不同节点数
+	Inbound    uint64            `json:"inbound"`
+	Outbound   uint64            `json:"outbound"`
+	Drops      uint64            `json:"drops"`
+	FirstPeer  time.Duration     `json:"firstPeer,omitempty"`  // 从启动到第一个节点连接的时间
+	PerHour    float64           `json:"perHour"`              // 每小时获得的不同节点数
+	AvgSession time.Duration     `json:"avgSession,omitempty"` // 已结束会话的平均时长
+}
+
+type abArm struct {
+	label string
+	srv   *p2p.Server
+	enr   map[string]string
+
+	mu       sync.Mutex
+	seen     map[enode.ID]bool
+	started  map[enode.ID]time.Time
+	inbound  uint64
+	outbound uint64
+	drops    uint64
+	first    time.Duration
+	sessions time.Duration
+	ended    int
+}
+
+// abExperiment 比较两个身份获得对等节点的速度
+type abExperiment struct {
+	start time.Time
+	arms  [2]*abArm
+}
+
+func newABArm(label string, srv *p2p.Server, entries map[string]string) *abArm {
+	return &abArm{label: label, srv: srv, enr: entries, seen: make(map[enode.ID]bool), started: make(map[enode.ID]time.Time)}
+}
+
+// newABServer 按 A 的配置创建身份 B 的服务器。protocols 必须是 B 自己的协议实例
+func newABServer(base p2p.Config, addr, name string, gate *gater, sibling enode.ID, protocols func(srv *p2p.Server) []p2p.Protocol) (*p2p.Server, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	cfg := base
+	cfg.PrivateKey = key
+	cfg.ListenAddr = addr
+	cfg.NodeDatabase = ""
+	if name != "" {
+		cfg.Name = name
+	}
+	cfg.Dialer = &nodeDialer{dialer: net.Dialer{Timeout: defaultDialTimeout}, gater: gate, sibling: sibling}
+	srv := &p2p.Server{Config: cfg}
+	srv.Protocols = protocols(srv)
+	return srv, nil
+}
+
+func newABExperiment(a, b *abArm) *abExperiment {
+	for _, arm := range []*abArm{a, b} {
+		for k, v := range arm.enr {
+			arm.srv.LocalNode().Set(enr.WithEntry(k, v))
+		}
+	}
+	return &abExperiment{start: time.Now(), arms: [2]*abArm{a, b}}
+}
+
+// track 统计一个身份的连接事件
+func (x *abExperiment) track(arm *abArm) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := arm.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			now := time.Now()
+			arm.mu.Lock()
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				arm.seen[ev.Peer] = true
+				arm.started[ev.Peer] = now
+				if arm.first == 0 {
+					arm.first = now.Sub(x.start)
+				}
+				if arm.isInbound(ev) {
+					arm.inbound++
+				} else {
+					arm.outbound++
+				}
+			case p2p.PeerEventTypeDrop:
+				if t, ok := arm.started[ev.Peer]; ok {
+					arm.drops++
+					arm.sessions += now.Sub(t)
+					arm.ended++
+					delete(arm.started, ev.Peer)
+				}
+			}
+			arm.mu.Unlock()
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+func (arm *abArm) isInbound(ev *p2p.PeerEvent) bool {
+	for _, p := range arm.srv.Peers() {
+		if p.ID() == ev.Peer {
+			return p.Inbound()
+		}
+	}
+	return false
+}
+
+func (x *abExperiment) report() []abArmStats {
+	if x == nil {
+		return nil
+	}
+	hours := time.Since(x.start).Hours()
+	list := make([]abArmStats, 0, len(x.arms))
+	for _, arm := range x.arms {
+		arm.mu.Lock()
+		s := abArmStats{
+			Label:     arm.label,
+			ID:        arm.srv.Self().ID(),
+			Name:      arm.srv.Name,
+			ENR:       arm.enr,
+			Peers:     arm.srv.PeerCount(),
+			Unique:    len(arm.seen),
+			Inbound:   arm.inbound,
+			Outbound:  arm.outbound,
+			Drops:     arm.drops,
+			FirstPeer: arm.first.Round(time.Millisecond),
+		}
+		if hours > 0 {
+			s.PerHour = float64(len(arm.seen)) / hours
+		}
+		if arm.ended > 0 {
+			s.AvgSession = (arm.sessions / time.Duration(arm.ended)).Round(time.Second)
+		}
+		arm.mu.Unlock()
+		list = append(list, s)
+	}
+	return list
+}
+
+// run 启动统计并定期打印两个身份的对比
+func (x *abExperiment) run() {
+	for _, arm := range x.arms {
+		log.Printf("A/B 实验身份 %s: %s 名称 %q ENR %v", arm.label, arm.srv.Self().URLv4(), arm.srv.Name, arm.enr)
+		go x.track(arm)
+	}
+	tick := time.NewTicker(abReportInterval)
+	defer tick.Stop()
+	for range tick.C {
+		for _, s := range x.report() {
+			log.Printf("A/B 实验 %s: 当前 %d 个节点，累计 %d 个 (入站 %d 出站 %d)，每小时 %.1f 个，平均会话 %v",
+				s.Label, s.Peers, s.Unique, s.Inbound, s.Outbound, s.PerHour, s.AvgSession)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 节点亲和：重启后先重拨节点历史（-peers.history）中有用的会话最多、累计连接最久的节点，
+// 而不是等节点发现从头找起，几秒内就恢复到稳定的节点集合。重拨期间节点发现找到的节点暂缓拨号，
+// 最多等待 affinityHold；之后按退避继续重拨没有连上的历史节点，直到都连上、连接数已满或超过
+// affinityRedialFor。结果见 admin_affinity。
+const (
+	evAffinity = "peers.affinity"
+
+	affinityMaxAge     = 7 * 24 * time.Hour // 更早连接过的节点地址多半已经失效，不重拨
+	affinityHold       = 5 * time.Second
+	affinityRedialBase = time.Second
+	affinityRedialMax  = 15 * time.Second
+	affinityRedialFor  = time.Minute
+)
+
+var peersAffinity = flag.Int("peers.affinity", 8, "重启后在节点发现之前先重拨的历史节点数（按有用的会话数和累计连接时长排名，需要 -peers.history），0 表示不重拨")
+
+// affinityPeer 是 admin_affinity 中一个重拨的历史节点
+type affinityPeer struct {
+	ID        enode.ID      `json:"id"`
+	Useful    int           `json:"useful"`
+	Uptime    time.Duration `json:"uptime"`
+	Longest   time.Duration `json:"longest"`
+	Attempts  int           `json:"attempts"`
+	Connected time.Duration `json:"connected,omitempty"` // 从开始重拨到连上用了多久，没有连上时为 0
+	Error     string        `json:"error,omitempty"`     // 最近一次拨号的错误
+
+	node *enode.Node
+}
+
+// affinityReport 是 admin_affinity 的返回值
+type affinityReport struct {
+	Started   time.Time      `json:"started"`
+	Done      bool           `json:"done"`
+	FirstPeer time.Duration  `json:"firstPeer,omitempty"`
+	Peers     []affinityPeer `json:"peers"`
+}
+
+// peerAffinity 在启动时重拨历史上最稳定的节点
+type peerAffinity struct {
+	srv     *p2p.Server
+	dialer  p2p.NodeDialer
+	history *peerHistory
+	events  *eventBus
+	max     int
+
+	hold     chan struct{} // 关闭后不再暂缓节点发现的拨号
+	holdOnce sync.Once
+
+	mu     sync.Mutex
+	report affinityReport
+}
+
+func newPeerAffinity(srv *p2p.Server, dialer p2p.NodeDialer, history *peerHistory, events *eventBus, max int) *peerAffinity {
+	return &peerAffinity{srv: srv, dialer: dialer, history: history, events: events, max: max, hold: make(chan struct{})}
+}
+
+func (a *peerAffinity) release() {
+	a.holdOnce.Do(func() { close(a.hold) })
+}
+
+// wait 在第一轮重拨结束前暂缓节点发现的拨号。a 可以为 nil
+func (a *peerAffinity) wait(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	select {
+	case <-a.hold:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *peerAffinity) run() {
+	best := a.history.best(a.max, affinityMaxAge)
+	start := time.Now()
+	a.mu.Lock()
+	a.report = affinityReport{Started: start, Peers: make([]affinityPeer, len(best))}
+	for i, e := range best {
+		a.report.Peers[i] = affinityPeer{ID: e.ID, Useful: e.Useful, Uptime: e.Uptime, Longest: e.Longest, node: e.Node}
+	}
+	a.mu.Unlock()
+	if len(best) == 0 {
+		a.release()
+		a.finish()
+		return
+	}
+	log.Printf("重启后先重拨 %d 个历史上最稳定的节点", len(best))
+	hold := time.AfterFunc(affinityHold, a.release)
+	defer hold.Stop()
+
+	delay := affinityRedialBase
+	deadline := start.Add(affinityRedialFor)
+	for {
+		connected := make(map[enode.ID]bool)
+		for _, p := range a.srv.Peers() {
+			connected[p.ID()] = true
+		}
+		var wg sync.WaitGroup
+		pending := 0
+		for i := range best {
+			a.mu.Lock()
+			ap := &a.report.Peers[i]
+			if ap.Connected == 0 && connected[ap.ID] {
+				// 对方先连了进来
+				ap.Connected = time.Since(start)
+			}
+			done := ap.Connected != 0
+			a.mu.Unlock()
+			if done {
+				continue
+			}
+			pending++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := a.dial(ap.node)
+				a.mu.Lock()
+				defer a.mu.Unlock()
+				ap.Attempts++
+				if err != nil {
+					ap.Error = err.Error()
+					return
+				}
+				ap.Connected, ap.Error = time.Since(start), ""
+				if a.report.FirstPeer == 0 {
+					a.report.FirstPeer = ap.Connected
+				}
+			}()
+		}
+		wg.Wait()
+		a.release()
+		if pending == 0 || a.srv.PeerCount() >= a.srv.MaxPeers || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(delay)
+		delay = min(2*delay, affinityRedialMax)
+	}
+	a.finish()
+}
+
+// finish 记录重拨结束
+func (a *peerAffinity) finish() {
+	a.mu.Lock()
+	a.report.Done = true
+	total, ok := len(a.report.Peers), 0
+	for _, p := range a.report.Peers {
+		if p.Connected != 0 {
+			ok++
+		}
+	}
+	first := a.report.FirstPeer
+	a.mu.Unlock()
+	if total == 0 {
+		return
+	}
+	log.Printf("历史节点重拨结束：%d 个中连上了 %d 个，第一个用时 %v", total, ok, first.Round(time.Millisecond))
+	a.events.emit(evAffinity, enode.ID{}, fmt.Sprintf("connected=%d total=%d first=%v", ok, total, first.Round(time.Millisecond)))
+}
+
+func (a *peerAffinity) dial(n *enode.Node) error {
+	ctx, cancel := context.WithTimeout(withDirectDial(context.Background(), dialAffinity), defaultDialTimeout)
+	defer cancel()
+	fd, err := a.dialer.Dial(ctx, n)
+	if err != nil {
+		return err
+	}
+	return a.srv.SetupConn(fd, reconnectConnFlags, n)
+}
+
+// status 返回重拨的结果。a 可以为 nil
+func (a *peerAffinity) status() *affinityReport {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := a.report
+	r.Peers = append([]affinityPeer{}, a.report.Peers...)
+	return &r
+}
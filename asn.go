@@ -0,0 +1,322 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 按远端 ASN 汇总的传输统计：带宽、TCP 建连时间（约为一次往返，只有出站连接有样本）
+// 和错误率，帮助运营者找出连接质量差的网络。ASN 数据库使用 iptoasn.com 的 TSV 格式
+// （可以是 .gz），每行为
+//
+//	起始 IP  结束 IP  ASN  国家代码  名称
+//
+// IPv4 和 IPv6 的文件可以用逗号分隔同时加载。
+const asnUnknown = 0
+
+const geoipCompiled = true
+
+// 这些断开原因属于正常结束，不计为错误
+var asnNormalDisc = []string{
+	p2p.DiscRequested.Error(),
+	p2p.DiscQuitting.Error(),
+	p2p.DiscTooManyPeers.Error(),
+	p2p.DiscAlreadyConnected.Error(),
+}
+
+type asnRange struct {
+	start, end netip.Addr
+	asn        uint32
+	country    string
+	name       string
+}
+
+// asnDB 是按起始地址排序的地址段
+type asnDB struct {
+	ranges []asnRange
+}
+
+func loadASNDB(paths string) (*asnDB, error) {
+	db := new(asnDB)
+	names := make(map[string]string) // 复用相同的名称字符串
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := db.load(path, names); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+func (db *asnDB) load(path string, names map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil || start.BitLen() != end.BitLen() {
+			return fmt.Errorf("%s:%d: 无效的记录", path, line)
+		}
+		if asn == asnUnknown {
+			continue // 未分配的地址段
+		}
+		name, ok := names[fields[4]]
+		if !ok {
+			name = fields[4]
+			names[name] = name
+		}
+		db.ranges = append(db.ranges, asnRange{start: start, end: end, asn: uint32(asn), country: fields[3], name: name})
+	}
+	return sc.Err()
+}
+
+// lookup 返回 ip 所属的地址段，找不到时返回 nil
+func (db *asnDB) lookup(ip netip.Addr) *asnRange {
+	ip = ip.Unmap()
+	i := sort.Search(len(db.ranges), func(i int) bool { return ip.Less(db.ranges[i].start) })
+	if i == 0 {
+		return nil
+	}
+	r := &db.ranges[i-1]
+	if r.start.BitLen() != ip.BitLen() || r.end.Less(ip) {
+		return nil
+	}
+	return r
+}
+
+// asnStat 是 admin_asnStats 中单个 ASN 的统计
+type asnStat struct {
+	ASN          uint32  `json:"asn"`
+	Name         string  `json:"name,omitempty"`
+	Country      string  `json:"country,omitempty"`
+	Peers        int     `json:"peers"` // 当前连接数
+	Sessions     uint64  `json:"sessions"`
+	BytesIn      uint64  `json:"bytesIn"`
+	BytesOut     uint64  `json:"bytesOut"`
+	Dials        uint64  `json:"dials"`
+	DialFailures uint64  `json:"dialFailures"`
+	Disconnects  uint64  `json:"disconnects"` // 异常断开的会话数
+	RTTAvg       float64 `json:"rttAvgMs,omitempty"`
+	RTTMin       float64 `json:"rttMinMs,omitempty"`
+	ErrorRate    float64 `json:"errorRate"` // (拨号失败 + 异常断开) / (拨号 + 会话)
+
+	rttSum   time.Duration
+	rttCount int
+	rttMin   time.Duration
+	metrics  *asnMetrics
+}
+
+type asnMetrics struct {
+	bytesIn, bytesOut, dialFailures, disconnects metrics.Counter
+	rtt                                          metrics.Histogram
+}
+
+// asnTracker 按 ASN 汇总传输统计
+type asnTracker struct {
+	db *asnDB
+	m  metrics.Metrics
+
+	mu    sync.Mutex
+	stats map[uint32]*asnStat
+	peers map[enode.ID]uint32 // 已连接节点所属的 ASN
+}
+
+func newASNTracker(db *asnDB, m metrics.Metrics) *asnTracker {
+	return &asnTracker{db: db, m: m, stats: make(map[uint32]*asnStat), peers: make(map[enode.ID]uint32)}
+}
+
+// stat 返回 ip 所属 ASN 的统计，调用方必须持有 t.mu
+func (t *asnTracker) stat(ip netip.Addr) *asnStat {
+	var (
+		asn           uint32
+		name, country string
+	)
+	if r := t.db.lookup(ip); r != nil {
+		asn, name, country = r.asn, r.name, r.country
+	}
+	s, ok := t.stats[asn]
+	if !ok {
+		prefix := fmt.Sprintf("demo/asn/%d/", asn)
+		s = &asnStat{ASN: asn, Name: name, Country: country, metrics: &asnMetrics{
+			bytesIn:      t.m.Counter(prefix + "bytes_in"),
+			bytesOut:     t.m.Counter(prefix + "bytes_out"),
+			dialFailures: t.m.Counter(prefix + "dial_failures"),
+			disconnects:  t.m.Counter(prefix + "disconnects"),
+			rtt:          t.m.Histogram(prefix + "rtt"),
+		}}
+		t.stats[asn] = s
+	}
+	return s
+}
+
+// dialed 记录一次出站 TCP 拨号，成功时 rtt 为建连时间。t 可以为 nil
+func (t *asnTracker) dialed(ip netip.Addr, rtt time.Duration, err error) {
+	if t == nil || !ip.IsValid() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.stat(ip)
+	s.Dials++
+	if err != nil {
+		s.DialFailures++
+		s.metrics.dialFailures.Inc(1)
+		return
+	}
+	s.rttSum += rtt
+	s.rttCount++
+	if s.rttMin == 0 || rtt < s.rttMin {
+		s.rttMin = rtt
+	}
+	s.metrics.rtt.Observe(rtt.Milliseconds())
+}
+
+// protocol 包装协议的 Run 函数，按远端 ASN 计量收发的字节数
+func (t *asnTracker) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		ip, ok := addrIP(p.RemoteAddr())
+		if !ok {
+			return run(p, rw)
+		}
+		t.mu.Lock()
+		s := t.stat(ip)
+		t.mu.Unlock()
+		return run(p, &asnRW{MsgReadWriter: rw, t: t, s: s})
+	}
+	return proto
+}
+
+type asnRW struct {
+	p2p.MsgReadWriter
+	t *asnTracker
+	s *asnStat
+}
+
+func (rw *asnRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil {
+		rw.t.mu.Lock()
+		rw.s.BytesIn += uint64(msg.Size)
+		rw.t.mu.Unlock()
+		rw.s.metrics.bytesIn.Inc(int64(msg.Size))
+	}
+	return msg, err
+}
+
+func (rw *asnRW) WriteMsg(msg p2p.Msg) error {
+	size := msg.Size
+	err := rw.MsgReadWriter.WriteMsg(msg)
+	if err == nil {
+		rw.t.mu.Lock()
+		rw.s.BytesOut += uint64(size)
+		rw.t.mu.Unlock()
+		rw.s.metrics.bytesOut.Inc(int64(size))
+	}
+	return err
+}
+
+// track 根据对等节点事件统计会话和异常断开
+func (t *asnTracker) track(srv *p2p.Server) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				ip, err := netip.ParseAddrPort(ev.RemoteAddress)
+				if err != nil {
+					continue
+				}
+				t.mu.Lock()
+				s := t.stat(ip.Addr())
+				s.Sessions++
+				t.peers[ev.Peer] = s.ASN
+				t.mu.Unlock()
+			case p2p.PeerEventTypeDrop:
+				t.mu.Lock()
+				asn, ok := t.peers[ev.Peer]
+				delete(t.peers, ev.Peer)
+				if s := t.stats[asn]; ok && s != nil && ev.Error != "" && !slices.Contains(asnNormalDisc, ev.Error) {
+					s.Disconnects++
+					s.metrics.disconnects.Inc(1)
+				}
+				t.mu.Unlock()
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// report 返回所有 ASN 的统计，错误率高的排在前面
+func (t *asnTracker) report() []asnStat {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	peers := make(map[uint32]int)
+	for _, asn := range t.peers {
+		peers[asn]++
+	}
+	list := make([]asnStat, 0, len(t.stats))
+	for asn, s := range t.stats {
+		r := *s
+		r.Peers = peers[asn]
+		if r.rttCount > 0 {
+			r.RTTAvg = float64(r.rttSum.Microseconds()) / float64(r.rttCount) / 1000
+			r.RTTMin = float64(r.rttMin.Microseconds()) / 1000
+		}
+		if n := r.Dials + r.Sessions; n > 0 {
+			r.ErrorRate = float64(r.DialFailures+r.Disconnects) / float64(n)
+		}
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ErrorRate != list[j].ErrorRate {
+			return list[i].ErrorRate > list[j].ErrorRate
+		}
+		return list[i].ASN < list[j].ASN
+	})
+	return list
+}
@@ -0,0 +1,56 @@
+//go:build minimal
+
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+const geoipCompiled = false
+
+// minimal 构建不包含 ASN/GeoIP 数据库，-asn.db 总是加载失败，节点按可选子系统降级运行
+// （-startup.strict 时退出），-peers.local 只按建连时间判断附近的节点
+var errNoGeoIP = errors.New("minimal 构建不包含 ASN 数据库 (-asn.db)")
+
+type asnRange struct {
+	country string
+}
+
+type asnDB struct {
+	ranges []asnRange
+}
+
+func loadASNDB(paths string) (*asnDB, error) {
+	return nil, errNoGeoIP
+}
+
+func (db *asnDB) lookup(ip netip.Addr) *asnRange {
+	return nil
+}
+
+type asnStat struct{}
+
+type asnTracker struct {
+	db *asnDB
+}
+
+func newASNTracker(db *asnDB, m metrics.Metrics) *asnTracker {
+	return &asnTracker{db: db}
+}
+
+func (t *asnTracker) dialed(ip netip.Addr, rtt time.Duration, err error) {}
+
+func (t *asnTracker) protocol(proto p2p.Protocol) p2p.Protocol {
+	return proto
+}
+
+func (t *asnTracker) track(srv *p2p.Server) {}
+
+func (t *asnTracker) report() []asnStat {
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 按可用带宽启用或关闭协议：可用带宽 = -bw.capacity 减去实测的协议流量（指数平均）。
+// 可用带宽低于 -bw.disable 中某个协议的阈值时关闭该协议，回到阈值的 bwHysteresis 倍以上时
+// 重新启用。切换在已有和之后的会话中立即生效：协议关闭期间仍然完成握手，但丢弃收到的其他消息，
+// 不处理对方的请求、不发送响应也不转发（见 bwGatedRW）。Hello 中通告的能力列表在启动时确定，
+// 不随切换变化；需要改变通告的能力时修改 -bw.disable 后重启节点。
+const (
+	evProtoDisabled = "proto.disabled"
+	evProtoEnabled  = "proto.enabled"
+
+	bwSampleInterval = 5 * time.Second
+	bwSmoothing      = 0.3  // 流量指数平均的权重
+	bwHysteresis     = 1.25 // 重新启用需要的可用带宽是阈值的这个倍数
+)
+
+// parseBitRate 解析带宽，例如 512kbit、2mbit、1.5gbit，单位按十进制换算，返回 bit/s
+func parseBitRate(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	units := []struct {
+		suffix string
+		mult   float64
+	}{{"gbit", 1e9}, {"mbit", 1e6}, {"kbit", 1e3}, {"bit", 1}}
+	for _, u := range units {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("无效的带宽 %q", s)
+			}
+			return v * u.mult, nil
+		}
+	}
+	return 0, fmt.Errorf("无效的带宽 %q，单位为 bit、kbit、mbit 或 gbit", s)
+}
+
+func formatBitRate(bps float64) string {
+	switch {
+	case bps >= 0.9995e9:
+		return fmt.Sprintf("%.1f Gbit/s", bps/1e9)
+	case bps >= 0.9995e6:
+		return fmt.Sprintf("%.1f Mbit/s", bps/1e6)
+	default:
+		return fmt.Sprintf("%.0f kbit/s", bps/1e3)
+	}
+}
+
+// parseBandwidthRules 解析 -bw.disable 参数，格式为 proto<rate,...
+func parseBandwidthRules(s string) (map[string]float64, error) {
+	rules := make(map[string]float64)
+	served := servedVersions()
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, rate, ok := strings.Cut(item, "<")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("无效的带宽规则 %q，格式为 proto<rate", item)
+		}
+		if _, ok := served[name]; !ok {
+			return nil, fmt.Errorf("带宽规则中的协议 %s 不存在", name)
+		}
+		bps, err := parseBitRate(rate)
+		if err != nil {
+			return nil, fmt.Errorf("协议 %s: %v", name, err)
+		}
+		rules[name] = bps
+	}
+	return rules, nil
+}
+
+// bwRule 是 admin_bandwidth 中一个协议的状态
+type bwRule struct {
+	Protocol string    `json:"protocol"`
+	Below    string    `json:"below"` // 可用带宽低于这个值时关闭
+	Enabled  bool      `json:"enabled"`
+	Since    time.Time `json:"since,omitzero"` // 上次切换的时间
+	Dropped  uint64    `json:"dropped"`        // 关闭期间丢弃的消息数
+}
+
+// bwStatus 是 admin_bandwidth 的返回值
+type bwStatus struct {
+	Capacity  string   `json:"capacity"`
+	Used      string   `json:"used"`
+	Available string   `json:"available"`
+	Rules     []bwRule `json:"rules"`
+}
+
+// bandwidthGovernor 按可用带宽切换协议
+type bandwidthGovernor struct {
+	usage    *usageTracker
+	events   *eventBus
+	capacity float64 // bit/s
+	rules    map[string]float64
+
+	mu      sync.Mutex
+	used    float64 // bit/s，指数平均
+	last    protoUsage
+	off     map[string]bool
+	since   map[string]time.Time
+	dropped map[string]uint64
+}
+
+func newBandwidthGovernor(usage *usageTracker, events *eventBus, capacity float64, rules map[string]float64) *bandwidthGovernor {
+	return &bandwidthGovernor{
+		usage:    usage,
+		events:   events,
+		capacity: capacity,
+		rules:    rules,
+		off:      make(map[string]bool),
+		since:    make(map[string]time.Time),
+		dropped:  make(map[string]uint64),
+	}
+}
+
+// protocol 包装协议的 Run 函数，使带宽规则在会话内生效。g 为 nil 或协议没有规则时原样返回
+func (g *bandwidthGovernor) protocol(proto p2p.Protocol) p2p.Protocol {
+	if g == nil {
+		return proto
+	}
+	if _, ok := g.rules[proto.Name]; !ok {
+		return proto
+	}
+	run := proto.Run
+	name := proto.Name
+	handshake, ok := observerHandshakes[name]
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		return run(p, &bwGatedRW{MsgReadWriter: rw, g: g, proto: name, handshake: handshake, hasHandshake: ok})
+	}
+	return proto
+}
+
+// disabled 返回协议当前是否因带宽不足而关闭，关闭时记一次丢弃的消息
+func (g *bandwidthGovernor) disabled(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.off[name] {
+		return false
+	}
+	g.dropped[name]++
+	return true
+}
+
+// bwGatedRW 在协议关闭期间丢弃收到的非握手消息，协议的处理逻辑看不到这些请求，
+// 也就不会为它们发送响应或转发。握手照常完成，连接和其他协议不受影响
+type bwGatedRW struct {
+	p2p.MsgReadWriter
+	g            *bandwidthGovernor
+	proto        string
+	handshake    uint64
+	hasHandshake bool
+}
+
+func (rw *bwGatedRW) ReadMsg() (p2p.Msg, error) {
+	for {
+		msg, err := rw.MsgReadWriter.ReadMsg()
+		if err != nil || (rw.hasHandshake && msg.Code == rw.handshake) || !rw.g.disabled(rw.proto) {
+			return msg, err
+		}
+		msg.Discard()
+	}
+}
+
+// sample 更新实测流量并按规则切换协议
+func (g *bandwidthGovernor) sample(elapsed time.Duration) {
+	u := g.usage.totals()
+	g.mu.Lock()
+	bits := float64(u.BytesIn-g.last.BytesIn+u.BytesOut-g.last.BytesOut) * 8
+	g.last = u
+	g.used = bwSmoothing*bits/elapsed.Seconds() + (1-bwSmoothing)*g.used
+	avail := max(0, g.capacity-g.used)
+	now := time.Now()
+	var changed []string
+	for name, below := range g.rules {
+		switch {
+		case !g.off[name] && avail < below:
+			g.off[name] = true
+		case g.off[name] && avail >= below*bwHysteresis:
+			delete(g.off, name)
+		default:
+			continue
+		}
+		g.since[name] = now
+		changed = append(changed, name)
+	}
+	off := make(map[string]bool, len(g.off))
+	for name := range g.off {
+		off[name] = true
+	}
+	g.mu.Unlock()
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+	for _, name := range changed {
+		detail := fmt.Sprintf("available=%s below=%s", formatBitRate(avail), formatBitRate(g.rules[name]))
+		if off[name] {
+			log.Printf("可用带宽 %s 低于 %s，暂停处理协议 %s 的消息", formatBitRate(avail), formatBitRate(g.rules[name]), name)
+			g.events.emit(evProtoDisabled, enode.ID{}, "proto="+name+" "+detail)
+		} else {
+			log.Printf("可用带宽恢复到 %s，恢复处理协议 %s 的消息", formatBitRate(avail), name)
+			g.events.emit(evProtoEnabled, enode.ID{}, "proto="+name+" "+detail)
+		}
+	}
+}
+
+func (g *bandwidthGovernor) status() *bwStatus {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st := &bwStatus{
+		Capacity:  formatBitRate(g.capacity),
+		Used:      formatBitRate(g.used),
+		Available: formatBitRate(max(0, g.capacity-g.used)),
+	}
+	for name, below := range g.rules {
+		st.Rules = append(st.Rules, bwRule{Protocol: name, Below: formatBitRate(below), Enabled: !g.off[name], Since: g.since[name], Dropped: g.dropped[name]})
+	}
+	sort.Slice(st.Rules, func(i, j int) bool { return st.Rules[i].Protocol < st.Rules[j].Protocol })
+	return st
+}
+
+func (g *bandwidthGovernor) run() {
+	g.mu.Lock()
+	g.last = g.usage.totals()
+	g.mu.Unlock()
+	tick := time.NewTicker(bwSampleInterval)
+	defer tick.Stop()
+	for range tick.C {
+		g.sample(bwSampleInterval)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// UDP 黑洞检测：p2p.Server 的节点发现在 UDP 出站被防火墙丢弃时不会报任何错误，
+// 节点只是永远找不到对等节点。检测器定期向引导节点和路由表中的节点发送 ping，
+// 如果整个检测窗口内发出的 ping 一个 pong 都没有收到，就认为发出的 UDP 数据包进了黑洞：
+// 打印醒目的告警、发出 discovery.blackhole 事件并把 demo/discovery/blackhole 指标置为 1，
+// 之后收到任意 pong 即恢复。没有可以 ping 的节点时不做判断。
+const (
+	evDiscBlackhole = "discovery.blackhole"
+	evDiscRecovered = "discovery.recovered"
+
+	blackholeProbes = 8 // 每轮最多 ping 的节点数
+)
+
+// blackholeStatus 是 admin_discoveryHealth 的返回值
+type blackholeStatus struct {
+	Window     time.Duration `json:"window"`
+	Blackhole  bool          `json:"blackhole"`
+	Since      time.Time     `json:"since,omitzero"`    // 进入黑洞状态的时间
+	LastPong   time.Time     `json:"lastPong,omitzero"` // 最近一次收到 pong 的时间
+	Probes     uint64        `json:"probes"`
+	Pongs      uint64        `json:"pongs"`
+	Unanswered int           `json:"unanswered"` // 最近一次 pong 之后没有回应的 ping 数
+}
+
+// blackholeWatch 检测节点发现的 UDP 出站是否被丢弃
+type blackholeWatch struct {
+	srv       *p2p.Server
+	events    *eventBus
+	bootnodes []*enode.Node
+	window    time.Duration
+	gauge     metrics.Gauge
+	probes    metrics.Counter
+	failures  metrics.Counter
+
+	mu         sync.Mutex
+	started    time.Time
+	lastPong   time.Time
+	unanswered int
+	since      time.Time
+	total      uint64
+	pongs      uint64
+}
+
+func newBlackholeWatch(srv *p2p.Server, events *eventBus, bootnodes []*enode.Node, window time.Duration, m metrics.Metrics) *blackholeWatch {
+	return &blackholeWatch{
+		srv:       srv,
+		events:    events,
+		bootnodes: bootnodes,
+		window:    window,
+		gauge:     m.Gauge("demo/discovery/blackhole"),
+		probes:    m.Counter("demo/discovery/probes"),
+		failures:  m.Counter("demo/discovery/probe_failures"),
+	}
+}
+
+// targets 选出本轮要 ping 的节点：先是引导节点，再从路由表中补足
+func (b *blackholeWatch) targets() []*enode.Node {
+	disc := b.srv.DiscoveryV4()
+	if disc == nil {
+		return nil
+	}
+	self := b.srv.Self().ID()
+	seen := map[enode.ID]bool{self: true}
+	var list []*enode.Node
+	add := func(n *enode.Node) {
+		if len(list) < blackholeProbes && !seen[n.ID()] && n.UDP() != 0 {
+			seen[n.ID()] = true
+			list = append(list, n)
+		}
+	}
+	for _, n := range b.bootnodes {
+		add(n)
+	}
+	for _, bucket := range disc.TableBuckets() {
+		for _, n := range bucket {
+			add(n.Node)
+		}
+	}
+	return list
+}
+
+// probe 并发 ping 一轮节点，返回收到的 pong 数
+func (b *blackholeWatch) probe(nodes []*enode.Node) int {
+	disc := b.srv.DiscoveryV4()
+	if disc == nil || len(nodes) == 0 {
+		return 0
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		pongs int
+	)
+	for _, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := disc.Ping(n); err == nil {
+				mu.Lock()
+				pongs++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	b.probes.Inc(int64(len(nodes)))
+	b.failures.Inc(int64(len(nodes) - pongs))
+	return pongs
+}
+
+// record 记录一轮 ping 的结果并在状态变化时告警
+func (b *blackholeWatch) record(now time.Time, sent, pongs int) {
+	b.mu.Lock()
+	b.total += uint64(sent)
+	b.pongs += uint64(pongs)
+	if pongs > 0 {
+		b.lastPong = now
+		b.unanswered = 0
+		recovered := !b.since.IsZero()
+		lost := now.Sub(b.since).Round(time.Second)
+		b.since = time.Time{}
+		b.mu.Unlock()
+		if recovered {
+			b.gauge.Set(0)
+			log.Printf("节点发现已恢复：收到 %d/%d 个 pong，此前 %v 没有任何 UDP 回应", pongs, sent, lost)
+			b.events.emit(evDiscRecovered, enode.ID{}, "")
+		}
+		return
+	}
+	b.unanswered += sent
+	quiet := now.Sub(b.lastPong)
+	if b.lastPong.IsZero() {
+		quiet = now.Sub(b.started)
+	}
+	enter := b.since.IsZero() && b.unanswered > 0 && quiet >= b.window
+	if enter {
+		b.since = now
+	}
+	unanswered := b.unanswered
+	b.mu.Unlock()
+	if enter {
+		b.gauge.Set(1)
+		banner := strings.Repeat("!", 72)
+		log.Print(banner)
+		log.Printf("警告：%v 内发出的 %d 个节点发现 ping 没有收到任何回应", quiet.Round(time.Second), unanswered)
+		log.Printf("UDP 出站（或回程）很可能被防火墙丢弃，节点将无法发现新的对等节点，")
+		log.Printf("请检查 UDP 端口 %s 的出入站规则", b.srv.ListenAddr)
+		log.Print(banner)
+		b.events.emit(evDiscBlackhole, enode.ID{}, fmt.Sprintf("unanswered=%d", unanswered))
+	}
+}
+
+func (b *blackholeWatch) status() *blackholeStatus {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &blackholeStatus{
+		Window:     b.window,
+		Blackhole:  !b.since.IsZero(),
+		Since:      b.since,
+		LastPong:   b.lastPong,
+		Probes:     b.total,
+		Pongs:      b.pongs,
+		Unanswered: b.unanswered,
+	}
+}
+
+// run 每隔窗口的四分之一 ping 一轮
+func (b *blackholeWatch) run(ctx context.Context) {
+	b.mu.Lock()
+	b.started = time.Now()
+	b.mu.Unlock()
+	tick := time.NewTicker(max(b.window/4, time.Second))
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			nodes := b.targets()
+			if len(nodes) == 0 {
+				continue
+			}
+			pongs := b.probe(nodes)
+			b.record(time.Now(), len(nodes), pongs)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
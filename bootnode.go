@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 引导节点的"邻里守望"：包装节点发现的 UDP 连接，按统计窗口检查收到的数据包，
+// 发现以下异常时发出告警：
+//
+//   - 来自同一子网（IPv4 /24、IPv6 /48）的数据包数突然超过阈值
+//   - 格式错误的数据包（过短、哈希不符、未知类型）集中出现
+//   - 同一个节点 ID 在一个窗口内从多个不同 IP 发送 ping（ID 冲突或冒充）
+//
+// 同一类型、同一对象的告警在 -watch.alert 内只发出一次，被抑制的次数附在下一次告警中，
+// 防止攻击期间日志本身被刷爆。
+const (
+	discv4MinType = 1
+	discv4MaxType = 6
+	// 每个窗口内最多跟踪的子网和节点 ID 数，超过后新出现的不再单独统计
+	watchMaxTracked = 65536
+)
+
+// 告警类型
+const (
+	alertSubnetSpike = "subnet-spike"
+	alertMalformed   = "malformed-burst"
+	alertIDCollision = "id-collision"
+)
+
+// watchAlert 是一条告警，以 JSON 行写入 -watch.out
+type watchAlert struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Key        string    `json:"key"` // 子网、"*" 或节点 ID
+	Count      int       `json:"count"`
+	Detail     string    `json:"detail,omitempty"`
+	Suppressed int       `json:"suppressed,omitempty"` // 上次告警以来被抑制的同类告警数
+}
+
+type watchConfig struct {
+	Window     time.Duration
+	Subnet     int // 每个窗口内单个子网的数据包数阈值
+	Malformed  int // 每个窗口内格式错误的数据包数阈值
+	Endpoints  int // 每个窗口内单个节点 ID 的不同 IP 数阈值
+	AlertEvery time.Duration
+}
+
+// watchConn 统计收到的数据包并检测异常，本身不丢弃任何数据包
+type watchConn struct {
+	discover.UDPConn
+	cfg   watchConfig
+	alert func(watchAlert)
+
+	mu        sync.Mutex
+	start     time.Time
+	subnets   map[netip.Prefix]int
+	malformed int
+	samples   []string // 本窗口中部分格式错误数据包的来源
+	ids       map[enode.ID]map[netip.Addr]bool
+	fired     map[string]bool
+	last      map[string]time.Time // 每个告警的上次发出时间
+	held      map[string]int       // 被抑制的告警数
+}
+
+func newWatchConn(conn discover.UDPConn, cfg watchConfig, alert func(watchAlert)) *watchConn {
+	c := &watchConn{
+		UDPConn: conn,
+		cfg:     cfg,
+		alert:   alert,
+		last:    make(map[string]time.Time),
+		held:    make(map[string]int),
+	}
+	c.reset(time.Now())
+	return c
+}
+
+// reset 开始新的统计窗口，调用方必须持有 c.mu
+func (c *watchConn) reset(now time.Time) {
+	c.start = now
+	c.subnets = make(map[netip.Prefix]int)
+	c.malformed = 0
+	c.samples = nil
+	c.ids = make(map[enode.ID]map[netip.Addr]bool)
+	c.fired = make(map[string]bool)
+}
+
+func (c *watchConn) ReadFromUDPAddrPort(b []byte) (int, netip.AddrPort, error) {
+	n, addr, err := c.UDPConn.ReadFromUDPAddrPort(b)
+	if err == nil {
+		c.inspect(b[:n], addr.Addr().Unmap(), time.Now())
+	}
+	return n, addr, err
+}
+
+func subnetOf(ip netip.Addr) netip.Prefix {
+	bits := 24
+	if ip.Is6() {
+		bits = 48
+	}
+	p, _ := ip.Prefix(bits)
+	return p
+}
+
+func (c *watchConn) inspect(pkt []byte, ip netip.Addr, now time.Time) {
+	// 校验放在锁外，ping 需要恢复签名
+	bad := ""
+	switch {
+	case len(pkt) <= discv4HeadSize:
+		bad = "过短"
+	case !bytes.Equal(pkt[:32], crypto.Keccak256(pkt[32:])):
+		bad = "哈希不符"
+	case pkt[discv4HeadSize] < discv4MinType || pkt[discv4HeadSize] > discv4MaxType:
+		bad = fmt.Sprintf("未知类型 %d", pkt[discv4HeadSize])
+	}
+	var (
+		id     enode.ID
+		signed bool
+	)
+	if bad == "" && pkt[discv4HeadSize] == discv4Ping {
+		pub, err := crypto.SigToPub(crypto.Keccak256(pkt[discv4HeadSize:]), pkt[32:discv4HeadSize])
+		if err != nil {
+			bad = "签名无效"
+		} else {
+			id, signed = enode.PubkeyToIDV4(pub), true
+		}
+	}
+
+	var alerts []watchAlert
+	c.mu.Lock()
+	if now.Sub(c.start) >= c.cfg.Window {
+		c.reset(now)
+	}
+	subnet := subnetOf(ip)
+	if count, ok := c.subnets[subnet]; ok || len(c.subnets) < watchMaxTracked {
+		c.subnets[subnet] = count + 1
+		if count+1 >= c.cfg.Subnet {
+			alerts = c.fire(alerts, now, alertSubnetSpike, subnet.String(), count+1, "")
+		}
+	}
+	if bad != "" {
+		c.malformed++
+		if len(c.samples) < 5 {
+			c.samples = append(c.samples, ip.String()+" "+bad)
+		}
+		if c.malformed >= c.cfg.Malformed {
+			alerts = c.fire(alerts, now, alertMalformed, "*", c.malformed, fmt.Sprint(c.samples))
+		}
+	}
+	if signed {
+		ips, ok := c.ids[id]
+		if !ok && len(c.ids) < watchMaxTracked {
+			ips = make(map[netip.Addr]bool)
+			c.ids[id] = ips
+		}
+		if ips != nil {
+			ips[ip] = true
+			if len(ips) >= c.cfg.Endpoints {
+				alerts = c.fire(alerts, now, alertIDCollision, id.String(), len(ips), fmt.Sprintf("最近来自 %s", ip))
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, a := range alerts {
+		c.alert(a)
+	}
+}
+
+// fire 在阈值第一次达到时产生告警，同一告警在 AlertEvery 内只发出一次。调用方必须持有 c.mu
+func (c *watchConn) fire(alerts []watchAlert, now time.Time, kind, key string, count int, detail string) []watchAlert {
+	k := kind + " " + key
+	if c.fired[k] {
+		return alerts
+	}
+	c.fired[k] = true
+	if last, ok := c.last[k]; ok && now.Sub(last) < c.cfg.AlertEvery {
+		c.held[k]++
+		return alerts
+	}
+	if len(c.last) >= watchMaxTracked {
+		for key, t := range c.last {
+			if now.Sub(t) >= c.cfg.AlertEvery {
+				delete(c.last, key)
+				delete(c.held, key)
+			}
+		}
+	}
+	c.last[k] = now
+	a := watchAlert{Time: now, Kind: kind, Key: key, Count: count, Detail: detail, Suppressed: c.held[k]}
+	delete(c.held, k)
+	return append(alerts, a)
+}
+
+// bootnodeCmd 运行只提供 discv4 节点发现的引导节点，并监视异常流量
+func bootnodeCmd(args []string) {
+	fs := flag.NewFlagSet("bootnode", flag.ExitOnError)
+	addr := fs.String("addr", ":30301", "UDP 监听地址")
+	keyFile := fs.String("nodekey", "nodekey", "引导节点私钥文件，不存在时自动生成")
+	db := fs.String("nodedb", "", "节点数据库目录，为空时只保存在内存中")
+	extIP := fs.String("extip", "", "在节点记录中公告的外部 IP")
+	var cfg watchConfig
+	fs.DurationVar(&cfg.Window, "watch.window", time.Minute, "异常检测的统计窗口")
+	fs.IntVar(&cfg.Subnet, "watch.subnet", 2000, "每个窗口内来自同一子网的数据包数告警阈值")
+	fs.IntVar(&cfg.Malformed, "watch.malformed", 100, "每个窗口内格式错误的数据包数告警阈值")
+	fs.IntVar(&cfg.Endpoints, "watch.endpoints", 4, "每个窗口内同一节点 ID 的不同 IP 数告警阈值")
+	fs.DurationVar(&cfg.AlertEvery, "watch.alert", 10*time.Minute, "同一告警的最短间隔")
+	out := fs.String("watch.out", "", "以 JSON 行追加写入告警的文件，为空时只写日志")
+	firehoseAddr := fs.String("firehose.addr", "", "通过 WebSocket 推送解析后的节点发现数据包的监听地址（discv4_subscribe），为空时不开启")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	if cfg.Window <= 0 || cfg.Subnet <= 0 || cfg.Malformed <= 0 || cfg.Endpoints < 2 {
+		log.Fatal("-watch.window、-watch.subnet、-watch.malformed 必须大于 0，-watch.endpoints 至少为 2")
+	}
+	key, err := crypto.LoadECDSA(*keyFile)
+	if os.IsNotExist(err) {
+		if key, err = crypto.GenerateKey(); err == nil {
+			err = crypto.SaveECDSA(*keyFile, key)
+		}
+	}
+	if err != nil {
+		log.Fatalf("加载引导节点私钥失败: %v", err)
+	}
+	var sink *json.Encoder
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("打开告警文件失败: %v", err)
+		}
+		defer f.Close()
+		sink = json.NewEncoder(f)
+	}
+	var sinkMu sync.Mutex
+	alert := func(a watchAlert) {
+		log.Printf("[watch] %s %s: %d 个 (窗口 %v) %s 抑制 %d 次", a.Kind, a.Key, a.Count, cfg.Window, a.Detail, a.Suppressed)
+		if sink != nil {
+			sinkMu.Lock()
+			sink.Encode(&a)
+			sinkMu.Unlock()
+		}
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", *addr)
+	if err != nil {
+		log.Fatalf("无效的监听地址: %v", err)
+	}
+	udp, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("监听 UDP 失败: %v", err)
+	}
+	nodes, err := enode.OpenDB(*db)
+	if err != nil {
+		log.Fatalf("打开节点数据库失败: %v", err)
+	}
+	defer nodes.Close()
+	ln := enode.NewLocalNode(nodes, key)
+	ln.SetFallbackIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(udp.LocalAddr().(*net.UDPAddr).Port)
+	if *extIP != "" {
+		ip := net.ParseIP(*extIP)
+		if ip == nil {
+			log.Fatalf("无效的 -extip: %q", *extIP)
+		}
+		ln.SetStaticIP(ip)
+	}
+	var conn discover.UDPConn = newWatchConn(udp, cfg, alert)
+	if *firehoseAddr != "" {
+		f := newFirehose()
+		stop, err := startFirehose(*firehoseAddr, f)
+		if err != nil {
+			log.Fatalf("启动节点发现数据包推送失败: %v", err)
+		}
+		defer stop()
+		conn = newFirehoseConn(conn, f)
+	}
+	disc, err := discover.ListenV4(conn, ln, discover.Config{PrivateKey: key})
+	if err != nil {
+		log.Fatalf("启动节点发现失败: %v", err)
+	}
+	defer disc.Close()
+	log.Printf("引导节点已启动: %s", ln.Node().URLv4())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-interrupt
+	log.Println("关闭引导节点...")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var errDialBudget = errors.New("该节点在当前窗口内的重试次数已用完")
+
+// dialBudget 限制在一个时间窗口内对同一节点的尝试次数。
+// 拨号调度器、重连器和目标连接数管理的拨号都经过 nodeDialer，共用同一个预算，
+// 避免一个不稳定但很有吸引力的节点占满所有拨号能力。crawl 和 scan 子命令使用同样的预算规则。
+type dialBudget struct {
+	max    int
+	window time.Duration
+
+	mu       sync.Mutex
+	attempts map[enode.ID][]time.Time
+	lastGC   time.Time
+}
+
+// newDialBudget 创建预算，max 为 0 时返回 nil（不限制）
+func newDialBudget(max int, window time.Duration) *dialBudget {
+	if max <= 0 || window <= 0 {
+		return nil
+	}
+	return &dialBudget{max: max, window: window, attempts: make(map[enode.ID][]time.Time), lastGC: time.Now()}
+}
+
+// take 记录一次对 id 的尝试，预算用完时返回 errDialBudget
+func (b *dialBudget) take(id enode.ID) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Sub(b.lastGC) > b.window {
+		for id, list := range b.attempts {
+			if len(b.prune(list, now)) == 0 {
+				delete(b.attempts, id)
+			}
+		}
+		b.lastGC = now
+	}
+	list := b.prune(b.attempts[id], now)
+	if len(list) >= b.max {
+		b.attempts[id] = list
+		return errDialBudget
+	}
+	b.attempts[id] = append(list, now)
+	return nil
+}
+
+// prune 去掉窗口之外的尝试记录
+func (b *dialBudget) prune(list []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(list) && now.Sub(list[i]) >= b.window {
+		i++
+	}
+	return list[i:]
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 按能力版本固定连接：协议迁移期间要求所有节点至少通告某个版本的能力（例如 chat/2），
+// 只通告更低版本或根本不支持该协议的节点会被断开，断开原因为 DiscIncompatibleVersion，
+// 本地日志和 peer.capversion 事件中写明缺少的能力。devp2p 节点会通告自己支持的所有版本，
+// 所以只要升级后的节点同时通告新旧版本，就可以先升级再逐步提高要求。
+// 启动时 -caps.min 中低于要求的本地协议版本不再通告和提供；admin_setCapPins 只改变对节点的要求，
+// 通告的能力在下次启动时才随之改变。
+const evPeerCapVersion = "peer.capversion"
+
+// capPin 要求节点通告 Name 协议的 Version 或更高版本
+type capPin struct {
+	Name    string `json:"name"`
+	Version uint   `json:"version"`
+	// 只约束通告了该协议的节点，不支持该协议的节点不受影响（滚动升级完成后使用）
+	IfPresent bool `json:"ifPresent,omitempty"`
+}
+
+func (c capPin) String() string {
+	if c.IfPresent {
+		return fmt.Sprintf("%s/%d+?", c.Name, c.Version)
+	}
+	return fmt.Sprintf("%s/%d+", c.Name, c.Version)
+}
+
+// parseCapPins 解析 "chat/2,gossip/1" 形式的列表，版本后的 "+" 可以省略，
+// 最后加上 "?"（例如 chat/2+?）表示只约束通告了该协议的节点
+func parseCapPins(spec string) ([]capPin, error) {
+	var pins []capPin
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		optional := strings.HasSuffix(item, "?")
+		name, ver, ok := strings.Cut(strings.TrimSuffix(strings.TrimSuffix(item, "?"), "+"), "/")
+		v, err := strconv.ParseUint(ver, 10, 32)
+		if !ok || name == "" || err != nil {
+			return nil, fmt.Errorf("无效的能力版本 %q，格式为 协议/版本", item)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("协议 %s 重复出现", name)
+		}
+		seen[name] = true
+		pins = append(pins, capPin{Name: name, Version: uint(v), IfPresent: optional})
+	}
+	return pins, nil
+}
+
+// capPinStatus 是 admin_capPins 的返回值
+type capPinStatus struct {
+	Pins     []capPin          `json:"pins"`
+	Rejected map[string]uint64 `json:"rejected"` // 按要求统计断开的节点数
+}
+
+// capPinner 断开不满足能力版本要求的节点
+type capPinner struct {
+	srv    *p2p.Server
+	events *eventBus
+
+	mu       sync.Mutex
+	pins     []capPin
+	rejected map[string]uint64
+}
+
+func newCapPinner(srv *p2p.Server, events *eventBus, pins []capPin) *capPinner {
+	return &capPinner{srv: srv, events: events, pins: pins, rejected: make(map[string]uint64)}
+}
+
+// pinnedProtocols 去掉低于要求的协议版本，使节点不再通告和提供它们。
+// 某个协议的所有版本都低于要求时保留原样，由 capPinner 断开对方
+func pinnedProtocols(protos []p2p.Protocol, pins []capPin) []p2p.Protocol {
+	var kept []p2p.Protocol
+	for _, proto := range protos {
+		if !belowPin(proto, pins) || !slices.ContainsFunc(protos, func(p p2p.Protocol) bool { return p.Name == proto.Name && !belowPin(p, pins) }) {
+			kept = append(kept, proto)
+		}
+	}
+	return kept
+}
+
+func belowPin(proto p2p.Protocol, pins []capPin) bool {
+	return slices.ContainsFunc(pins, func(pin capPin) bool { return pin.Name == proto.Name && proto.Version < pin.Version })
+}
+
+// capViolation 返回 caps 不满足的第一个要求
+func capViolation(pins []capPin, caps []p2p.Cap) (capPin, bool) {
+	for _, pin := range pins {
+		ok, present := false, false
+		for _, c := range caps {
+			present = present || c.Name == pin.Name
+			if c.Name == pin.Name && c.Version >= pin.Version {
+				ok = true
+				break
+			}
+		}
+		if !ok && (present || !pin.IfPresent) {
+			return pin, true
+		}
+	}
+	return capPin{}, false
+}
+
+// check 在节点不满足要求时断开它
+func (c *capPinner) check(p *p2p.Peer) {
+	c.mu.Lock()
+	pin, bad := capViolation(c.pins, p.Caps())
+	if bad {
+		c.rejected[pin.String()]++
+	}
+	c.mu.Unlock()
+	if !bad {
+		return
+	}
+	log.Printf("断开节点 %s：要求 %s，对方通告的能力为 %v", p.ID().TerminalString(), pin, p.Caps())
+	c.events.emit(evPeerCapVersion, p.ID(), fmt.Sprintf("need=%s caps=%v", pin, p.Caps()))
+	p.Disconnect(p2p.DiscIncompatibleVersion)
+}
+
+// add 增加或替换一个协议的要求，并立即检查已连接的节点
+func (c *capPinner) add(pin capPin) {
+	c.mu.Lock()
+	pins := make([]capPin, 0, len(c.pins)+1)
+	for _, p := range c.pins {
+		if p.Name != pin.Name {
+			pins = append(pins, p)
+		}
+	}
+	c.mu.Unlock()
+	c.set(append(pins, pin))
+}
+
+// set 替换要求，并立即检查已连接的节点
+func (c *capPinner) set(pins []capPin) {
+	c.mu.Lock()
+	c.pins = pins
+	c.mu.Unlock()
+	log.Printf("能力版本要求: %v", pins)
+	for _, p := range c.srv.Peers() {
+		c.check(p)
+	}
+}
+
+func (c *capPinner) status() capPinStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := capPinStatus{Pins: append([]capPin{}, c.pins...), Rejected: make(map[string]uint64, len(c.rejected))}
+	for k, v := range c.rejected {
+		s.Rejected[k] = v
+	}
+	return s
+}
+
+// enforce 检查每个新连接的节点
+func (c *capPinner) enforce() {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := c.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != p2p.PeerEventTypeAdd {
+				continue
+			}
+			for _, p := range c.srv.Peers() {
+				if p.ID() == ev.Peer {
+					c.check(p)
+				}
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/peerstate"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// chat 协议消息
+const (
+	chatStatusMsg = 0x00
+	chatTextMsg   = 0x01
+	chatGoAwayMsg = 0x02
+
+	chatMsgCount = 3
+)
+
+const (
+	// chat/2 的文本消息带有发送时间。两个版本同时提供，连接时使用双方都支持的最高版本
+	chatVersion          = 2
+	chatHandshakeTimeout = 5 * time.Second
+	chatMaxMsgSize       = 64 * 1024
+
+	// 关闭时推荐给每个节点的替代节点数量及发送超时
+	goAwayMaxAlternatives = 8
+	goAwayTimeout         = 2 * time.Second
+	// 等待拨号的推荐节点上限。推荐来自不可信的对方，每条消息只采纳前 goAwayMaxAlternatives 个
+	goAwayMaxHints = 64
+)
+
+// chatVersions 是本节点提供的所有 chat 版本，从高到低
+var chatVersions = []uint{2, 1}
+
+var errChatVersion = errors.New("chat 协议版本不兼容")
+
+// chatStatus 是握手消息。ListenPort 让对方能为入站连接构造可拨号地址。
+type chatStatus struct {
+	Version    uint
+	Name       string
+	ListenPort uint16
+}
+
+type chatText struct {
+	Text string
+}
+
+// chatTextV2 是 chat/2 的文本消息，Sent 为发送时间（Unix 毫秒）
+type chatTextV2 struct {
+	Text string
+	Sent uint64
+}
+
+// encodeChatText 按协商的版本构造文本消息
+func encodeChatText(version uint, text string) any {
+	if version >= 2 {
+		return &chatTextV2{Text: text, Sent: uint64(time.Now().UnixMilli())}
+	}
+	return &chatText{Text: text}
+}
+
+// chatGoAway 通知对方本节点即将下线，并推荐其他可以连接的节点
+type chatGoAway struct {
+	Reason       string
+	Alternatives []string // enode URL
+}
+
+type chatPeer struct {
+	peer    *p2p.Peer
+	rw      p2p.MsgReadWriter
+	version uint // 协商的 chat 版本
+	status  chatStatus
+}
+
+// chatProtocol 是演示用的聊天协议，也负责节点间的下线通知
+type chatProtocol struct {
+	srv     *p2p.Server
+	store   *peerStore
+	events  *eventBus
+	peers   *peerstate.Set[*chatPeer]
+	hints   *nodeQueue   // 其他节点推荐的替代节点，作为拨号候选
+	reasons *dialReasons // 把推荐节点的拨号记为 PEX，可以为 nil
+	passive bool         // 观察模式下不广播消息，也不发送下线通知
+}
+
+func newChatProtocol(srv *p2p.Server, store *peerStore, events *eventBus) *chatProtocol {
+	return &chatProtocol{
+		srv:    srv,
+		store:  store,
+		events: events,
+		peers:  peerstate.New[*chatPeer](),
+		hints:  newNodeQueue(goAwayMaxHints),
+	}
+}
+
+// protocols 返回每个 chat 版本的协议，所有版本共用同一个节点集合。
+// 推荐的替代节点只作为最高版本的拨号候选：nodeQueue 只能有一个读取方
+func (c *chatProtocol) protocols() []p2p.Protocol {
+	protos := make([]p2p.Protocol, len(chatVersions))
+	for i, version := range chatVersions {
+		protos[i] = p2p.Protocol{
+			Name:    "chat",
+			Version: version,
+			Length:  chatMsgCount,
+			Run:     c.peers.Run(c.handshake(version), c.run),
+		}
+	}
+	protos[0].DialCandidates = c.reasons.tag(c.hints, dialPEX)
+	return protos
+}
+
+func (c *chatProtocol) handshake(version uint) func(p *p2p.Peer, rw p2p.MsgReadWriter) (*chatPeer, error) {
+	return func(p *p2p.Peer, rw p2p.MsgReadWriter) (*chatPeer, error) {
+		return c.handshakeVersion(p, rw, version)
+	}
+}
+
+func (c *chatProtocol) handshakeVersion(p *p2p.Peer, rw p2p.MsgReadWriter, version uint) (*chatPeer, error) {
+	ours := chatStatus{Version: version, Name: c.srv.Name, ListenPort: uint16(c.srv.Self().TCP())}
+	errc := make(chan error, 2)
+	var theirs chatStatus
+	go func() { errc <- p2p.Send(rw, chatStatusMsg, &ours) }()
+	go func() { errc <- readChatStatus(rw, &theirs) }()
+	timeout := time.NewTimer(chatHandshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, p2p.DiscReadTimeout
+		}
+	}
+	if theirs.Version != version {
+		return nil, fmt.Errorf("%w: %d", errChatVersion, theirs.Version)
+	}
+	if p.Inbound() && theirs.ListenPort != 0 {
+		n := p.Node()
+		c.store.setDialable(enode.NewV4(n.Pubkey(), n.IP(), int(theirs.ListenPort), int(theirs.ListenPort)))
+	}
+	return &chatPeer{peer: p, rw: rw, version: version, status: theirs}, nil
+}
+
+func readChatStatus(rw p2p.MsgReadWriter, status *chatStatus) error {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != chatStatusMsg {
+		return fmt.Errorf("握手阶段收到意外消息 %d", msg.Code)
+	}
+	if msg.Size > chatMaxMsgSize {
+		return fmt.Errorf("消息过大: %d", msg.Size)
+	}
+	return msg.Decode(status)
+}
+
+func (c *chatProtocol) run(ctx context.Context, p *p2p.Peer, rw p2p.MsgReadWriter, cp *chatPeer) error {
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > chatMaxMsgSize {
+			return fmt.Errorf("消息过大: %d", msg.Size)
+		}
+		switch msg.Code {
+		case chatTextMsg:
+			if cp.version >= 2 {
+				var text chatTextV2
+				if err := msg.Decode(&text); err != nil {
+					return err
+				}
+				delay := time.Since(time.UnixMilli(int64(text.Sent))).Round(time.Millisecond)
+				log.Printf("[chat] %s: %s (延迟 %v)", p.ID().TerminalString(), text.Text, delay)
+				break
+			}
+			var text chatText
+			if err := msg.Decode(&text); err != nil {
+				return err
+			}
+			log.Printf("[chat] %s: %s", p.ID().TerminalString(), text.Text)
+		case chatGoAwayMsg:
+			var ga chatGoAway
+			if err := msg.Decode(&ga); err != nil {
+				return err
+			}
+			c.handleGoAway(p, &ga)
+		default:
+			msg.Discard()
+			return fmt.Errorf("未知的消息代码 %d", msg.Code)
+		}
+		msg.Discard()
+	}
+}
+
+func (c *chatProtocol) handleGoAway(p *p2p.Peer, ga *chatGoAway) {
+	c.peers.Drain(p.ID())
+	self := c.srv.Self().ID()
+	connected := make(map[enode.ID]bool)
+	for _, peer := range c.srv.Peers() {
+		connected[peer.ID()] = true
+	}
+	var hints []*enode.Node
+	for _, url := range ga.Alternatives[:min(len(ga.Alternatives), goAwayMaxAlternatives)] {
+		n, err := enode.ParseV4(url)
+		if err != nil || n.ID() == self || connected[n.ID()] {
+			continue
+		}
+		connected[n.ID()] = true // 同一条消息中重复的节点只算一次
+		hints = append(hints, n)
+	}
+	added := c.hints.push(hints...)
+	log.Printf("节点 %s 即将下线 (%s)，推荐了 %d 个替代节点，加入拨号候选 %d 个", p.ID().TerminalString(), ga.Reason, len(ga.Alternatives), added)
+	c.events.emit(evGoAway, p.ID(), fmt.Sprintf("reason=%s alternatives=%d queued=%d", ga.Reason, len(ga.Alternatives), added))
+}
+
+// broadcast 向所有 chat 节点发送文本消息，返回发送成功的节点数
+func (c *chatProtocol) broadcast(text string) int {
+	if c.passive {
+		return 0
+	}
+	var sent int
+	c.peers.Range(func(p *p2p.Peer, cp *chatPeer) bool {
+		if err := p2p.Send(cp.rw, chatTextMsg, encodeChatText(cp.version, text)); err == nil {
+			sent++
+		}
+		return true
+	})
+	return sent
+}
+
+// goAway 在关闭前通知所有节点，并附上从节点库中挑选的健康替代节点
+func (c *chatProtocol) goAway(reason string) {
+	if c.passive {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), goAwayTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	c.peers.Range(func(p *p2p.Peer, cp *chatPeer) bool {
+		msg := chatGoAway{Reason: reason}
+		for _, n := range c.store.healthy(p.ID(), goAwayMaxAlternatives) {
+			msg.Alternatives = append(msg.Alternatives, n.URLv4())
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p2p.Send(cp.rw, chatGoAwayMsg, &msg)
+		}()
+		return true
+	})
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("发送下线通知超时")
+	}
+}
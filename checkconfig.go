@@ -0,0 +1,369 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+)
+
+// checkConfigCmd 在不启动节点的情况下检查节点参数，一次列出所有问题。
+// 退出码：0 表示没有问题，1 表示发现问题，2 表示参数无法解析。
+func checkConfigCmd(args []string) {
+	flag.CommandLine.Parse(args)
+	if *configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, *configFile); err != nil {
+			fmt.Fprintln(stdout, "✗", err)
+			os.Exit(1)
+		}
+	}
+
+	problems := checkConfig()
+	for _, p := range problems {
+		fmt.Fprintln(stdout, "✗", p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(stdout, "发现 %d 个问题\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Fprintln(stdout, "配置检查通过")
+}
+
+// checkConfig 返回当前命令行参数中的所有问题
+func checkConfig() []string {
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if err := checkListenAddr(*listenAddr); err != nil {
+		report("-addr %q: %v", *listenAddr, err)
+	}
+	if *rpcAddr != "" {
+		if err := checkListenAddr(*rpcAddr); err != nil {
+			report("-rpc.addr %q: %v", *rpcAddr, err)
+		}
+	}
+	if err := checkListenAddr(*metricsAddr); err != nil {
+		report("-metrics.addr %q: %v", *metricsAddr, err)
+	}
+	if *crawlServe != "" {
+		if err := checkListenAddr(*crawlServe); err != nil {
+			report("-crawl.serve %q: %v", *crawlServe, err)
+		}
+	}
+	if *nextEndpointAddr != "" {
+		if _, err := parseEndpoint(*nextEndpointAddr); err != nil {
+			report("-endpoint.next %q: %v", *nextEndpointAddr, err)
+		}
+	}
+
+	if *enrDNS != "" && !validHostname(*enrDNS) {
+		report("-enr.dns %q 不是有效的主机名", *enrDNS)
+	}
+
+	var restrict *netutil.Netlist
+	if *netrestrict != "" {
+		var err error
+		if restrict, err = netutil.ParseNetlist(*netrestrict); err != nil {
+			report("-netrestrict: %v", err)
+		}
+	}
+	for _, url := range strings.Split(*bootnodes, ",") {
+		if url == "" {
+			continue
+		}
+		n, err := enode.ParseV4(url)
+		if err != nil {
+			report("-bootnodes: 无效的 enode URL %q: %v", url, err)
+			continue
+		}
+		if _, ok := n.TCPEndpoint(); !ok {
+			report("-bootnodes: 节点 %s 没有 IP 地址", n.ID().TerminalString())
+		} else if restrict != nil && !restrict.ContainsAddr(n.IPAddr()) {
+			report("-bootnodes: 节点 %s 的地址 %v 不在 -netrestrict 范围内", n.ID().TerminalString(), n.IPAddr())
+		}
+	}
+
+	if _, err := nat.Parse(*natSpec); err != nil {
+		report("-nat %q: %v", *natSpec, err)
+	}
+
+	if *keySeed != "" {
+		if *ephemeral || isFlagSet(flag.CommandLine, "nodekey") {
+			report("-key.seed 不能与 -ephemeral 或 -nodekey 同时使用")
+		}
+		if _, err := deriveNodeKey(*keySeed, *keyIndex); err != nil {
+			report("-key.seed: %v", err)
+		}
+	} else if isFlagSet(flag.CommandLine, "key.index") {
+		report("-key.index 需要与 -key.seed 一起使用")
+	} else if *ephemeral {
+		if set := ephemeralConflicts(flag.CommandLine); len(set) > 0 {
+			report("-ephemeral 不能与 %s 同时使用", strings.Join(set, "、"))
+		}
+	} else if info, err := os.Stat(*nodeKeyFile); err == nil {
+		if info.Mode().Perm()&0o077 != 0 {
+			report("-nodekey %s: 权限 %v 过宽，私钥应只允许所有者读写 (chmod 600)", *nodeKeyFile, info.Mode().Perm())
+		}
+		if _, err := crypto.LoadECDSA(*nodeKeyFile); err != nil {
+			report("-nodekey %s: %v", *nodeKeyFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		report("-nodekey %s: %v", *nodeKeyFile, err)
+	}
+
+	if *fileDir != "" {
+		if info, err := os.Stat(*fileDir); err != nil {
+			report("-file.dir: %v", err)
+		} else if !info.IsDir() {
+			report("-file.dir %s 不是目录", *fileDir)
+		}
+	}
+	if *fileToken != "" {
+		if _, err := decodeToken(*fileToken); err != nil {
+			report("-file.token: %v", err)
+		}
+	}
+
+	if *maxPeers <= 0 {
+		report("-peers.max 必须大于 0")
+	}
+	if *peersTarget < 0 || *peersTarget > *maxPeers {
+		report("-peers.target %d 必须在 0 到 -peers.max (%d) 之间", *peersTarget, *maxPeers)
+	}
+	if *peersHysteresis < 0 {
+		report("-peers.hysteresis 不能为负数")
+	}
+	if *peersInbound < 0 || *peersInbound >= 100 {
+		report("-peers.inbound %d 必须在 0-99 之间", *peersInbound)
+	}
+	if *peersLocal < 0 || *peersLocal >= 100 {
+		report("-peers.local %d 必须在 0-99 之间", *peersLocal)
+	}
+	if *peersLocal > 0 && *peersLocalCountry != "" && *asnDBPath == "" {
+		report("-peers.local.country 需要 -asn.db")
+	}
+	if *peersAffinity < 0 {
+		report("-peers.affinity 不能为负数")
+	}
+	if *conformEvery > 0 && *conformPing <= 0 {
+		report("-conform.ping 必须大于 0")
+	}
+	if err := validEvictPolicy(*peersEvict); err != nil {
+		report("-peers.evict: %v", err)
+	}
+	if _, err := newPayloadCodec(*compressAlgo, *compressMin, fileMaxMsgSize, metrics.Noop); err != nil {
+		report("-compress: %v", err)
+	}
+	if _, err := parseTopicTTLs(*gossipTTL); err != nil {
+		report("-gossip.ttl: %v", err)
+	}
+	if _, err := parseTopicPriorities(*gossipPrio); err != nil {
+		report("-gossip.priority: %v", err)
+	}
+	if *gossipFanout <= 0 {
+		report("-gossip.fanout 必须大于 0")
+	}
+	if _, err := parseCapPins(*capsMin); err != nil {
+		report("-caps.min: %v", err)
+	}
+	if *discBlackhole < 0 {
+		report("-disc.blackhole 不能为负数")
+	} else if *discBlackhole > 0 && *discBlackhole < 10*time.Second {
+		report("-disc.blackhole 至少为 10s，过短的窗口会把偶发丢包误判为黑洞")
+	}
+	if *fileSlots < 0 {
+		report("-file.slots 不能为负数")
+	}
+	if *filePeerRate != "" {
+		if _, err := parseBitRate(*filePeerRate); err != nil {
+			report("-file.peer.rate: %v", err)
+		}
+	}
+	if *fileBad < 0 {
+		report("-file.bad 不能为负数")
+	}
+	if *fileTFT {
+		if *fileSlots == 0 {
+			report("-file.tft 通过公平调度限速，-file.slots 不能为 0")
+		}
+		if *fileTFTFree < 0 || *fileTFTRatio <= 0 {
+			report("-file.tft.free 不能为负数，-file.tft.ratio 必须大于 0")
+		}
+		if _, err := parseBitRate(*fileTFTRate); err != nil {
+			report("-file.tft.rate: %v", err)
+		}
+	}
+	if *bwDisable != "" {
+		if _, err := parseBandwidthRules(*bwDisable); err != nil {
+			report("-bw.disable: %v", err)
+		}
+		if _, err := parseBitRate(*bwCapacity); err != nil {
+			report("-bw.disable 需要有效的 -bw.capacity: %v", err)
+		}
+	}
+	if _, err := parseMeteredWarn(*meteredWarn); err != nil {
+		report("-metered.warn: %v", err)
+	}
+	if *meteredCap < 0 || *meteredDials <= 0 {
+		report("-metered.cap 不能为负数，-metered.dials 必须大于 0")
+	}
+	if *metered && *stabilityRebal {
+		report("-metered 与 -stability.rebalance 冲突：按流量计费时不主动替换已有会话")
+	}
+	if *metered && *peersEvict != evictReject {
+		report("-metered 与 -peers.evict=%s 冲突：按流量计费时不为新节点断开已有会话", *peersEvict)
+	}
+	if _, err := parseSLOTargets(*sloTargets); err != nil {
+		report("-slo: %v", err)
+	}
+	if *sloWindow < sloMinSamples || *sloDrop < 0 {
+		report("-slo.window 至少为 %d，-slo.drop 不能为负数", sloMinSamples)
+	}
+	if *enrWatchEvery <= 0 {
+		report("-enr.watch.interval 必须大于 0")
+	}
+	if *ifacePoll < 0 {
+		report("-iface.poll 不能为负数")
+	}
+	if *guardWindow < 0 || *guardEndpoints < 2 {
+		report("-guard.window 不能为负数，-guard.endpoints 至少为 2")
+	}
+	if *staticPeers != "" {
+		for _, url := range strings.Split(*staticPeers, ",") {
+			if _, err := enode.ParseV4(url); url != "" && err != nil {
+				report("-peers.static: %v", err)
+			}
+		}
+	}
+	if *reportEvery < time.Minute {
+		report("-report.every 至少为 1m")
+	}
+	if *reportWebhook != "" {
+		if u, err := url.Parse(*reportWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			report("-report.webhook 必须是 http 或 https URL")
+		}
+	}
+	if *stabilityRebal && (*stabilityInterval <= 0 || *stabilityCalm <= 0) {
+		report("-stability.interval 和 -stability.calm 必须大于 0")
+	}
+	if *slowStartRamp < 0 {
+		report("-slowstart 不能为负数")
+	}
+	if *slowStartDials < 1 || *slowStartDials > slowStartMaxDials {
+		report("-slowstart.dials 必须在 1 到 %d 之间", slowStartMaxDials)
+	}
+	if _, err := parseENREntries(*abENR); err != nil {
+		report("-ab.enr: %v", err)
+	}
+	if *abAddr != "" {
+		if _, err := net.ResolveTCPAddr("tcp", *abAddr); err != nil {
+			report("-ab.addr: %v", err)
+		} else if *abAddr == *listenAddr {
+			report("-ab.addr 不能与 -addr 相同")
+		}
+	} else if *abName != "" || *abENR != "" {
+		report("-ab.name 和 -ab.enr 需要同时设置 -ab.addr")
+	}
+	if *asnDBPath != "" {
+		if _, err := loadASNDB(*asnDBPath); err != nil {
+			report("-asn.db: %v", err)
+		}
+	}
+	if *upgradeTarget != "" {
+		if _, _, err := parseUpgrade(*upgradeTarget); err != nil {
+			report("-upgrade: %v", err)
+		}
+		if *upgradeThreshold <= 0 || *upgradeThreshold > 1 {
+			report("-upgrade.threshold 必须在 (0, 1] 范围内")
+		}
+	}
+	if *fleetURL != "" {
+		if u, err := url.Parse(*fleetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report("-fleet.url %q 不是有效的 http(s) 地址", *fleetURL)
+		}
+		if *fleetInterval <= 0 {
+			report("-fleet.interval 必须大于 0")
+		}
+		if *fleetConfigKey != "" {
+			if _, err := parseNodeID(*fleetConfigKey); err != nil {
+				report("-fleet.config.key %q: %v", *fleetConfigKey, err)
+			}
+			if *fleetConfigEvery <= 0 {
+				report("-fleet.config.interval 必须大于 0")
+			}
+		}
+	}
+	if *controlKey != "" {
+		if _, err := parseNodeID(*controlKey); err != nil {
+			report("-control.key %q: %v", *controlKey, err)
+		}
+	}
+	if _, ok := nodeProfiles[*profileName]; !ok {
+		report("-profile: 未知的运行配置 %q", *profileName)
+	}
+	if _, ok := logLangs[*logLang]; !ok && *logLang != "" {
+		report("-log.lang: 未知的日志语言 %q，可选 zh|en", *logLang)
+	}
+	if _, err := loadNetworkProfile(*networkFlag); err != nil {
+		report("-network: %v", err)
+	}
+	if _, err := parseFleetIDs(*peersNotesSync); err != nil {
+		report("-peers.notes.sync: %v", err)
+	}
+	if *pairFlag != "" {
+		if *pairFlag != pairHost {
+			if _, err := decodePairCode(*pairFlag); err != nil {
+				report("-pair: %v", err)
+			}
+		}
+		var set []string
+		for _, name := range []string{"bootnodes", "network", "discv5", "dial.pace"} {
+			if isFlagSet(flag.CommandLine, name) {
+				set = append(set, "-"+name)
+			}
+		}
+		if len(set) > 0 {
+			report("-pair 关闭了节点发现，不能与 %s 同时使用", strings.Join(set, "、"))
+		}
+	}
+	if *dialBudgetMax < 0 {
+		report("-dial.budget 不能为负数")
+	}
+	if *dialPaceFresh <= 0 {
+		report("-dial.pace.fresh 必须大于 0")
+	}
+	if *quotaWindow <= 0 {
+		report("-quota.window 必须大于 0")
+	}
+	return problems
+}
+
+// checkListenAddr 检查 host:port 形式的监听地址，host 可以为空
+func checkListenAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host != "" {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return fmt.Errorf("无效的 IP 地址 %q", host)
+		}
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("无效的端口 %q", port)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var errChunkHash = errors.New("数据块内容与哈希不符")
+
+// chunkStore 是按内容寻址的本地数据块存储，键为数据块的 SHA-256。
+//
+// 共享目录中的文件和下载得到的文件都按 fileChunkSize 切块后存入这里，
+// 相同内容只保存一份，别的节点请求时直接从这里读取。
+// dir 为空时数据块只保存在内存中（-ephemeral），不限制大小。
+type chunkStore struct {
+	dir string
+
+	mu  sync.RWMutex
+	mem map[common.Hash][]byte // dir 为空时使用
+}
+
+func newChunkStore(dir string) (*chunkStore, error) {
+	if dir == "" {
+		return &chunkStore{mem: make(map[common.Hash][]byte)}, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &chunkStore{dir: dir}, nil
+}
+
+func chunkHash(data []byte) common.Hash {
+	return sha256.Sum256(data)
+}
+
+func (s *chunkStore) path(h common.Hash) string {
+	hex := h.Hex()[2:]
+	return filepath.Join(s.dir, hex[:2], hex[2:])
+}
+
+func (s *chunkStore) has(h common.Hash) bool {
+	if s.mem != nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		_, ok := s.mem[h]
+		return ok
+	}
+	_, err := os.Stat(s.path(h))
+	return err == nil
+}
+
+// get 读取数据块并校验内容，磁盘上损坏的数据块会被删除
+func (s *chunkStore) get(h common.Hash) ([]byte, error) {
+	if s.mem != nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		data, ok := s.mem[h]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(s.path(h))
+	if err != nil {
+		return nil, err
+	}
+	if chunkHash(data) != h {
+		os.Remove(s.path(h))
+		return nil, fmt.Errorf("%w: %x", errChunkHash, h[:8])
+	}
+	return data, nil
+}
+
+// put 保存数据块并返回其哈希，已存在的数据块不会重复写入
+func (s *chunkStore) put(data []byte) (common.Hash, error) {
+	h := chunkHash(data)
+	if s.has(h) {
+		return h, nil
+	}
+	return h, s.write(h, data)
+}
+
+// putVerified 保存从网络收到的数据块，内容必须与期望的哈希一致
+func (s *chunkStore) putVerified(h common.Hash, data []byte) error {
+	if chunkHash(data) != h {
+		return fmt.Errorf("%w: %x", errChunkHash, h[:8])
+	}
+	if s.has(h) {
+		return nil
+	}
+	return s.write(h, data)
+}
+
+// write 先写临时文件再重命名，避免并发写入或中途退出留下不完整的数据块
+func (s *chunkStore) write(h common.Hash, data []byte) error {
+	if s.mem != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.mem[h] = append([]byte(nil), data...)
+		return nil
+	}
+	p := s.path(h)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// stats 返回数据块数量和总字节数
+func (s *chunkStore) stats() (count int, size int64, err error) {
+	if s.mem != nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for _, data := range s.mem {
+			count++
+			size += int64(len(data))
+		}
+		return count, size, nil
+	}
+	err = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || d.Name()[0] == '.' {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+	return count, size, err
+}
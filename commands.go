@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+type command struct {
+	usage string
+	run   func(args []string)
+}
+
+// 子命令：命令行第一个参数不以 "-" 开头时按子命令处理
+var commands = map[string]command{
+	"bootnode":     {"运行只提供节点发现的引导节点，监视并告警异常流量（子网突发、畸形数据包、节点 ID 冲突）", bootnodeCmd},
+	"check-config": {"检查节点参数（与启动节点时相同）但不启动节点，发现问题时退出码为 1", checkConfigCmd},
+	"scan":         {"只做 RLPx 握手和 Hello 交换，按实现特征为节点聚类（不依赖客户端名称）", scanCmd},
+	"init":         {"首次运行向导：生成节点私钥和配置文件，检查端口与引导节点", initCmd},
+	"interop":      {"连接参考节点，按脚本交换所有演示协议的消息并输出逐项的兼容性报告", interopCmd},
+	"issue-token":  {"为节点签发文件下载令牌", issueTokenCmd},
+	"control":      {"用管理员私钥签发运营者控制命令（暂停 gossip、全网断开节点、关闭节点），通过 admin_control 发布", controlCmd},
+	"coordinator":  {"运行机群协调者：接收节点登记和心跳，在 /nodes 提供在线节点清单", coordinatorCmd},
+	"crawl":        {"通过 discv4 爬取网络中的节点记录，带有限速和 nocrawl 排除等礼貌控制", crawlCmd},
+	"db":           {"查看节点发现的数据库：inspect 列出节点记录和存活统计，stats 汇总大小和按最近 pong 时间的分布", dbCmd},
+	"doctor":       {"运行环境自检：端口、NAT、引导节点、时钟和节点数据库", doctorCmd},
+	"state-graph":  {"输出协议状态机的转换图（Graphviz DOT 格式），用于文档", stateGraphCmd},
+}
+
+// runCommand 执行子命令，name 不是已知子命令时打印帮助并退出
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "未知的子命令 %q，可用的子命令:\n", name)
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(stderr, "  %-14s %s\n", n, commandUsage(commands[n].usage))
+		}
+		os.Exit(2)
+	}
+	cmd.run(args)
+}
+
+// 解析节点 ID，支持十六进制 ID 和 enode URL
+func parseNodeID(s string) (enode.ID, error) {
+	if strings.HasPrefix(s, "enode://") {
+		n, err := enode.ParseV4(s)
+		if err != nil {
+			return enode.ID{}, err
+		}
+		return n.ID(), nil
+	}
+	return enode.ParseID(s)
+}
+
+func issueTokenCmd(args []string) {
+	fs := flag.NewFlagSet("issue-token", flag.ExitOnError)
+	keyFile := fs.String("nodekey", "nodekey", "签发令牌的节点私钥文件，需与提供文件的节点一致")
+	holder := fs.String("holder", "", "令牌持有者的节点 ID 或 enode URL")
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "令牌有效期")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	if *holder == "" {
+		log.Fatal("必须指定 -holder")
+	}
+	id, err := parseNodeID(*holder)
+	if err != nil {
+		log.Fatalf("无效的持有者: %v", err)
+	}
+	key, err := crypto.LoadECDSA(*keyFile)
+	if err != nil {
+		log.Fatalf("加载节点密钥失败: %v", err)
+	}
+	token, err := issueToken(key, id, *ttl)
+	if err != nil {
+		log.Fatalf("签发令牌失败: %v", err)
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+)
+
+// 子协议载荷压缩。RLPx 层的 snappy 以帧为单位压缩，压缩率有限；file 和 gossip 协议
+// 可以在握手时协商对较大的载荷（文件数据、gossip 消息内容）额外使用 zstd。
+// 握手消息中的 Compress 字段列出本节点支持的算法（逗号分隔），双方都支持时才启用，
+// 压缩后的载荷在消息的 Codec 字段中标明算法。旧版本节点不发送 Compress 字段，不受影响。
+// zstd 的实现见 compress_zstd.go，minimal 构建不包含 zstd，默认的 -compress 为 none。
+const (
+	codecZstd = "zstd"
+
+	defaultCompressMin = 1024
+)
+
+var errUnknownCodec = errors.New("未知的压缩算法")
+
+// compressStats 是一个协议上的压缩效果
+type compressStats struct {
+	Messages uint64  `json:"messages"` // 实际压缩发送的消息数
+	Skipped  uint64  `json:"skipped"`  // 压缩后没有变小而按原样发送的消息数
+	Raw      uint64  `json:"raw"`      // 压缩前的字节数
+	Wire     uint64  `json:"wire"`     // 实际发送的字节数
+	Saved    int64   `json:"saved"`
+	Ratio    float64 `json:"ratio"` // Wire / Raw
+}
+
+// payloadCodec 负责载荷的压缩和解压，为 nil 时表示不支持压缩
+type payloadCodec struct {
+	min  int // 小于这个大小的载荷不压缩
+	zstd *zstdCodec
+	m    metrics.Metrics
+
+	mu    sync.Mutex
+	stats map[string]*compressStats
+}
+
+// newPayloadCodec 按 -compress 参数创建压缩器，algo 为 none 时返回 nil
+func newPayloadCodec(algo string, min int, maxSize int, m metrics.Metrics) (*payloadCodec, error) {
+	switch algo {
+	case "none", "":
+		return nil, nil
+	case codecZstd:
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownCodec, algo)
+	}
+	z, err := newZstdCodec(maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadCodec{min: min, zstd: z, m: m, stats: make(map[string]*compressStats)}, nil
+}
+
+// offer 返回握手消息中的 Compress 字段
+func (c *payloadCodec) offer() string {
+	if c == nil {
+		return ""
+	}
+	return codecZstd
+}
+
+// accepts 判断对方握手时提供的算法列表中是否有我们支持的
+func (c *payloadCodec) accepts(theirs string) bool {
+	return c != nil && slices.Contains(strings.Split(theirs, ","), codecZstd)
+}
+
+// compress 压缩 data，返回要发送的载荷和算法名。载荷过小或压缩后没有变小时原样返回，算法名为空。
+func (c *payloadCodec) compress(proto string, data []byte) ([]byte, string) {
+	if len(data) < c.min {
+		return data, ""
+	}
+	out := c.zstd.encode(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stat(proto)
+	s.Raw += uint64(len(data))
+	c.m.Counter("demo/compress/" + proto + "/raw").Inc(int64(len(data)))
+	if len(out) >= len(data) {
+		s.Skipped++
+		s.Wire += uint64(len(data))
+		c.m.Counter("demo/compress/" + proto + "/wire").Inc(int64(len(data)))
+		return data, ""
+	}
+	s.Messages++
+	s.Wire += uint64(len(out))
+	c.m.Counter("demo/compress/" + proto + "/wire").Inc(int64(len(out)))
+	return out, codecZstd
+}
+
+// decompress 按 codec 解压收到的载荷
+func (c *payloadCodec) decompress(codec string, data []byte) ([]byte, error) {
+	switch {
+	case codec == "":
+		return data, nil
+	case codec != codecZstd || c == nil:
+		return nil, fmt.Errorf("%w: %q", errUnknownCodec, codec)
+	}
+	out, err := c.zstd.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %v", err)
+	}
+	return out, nil
+}
+
+// stat 返回协议的统计，调用方必须持有 c.mu
+func (c *payloadCodec) stat(proto string) *compressStats {
+	s := c.stats[proto]
+	if s == nil {
+		s = new(compressStats)
+		c.stats[proto] = s
+	}
+	return s
+}
+
+func (c *payloadCodec) report() map[string]compressStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := make(map[string]compressStats, len(c.stats))
+	for proto, s := range c.stats {
+		r := *s
+		r.Saved = int64(r.Raw) - int64(r.Wire)
+		if r.Raw > 0 {
+			r.Ratio = float64(r.Wire) / float64(r.Raw)
+		}
+		report[proto] = r
+	}
+	return report
+}
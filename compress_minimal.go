@@ -0,0 +1,25 @@
+//go:build minimal
+
+package main
+
+import "errors"
+
+const (
+	zstdCompiled    = false
+	defaultCompress = "none"
+)
+
+// minimal 构建不包含 zstd，只能以 -compress none 运行，握手中不提供压缩
+type zstdCodec struct{}
+
+func newZstdCodec(maxSize int) (*zstdCodec, error) {
+	return nil, errors.New("minimal 构建不包含 zstd 压缩，使用 -compress none")
+}
+
+func (z *zstdCodec) encode(data []byte) []byte {
+	return data
+}
+
+func (z *zstdCodec) decode(data []byte) ([]byte, error) {
+	return nil, errUnknownCodec
+}
@@ -0,0 +1,36 @@
+//go:build !minimal
+
+package main
+
+import "github.com/klauspost/compress/zstd"
+
+const (
+	zstdCompiled    = true
+	defaultCompress = codecZstd
+)
+
+type zstdCodec struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func newZstdCodec(maxSize int) (*zstdCodec, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	// 限制解压后的大小，防止压缩炸弹
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(maxSize)), zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdCodec{enc: enc, dec: dec}, nil
+}
+
+func (z *zstdCodec) encode(data []byte) []byte {
+	return z.enc.EncodeAll(data, nil)
+}
+
+func (z *zstdCodec) decode(data []byte) ([]byte, error) {
+	return z.dec.DecodeAll(data, nil)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/peerstate"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 协议一致性检查：conf 协议除握手外只有 ping/pong，用于在混合了多种实现的测试网络中主动检查对方的行为，
+// 结果以徽章的形式显示在 admin_peers 中。每隔 -conform.every 对每个支持 conf 协议的节点做以下检查：
+//
+//	ping     在 -conform.ping 内应答 ping
+//	tail     应答带有未知尾部字段的 ping（解码时忽略将来新增的字段）
+//	unknown  收到协议长度内保留的消息代码后忽略它，既不断开连接也不影响后续应答
+//
+// unknown 检查不通过的节点通常会断开连接，结果在断开后仍然保留，重新连接时不再检查，以免反复断开。
+// 不支持 conf 协议的节点在 admin_peers 中没有 conformance 字段。
+const (
+	confVersion   = 1
+	confStatusMsg = 0x00
+	confPingMsg   = 0x01
+	confPongMsg   = 0x02
+	// 0x03、0x04 为将来的扩展保留：实现必须忽略这个范围内不认识的消息代码
+	confReservedMsg = 0x04
+
+	confMsgCount         = 5
+	confMaxMsgSize       = 1024
+	confHandshakeTimeout = 5 * time.Second
+	// 连接建立后等待这么久再开始检查
+	confStartDelay = 5 * time.Second
+	// 保留检查结果的节点数，包括已断开的节点
+	confResultCache = 1024
+
+	evPeerNonconformant = "peer.nonconformant"
+)
+
+// 检查项，也是徽章的名字
+const (
+	confCheckPing    = "ping"
+	confCheckTail    = "tail"
+	confCheckUnknown = "unknown"
+)
+
+var (
+	conformEvery = flag.Duration("conform.every", 10*time.Minute, "每隔多久对支持 conf 协议的节点做一次一致性检查（ping 应答、未知字段、保留的消息代码），0 表示只应答不检查")
+	conformPing  = flag.Duration("conform.ping", 2*time.Second, "一致性检查中 ping 的应答时限")
+)
+
+var (
+	errConfVersion = errors.New("conf 协议版本不兼容")
+	errConfClosed  = errors.New("连接已断开")
+	// 未通过 unknown 检查的原因，重新连接时据此跳过这项检查
+	errConfUnknownClosed = errors.New("收到保留的消息代码后断开了连接")
+)
+
+var confChecks = []string{confCheckPing, confCheckTail, confCheckUnknown}
+
+type confStatus struct {
+	Version uint
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+type confPing struct {
+	Nonce uint64
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+type confPong struct {
+	Nonce uint64
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// conformResult 是一个节点最近一次一致性检查的结果
+type conformResult struct {
+	Badges  []string          `json:"badges"`           // 通过的检查
+	Failed  map[string]string `json:"failed,omitempty"` // 没有通过的检查及原因
+	PingRTT time.Duration     `json:"pingRtt,omitempty"`
+	Checked time.Time         `json:"checked,omitzero"` // 为空表示还没有检查过
+}
+
+// failedUnknown 判断节点以前是否因为保留的消息代码断开过连接
+func (r *conformResult) failedUnknown() bool {
+	return r != nil && r.Failed[confCheckUnknown] == errConfUnknownClosed.Error()
+}
+
+// conformPeer 是 conf 协议中一个节点的状态
+type conformPeer struct {
+	rw p2p.MsgReadWriter
+
+	mu      sync.Mutex
+	pending map[uint64]chan struct{} // 等待 pong 的 ping，键为 nonce
+}
+
+// conformTracker 实现 conf 协议，主动检查对方并保存结果
+type conformTracker struct {
+	every   time.Duration
+	timeout time.Duration
+	events  *eventBus
+	peers   *peerstate.Set[*conformPeer]
+	passive bool // 观察模式下只完成握手，不主动检查也不应答 ping
+
+	mu      sync.Mutex
+	results lru.BasicLRU[enode.ID, *conformResult]
+}
+
+func newConformTracker(every, timeout time.Duration, events *eventBus) *conformTracker {
+	return &conformTracker{
+		every:   every,
+		timeout: timeout,
+		events:  events,
+		peers:   peerstate.New[*conformPeer](),
+		results: lru.NewBasicLRU[enode.ID, *conformResult](confResultCache),
+	}
+}
+
+func (t *conformTracker) protocol() p2p.Protocol {
+	return p2p.Protocol{
+		Name:    "conf",
+		Version: confVersion,
+		Length:  confMsgCount,
+		Run:     t.peers.Run(t.handshake, t.run),
+	}
+}
+
+func (t *conformTracker) handshake(p *p2p.Peer, rw p2p.MsgReadWriter) (*conformPeer, error) {
+	errc := make(chan error, 2)
+	var theirs confStatus
+	go func() { errc <- p2p.Send(rw, confStatusMsg, &confStatus{Version: confVersion}) }()
+	go func() {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer msg.Discard()
+		if msg.Code != confStatusMsg {
+			errc <- fmt.Errorf("握手阶段收到意外消息 %d", msg.Code)
+			return
+		}
+		errc <- msg.Decode(&theirs)
+	}()
+	timeout := time.NewTimer(confHandshakeTimeout)
+	defer timeout.Stop()
+	for range 2 {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, p2p.DiscReadTimeout
+		}
+	}
+	if theirs.Version != confVersion {
+		return nil, fmt.Errorf("%w: %d", errConfVersion, theirs.Version)
+	}
+	t.mu.Lock()
+	if _, ok := t.results.Get(p.ID()); !ok {
+		t.results.Add(p.ID(), &conformResult{Badges: []string{}})
+	}
+	t.mu.Unlock()
+	return &conformPeer{rw: rw, pending: make(map[uint64]chan struct{})}, nil
+}
+
+func (t *conformTracker) run(ctx context.Context, p *p2p.Peer, rw p2p.MsgReadWriter, cp *conformPeer) error {
+	if t.every > 0 && !t.passive {
+		go t.loop(ctx, p, cp)
+	}
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > confMaxMsgSize {
+			return fmt.Errorf("消息过大: %d", msg.Size)
+		}
+		switch msg.Code {
+		case confPingMsg:
+			var ping confPing
+			if err := msg.Decode(&ping); err != nil {
+				return err
+			}
+			if t.passive {
+				break
+			}
+			if err := p2p.Send(rw, confPongMsg, &confPong{Nonce: ping.Nonce}); err != nil {
+				return err
+			}
+		case confPongMsg:
+			var pong confPong
+			if err := msg.Decode(&pong); err != nil {
+				return err
+			}
+			cp.mu.Lock()
+			if ch, ok := cp.pending[pong.Nonce]; ok {
+				close(ch)
+				delete(cp.pending, pong.Nonce)
+			}
+			cp.mu.Unlock()
+		default:
+			// 保留的消息代码：忽略，这正是 unknown 检查要求对方做到的
+		}
+		msg.Discard()
+	}
+}
+
+// loop 在连接建立 confStartDelay 后检查一次，之后每隔 t.every 检查一次
+func (t *conformTracker) loop(ctx context.Context, p *p2p.Peer, cp *conformPeer) {
+	timer := time.NewTimer(confStartDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+		t.check(ctx, p, cp)
+		timer.Reset(t.every)
+	}
+}
+
+// ping 发送一个 ping 并等待对应的 pong，tail 不为空时附加在消息末尾
+func (cp *conformPeer) ping(ctx context.Context, tail []rlp.RawValue, timeout time.Duration) (time.Duration, error) {
+	nonce := rand.Uint64()
+	ch := make(chan struct{})
+	cp.mu.Lock()
+	cp.pending[nonce] = ch
+	cp.mu.Unlock()
+	defer func() {
+		cp.mu.Lock()
+		delete(cp.pending, nonce)
+		cp.mu.Unlock()
+	}()
+	start := time.Now()
+	if err := p2p.Send(cp.rw, confPingMsg, &confPing{Nonce: nonce, Rest: tail}); err != nil {
+		return 0, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, fmt.Errorf("%v 内没有收到 pong", timeout)
+	case <-ctx.Done():
+		return 0, errConfClosed
+	}
+}
+
+// check 依次做所有检查并保存结果
+func (t *conformTracker) check(ctx context.Context, p *p2p.Peer, cp *conformPeer) {
+	t.mu.Lock()
+	prev, _ := t.results.Get(p.ID())
+	t.mu.Unlock()
+	res := &conformResult{Badges: []string{}, Failed: make(map[string]string), Checked: time.Now()}
+
+	rtt, err := cp.ping(ctx, nil, t.timeout)
+	if err == errConfClosed {
+		return
+	}
+	res.record(confCheckPing, err)
+	res.PingRTT = rtt
+
+	extra, _ := rlp.EncodeToBytes("future")
+	_, err = cp.ping(ctx, []rlp.RawValue{extra}, t.timeout)
+	if err == errConfClosed {
+		return
+	}
+	res.record(confCheckTail, err)
+
+	// 放在最后，不通过的节点一般会断开连接
+	if prev.failedUnknown() {
+		res.record(confCheckUnknown, errConfUnknownClosed)
+	} else if err := p2p.Send(cp.rw, confReservedMsg, []uint{confVersion}); err != nil {
+		return
+	} else {
+		_, err := cp.ping(ctx, nil, t.timeout)
+		if err == errConfClosed {
+			err = errConfUnknownClosed
+		} else if err != nil {
+			err = fmt.Errorf("收到保留的消息代码后没有应答 ping: %v", err)
+		}
+		res.record(confCheckUnknown, err)
+	}
+
+	t.mu.Lock()
+	t.results.Add(p.ID(), res)
+	t.mu.Unlock()
+	for _, name := range confChecks {
+		reason, failed := res.Failed[name]
+		if failed && (prev == nil || prev.Failed[name] != reason) {
+			log.Printf("节点 %s 没有通过一致性检查 %s: %s", p.ID().TerminalString(), name, reason)
+			t.events.emit(evPeerNonconformant, p.ID(), name+": "+reason)
+		}
+	}
+}
+
+func (r *conformResult) record(check string, err error) {
+	if err != nil {
+		r.Failed[check] = err.Error()
+		return
+	}
+	r.Badges = append(r.Badges, check)
+}
+
+// result 返回节点的检查结果，对方不支持 conf 协议时返回 nil
+func (t *conformTracker) result(id enode.ID) *conformResult {
+	if t == nil || t.peers.Peer(id) == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.results.Get(id)
+	if !ok {
+		return nil
+	}
+	cp := *r
+	cp.Badges = slices.Clone(r.Badges)
+	return &cp
+}
+
+// adminPeer 是 admin_peers 中的一个节点，在 p2p.PeerInfo 的基础上附带一致性检查的结果
+type adminPeer struct {
+	*p2p.PeerInfo
+	Conformance *conformResult `json:"conformance,omitempty"`
+}
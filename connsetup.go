@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 连接建立各阶段的耗时：TCP 建连、RLPx 加密握手（auth/ack）、devp2p Hello 交换、子协议握手，
+// 分别记入直方图 demo/setup/<阶段>（子协议握手按协议统计，例如 demo/setup/handshake/chat），
+// 在某个阶段断开的连接记入 demo/setup/<阶段>/failures，用于找出在整个节点群体中普遍偏慢或超时的阶段。
+// admin_setupPhases 返回最近 setupWindow 次的分位数。
+//
+// 入站连接由 p2p.Server 自己 accept，拿不到底层连接，只统计子协议握手；出站连接经过 nodeDialer，
+// 四个阶段都统计。RLPx 握手的结束时间按对方 ack 消息的长度前缀判断，Hello 交换在第一个子协议
+// 启动时结束（p2p.Server 在 Hello 交换和连接检查都通过后才启动子协议）。
+const (
+	setupTCP   = "tcp"
+	setupAuth  = "auth"
+	setupHello = "hello"
+	// 子协议握手的阶段名为 setupHandshake + "/" + 协议名
+	setupHandshake = "handshake"
+
+	// 每个阶段保留的最近样本数
+	setupWindow = 512
+	// 旧式（EIP-8 之前）ack 消息的固定长度，以 0x04 开头，没有长度前缀
+	setupLegacyAckLen = 210
+)
+
+// setupPhaseStats 是 admin_setupPhases 中一个阶段的耗时
+type setupPhaseStats struct {
+	Phase    string        `json:"phase"`
+	Samples  int           `json:"samples"`
+	Total    uint64        `json:"total"`
+	Failures uint64        `json:"failures"` // 在这个阶段断开的连接数
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+// setupTracker 测量连接建立各阶段的耗时
+type setupTracker struct {
+	m metrics.Metrics
+
+	mu       sync.Mutex
+	conns    map[string]*setupConn // Hello 交换尚未结束的出站连接，键为 "本地地址|远端地址"
+	series   map[string]*sloSeries
+	failures map[string]uint64
+}
+
+func newSetupTracker(m metrics.Metrics) *setupTracker {
+	return &setupTracker{m: m, conns: make(map[string]*setupConn), series: make(map[string]*sloSeries), failures: make(map[string]uint64)}
+}
+
+func setupKey(local, remote net.Addr) string {
+	return local.String() + "|" + remote.String()
+}
+
+// observe 记录一个阶段的耗时
+func (t *setupTracker) observe(phase string, d time.Duration) {
+	t.m.Histogram("demo/setup/" + phase).Observe(d.Milliseconds())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.series[phase]
+	if s == nil {
+		s = new(sloSeries)
+		t.series[phase] = s
+	}
+	s.add(d, setupWindow)
+}
+
+// failed 记录在 phase 阶段断开的连接
+func (t *setupTracker) failed(phase string) {
+	t.m.Counter("demo/setup/" + phase + "/failures").Inc(1)
+	t.mu.Lock()
+	t.failures[phase]++
+	t.mu.Unlock()
+}
+
+// dialed 包装拨号得到的连接，d 是 TCP 建连的耗时
+func (t *setupTracker) dialed(fd net.Conn, d time.Duration) net.Conn {
+	if t == nil {
+		return fd
+	}
+	t.observe(setupTCP, d)
+	c := &setupConn{Conn: fd, t: t, key: setupKey(fd.LocalAddr(), fd.RemoteAddr()), start: time.Now()}
+	t.mu.Lock()
+	t.conns[c.key] = c
+	t.mu.Unlock()
+	return c
+}
+
+// protocol 包装协议的 Run 函数：第一个启动的子协议结束对应连接的 Hello 阶段，
+// 并测量子协议自己的握手（收发第一条消息）耗时
+func (t *setupTracker) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	phase := setupHandshake + "/" + proto.Name
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		start := time.Now()
+		t.mu.Lock()
+		c := t.conns[setupKey(p.LocalAddr(), p.RemoteAddr())]
+		t.mu.Unlock()
+		if c != nil {
+			c.helloDone(start)
+		}
+		hrw := &setupRW{MsgReadWriter: rw, t: t, phase: phase, start: start}
+		err := run(p, hrw)
+		hrw.finish()
+		return err
+	}
+	return proto
+}
+
+// report 返回各阶段的耗时，按连接建立的顺序排列
+func (t *setupTracker) report() []setupPhaseStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	order := map[string]int{setupTCP: 0, setupAuth: 1, setupHello: 2}
+	rank := func(phase string) int {
+		if r, ok := order[phase]; ok {
+			return r
+		}
+		return len(order)
+	}
+	phases := make(map[string]bool)
+	for phase := range t.series {
+		phases[phase] = true
+	}
+	for phase := range t.failures {
+		phases[phase] = true
+	}
+	list := []setupPhaseStats{}
+	for phase := range phases {
+		st := setupPhaseStats{Phase: phase, Failures: t.failures[phase]}
+		if s := t.series[phase]; s != nil {
+			sorted := append([]time.Duration(nil), s.samples...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			n := len(sorted)
+			st.Samples, st.Total = n, s.total
+			st.P50, st.P90, st.P99, st.Max = sorted[n/2], sorted[min(n-1, n*90/100)], sorted[min(n-1, n*99/100)], sorted[n-1]
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if ri, rj := rank(list[i].Phase), rank(list[j].Phase); ri != rj {
+			return ri < rj
+		}
+		return list[i].Phase < list[j].Phase
+	})
+	return list
+}
+
+// setupConn 记录出站连接上 RLPx 握手和 Hello 交换结束的时间
+type setupConn struct {
+	net.Conn
+	t     *setupTracker
+	key   string
+	start time.Time // TCP 连接建立的时间
+
+	mu     sync.Mutex
+	prefix []byte // ack 消息开头的字节，用于得到消息长度
+	read   int    // 已读取的 ack 字节数
+	want   int    // ack 消息的总长度，读到长度前缀之前为 0
+	authAt time.Time
+	hello  bool
+}
+
+func (c *setupConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		if c.authAt.IsZero() {
+			c.readAck(b[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// readAck 统计 ack 消息已读取的字节数，读完时 RLPx 握手结束，调用方必须持有 c.mu
+func (c *setupConn) readAck(b []byte) {
+	if c.want == 0 {
+		need := min(2-len(c.prefix), len(b))
+		c.prefix = append(c.prefix, b[:need]...)
+		if len(c.prefix) < 2 {
+			c.read += len(b)
+			return
+		}
+		if c.prefix[0] == 0x04 {
+			c.want = setupLegacyAckLen
+		} else {
+			c.want = 2 + int(binary.BigEndian.Uint16(c.prefix))
+		}
+	}
+	c.read += len(b)
+	if c.read >= c.want {
+		c.authAt = time.Now()
+		c.t.observe(setupAuth, c.authAt.Sub(c.start))
+	}
+}
+
+// helloDone 在连接的第一个子协议启动时调用
+func (c *setupConn) helloDone(now time.Time) {
+	c.mu.Lock()
+	if c.hello || c.authAt.IsZero() {
+		c.mu.Unlock()
+		return
+	}
+	c.hello = true
+	authAt := c.authAt
+	c.mu.Unlock()
+	c.t.observe(setupHello, now.Sub(authAt))
+	c.t.mu.Lock()
+	delete(c.t.conns, c.key)
+	c.t.mu.Unlock()
+}
+
+// Close 在 Hello 交换结束之前关闭时记录断开的阶段
+func (c *setupConn) Close() error {
+	c.mu.Lock()
+	phase := ""
+	switch {
+	case c.authAt.IsZero():
+		phase = setupAuth
+	case !c.hello:
+		phase = setupHello
+	}
+	c.hello = true
+	c.mu.Unlock()
+	if phase != "" {
+		c.t.failed(phase)
+		c.t.mu.Lock()
+		if c.t.conns[c.key] == c {
+			delete(c.t.conns, c.key)
+		}
+		c.t.mu.Unlock()
+	}
+	return c.Conn.Close()
+}
+
+// setupRW 测量子协议握手：从协议启动到第一条消息发出并收到对方的第一条消息
+type setupRW struct {
+	p2p.MsgReadWriter
+	t     *setupTracker
+	phase string
+	start time.Time
+
+	mu          sync.Mutex
+	read, wrote bool
+	done        bool
+}
+
+func (rw *setupRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil {
+		rw.progress(true)
+	}
+	return msg, err
+}
+
+func (rw *setupRW) WriteMsg(msg p2p.Msg) error {
+	err := rw.MsgReadWriter.WriteMsg(msg)
+	if err == nil {
+		rw.progress(false)
+	}
+	return err
+}
+
+func (rw *setupRW) progress(read bool) {
+	rw.mu.Lock()
+	if rw.done {
+		rw.mu.Unlock()
+		return
+	}
+	if read {
+		rw.read = true
+	} else {
+		rw.wrote = true
+	}
+	rw.done = rw.read && rw.wrote
+	done := rw.done
+	rw.mu.Unlock()
+	if done {
+		rw.t.observe(rw.phase, time.Since(rw.start))
+	}
+}
+
+// finish 在协议退出时调用，握手没有完成时记为失败
+func (rw *setupRW) finish() {
+	rw.mu.Lock()
+	failed := !rw.done
+	rw.done = true
+	rw.mu.Unlock()
+	if failed {
+		rw.t.failed(rw.phase)
+	}
+}
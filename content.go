@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 内容发现使用的 gossip 主题
+const (
+	topicContentAnnounce = "content/announce"
+	topicContentFind     = "content/find"
+	topicContentFound    = "content/found"
+)
+
+const (
+	providerTTL         = time.Hour
+	providerMaxTTL      = 24 * time.Hour
+	contentScanInterval = time.Minute
+	// 在提供者记录过期前重新公告
+	contentReannounce = providerTTL / 2
+	findTimeout       = 3 * time.Second
+	// 提供者记录来自不可信的公告和查询响应，按内容和总数限制记录数，超出时先淘汰最早加入的记录
+	providerMaxPerHash = 32
+	providerMaxTotal   = 16384
+)
+
+// providerRecord 声明某个节点提供内容 Hash，TTL 秒后失效。
+// 记录没有签名：内容本身按哈希校验，伪造的记录最多导致一次失败的下载。
+type providerRecord struct {
+	Hash common.Hash `json:"hash"`
+	Node string      `json:"node"` // enode URL
+	TTL  uint64      `json:"ttl"`
+}
+
+type contentFind struct {
+	QueryID uint64
+	Hash    common.Hash
+}
+
+type contentFound struct {
+	QueryID   uint64
+	Providers []providerRecord
+}
+
+type providerEntry struct {
+	node    *enode.Node
+	added   time.Time
+	expires time.Time
+}
+
+// contentIndex 通过 gossip 公告本节点共享的内容，记录其他节点的提供者记录，
+// 并响应网络中的查询
+type contentIndex struct {
+	gossip *gossipProtocol
+	files  *fileProtocol
+	self   func() *enode.Node
+
+	mu        sync.Mutex
+	providers map[common.Hash]map[enode.ID]*providerEntry
+	count     int                       // providers 中的记录总数
+	announced map[common.Hash]time.Time // 本节点共享的内容及上次公告时间
+	queries   map[uint64]chan []providerRecord
+}
+
+func newContentIndex(gossip *gossipProtocol, files *fileProtocol, self func() *enode.Node) *contentIndex {
+	c := &contentIndex{
+		gossip:    gossip,
+		files:     files,
+		self:      self,
+		providers: make(map[common.Hash]map[enode.ID]*providerEntry),
+		announced: make(map[common.Hash]time.Time),
+		queries:   make(map[uint64]chan []providerRecord),
+	}
+	gossip.subscribe(topicContentAnnounce, c.handleAnnounce)
+	gossip.subscribe(topicContentFind, c.handleFind)
+	gossip.subscribe(topicContentFound, c.handleFound)
+	return c
+}
+
+// run 定期扫描共享目录，公告新增的内容并续期已公告的内容，同时清理过期的提供者记录
+func (c *contentIndex) run(ctx context.Context) {
+	ticker := time.NewTicker(contentScanInterval)
+	defer ticker.Stop()
+	for {
+		if c.files.manifest != nil {
+			c.scan()
+		}
+		c.mu.Lock()
+		c.expire(time.Now())
+		c.mu.Unlock()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *contentIndex) scan() {
+	m, err := c.files.manifest.build()
+	if err != nil {
+		log.Printf("扫描共享目录失败: %v", err)
+		return
+	}
+	now := time.Now()
+	current := make(map[common.Hash]bool, len(m.Entries))
+	var fresh []common.Hash
+	c.mu.Lock()
+	for _, e := range m.Entries {
+		current[e.Hash] = true
+		if last, ok := c.announced[e.Hash]; !ok || now.Sub(last) >= contentReannounce {
+			if !ok {
+				log.Printf("公告新共享的内容 %s (%x)", e.Path, e.Hash[:8])
+			}
+			c.announced[e.Hash] = now
+			fresh = append(fresh, e.Hash)
+		}
+	}
+	for h := range c.announced {
+		if !current[h] {
+			delete(c.announced, h)
+		}
+	}
+	c.mu.Unlock()
+
+	self := c.self().URLv4()
+	for _, h := range fresh {
+		payload, _ := rlp.EncodeToBytes(&providerRecord{Hash: h, Node: self, TTL: uint64(providerTTL / time.Second)})
+		c.gossip.publish(topicContentAnnounce, payload)
+	}
+}
+
+func (c *contentIndex) addProvider(rec *providerRecord) {
+	n, err := enode.ParseV4(rec.Node)
+	if err != nil {
+		return
+	}
+	ttl := min(time.Duration(rec.TTL)*time.Second, providerMaxTTL)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if set := c.providers[rec.Hash]; set != nil {
+		if e, ok := set[n.ID()]; ok {
+			e.node, e.expires = n, now.Add(ttl)
+			return
+		}
+		if len(set) >= providerMaxPerHash {
+			c.evictOldest(rec.Hash, set)
+		}
+	}
+	// 先腾出名额再取集合：清理和淘汰会删除变空的集合
+	if c.count >= providerMaxTotal {
+		c.expire(now)
+	}
+	for c.count >= providerMaxTotal {
+		c.evictOldestGlobal()
+	}
+	set, ok := c.providers[rec.Hash]
+	if !ok {
+		set = make(map[enode.ID]*providerEntry)
+		c.providers[rec.Hash] = set
+	}
+	set[n.ID()] = &providerEntry{node: n, added: now, expires: now.Add(ttl)}
+	c.count++
+}
+
+// evictOldest 删除内容 h 最早加入的提供者记录，调用方必须持有 c.mu
+func (c *contentIndex) evictOldest(h common.Hash, set map[enode.ID]*providerEntry) {
+	var oldest enode.ID
+	var found *providerEntry
+	for id, e := range set {
+		if found == nil || e.added.Before(found.added) {
+			oldest, found = id, e
+		}
+	}
+	if found != nil {
+		delete(set, oldest)
+		c.count--
+	}
+}
+
+// evictOldestGlobal 删除所有内容中最早加入的提供者记录，调用方必须持有 c.mu
+func (c *contentIndex) evictOldestGlobal() {
+	var (
+		hash  common.Hash
+		found *providerEntry
+	)
+	for h, set := range c.providers {
+		for _, e := range set {
+			if found == nil || e.added.Before(found.added) {
+				hash, found = h, e
+			}
+		}
+	}
+	if found == nil {
+		c.count = 0
+		return
+	}
+	c.evictOldest(hash, c.providers[hash])
+	if len(c.providers[hash]) == 0 {
+		delete(c.providers, hash)
+	}
+}
+
+// expire 删除所有过期的提供者记录，调用方必须持有 c.mu
+func (c *contentIndex) expire(now time.Time) {
+	for h, set := range c.providers {
+		for id, e := range set {
+			if now.After(e.expires) {
+				delete(set, id)
+				c.count--
+			}
+		}
+		if len(set) == 0 {
+			delete(c.providers, h)
+		}
+	}
+}
+
+// lookup 返回本地已知的提供者记录（包括本节点），同时清理过期记录
+func (c *contentIndex) lookup(h common.Hash) []providerRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var recs []providerRecord
+	if _, ok := c.announced[h]; ok {
+		recs = append(recs, providerRecord{Hash: h, Node: c.self().URLv4(), TTL: uint64(providerTTL / time.Second)})
+	}
+	for id, e := range c.providers[h] {
+		if now.After(e.expires) {
+			delete(c.providers[h], id)
+			c.count--
+			continue
+		}
+		recs = append(recs, providerRecord{Hash: h, Node: e.node.URLv4(), TTL: uint64(e.expires.Sub(now) / time.Second)})
+	}
+	if len(c.providers[h]) == 0 {
+		delete(c.providers, h)
+	}
+	return recs
+}
+
+// findProviders 先查本地记录，再向网络发出查询并在超时前收集响应
+func (c *contentIndex) findProviders(ctx context.Context, h common.Hash) []providerRecord {
+	found := make(map[string]providerRecord)
+	for _, r := range c.lookup(h) {
+		found[r.Node] = r
+	}
+
+	id := rand.Uint64()
+	ch := make(chan []providerRecord, 16)
+	c.mu.Lock()
+	c.queries[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.queries, id)
+		c.mu.Unlock()
+	}()
+	payload, _ := rlp.EncodeToBytes(&contentFind{QueryID: id, Hash: h})
+	c.gossip.publish(topicContentFind, payload)
+
+	timeout := time.NewTimer(findTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case recs := <-ch:
+			for _, r := range recs {
+				if r.Hash == h {
+					found[r.Node] = r
+				}
+			}
+		case <-timeout.C:
+			list := make([]providerRecord, 0, len(found))
+			for _, r := range found {
+				list = append(list, r)
+			}
+			return list
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *contentIndex) handleAnnounce(from enode.ID, msg *gossipMessage) {
+	var rec providerRecord
+	if err := rlp.DecodeBytes(msg.Payload, &rec); err != nil {
+		return
+	}
+	c.addProvider(&rec)
+}
+
+func (c *contentIndex) handleFind(from enode.ID, msg *gossipMessage) {
+	var q contentFind
+	if err := rlp.DecodeBytes(msg.Payload, &q); err != nil {
+		return
+	}
+	recs := c.lookup(q.Hash)
+	if len(recs) == 0 {
+		return
+	}
+	payload, _ := rlp.EncodeToBytes(&contentFound{QueryID: q.QueryID, Providers: recs})
+	c.gossip.publish(topicContentFound, payload)
+}
+
+func (c *contentIndex) handleFound(from enode.ID, msg *gossipMessage) {
+	var resp contentFound
+	if err := rlp.DecodeBytes(msg.Payload, &resp); err != nil {
+		return
+	}
+	for i := range resp.Providers {
+		c.addProvider(&resp.Providers[i])
+	}
+	c.mu.Lock()
+	ch := c.queries[resp.QueryID]
+	c.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- resp.Providers:
+		default:
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func newTestContentIndex() *contentIndex {
+	return &contentIndex{
+		self:      func() *enode.Node { return nil },
+		providers: make(map[common.Hash]map[enode.ID]*providerEntry),
+		announced: make(map[common.Hash]time.Time),
+	}
+}
+
+// testProviderURLs 生成 n 个不同节点的 enode URL
+func testProviderURLs(t testing.TB, n int) []string {
+	t.Helper()
+	urls := make([]string, n)
+	for i := range urls {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls[i] = enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303).URLv4()
+	}
+	return urls
+}
+
+func testHash(i int) common.Hash {
+	var h common.Hash
+	binary.BigEndian.PutUint64(h[24:], uint64(i)+1)
+	return h
+}
+
+// checkProviderCount 检查 count 与 providers 中的记录数一致，并且没有空集合
+func checkProviderCount(t *testing.T, c *contentIndex) {
+	t.Helper()
+	var total int
+	for h, set := range c.providers {
+		if len(set) == 0 {
+			t.Errorf("内容 %x 的提供者集合为空", h)
+		}
+		total += len(set)
+	}
+	if total != c.count {
+		t.Fatalf("count = %d，实际记录数 %d", c.count, total)
+	}
+}
+
+func TestContentProviderPerHashCap(t *testing.T) {
+	c := newTestContentIndex()
+	urls := testProviderURLs(t, providerMaxPerHash+5)
+	h := testHash(0)
+	for _, u := range urls {
+		c.addProvider(&providerRecord{Hash: h, Node: u, TTL: 3600})
+	}
+	if n := len(c.providers[h]); n != providerMaxPerHash {
+		t.Fatalf("每个内容的提供者数 = %d，应为 %d", n, providerMaxPerHash)
+	}
+	checkProviderCount(t, c)
+	for _, u := range urls[:5] {
+		if _, ok := c.providers[h][enode.MustParseV4(u).ID()]; ok {
+			t.Errorf("最早加入的记录 %s 没有被淘汰", u)
+		}
+	}
+	last := enode.MustParseV4(urls[len(urls)-1]).ID()
+	if _, ok := c.providers[h][last]; !ok {
+		t.Error("最新的记录丢失")
+	}
+}
+
+func TestContentProviderRefresh(t *testing.T) {
+	c := newTestContentIndex()
+	url := testProviderURLs(t, 1)[0]
+	h := testHash(0)
+	c.addProvider(&providerRecord{Hash: h, Node: url, TTL: 10})
+	c.addProvider(&providerRecord{Hash: h, Node: url, TTL: 3600})
+	if c.count != 1 {
+		t.Fatalf("同一提供者重复公告后 count = %d，应为 1", c.count)
+	}
+	recs := c.lookup(h)
+	if len(recs) != 1 || recs[0].TTL < 3000 {
+		t.Fatalf("续期后的记录 = %+v", recs)
+	}
+}
+
+func TestContentProviderTotalCap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("生成大量节点私钥")
+	}
+	c := newTestContentIndex()
+	extra := 10
+	urls := testProviderURLs(t, providerMaxTotal+extra)
+	for i, u := range urls {
+		c.addProvider(&providerRecord{Hash: testHash(i), Node: u, TTL: 3600})
+	}
+	if c.count != providerMaxTotal {
+		t.Fatalf("count = %d，应为 %d", c.count, providerMaxTotal)
+	}
+	checkProviderCount(t, c)
+	for i := range extra {
+		if _, ok := c.providers[testHash(i)]; ok {
+			t.Errorf("最早加入的内容 %d 没有被淘汰", i)
+		}
+	}
+	for i := len(urls) - extra; i < len(urls); i++ {
+		if len(c.lookup(testHash(i))) != 1 {
+			t.Errorf("超出总数上限后新加入的内容 %d 丢失", i)
+		}
+	}
+}
+
+// 总数达到上限时清理过期记录会删除变空的集合，新记录不能写进被删除的集合
+func TestContentProviderExpireAtCap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("生成大量节点私钥")
+	}
+	c := newTestContentIndex()
+	urls := testProviderURLs(t, providerMaxTotal+1)
+	for i, u := range urls[:providerMaxTotal] {
+		c.addProvider(&providerRecord{Hash: testHash(i / providerMaxPerHash), Node: u, TTL: 3600})
+	}
+	// 让所有记录过期
+	for _, set := range c.providers {
+		for _, e := range set {
+			e.expires = e.added.Add(-time.Second)
+		}
+	}
+	h := testHash(providerMaxTotal)
+	c.addProvider(&providerRecord{Hash: h, Node: urls[providerMaxTotal], TTL: 3600})
+	checkProviderCount(t, c)
+	if c.count != 1 {
+		t.Fatalf("清理过期记录后 count = %d，应为 1", c.count)
+	}
+	if recs := c.lookup(h); len(recs) != 1 || recs[0].Node != urls[providerMaxTotal] {
+		t.Fatalf("新记录丢失: %+v", recs)
+	}
+}
+
+func TestContentProviderExpire(t *testing.T) {
+	c := newTestContentIndex()
+	urls := testProviderURLs(t, 4)
+	for i, u := range urls {
+		c.addProvider(&providerRecord{Hash: testHash(i % 2), Node: u, TTL: 3600})
+	}
+	for _, e := range c.providers[testHash(0)] {
+		e.expires = time.Now().Add(-time.Second)
+	}
+	c.expire(time.Now())
+	checkProviderCount(t, c)
+	if _, ok := c.providers[testHash(0)]; ok {
+		t.Fatal("全部过期的内容没有被删除")
+	}
+	if n := len(c.providers[testHash(1)]); n != 2 {
+		t.Fatalf("未过期的记录数 = %d，应为 2", n)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 运营者控制命令，用于在事故中统一处置大量部署的节点。命令由管理员私钥签名，
+// 通过 gossip 的 control 主题在全网传播；只有以 -control.key 配置了管理员公钥
+// （节点 ID 形式）的节点才会执行，其他节点只负责转发。暂停 gossip 的节点仍然转发
+// 控制命令，否则之后的恢复命令无法到达它。
+const (
+	topicControl = "control"
+
+	ctlPauseGossip  = "pause-gossip"  // 停止转发其他节点的 gossip 消息
+	ctlResumeGossip = "resume-gossip" // 恢复转发
+	ctlDropPeer     = "drop-peer"     // 断开 Target 并在 Ban 秒内拒绝与它连接
+	ctlShutdown     = "shutdown"      // 关闭节点
+
+	// 命令的最长有效期，限制被截获的命令可以重放的时间
+	controlMaxTTL = time.Hour
+	// 允许的签发时间偏差
+	controlClockSkew  = time.Minute
+	defaultControlBan = 24 * time.Hour
+	controlMaxBan     = 7 * 24 * time.Hour
+)
+
+const evControl = "control.exec"
+
+var (
+	errControlSigner  = errors.New("控制命令不是由管理员签名")
+	errControlExpired = errors.New("控制命令已过期")
+	errControlAction  = errors.New("未知的控制命令")
+)
+
+// controlCommand 是签名的控制命令
+type controlCommand struct {
+	Action string
+	Target enode.ID // drop-peer 的目标
+	Ban    uint64   // drop-peer 拒绝连接的秒数
+	Issued uint64   // unix 秒
+	Expiry uint64   // unix 秒，过期后不再执行
+	Nonce  uint64   // 使内容相同的两次命令可以区分
+	Sig    []byte
+}
+
+func (c *controlCommand) sigHash() common.Hash {
+	payload, _ := rlp.EncodeToBytes([]any{c.Action, c.Target, c.Ban, c.Issued, c.Expiry, c.Nonce})
+	return crypto.Keccak256Hash(payload)
+}
+
+// signControl 用管理员私钥签名命令，返回文本形式
+func signControl(key *ecdsa.PrivateKey, c *controlCommand) (string, error) {
+	h := c.sigHash()
+	sig, err := crypto.Sign(h[:], key)
+	if err != nil {
+		return "", err
+	}
+	c.Sig = sig
+	b, err := rlp.EncodeToBytes(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeControl(s string) (*controlCommand, []byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, nil, fmt.Errorf("无效的命令编码: %v", err)
+	}
+	var c controlCommand
+	if err := rlp.DecodeBytes(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("无效的控制命令: %v", err)
+	}
+	return &c, b, nil
+}
+
+// signer 返回签名者的节点 ID
+func (c *controlCommand) signer() (enode.ID, error) {
+	h := c.sigHash()
+	pub, err := crypto.SigToPub(h[:], c.Sig)
+	if err != nil {
+		return enode.ID{}, fmt.Errorf("无效的命令签名: %v", err)
+	}
+	return enode.PubkeyToIDV4(pub), nil
+}
+
+// validate 检查命令本身的格式和有效期，不检查签名者
+func (c *controlCommand) validate(now time.Time) error {
+	switch c.Action {
+	case ctlPauseGossip, ctlResumeGossip, ctlShutdown:
+	case ctlDropPeer:
+		if c.Target == (enode.ID{}) {
+			return errors.New("drop-peer 缺少目标节点")
+		}
+		if time.Duration(c.Ban)*time.Second > controlMaxBan {
+			return fmt.Errorf("拒绝连接的时间超过 %v", controlMaxBan)
+		}
+	default:
+		return fmt.Errorf("%w: %q", errControlAction, c.Action)
+	}
+	issued, expiry := time.Unix(int64(c.Issued), 0), time.Unix(int64(c.Expiry), 0)
+	if expiry.Sub(issued) > controlMaxTTL || issued.After(now.Add(controlClockSkew)) {
+		return fmt.Errorf("控制命令的有效期无效: %v - %v", issued, expiry)
+	}
+	if !now.Before(expiry) {
+		return errControlExpired
+	}
+	return nil
+}
+
+func (c *controlCommand) String() string {
+	if c.Action == ctlDropPeer {
+		return fmt.Sprintf("%s %s ban=%v", c.Action, c.Target.TerminalString(), time.Duration(c.Ban)*time.Second)
+	}
+	return c.Action
+}
+
+// controlHandler 校验并执行控制命令
+type controlHandler struct {
+	admin    enode.ID // 零值表示不执行任何命令
+	self     enode.ID
+	srv      *p2p.Server
+	gossip   *gossipProtocol
+	events   *eventBus
+	shutdown func()
+	notes    *peerNotes // 运营者备注中禁止的节点，见 peernotes.go，可以为 nil
+
+	mu       sync.Mutex
+	executed map[common.Hash]time.Time // 已执行的命令及其过期时间，防止重放
+	banned   map[enode.ID]time.Time
+	listed   map[enode.ID]bool // 机群配置下发的禁止列表，见 fleetconfig.go
+}
+
+func newControlHandler(admin, self enode.ID, srv *p2p.Server, gossip *gossipProtocol, events *eventBus, shutdown func()) *controlHandler {
+	h := &controlHandler{
+		admin:    admin,
+		self:     self,
+		srv:      srv,
+		gossip:   gossip,
+		events:   events,
+		shutdown: shutdown,
+		executed: make(map[common.Hash]time.Time),
+		banned:   make(map[enode.ID]time.Time),
+	}
+	// 所有节点都订阅控制主题，这样兴趣传播不会把命令挡在不执行命令的节点之外
+	gossip.subscribe(topicControl, h.handleGossip)
+	return h
+}
+
+func (h *controlHandler) handleGossip(from enode.ID, msg *gossipMessage) {
+	if h.admin == (enode.ID{}) {
+		return
+	}
+	var c controlCommand
+	if err := rlp.DecodeBytes(msg.Payload, &c); err != nil {
+		log.Printf("收到无效的控制命令 (来自 %s): %v", from.TerminalString(), err)
+		return
+	}
+	if err := h.execute(&c); err != nil {
+		log.Printf("拒绝控制命令 %s (来自 %s): %v", &c, from.TerminalString(), err)
+	}
+}
+
+// execute 校验并执行命令，同一命令只执行一次
+func (h *controlHandler) execute(c *controlCommand) error {
+	now := time.Now()
+	if err := c.validate(now); err != nil {
+		return err
+	}
+	signer, err := c.signer()
+	if err != nil {
+		return err
+	}
+	if signer != h.admin {
+		return errControlSigner
+	}
+	id := c.sigHash()
+	h.mu.Lock()
+	for k, exp := range h.executed {
+		if now.After(exp) {
+			delete(h.executed, k)
+		}
+	}
+	if _, ok := h.executed[id]; ok {
+		h.mu.Unlock()
+		return nil
+	}
+	h.executed[id] = time.Unix(int64(c.Expiry), 0)
+	h.mu.Unlock()
+
+	log.Printf("执行运营者控制命令: %s", c)
+	h.events.emit(evControl, c.Target, c.String())
+	switch c.Action {
+	case ctlPauseGossip:
+		h.gossip.relaying.Store(false)
+		h.gossip.interestChanged()
+	case ctlResumeGossip:
+		h.gossip.relaying.Store(true)
+		h.gossip.interestChanged()
+	case ctlDropPeer:
+		h.drop(c.Target, time.Duration(c.Ban)*time.Second)
+	case ctlShutdown:
+		h.shutdown()
+	}
+	return nil
+}
+
+// drop 断开节点并在 ban 时间内拒绝与它连接
+func (h *controlHandler) drop(id enode.ID, ban time.Duration) {
+	if id == h.self {
+		log.Printf("控制命令要求断开本节点，忽略")
+		return
+	}
+	if ban == 0 {
+		ban = defaultControlBan
+	}
+	h.mu.Lock()
+	h.banned[id] = time.Now().Add(ban)
+	h.mu.Unlock()
+	for _, p := range h.srv.Peers() {
+		if p.ID() == id {
+			// RemovePeer 会等待连接结束，而命令可能正是从这个节点收到的，不能在读循环中等待
+			go h.srv.RemovePeer(p.Node())
+		}
+	}
+}
+
+// setBanlist 替换机群配置下发的禁止列表，并断开列表中已连接的节点
+func (h *controlHandler) setBanlist(ids []enode.ID) {
+	listed := make(map[enode.ID]bool, len(ids))
+	for _, id := range ids {
+		if id != h.self {
+			listed[id] = true
+		}
+	}
+	h.mu.Lock()
+	h.listed = listed
+	h.mu.Unlock()
+	for _, p := range h.srv.Peers() {
+		if listed[p.ID()] {
+			log.Printf("断开机群配置禁止的节点 %s", p.ID().TerminalString())
+			p.Disconnect(p2p.DiscRequested)
+		}
+	}
+}
+
+// isBanned 判断节点是否被控制命令、机群配置或运营者备注禁止连接
+func (h *controlHandler) isBanned(id enode.ID) bool {
+	if h == nil {
+		return false
+	}
+	if h.notes.banned(id) {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listed[id] {
+		return true
+	}
+	until, ok := h.banned[id]
+	if ok && time.Now().After(until) {
+		delete(h.banned, id)
+		return false
+	}
+	return ok
+}
+
+func (h *controlHandler) checkDial(id enode.ID) error {
+	if h.isBanned(id) {
+		return fmt.Errorf("节点 %s 已被运营者禁止连接", id.TerminalString())
+	}
+	return nil
+}
+
+// enforce 断开被禁止的节点的入站连接。与 gater 一样，只能在节点加入后断开。
+func (h *controlHandler) enforce(srv *p2p.Server) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != p2p.PeerEventTypeAdd || !h.isBanned(ev.Peer) {
+				continue
+			}
+			for _, p := range srv.Peers() {
+				if p.ID() == ev.Peer {
+					log.Printf("拒绝被禁止的节点 %s (%s)", p.ID().TerminalString(), ev.RemoteAddress)
+					p.Disconnect(p2p.DiscRequested)
+				}
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// publish 在本节点执行命令并发布到全网。本节点没有配置管理员公钥时只转发。
+func (h *controlHandler) publish(text string) (string, error) {
+	c, raw, err := decodeControl(text)
+	if err != nil {
+		return "", err
+	}
+	if err := c.validate(time.Now()); err != nil {
+		return "", err
+	}
+	if h.admin != (enode.ID{}) {
+		if err := h.execute(c); err != nil {
+			return "", err
+		}
+	}
+	h.gossip.publish(topicControl, raw)
+	return c.String(), nil
+}
+
+// controlCmd 用管理员私钥签发控制命令
+func controlCmd(args []string) {
+	fs := flag.NewFlagSet("control", flag.ExitOnError)
+	keyFile := fs.String("key", "adminkey", "管理员私钥文件，对应节点上 -control.key 配置的 ID")
+	action := fs.String("action", "", "命令: pause-gossip|resume-gossip|drop-peer|shutdown")
+	peer := fs.String("peer", "", "drop-peer 的目标节点 ID 或 enode URL")
+	ban := fs.Duration("ban", defaultControlBan, "drop-peer 之后拒绝与目标连接的时间")
+	ttl := fs.Duration("ttl", 10*time.Minute, "命令的有效期，最长 1 小时")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	key, err := crypto.LoadECDSA(*keyFile)
+	if err != nil {
+		log.Fatalf("加载管理员私钥失败: %v", err)
+	}
+	now := time.Now()
+	c := controlCommand{
+		Action: *action,
+		Issued: uint64(now.Unix()),
+		Expiry: uint64(now.Add(*ttl).Unix()),
+		Nonce:  uint64(now.UnixNano()),
+	}
+	if *action == ctlDropPeer {
+		if c.Target, err = parseNodeID(*peer); err != nil {
+			log.Fatalf("无效的目标节点: %v", err)
+		}
+		c.Ban = uint64(*ban / time.Second)
+	}
+	if err := c.validate(now); err != nil {
+		log.Fatal(err)
+	}
+	text, err := signControl(key, &c)
+	if err != nil {
+		log.Fatalf("签名失败: %v", err)
+	}
+	log.Printf("管理员 ID: %s", enode.PubkeyToIDV4(&key.PublicKey))
+	fmt.Println(text)
+}
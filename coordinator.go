@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// fleetMember 是协调者清单中的一个节点
+type fleetMember struct {
+	fleetRegistration
+	Seq      uint64        `json:"seq"`
+	Peers    int           `json:"peers"`
+	Uptime   time.Duration `json:"uptime"`
+	LastSeen time.Time     `json:"lastSeen"`
+	Online   bool          `json:"online"` // 在 -stale 时间内收到过心跳
+}
+
+// coordinator 是机群模式的中心协调者，只在内存中保存清单；
+// 重启后节点的下一次心跳会收到 404 并重新登记
+type coordinator struct {
+	token  string
+	stale  time.Duration
+	forget time.Duration
+
+	mu      sync.Mutex
+	members map[enode.ID]*fleetMember
+
+	// 下发给节点的配置文件和签名私钥，configPath 为空时 /config 返回 404
+	configPath string
+	configKey  *ecdsa.PrivateKey
+	configMu   sync.Mutex
+	configMod  time.Time
+	signed     *signedFleetConfig
+}
+
+func (c *coordinator) authorized(r *http.Request) bool {
+	return c.token == "" || r.Header.Get("Authorization") == "Bearer "+c.token
+}
+
+// decode 读取请求中的 JSON，出错时已经写好响应
+func (c *coordinator) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只接受 POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !c.authorized(r) {
+		http.Error(w, "令牌无效", http.StatusUnauthorized)
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, fleetMaxBody)).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (c *coordinator) register(w http.ResponseWriter, r *http.Request) {
+	var reg fleetRegistration
+	if !c.decode(w, r, &reg) {
+		return
+	}
+	n, err := enode.ParseV4(reg.Enode)
+	if err != nil || n.ID() != reg.ID {
+		http.Error(w, "enode 与节点 ID 不符", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	_, known := c.members[reg.ID]
+	c.members[reg.ID] = &fleetMember{fleetRegistration: reg, LastSeen: time.Now()}
+	c.mu.Unlock()
+	if !known {
+		log.Printf("节点登记: %s %s (%s %s)", reg.ID.TerminalString(), reg.Name, reg.Version, reg.Build)
+	}
+}
+
+func (c *coordinator) heartbeat(w http.ResponseWriter, r *http.Request) {
+	var hb fleetHeartbeat
+	if !c.decode(w, r, &hb) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.members[hb.ID]
+	if m == nil {
+		http.Error(w, "未登记的节点", http.StatusNotFound)
+		return
+	}
+	m.Seq, m.Peers, m.Uptime, m.LastSeen = hb.Seq, hb.Peers, hb.Uptime, time.Now()
+}
+
+func (c *coordinator) deregister(w http.ResponseWriter, r *http.Request) {
+	var hb fleetHeartbeat
+	if !c.decode(w, r, &hb) {
+		return
+	}
+	c.mu.Lock()
+	delete(c.members, hb.ID)
+	c.mu.Unlock()
+	log.Printf("节点下线: %s", hb.ID.TerminalString())
+}
+
+func (c *coordinator) nodes(w http.ResponseWriter, r *http.Request) {
+	if !c.authorized(r) {
+		http.Error(w, "令牌无效", http.StatusUnauthorized)
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	list := make([]fleetMember, 0, len(c.members))
+	for id, m := range c.members {
+		if now.Sub(m.LastSeen) > c.forget {
+			delete(c.members, id)
+			continue
+		}
+		m.Online = now.Sub(m.LastSeen) <= c.stale
+		list = append(list, *m)
+	}
+	c.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.String() < list[j].ID.String() })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// config 返回签名的配置。配置文件修改后重新读取并签名，文件有错误时继续提供上一个版本
+func (c *coordinator) config(w http.ResponseWriter, r *http.Request) {
+	if !c.authorized(r) {
+		http.Error(w, "令牌无效", http.StatusUnauthorized)
+		return
+	}
+	if c.configPath == "" {
+		http.NotFound(w, r)
+		return
+	}
+	c.configMu.Lock()
+	if fi, err := os.Stat(c.configPath); err != nil {
+		log.Printf("读取配置文件失败: %v", err)
+	} else if !fi.ModTime().Equal(c.configMod) {
+		if err := c.loadConfig(); err != nil {
+			log.Printf("配置文件 %s 有错误，继续使用上一个版本: %v", c.configPath, err)
+		}
+		c.configMod = fi.ModTime()
+	}
+	signed := c.signed
+	c.configMu.Unlock()
+	if signed == nil {
+		http.Error(w, "没有可用的配置", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signed)
+}
+
+// loadConfig 读取、校验并签名配置文件，调用方必须持有 c.configMu
+func (c *coordinator) loadConfig() error {
+	raw, err := os.ReadFile(c.configPath)
+	if err != nil {
+		return err
+	}
+	var cfg fleetConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+	if _, err := cfg.parse(); err != nil {
+		return err
+	}
+	// 重新编码为紧凑格式，节点按这份字节校验签名
+	compact, _ := json.Marshal(&cfg)
+	signed, err := signFleetConfig(c.configKey, compact)
+	if err != nil {
+		return err
+	}
+	c.signed = signed
+	log.Printf("已加载配置版本 %d", cfg.Version)
+	return nil
+}
+
+// coordinatorCmd 运行机群协调者
+func coordinatorCmd(args []string) {
+	fs := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8300", "HTTP 监听地址")
+	token := fs.String("token", "", "要求节点出示的共享令牌（与节点的 -fleet.token 相同）")
+	stale := fs.Duration("stale", 2*time.Minute, "超过这个时间没有心跳的节点标记为离线")
+	forget := fs.Duration("forget", 24*time.Hour, "超过这个时间没有心跳的节点从清单中删除")
+	configPath := fs.String("config", "", "下发给节点的配置文件 (JSON)，修改后自动重新加载")
+	configKey := fs.String("config.key", "configkey", "签名配置的私钥文件，节点以 -fleet.config.key 配置对应的 ID")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	c := &coordinator{token: *token, stale: *stale, forget: *forget, members: make(map[enode.ID]*fleetMember), configPath: *configPath}
+	if *configPath != "" {
+		key, err := crypto.LoadECDSA(*configKey)
+		if err != nil {
+			log.Fatalf("加载配置签名私钥失败: %v", err)
+		}
+		c.configKey = key
+		log.Printf("配置签名 ID: %s", enode.PubkeyToIDV4(&key.PublicKey))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.register)
+	mux.HandleFunc("/heartbeat", c.heartbeat)
+	mux.HandleFunc("/deregister", c.deregister)
+	mux.HandleFunc("/nodes", c.nodes)
+	mux.HandleFunc("/config", c.config)
+	log.Printf("协调者监听: http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
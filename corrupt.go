@@ -0,0 +1,181 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 坏数据检测：从网络收到的每个数据块都按清单中的哈希校验，文件下载完后再校验整个文件的哈希，
+// 本地存储读出的数据块同样校验（见 chunkstore.go）。校验失败的数据块自动重新请求：单节点下载
+// 向同一节点重试 fileChunkRetries 次，多节点下载交给其他提供者。每次校验失败计入对方的坏数据
+// 分数（半衰期 corruptHalfLife），分数达到 -file.bad 的节点是坏数据源：多节点下载不再向它请求，
+// 连接已满时最先被驱逐（见 evict.go），设置 -file.bad.drop 时直接断开。
+const (
+	evPeerCorrupt = "peer.corrupt" // 对方发来了校验失败的数据
+	evPeerBadData = "peer.baddata" // 对方的坏数据分数达到上限
+
+	corruptHalfLife = time.Hour
+	// 单节点下载时同一个数据块校验失败后最多重新请求的次数
+	fileChunkRetries = 3
+	// 清单与数据块不一致（数据块都校验通过但文件哈希不对）计入的分数
+	corruptFileScore = 2
+	// 分数衰减到这个值以下的节点不再保留
+	corruptForgetScore = 0.01
+)
+
+// corruptStats 是 admin_fileCorruption 返回的单个节点的坏数据统计
+type corruptStats struct {
+	ID        enode.ID  `json:"id"`
+	Score     float64   `json:"score"`
+	Verified  uint64    `json:"verified"`  // 校验通过的数据块数
+	BadChunks uint64    `json:"badChunks"` // 校验失败的数据块数
+	BadFiles  uint64    `json:"badFiles"`  // 整个文件校验失败的次数
+	Last      time.Time `json:"last,omitempty"`
+	Offender  bool      `json:"offender"`
+
+	scoreAt time.Time
+}
+
+// corruptTracker 按节点统计校验失败的数据，找出反复发送坏数据的节点
+type corruptTracker struct {
+	limit  float64 // 为 0 时只统计，不认定坏数据源
+	drop   bool
+	srv    *p2p.Server // drop 时用来断开节点，可以为 nil
+	events *eventBus
+
+	badChunks, badLocal metrics.Counter
+
+	mu    sync.Mutex
+	peers map[enode.ID]*corruptStats
+}
+
+func newCorruptTracker(limit float64, drop bool, events *eventBus, m metrics.Metrics) *corruptTracker {
+	return &corruptTracker{
+		limit:     limit,
+		drop:      drop,
+		events:    events,
+		badChunks: m.Counter("demo/file/corrupt_chunks"),
+		badLocal:  m.Counter("demo/file/corrupt_local"),
+		peers:     make(map[enode.ID]*corruptStats),
+	}
+}
+
+// entry 返回节点的统计并把分数衰减到 now，调用方必须持有 t.mu
+func (t *corruptTracker) entry(id enode.ID, now time.Time) *corruptStats {
+	s := t.peers[id]
+	if s == nil {
+		s = &corruptStats{ID: id, scoreAt: now}
+		t.peers[id] = s
+	}
+	s.Score *= math.Pow(0.5, float64(now.Sub(s.scoreAt))/float64(corruptHalfLife))
+	s.scoreAt = now
+	return s
+}
+
+// verified 记录一个校验通过的数据块，只统计发送过坏数据的节点
+func (t *corruptTracker) verified(id enode.ID) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if s := t.peers[id]; s != nil {
+		s.Verified++
+	}
+	t.mu.Unlock()
+}
+
+// badChunk 记录节点发来的一个校验失败的数据块
+func (t *corruptTracker) badChunk(id enode.ID, detail string) {
+	if t == nil {
+		return
+	}
+	t.badChunks.Inc(1)
+	t.bad(id, 1, detail, func(s *corruptStats) { s.BadChunks++ })
+}
+
+// badFile 记录节点共享的清单与数据块不一致
+func (t *corruptTracker) badFile(id enode.ID, detail string) {
+	if t == nil {
+		return
+	}
+	t.bad(id, corruptFileScore, detail, func(s *corruptStats) { s.BadFiles++ })
+}
+
+func (t *corruptTracker) bad(id enode.ID, score float64, detail string, count func(*corruptStats)) {
+	now := time.Now()
+	t.mu.Lock()
+	s := t.entry(id, now)
+	count(s)
+	s.Score += score
+	s.Last = now
+	was := s.Offender
+	s.Offender = t.limit > 0 && s.Score >= t.limit
+	offender, total := s.Offender, s.Score
+	t.mu.Unlock()
+
+	log.Printf("节点 %s 发来的数据校验失败: %s (坏数据分数 %.1f)", id.TerminalString(), detail, total)
+	t.events.emit(evPeerCorrupt, id, detail)
+	if offender && !was {
+		log.Printf("节点 %s 反复发送坏数据，已标记为坏数据源", id.TerminalString())
+		t.events.emit(evPeerBadData, id, "")
+	}
+	if offender && t.drop && t.srv != nil {
+		for _, p := range t.srv.Peers() {
+			if p.ID() == id {
+				log.Printf("断开反复发送坏数据的节点 %s", id.TerminalString())
+				p.Disconnect(p2p.DiscUselessPeer)
+			}
+		}
+	}
+}
+
+// badLocalChunk 记录本地存储中一个损坏的数据块（已被删除，需要重新获取）
+func (t *corruptTracker) badLocalChunk() {
+	if t != nil {
+		t.badLocal.Inc(1)
+	}
+}
+
+// offender 返回节点是否是坏数据源
+func (t *corruptTracker) offender(id enode.ID) bool {
+	if t == nil || t.limit == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.peers[id]
+	if !ok {
+		return false
+	}
+	s.Offender = t.entry(id, time.Now()).Score >= t.limit
+	return s.Offender
+}
+
+// report 返回发送过坏数据的节点，分数最高的排在前面
+func (t *corruptTracker) report() []corruptStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	list := []corruptStats{}
+	for id, s := range t.peers {
+		t.entry(id, now)
+		if s.Score < corruptForgetScore {
+			delete(t.peers, id)
+			continue
+		}
+		s.Offender = t.limit > 0 && s.Score >= t.limit
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Score > list[j].Score })
+	return list
+}
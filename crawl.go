@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// noCrawl 是节点记录中的 "nocrawl" 字段。带有这个字段的节点要求爬虫不要反复查询它，
+// crawl 子命令在读到这个字段后不再向该节点发送任何请求，也不把它写入结果。
+type noCrawl struct{}
+
+func (noCrawl) ENRKey() string { return "nocrawl" }
+
+var crawlOptOut = flag.Bool("crawl.optout", false, "在节点记录中加入 nocrawl 字段，要求爬虫不要反复查询本节点")
+
+// crawlRecord 是爬取结果中的单个节点
+type crawlRecord struct {
+	Seq       uint64    `json:"seq"`
+	Record    string    `json:"record"`
+	Addr      string    `json:"addr,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// crawler 通过 discv4 随机查找遍历网络，对发现的每个节点请求一次完整的节点记录。
+// 疑似蜜罐（见 honeypot.go）不再请求，也不写入结果
+type crawler struct {
+	disc    *discover.UDPv4
+	conn    *politeConn
+	honey   *honeypotConn
+	budget  *dialBudget
+	recheck time.Duration
+
+	mu       sync.Mutex
+	nodes    map[enode.ID]*crawlRecord
+	checked  map[enode.ID]time.Time
+	excluded map[enode.ID]bool
+	failed   int
+}
+
+// crawlOptions 是一次爬取的参数，crawl 子命令和机群配置下发的定时爬取共用
+type crawlOptions struct {
+	Bootnodes    []*enode.Node
+	Listen       string
+	Duration     time.Duration
+	Out          string
+	Workers      int
+	PPS          float64
+	PerNode      float64 // 每个节点每分钟的查询数
+	Recheck      time.Duration
+	Respect      bool
+	BudgetMax    int
+	BudgetWindow time.Duration
+	SaveEvery    time.Duration // 爬取过程中保存中间结果的间隔，0 表示只在结束时保存
+}
+
+func crawlCmd(args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	boot := fs.String("bootnodes", "", "引导节点 enode URLs，逗号分隔")
+	listen := fs.String("addr", ":0", "UDP 监听地址")
+	duration := fs.Duration("duration", 10*time.Minute, "爬取时长")
+	out := fs.String("out", "nodes.json", "爬取结果文件，已存在时在其基础上继续")
+	workers := fs.Int("workers", 8, "同时请求节点记录的数量")
+	pps := fs.Float64("rate.pps", 100, "全局每秒最多发送的数据包数，0 表示不限制")
+	perNode := fs.Float64("rate.node", 6, "每个节点每分钟最多发送的 findnode 查询数，0 表示不限制")
+	recheck := fs.Duration("recheck", 30*time.Minute, "同一节点至少间隔多久才再次请求节点记录")
+	respect := fs.Bool("respect-nocrawl", true, "排除节点记录中带有 nocrawl 字段的节点")
+	budgetMax := fs.Int("budget", 5, "每个节点在 -budget.window 内最多请求节点记录的次数，0 表示不限制")
+	budgetWindow := fs.Duration("budget.window", time.Hour, "请求预算的统计窗口")
+	saveEvery := fs.Duration("save.every", time.Minute, "爬取过程中每隔多久把中间结果写入 -out，0 表示只在结束时写入")
+	serve := fs.String("serve", "", "在这个 HTTP 地址的 /nodes.json 提供 -out 的最新内容（支持 ETag、If-Modified-Since 和断点续传），为空时不提供")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	nodes := parseBootnodes(*boot)
+	if len(nodes) == 0 {
+		log.Fatal("必须指定 -bootnodes")
+	}
+	if *serve != "" {
+		startCrawlServer(*serve, func() string { return *out })
+	}
+	err := runCrawl(crawlOptions{
+		Bootnodes:    nodes,
+		Listen:       *listen,
+		Duration:     *duration,
+		Out:          *out,
+		Workers:      *workers,
+		PPS:          *pps,
+		PerNode:      *perNode,
+		Recheck:      *recheck,
+		Respect:      *respect,
+		BudgetMax:    *budgetMax,
+		BudgetWindow: *budgetWindow,
+		SaveEvery:    *saveEvery,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runCrawl 使用独立的 UDP 端口和临时密钥爬取一次，结果合并写入 o.Out
+func runCrawl(o crawlOptions) error {
+	addr, err := net.ResolveUDPAddr("udp", o.Listen)
+	if err != nil {
+		return fmt.Errorf("无效的监听地址: %v", err)
+	}
+	udp, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("监听 UDP 失败: %v", err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	db, err := enode.OpenDB("")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn := newPoliteConn(udp, o.PPS, o.PerNode/60, max(o.PerNode/10, 3))
+	honey := newHoneypotConn(conn)
+	disc, err := discover.ListenV4(honey, enode.NewLocalNode(db, key), discover.Config{PrivateKey: key, Bootnodes: o.Bootnodes})
+	if err != nil {
+		return fmt.Errorf("启动节点发现失败: %v", err)
+	}
+	defer disc.Close()
+
+	c := &crawler{
+		disc:     disc,
+		conn:     conn,
+		honey:    honey,
+		budget:   newDialBudget(o.BudgetMax, o.BudgetWindow),
+		recheck:  o.Recheck,
+		nodes:    make(map[enode.ID]*crawlRecord),
+		checked:  make(map[enode.ID]time.Time),
+		excluded: make(map[enode.ID]bool),
+	}
+	if err := c.load(o.Out); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取已有结果失败: %v", err)
+	}
+	log.Printf("开始爬取，时长 %v，全局 %.0f 包/秒，每节点 %.0f 查询/分钟", o.Duration, o.PPS, o.PerNode)
+	stopSave := c.checkpoints(o.Out, o.SaveEvery)
+	c.run(o.Duration, o.Workers, o.Respect)
+	stopSave()
+	honeypots, tainted := c.honey.excluded()
+	c.mu.Lock()
+	for id := range honeypots {
+		delete(c.nodes, id)
+	}
+	for id := range tainted {
+		delete(c.nodes, id)
+	}
+	c.mu.Unlock()
+	if err := c.save(o.Out, nil); err != nil {
+		return fmt.Errorf("保存结果失败: %v", err)
+	}
+	log.Printf("爬取结束: %d 个节点，排除 %d 个，失败 %d 次，已写入 %s", len(c.nodes), len(c.excluded), c.failed, o.Out)
+	if len(honeypots) > 0 || len(tainted) > 0 {
+		hp := honeypotPath(o.Out)
+		if err := saveHoneypots(hp, honeypots); err != nil {
+			return fmt.Errorf("保存疑似蜜罐失败: %v", err)
+		}
+		log.Printf("疑似蜜罐 %d 个 (%s)，只由蜜罐报告的节点 %d 个，均未计入结果，蜜罐已写入 %s",
+			len(honeypots), honeypotSummary(honeypots), len(tainted), hp)
+	}
+	return nil
+}
+
+func (c *crawler) run(duration time.Duration, workers int, respect bool) {
+	it := c.disc.RandomNodes()
+	time.AfterFunc(duration, it.Close)
+
+	queue := make(chan *enode.Node)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				c.check(n, respect)
+			}
+		}()
+	}
+
+	stats := time.NewTicker(10 * time.Second)
+	defer stats.Stop()
+	for it.Next() {
+		n := it.Node()
+		if !c.due(n.ID()) {
+			continue
+		}
+		queue <- n
+		select {
+		case <-stats.C:
+			c.mu.Lock()
+			log.Printf("已发现 %d 个节点，排除 %d 个，疑似蜜罐 %d 个；发送 %d 个数据包，按每节点限速丢弃 %d 个，全局限速累计等待 %v",
+				len(c.nodes), len(c.excluded), c.honey.count(), c.conn.sent.Load(), c.conn.dropped.Load(), time.Duration(c.conn.waited.Load()).Round(time.Millisecond))
+			c.mu.Unlock()
+		default:
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// due 判断节点是否需要（再次）请求节点记录，并记录本次检查时间
+func (c *crawler) due(id enode.ID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.excluded[id] || c.honey.isHoneypot(id) || time.Since(c.checked[id]) < c.recheck || c.budget.take(id) != nil {
+		return false
+	}
+	c.checked[id] = time.Now()
+	return true
+}
+
+func (c *crawler) check(n *enode.Node, respect bool) {
+	full, err := c.disc.RequestENR(n)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.failed++
+		return
+	}
+	if c.honey.isHoneypot(n.ID()) {
+		delete(c.nodes, n.ID())
+		return
+	}
+	if respect && full.Load(&noCrawl{}) == nil {
+		c.excluded[n.ID()] = true
+		delete(c.nodes, n.ID())
+		if addr, ok := full.UDPEndpoint(); ok {
+			c.conn.exclude(addr)
+		}
+		return
+	}
+	now := time.Now()
+	r, ok := c.nodes[n.ID()]
+	if !ok {
+		r = &crawlRecord{FirstSeen: now}
+		c.nodes[n.ID()] = r
+	}
+	r.Seq = full.Seq()
+	r.Record = full.String()
+	r.LastSeen = now
+	if addr, ok := full.UDPEndpoint(); ok {
+		r.Addr = addr.String()
+	}
+}
+
+func (c *crawler) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var nodes map[enode.ID]*crawlRecord
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for id, r := range nodes {
+		c.nodes[id] = r
+		c.checked[id] = r.LastSeen
+	}
+	return nil
+}
+
+// checkpoints 每隔 every 把中间结果写入 path，返回的函数停止写入并等待正在进行的写入结束
+func (c *crawler) checkpoints(path string, every time.Duration) func() {
+	if every <= 0 {
+		return func() {}
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// 已标记的疑似蜜罐不写入，只由蜜罐报告的节点要到爬取结束时才能确定
+				if err := c.save(path, c.honey.isHoneypot); err != nil {
+					log.Printf("保存中间结果失败: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// save 把结果写入 path，skip 不为 nil 时跳过它返回 true 的节点
+func (c *crawler) save(path string, skip func(enode.ID) bool) error {
+	c.mu.Lock()
+	nodes := c.nodes
+	if skip != nil {
+		nodes = make(map[enode.ID]*crawlRecord, len(c.nodes))
+		for id, r := range c.nodes {
+			if !skip(id) {
+				nodes[id] = r
+			}
+		}
+	}
+	data, err := json.MarshalIndent(nodes, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// 爬取结果的 HTTP 服务：crawl 子命令的 -serve（或节点的 -crawl.serve，提供机群配置下发的定时爬取的
+// 结果）在 GET /nodes.json 提供最新的爬取结果文件，下游的分析任务可以直接从正在运行的爬虫拉取。
+// 响应带有 ETag（文件内容的哈希）和 Last-Modified，客户端带上 If-None-Match 或 If-Modified-Since
+// 时没有变化返回 304；支持 Range 请求，大文件中断后可以续传。爬取过程中每隔 -save.every 保存一次
+// 中间结果，所以长时间的爬取也能拉到新发现的节点。
+var crawlServe = flag.String("crawl.serve", "", "在这个 HTTP 地址的 /nodes.json 提供机群配置下发的定时爬取的结果，为空时不提供")
+
+// crawlDataset 提供一个爬取结果文件
+type crawlDataset struct {
+	path func() string // 每次请求时读取，机群配置可能修改输出文件
+
+	mu   sync.Mutex
+	etag string // 按文件路径、修改时间和大小缓存，避免每次请求都重新计算哈希
+	key  string
+}
+
+func newCrawlDataset(path func() string) *crawlDataset {
+	return &crawlDataset{path: path}
+}
+
+func (d *crawlDataset) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "只支持 GET", http.StatusMethodNotAllowed)
+		return
+	}
+	path := d.path()
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "还没有爬取结果", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag, err := d.tag(path, info, f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	// ServeContent 处理 If-None-Match、If-Modified-Since 和 Range
+	http.ServeContent(w, r, "nodes.json", info.ModTime(), f)
+}
+
+// tag 返回文件的 ETag，读取后把 f 恢复到开头
+func (d *crawlDataset) tag(path string, info fs.FileInfo, f *os.File) (string, error) {
+	key := fmt.Sprintf("%s|%d|%d", path, info.ModTime().UnixNano(), info.Size())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if key == d.key {
+		return d.etag, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	d.key, d.etag = key, `"`+hex.EncodeToString(h.Sum(nil)[:16])+`"`
+	return d.etag, nil
+}
+
+// startCrawlServer 在 addr 上提供爬取结果
+func startCrawlServer(addr string, path func() string) {
+	mux := http.NewServeMux()
+	mux.Handle("/nodes.json", newCrawlDataset(path))
+	go func() {
+		log.Printf("爬取结果 HTTP 服务监听: http://%s/nodes.json", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("爬取结果 HTTP 服务退出: %v", err)
+		}
+	}()
+}
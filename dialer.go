@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const defaultDialTimeout = 15 * time.Second
+
+// nodeDialer 是所有出站拨号的统一入口：p2p.Server 的拨号调度器和重连器都通过它拨号，
+// 在建立 TCP 连接之前先经过门控检查。
+type nodeDialer struct {
+	dialer   net.Dialer
+	gater    *gater
+	target   *peerTarget     // 为 nil 时不限制动态拨号
+	slots    *inboundReserve // 为 nil 时不为入站连接保留名额
+	budget   *dialBudget     // 为 nil 时不限制每个节点的重试次数
+	control  *controlHandler // 拒绝拨号被运营者控制命令禁止的节点，可以为 nil
+	asn      *asnTracker     // 按 ASN 记录拨号结果和建连时间，可以为 nil
+	sibling  enode.ID        // A/B 实验中同一进程的另一个身份，不拨号
+	slow     *slowStart      // 启动阶段限制并发拨号数和速率，可以为 nil
+	reasons  *dialReasons    // 记录拨号来源，可以为 nil
+	metered  *meteredMode    // 按流量计费时限制动态拨号的速率，可以为 nil
+	network  *networkFilter  // 不拨号其他网络的节点，可以为 nil
+	pace     *dialPacer      // 按路由表的重新验证结果过滤节点发现找到的节点，可以为 nil
+	setup    *setupTracker   // 测量连接建立各阶段的耗时，可以为 nil
+	local    *localityPolicy // 为附近的节点保留名额，可以为 nil
+	affinity *peerAffinity   // 启动时先重拨历史节点，期间暂缓节点发现的拨号，可以为 nil
+}
+
+func newNodeDialer(g *gater) *nodeDialer {
+	return &nodeDialer{dialer: net.Dialer{Timeout: defaultDialTimeout}, gater: g}
+}
+
+type directDialKey struct{}
+
+// withDirectDial 标记由本节点自己发起的拨号（重连、主动补充连接）及其原因，
+// 这类拨号不受目标连接数的限制
+func withDirectDial(ctx context.Context, reason string) context.Context {
+	return context.WithValue(context.WithValue(ctx, directDialKey{}, true), dialReasonKey{}, reason)
+}
+
+func isDirectDial(ctx context.Context) bool {
+	v, _ := ctx.Value(directDialKey{}).(bool)
+	return v
+}
+
+// Dial 实现 p2p.NodeDialer
+func (d *nodeDialer) Dial(ctx context.Context, n *enode.Node) (fd net.Conn, err error) {
+	if err := d.gater.checkDial(); err != nil {
+		return nil, err
+	}
+	if err := d.slots.checkDial(); err != nil {
+		return nil, err
+	}
+	reason := d.reasons.reason(ctx, n.ID())
+	var paceClass string
+	localChecked := true
+	// 目标连接数、计费限速等只限制调度器拨号节点发现找到的节点，
+	// 静态节点、机群节点和引导节点由运营者指定，始终拨号
+	if !isDirectDial(ctx) && reason == dialDHT {
+		if err := d.target.checkDial(); err != nil {
+			return nil, err
+		}
+		if err := d.affinity.wait(ctx); err != nil {
+			return nil, err
+		}
+		if paceClass, err = d.pace.checkDial(n.ID()); err != nil {
+			return nil, err
+		}
+		if localChecked, err = d.local.checkDial(n); err != nil {
+			return nil, err
+		}
+		if err := d.metered.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if n.ID() == d.sibling {
+		return nil, errABSibling
+	}
+	if err := d.control.checkDial(n.ID()); err != nil {
+		return nil, err
+	}
+	if err := d.network.checkDial(n); err != nil {
+		return nil, err
+	}
+	if err := d.budget.take(n.ID()); err != nil {
+		return nil, err
+	}
+	release, err := d.slow.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.reasons != nil {
+		defer func() { d.reasons.dialed(n.ID(), reason, err) }()
+	}
+	if paceClass != "" {
+		defer func() { d.pace.dialed(paceClass, err) }()
+	}
+	fd, rtt, err := d.dialEndpoint(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.local.dialed(n, fd, rtt, localChecked); err != nil {
+		return nil, err
+	}
+	return d.setup.dialed(fd, rtt), nil
+}
+
+// dialEndpoint 按主机名、记录中的 IP 和公告的下一个端点的顺序建立 TCP 连接，返回建连时间
+func (d *nodeDialer) dialEndpoint(ctx context.Context, n *enode.Node) (net.Conn, time.Duration, error) {
+	addr, hasAddr := n.TCPEndpoint()
+	// 节点公告了主机名时优先按主机名拨号，以便跟随动态 IP
+	if name, ok := dnsEndpoint(n); ok {
+		fd, rtt, err := d.dial(ctx, name)
+		if err == nil || !hasAddr {
+			return fd, rtt, err
+		}
+		log.Printf("按主机名 %s 拨号节点 %s 失败，回退到记录中的 IP: %v", name, n.ID().TerminalString(), err)
+	}
+	if !hasAddr {
+		return nil, 0, fmt.Errorf("节点没有 TCP 端点")
+	}
+	fd, rtt, err := d.dial(ctx, addr.String())
+	if err != nil {
+		// 节点公告了迁移目标时尝试新地址
+		if next, ok := nextEndpoint(n); ok && next != addr {
+			if fd, rtt, nerr := d.dial(ctx, next.String()); nerr == nil {
+				log.Printf("节点 %s 原地址不可达，已通过公告的下一个端点 %v 连接", n.ID().TerminalString(), next)
+				return fd, rtt, nil
+			}
+		}
+	}
+	return fd, rtt, err
+}
+
+// dial 建立 TCP 连接并记录建连时间
+func (d *nodeDialer) dial(ctx context.Context, addr string) (net.Conn, time.Duration, error) {
+	start := time.Now()
+	fd, err := d.dialer.DialContext(ctx, "tcp", addr)
+	rtt := time.Since(start)
+	if d.setup != nil && err != nil {
+		d.setup.failed(setupTCP)
+	}
+	if d.asn != nil {
+		var ip netip.Addr
+		if fd != nil {
+			ip, _ = addrIP(fd.RemoteAddr())
+		} else if ap, perr := netip.ParseAddrPort(addr); perr == nil {
+			ip = ap.Addr()
+		}
+		d.asn.dialed(ip, rtt, err)
+	}
+	return fd, rtt, err
+}
+
+// addrIP 返回连接远端地址中的 IP
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr(), true
+}
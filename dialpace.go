@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 按节点发现的刷新周期安排拨号：p2p.Server 的拨号调度器从随机查找中取节点，其中很多只出现在
+// 别人的 neighbors 响应里，从没有被验证在线，拨号大多失败。开启 -dial.pace 后每隔 dialPaceInterval
+// 读取一次 discv4 路由表，跟着路由表的重新验证（ping/pong）走：
+//
+//   - 节点刚通过重新验证时放进拨号候选队列，优先交给调度器拨号
+//   - 重新验证失败的节点（以前在线、现在不在线，或者被移出了路由表）在 dialPaceCooldown 内不拨号
+//
+// 只影响调度器从节点发现中取得的节点，静态节点、引导节点和本节点自己发起的拨号不受影响。
+// 按目标节点的验证状态（fresh、validated、unvalidated、unknown）分别统计拨号的 TCP 连接成功率。
+const (
+	dialPaceInterval = 10 * time.Second
+	dialPaceCooldown = 30 * time.Minute
+	// 等待拨号的刚验证节点上限，多出的等下一轮
+	dialPaceMaxQueue = 256
+)
+
+// 拨号目标在路由表中的验证状态
+const (
+	paceFresh       = "fresh"       // 在 -dial.pace.fresh 内刚通过重新验证
+	paceValidated   = "validated"   // 在路由表中并且在线
+	paceUnvalidated = "unvalidated" // 在路由表中但还没有通过验证
+	paceUnknown     = "unknown"     // 不在路由表中，只是查找结果
+)
+
+var errDialRevalidation = errors.New("节点没有通过节点发现的重新验证")
+
+// dialPaceClass 是 admin_dialPacing 中一种验证状态的拨号统计
+type dialPaceClass struct {
+	Class     string  `json:"class"`
+	Dials     int     `json:"dials"`
+	Connected int     `json:"connected"`
+	HitRate   float64 `json:"hitRate"`
+}
+
+// dialPaceStatus 是 admin_dialPacing 的返回值
+type dialPaceStatus struct {
+	Fresh    int             `json:"fresh"`    // 刚通过重新验证的节点数
+	Failing  int             `json:"failing"`  // 重新验证失败、暂不拨号的节点数
+	Queued   uint64          `json:"queued"`   // 放进拨号候选队列的节点总数
+	Rejected uint64          `json:"rejected"` // 因重新验证失败而拒绝的拨号总数
+	Classes  []dialPaceClass `json:"classes"`
+}
+
+type dialPaceNode struct {
+	checks    int
+	live      bool
+	validated time.Time // 最近一次观察到通过重新验证的时间，启动时已在线的节点为零值
+	queued    time.Time
+}
+
+// dialPacer 跟踪路由表的重新验证结果并据此过滤和排序动态拨号
+type dialPacer struct {
+	srv   *p2p.Server
+	fresh time.Duration
+	queue *nodeQueue
+	m     metrics.Metrics
+
+	mu       sync.Mutex
+	table    map[enode.ID]*dialPaceNode
+	failing  map[enode.ID]time.Time
+	stats    map[string]*dialPaceClass
+	queued   uint64
+	rejected uint64
+}
+
+func newDialPacer(srv *p2p.Server, fresh time.Duration, m metrics.Metrics) *dialPacer {
+	return &dialPacer{
+		srv:     srv,
+		fresh:   fresh,
+		queue:   newNodeQueue(dialPaceMaxQueue),
+		m:       m,
+		table:   make(map[enode.ID]*dialPaceNode),
+		failing: make(map[enode.ID]time.Time),
+		stats:   make(map[string]*dialPaceClass),
+	}
+}
+
+// candidates 返回刚通过重新验证的节点，作为协议的 DialCandidates
+func (p *dialPacer) candidates() enode.Iterator {
+	return p.queue
+}
+
+func (p *dialPacer) run(ctx context.Context) {
+	tick := time.NewTicker(dialPaceInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			p.refresh(time.Now())
+		case <-ctx.Done():
+			p.queue.Close()
+			return
+		}
+	}
+}
+
+// refresh 比较路由表和上一次的快照，找出刚通过和没有通过重新验证的节点
+func (p *dialPacer) refresh(now time.Time) {
+	disc := p.srv.DiscoveryV4()
+	if disc == nil {
+		return
+	}
+	connected := make(map[enode.ID]bool)
+	for _, peer := range p.srv.Peers() {
+		connected[peer.ID()] = true
+	}
+	var push []*enode.Node
+	p.mu.Lock()
+	seen := make(map[enode.ID]bool)
+	for _, bucket := range disc.TableBuckets() {
+		for _, b := range bucket {
+			id := b.Node.ID()
+			seen[id] = true
+			prev := p.table[id]
+			cur := &dialPaceNode{checks: b.Checks, live: b.Live}
+			if prev != nil {
+				cur.validated, cur.queued = prev.validated, prev.queued
+			}
+			switch {
+			case prev != nil && b.Live && (b.Checks > prev.checks || !prev.live):
+				cur.validated = now
+				delete(p.failing, id)
+			case prev != nil && (prev.live && !b.Live || b.Checks < prev.checks):
+				p.failing[id] = now
+			}
+			p.table[id] = cur
+			if cur.validated.Equal(now) && now.Sub(cur.queued) >= p.fresh && !connected[id] {
+				if _, ok := b.Node.TCPEndpoint(); ok {
+					cur.queued = now
+					push = append(push, b.Node)
+				}
+			}
+		}
+	}
+	// 验证过的节点被移出路由表说明重新验证失败了
+	for id, n := range p.table {
+		if !seen[id] {
+			if n.checks > 0 {
+				p.failing[id] = now
+			}
+			delete(p.table, id)
+		}
+	}
+	for id, t := range p.failing {
+		if now.Sub(t) >= dialPaceCooldown {
+			delete(p.failing, id)
+		}
+	}
+	p.mu.Unlock()
+	if len(push) > 0 {
+		added := p.queue.push(push...)
+		p.m.Counter("demo/dialpace/queued").Inc(int64(added))
+		p.mu.Lock()
+		p.queued += uint64(added)
+		p.mu.Unlock()
+	}
+}
+
+// class 返回节点的验证状态，调用方必须持有 p.mu
+func (p *dialPacer) class(id enode.ID, now time.Time) string {
+	n := p.table[id]
+	switch {
+	case n == nil:
+		return paceUnknown
+	case !n.live:
+		return paceUnvalidated
+	case !n.validated.IsZero() && now.Sub(n.validated) < p.fresh:
+		return paceFresh
+	default:
+		return paceValidated
+	}
+}
+
+// checkDial 拒绝拨号重新验证失败的节点，返回节点的验证状态。p 可以为 nil
+func (p *dialPacer) checkDial(id enode.ID) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.failing[id]; ok {
+		p.rejected++
+		p.m.Counter("demo/dialpace/rejected").Inc(1)
+		return "", errDialRevalidation
+	}
+	return p.class(id, time.Now()), nil
+}
+
+// dialed 记录一次动态拨号的结果。p 可以为 nil
+func (p *dialPacer) dialed(class string, err error) {
+	if p == nil || class == "" {
+		return
+	}
+	p.m.Counter("demo/dialpace/" + class + "/dials").Inc(1)
+	if err == nil {
+		p.m.Counter("demo/dialpace/" + class + "/connected").Inc(1)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.stats[class]
+	if st == nil {
+		st = &dialPaceClass{Class: class}
+		p.stats[class] = st
+	}
+	st.Dials++
+	if err == nil {
+		st.Connected++
+	}
+}
+
+func (p *dialPacer) status() *dialPaceStatus {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	st := &dialPaceStatus{Failing: len(p.failing), Queued: p.queued, Rejected: p.rejected}
+	for id := range p.table {
+		if p.class(id, now) == paceFresh {
+			st.Fresh++
+		}
+	}
+	for _, class := range []string{paceFresh, paceValidated, paceUnvalidated, paceUnknown} {
+		if c := p.stats[class]; c != nil {
+			cc := *c
+			cc.HitRate = math.Round(float64(c.Connected)/float64(c.Dials)*1000) / 1000
+			st.Classes = append(st.Classes, cc)
+		}
+	}
+	return st
+}
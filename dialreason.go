@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 拨号来源：每次拨号都带上发起的原因，连接成功后记入节点的会话记录，会话结束时按来源统计
+// 会话时长和长连接数（demo/dial/<来源>/*、demo/session/<来源>/* 指标和 admin_dialReasons），
+// 用来判断哪些来源真正带来了有用的长期连接。本节点自己发起的拨号通过 withDirectDial 标明原因，
+// p2p.Server 拨号调度器的拨号按节点区分为静态节点、引导节点、其他节点推荐的节点（PEX，例如下线通知中的
+// 替代节点，见 tag）和节点发现（DHT 查找）找到的节点。
+//
+// 每个来源的有效性评分（0-100）= 100 × 成功率 × (长连接占比 + 有用会话占比) / 2，
+// 成功率是建立的会话数与拨号次数之比（入站连接记为 1），有用会话是持续 1 分钟以上
+// 并且交换了至少 dialUsefulBytes 字节协议消息的会话。摘要报告（见 summary.go）中按周期比较各来源。
+const (
+	dialBootnode  = "bootnode"
+	dialDHT       = "dht"
+	dialPEX       = "pex" // 其他节点推荐的节点
+	dialStatic    = "static"
+	dialFleet     = "fleet" // 机群配置下发的静态节点
+	dialReconnect = "reconnect"
+	dialRecovery  = "recovery"
+	dialAffinity  = "affinity" // 重启后先重拨历史上最稳定的节点
+	dialRebalance = "rebalance"
+	dialTarget    = "target"
+	dialRPC       = "rpc" // 运营者通过 admin_dial 发起
+	dialInbound   = "inbound"
+
+	dialLongLived   = 10 * time.Minute // 会话持续这么久以上算作长连接
+	dialUsefulBytes = 4 << 10
+	// 拨号候选交给调度器后这么久内的拨号按候选的来源记录
+	dialTagWindow = time.Minute
+)
+
+type dialReasonKey struct{}
+
+// dialReasonOf 返回 withDirectDial 标明的拨号原因
+func dialReasonOf(ctx context.Context) string {
+	v, _ := ctx.Value(dialReasonKey{}).(string)
+	return v
+}
+
+// dialReasonStats 是 admin_dialReasons 和摘要报告中一个来源的统计
+type dialReasonStats struct {
+	Reason      string        `json:"reason"`
+	Dials       int           `json:"dials"`
+	Failed      int           `json:"failed"`
+	Sessions    int           `json:"sessions"` // 建立的会话数，包括当前的
+	Active      int           `json:"active"`
+	LongLived   int           `json:"longLived"`  // 持续超过 10 分钟的会话数，包括当前的
+	Useful      int           `json:"useful"`     // 已结束的有用会话数
+	AvgSession  time.Duration `json:"avgSession"` // 已结束会话的平均时长
+	SuccessRate float64       `json:"successRate"`
+	Score       float64       `json:"score"`
+	ended       int
+	total       time.Duration
+}
+
+// dialPending 是拨号成功、等待握手完成的连接
+type dialPending struct {
+	reason string
+	time   time.Time
+}
+
+type dialSession struct {
+	reason string
+	start  time.Time
+	base   uint64 // 会话开始时节点的累计流量
+	long   bool
+}
+
+// dialReasons 记录拨号来源和每个来源带来的会话
+type dialReasons struct {
+	m         metrics.Metrics
+	bootnodes map[enode.ID]bool
+	traffic   func(enode.ID) uint64 // 节点的累计流量，用于判断会话是否有用，可以为 nil
+
+	mu       sync.Mutex
+	static   map[enode.ID]string      // 静态节点 → 来源
+	tagged   map[enode.ID]dialPending // 调度器最近从 tag 包装的拨号候选取得的节点
+	pending  map[enode.ID]dialPending
+	sessions map[enode.ID]*dialSession
+	stats    map[string]*dialReasonStats
+}
+
+func newDialReasons(bootnodes, static []*enode.Node, m metrics.Metrics) *dialReasons {
+	d := &dialReasons{
+		m:         m,
+		bootnodes: make(map[enode.ID]bool),
+		static:    make(map[enode.ID]string),
+		tagged:    make(map[enode.ID]dialPending),
+		pending:   make(map[enode.ID]dialPending),
+		sessions:  make(map[enode.ID]*dialSession),
+		stats:     make(map[string]*dialReasonStats),
+	}
+	for _, n := range bootnodes {
+		d.bootnodes[n.ID()] = true
+	}
+	for _, n := range static {
+		d.static[n.ID()] = dialStatic
+	}
+	return d
+}
+
+// addStatic 记录通过 srv.AddPeer 添加的静态节点的来源。d 可以为 nil
+func (d *dialReasons) addStatic(id enode.ID, reason string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.static[id] = reason
+}
+
+// reason 返回一次拨号的来源。d 为 nil 时不区分静态节点和引导节点
+func (d *dialReasons) reason(ctx context.Context, id enode.ID) string {
+	if r := dialReasonOf(ctx); r != "" {
+		return r
+	}
+	if d == nil {
+		return dialDHT
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.static[id]; ok {
+		return r
+	}
+	if d.bootnodes[id] {
+		return dialBootnode
+	}
+	if t, ok := d.tagged[id]; ok {
+		delete(d.tagged, id)
+		if time.Since(t.time) < dialTagWindow {
+			return t.reason
+		}
+	}
+	return dialDHT
+}
+
+// tag 包装一个拨号候选来源，调度器随后拨号其中的节点时记为 reason。d 为 nil 时原样返回
+func (d *dialReasons) tag(it enode.Iterator, reason string) enode.Iterator {
+	if d == nil {
+		return it
+	}
+	return &taggedIterator{Iterator: it, d: d, reason: reason}
+}
+
+// taggedIterator 在调度器取出节点时记录它的来源
+type taggedIterator struct {
+	enode.Iterator
+	d      *dialReasons
+	reason string
+}
+
+func (it *taggedIterator) Node() *enode.Node {
+	n := it.Iterator.Node()
+	if n == nil {
+		return nil
+	}
+	now := time.Now()
+	it.d.mu.Lock()
+	defer it.d.mu.Unlock()
+	for id, t := range it.d.tagged {
+		if now.Sub(t.time) >= dialTagWindow {
+			delete(it.d.tagged, id)
+		}
+	}
+	it.d.tagged[n.ID()] = dialPending{it.reason, now}
+	return n
+}
+
+// entry 返回来源的统计，调用方必须持有 d.mu
+func (d *dialReasons) entry(reason string) *dialReasonStats {
+	st := d.stats[reason]
+	if st == nil {
+		st = &dialReasonStats{Reason: reason}
+		d.stats[reason] = st
+	}
+	return st
+}
+
+// dialed 记录一次拨号的结果。d 可以为 nil
+func (d *dialReasons) dialed(id enode.ID, reason string, err error) {
+	if d == nil {
+		return
+	}
+	d.m.Counter("demo/dial/" + reason + "/attempts").Inc(1)
+	if err != nil {
+		d.m.Counter("demo/dial/" + reason + "/failed").Inc(1)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := d.entry(reason)
+	st.Dials++
+	if err != nil {
+		st.Failed++
+		return
+	}
+	now := time.Now()
+	// 握手失败的连接不会有会话，超时后删除
+	for other, p := range d.pending {
+		if now.Sub(p.time) >= time.Minute {
+			delete(d.pending, other)
+		}
+	}
+	d.pending[id] = dialPending{reason, now}
+}
+
+// started 记录一个会话的开始，返回它的来源。d 可以为 nil
+func (d *dialReasons) started(p *p2p.Peer) string {
+	if d == nil {
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reason := dialInbound
+	if pd, ok := d.pending[p.ID()]; ok && !p.Inbound() {
+		reason = pd.reason
+	}
+	delete(d.pending, p.ID())
+	d.sessions[p.ID()] = &dialSession{reason: reason, start: time.Now(), base: d.bytes(p.ID())}
+	d.entry(reason).Sessions++
+	d.m.Counter("demo/session/" + reason + "/started").Inc(1)
+	return reason
+}
+
+// ended 记录一个会话的结束，返回它是否是有用的会话。d 可以为 nil
+func (d *dialReasons) ended(id enode.ID) (useful bool) {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sessions[id]
+	if s == nil {
+		return false
+	}
+	delete(d.sessions, id)
+	dur := time.Since(s.start)
+	st := d.entry(s.reason)
+	st.ended++
+	st.total += dur
+	d.m.Histogram("demo/session/" + s.reason + "/duration").Observe(dur.Milliseconds())
+	if dur >= dialLongLived && !s.long {
+		st.LongLived++
+		d.m.Counter("demo/session/" + s.reason + "/long_lived").Inc(1)
+	}
+	if dur >= peerHealthyMinSession && d.bytes(id)-s.base >= dialUsefulBytes {
+		st.Useful++
+		d.m.Counter("demo/session/" + s.reason + "/useful").Inc(1)
+		return true
+	}
+	return false
+}
+
+func (d *dialReasons) bytes(id enode.ID) uint64 {
+	if d.traffic == nil {
+		return 0
+	}
+	return d.traffic(id)
+}
+
+// counters 返回各来源启动以来的累计统计。d 可以为 nil
+func (d *dialReasons) counters() map[string]dialReasonStats {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	// 当前会话达到长连接的时长时就计入，不等到结束
+	for _, s := range d.sessions {
+		if !s.long && now.Sub(s.start) >= dialLongLived {
+			s.long = true
+			d.entry(s.reason).LongLived++
+			d.m.Counter("demo/session/" + s.reason + "/long_lived").Inc(1)
+		}
+	}
+	m := make(map[string]dialReasonStats, len(d.stats))
+	for reason, st := range d.stats {
+		m[reason] = *st
+	}
+	for _, s := range d.sessions {
+		st := m[s.reason]
+		st.Active++
+		m[s.reason] = st
+	}
+	return m
+}
+
+// scoreReasons 计算 cur 相对于 base（可以为 nil）的增量和各来源的评分，按评分从高到低排序
+func scoreReasons(cur, base map[string]dialReasonStats) []dialReasonStats {
+	list := make([]dialReasonStats, 0, len(cur))
+	for reason, c := range cur {
+		b := base[reason]
+		c.Dials -= b.Dials
+		c.Failed -= b.Failed
+		c.Sessions -= b.Sessions
+		c.LongLived -= b.LongLived
+		c.Useful -= b.Useful
+		c.ended -= b.ended
+		c.total -= b.total
+		if c.Dials == 0 && c.Sessions == 0 && c.Active == 0 {
+			continue
+		}
+		if c.ended > 0 {
+			c.AvgSession = (c.total / time.Duration(c.ended)).Round(time.Second)
+		}
+		c.SuccessRate = 1
+		if c.Dials > 0 {
+			c.SuccessRate = min(1, float64(c.Sessions)/float64(c.Dials))
+		}
+		if c.Sessions > 0 {
+			long := float64(c.LongLived) / float64(c.Sessions)
+			useful := 0.0
+			if c.ended > 0 {
+				useful = float64(c.Useful) / float64(c.ended)
+			}
+			c.Score = math.Round(100*c.SuccessRate*(long+useful)/2*10) / 10
+		}
+		c.SuccessRate = math.Round(c.SuccessRate*1000) / 1000
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].Reason < list[j].Reason
+	})
+	return list
+}
+
+// report 返回启动以来各来源的统计和评分。d 可以为 nil
+func (d *dialReasons) report() []dialReasonStats {
+	if d == nil {
+		return nil
+	}
+	return scoreReasons(d.counters(), nil)
+}
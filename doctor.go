@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/nat"
+)
+
+const (
+	doctorNTPServer = "pool.ntp.org:123"
+	// 超过这个偏差时节点发现的数据包会因为过期而被对方丢弃
+	doctorMaxDrift   = 10 * time.Second
+	doctorNATTimeout = 15 * time.Second
+)
+
+// doctorCheck 是一项自检的结果，失败时附带建议
+type doctorCheck struct {
+	name   string
+	err    error
+	detail string
+	advice string
+}
+
+// doctorCmd 使用与启动节点相同的参数做运行环境自检，逐项给出可操作的建议。
+// 大多数"连不上节点"的问题都是端口、NAT、引导节点、时钟或磁盘中的一项。
+func doctorCmd(args []string) {
+	flag.CommandLine.Parse(args)
+	if *configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, *configFile); err != nil {
+			fmt.Fprintln(stdout, "✗", err)
+			os.Exit(1)
+		}
+	}
+
+	checks := []func() doctorCheck{doctorPorts, doctorNAT, doctorBootnodes, doctorClock, doctorNodeDB}
+	failed := 0
+	for _, check := range checks {
+		c := check()
+		if c.err != nil {
+			failed++
+			fmt.Fprintf(stdout, "✗ %s: %v\n", c.name, c.err)
+			if c.advice != "" {
+				fmt.Fprintf(stdout, "    建议: %s\n", c.advice)
+			}
+			continue
+		}
+		fmt.Fprintf(stdout, "✓ %s: %s\n", c.name, c.detail)
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d 项检查失败\n", failed)
+		os.Exit(1)
+	}
+	fmt.Fprintln(stdout, "所有检查通过")
+}
+
+func doctorPorts() doctorCheck {
+	c := doctorCheck{name: "端口", detail: fmt.Sprintf("%s 可以绑定 (TCP/UDP)", *listenAddr)}
+	if c.err = probeListen(*listenAddr); c.err != nil {
+		c.advice = "端口可能已被另一个节点实例占用，用 -addr 换一个端口，或检查是否需要 root 权限绑定 1024 以下的端口"
+	}
+	return c
+}
+
+func doctorNAT() doctorCheck {
+	c := doctorCheck{name: "NAT"}
+	natm, err := nat.Parse(*natSpec)
+	if err != nil {
+		c.err, c.advice = err, "运行 check-config 检查 -nat 的格式"
+		return c
+	}
+	if natm == nil {
+		c.detail = "未启用端口映射 (-nat none)，只有在公网地址上运行或手动转发端口时其他节点才能连接到本节点"
+		return c
+	}
+	_, portStr, _ := net.SplitHostPort(*listenAddr)
+	port, _ := strconv.Atoi(portStr)
+
+	type result struct {
+		ip  net.IP
+		ext uint16
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		if r.ip, r.err = natm.ExternalIP(); r.err != nil {
+			done <- r
+			return
+		}
+		if r.ext, r.err = natm.AddMapping("tcp", port, port, "devp2p-demo doctor", time.Minute); r.err == nil {
+			natm.DeleteMapping("tcp", int(r.ext), port)
+		}
+		done <- r
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			c.err = r.err
+			c.advice = "路由器可能不支持或未开启 UPnP/NAT-PMP；在路由器上手动转发端口并使用 -nat extip:<公网IP>"
+			return c
+		}
+		c.detail = fmt.Sprintf("%v 外部地址 %v，TCP 端口映射成功", natm, r.ip)
+	case <-time.After(doctorNATTimeout):
+		c.err = fmt.Errorf("%v 在 %v 内没有响应", natm, doctorNATTimeout)
+		c.advice = "没有找到 UPnP/NAT-PMP 网关；如果有公网地址使用 -nat extip:<公网IP>，否则使用 -nat none"
+	}
+	return c
+}
+
+func doctorBootnodes() doctorCheck {
+	c := doctorCheck{name: "引导节点"}
+	nodes := parseBootnodes(*bootnodes)
+	if len(nodes) == 0 {
+		c.detail = "未配置引导节点，本节点只能等待其他节点连接"
+		return c
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		c.err = err
+		return c
+	}
+	var ok []string
+	var lastErr error
+	for _, n := range nodes {
+		if rtt, err := probeBootnode(key, n); err != nil {
+			lastErr = fmt.Errorf("%s: %v", n.ID().TerminalString(), err)
+		} else {
+			ok = append(ok, fmt.Sprintf("%s (%v)", n.ID().TerminalString(), rtt.Round(time.Millisecond)))
+		}
+	}
+	if len(ok) == 0 {
+		c.err = fmt.Errorf("%d 个引导节点都没有响应，最后一个错误: %v", len(nodes), lastErr)
+		c.advice = "确认 enode URL 中的地址和端口正确，并检查防火墙是否放行了出站 UDP"
+		return c
+	}
+	c.detail = fmt.Sprintf("%d/%d 个可达: %v", len(ok), len(nodes), ok)
+	return c
+}
+
+func doctorClock() doctorCheck {
+	c := doctorCheck{name: "时钟"}
+	drift, err := probeClock(doctorNTPServer)
+	if err != nil {
+		c.err = fmt.Errorf("无法查询 NTP 服务器 %s: %v", doctorNTPServer, err)
+		c.advice = "如果网络禁止访问 NTP，请用其他方式确认系统时间准确"
+		return c
+	}
+	if drift.Abs() > doctorMaxDrift {
+		c.err = fmt.Errorf("本地时钟偏差 %v", drift.Round(time.Millisecond))
+		c.advice = "节点发现协议会丢弃时间戳过期的数据包，请启用 NTP 时间同步 (例如 timedatectl set-ntp true)"
+		return c
+	}
+	c.detail = fmt.Sprintf("偏差 %v", drift.Round(time.Millisecond))
+	return c
+}
+
+func doctorNodeDB() doctorCheck {
+	c := doctorCheck{name: "节点数据库"}
+	if *nodeDB == "" {
+		c.detail = "未配置 -nodedb，节点数据库只保存在内存中，重启后需要重新发现节点"
+		return c
+	}
+	if err := os.MkdirAll(*nodeDB, 0o755); err != nil {
+		c.err, c.advice = err, "确认运行节点的用户对该目录有写权限"
+		return c
+	}
+	f, err := os.CreateTemp(*nodeDB, ".doctor-*")
+	if err == nil {
+		_, err = f.Write(make([]byte, 4096))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		os.Remove(f.Name())
+	}
+	if err != nil {
+		c.err, c.advice = err, "确认运行节点的用户对该目录有写权限，并且磁盘没有写满"
+		return c
+	}
+	db, err := enode.OpenDB(*nodeDB)
+	if err != nil {
+		c.err, c.advice = err, "数据库可能正被另一个节点实例使用，或者已经损坏；停止其他实例或删除该目录后重试"
+		return c
+	}
+	db.Close()
+	abs, _ := filepath.Abs(*nodeDB)
+	c.detail = fmt.Sprintf("%s 可写", abs)
+	return c
+}
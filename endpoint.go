@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// 蓝绿切换时预先公告的下一个端点。
+// 长连接的节点在原地址拨号失败时会尝试这里记录的地址，从而跟随节点迁移到新主机。
+type nextIP net.IP
+
+func (nextIP) ENRKey() string { return "next-ip" }
+
+type nextTCP uint16
+
+func (nextTCP) ENRKey() string { return "next-tcp" }
+
+// dnsName 是实验性的 "dns" 字段：IP 经常变化但主机名稳定的节点公告自己的主机名，
+// 拨号方优先按主机名解析出最新的地址，没有这个字段或解析失败时仍使用记录中的 IP。
+type dnsName string
+
+func (dnsName) ENRKey() string { return "dns" }
+
+// dnsEndpoint 返回节点记录中公告的主机名和 TCP 端口
+func dnsEndpoint(n *enode.Node) (string, bool) {
+	var (
+		host dnsName
+		port enr.TCP
+	)
+	if n.Load(&host) != nil || host == "" || n.Load(&port) != nil || port == 0 {
+		return "", false
+	}
+	return net.JoinHostPort(string(host), strconv.Itoa(int(port))), true
+}
+
+// validHostname 粗略检查主机名：由字母、数字、'-' 和 '.' 组成，不是 IP 地址
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 || net.ParseIP(host) != nil {
+		return false
+	}
+	for _, c := range host {
+		if !(c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseEndpoint 解析 "ip:port" 形式的端点
+func parseEndpoint(s string) (netip.AddrPort, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("无效的 IP 地址 %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return netip.AddrPort{}, fmt.Errorf("无效的端口 %q", port)
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(p)), nil
+}
+
+// announceNextEndpoint 在本地节点记录中公告下一个端点
+func announceNextEndpoint(ln *enode.LocalNode, ep netip.AddrPort) {
+	ln.Set(nextIP(ep.Addr().AsSlice()))
+	ln.Set(nextTCP(ep.Port()))
+	log.Printf("已公告下一个端点 %v (seq %d)", ep, ln.Node().Seq())
+}
+
+// clearNextEndpoint 撤销公告的下一个端点
+func clearNextEndpoint(ln *enode.LocalNode) {
+	ln.Delete(nextIP(nil))
+	ln.Delete(nextTCP(0))
+}
+
+// switchEndpoint 把公告的下一个端点切换为主端点，并清除 next 字段。
+// 各字段的修改只会让记录失效，下次读取时才统一重新签名，因此通常只产生一个新的 seq。
+func switchEndpoint(ln *enode.LocalNode) (netip.AddrPort, error) {
+	ep, ok := nextEndpoint(ln.Node())
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("没有公告下一个端点")
+	}
+	ln.SetStaticIP(ep.Addr().AsSlice())
+	ln.Set(enr.TCP(ep.Port()))
+	ln.SetFallbackUDP(int(ep.Port()))
+	clearNextEndpoint(ln)
+	log.Printf("主端点已切换为 %v (seq %d)", ep, ln.Node().Seq())
+	return ep, nil
+}
+
+// nextEndpoint 读取节点记录中公告的下一个端点
+func nextEndpoint(n *enode.Node) (netip.AddrPort, bool) {
+	var (
+		ip   nextIP
+		port nextTCP
+	)
+	if n.Load(&ip) != nil || n.Load(&port) != nil || port == 0 {
+		return netip.AddrPort{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), true
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 节点记录属性的监视：通过 admin_watchEnr 或 WebSocket 订阅 admin_subscribe ["enrChanges", node, attrs]
+// 监视指定节点的指定属性（例如 seq、ip、tcp），后台每隔 -enr.watch.interval 通过节点发现重新解析
+// 这些节点的记录，属性变化时记录 enr.changed 事件并通知订阅者。attrs 为空表示监视所有属性。
+const (
+	evENRChanged = "enr.changed"
+
+	enrWatchMax     = 256 // 最多同时监视的节点数
+	enrWatchWorkers = 8
+	enrNotifyBuffer = 16
+)
+
+var errENRWatchFull = errors.New("监视的节点数已达上限")
+
+// enrAttrChange 是一个属性的变化，新增或删除的属性对应的值为空
+type enrAttrChange struct {
+	Attr string `json:"attr"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// enrChange 是一次通知的内容
+type enrChange struct {
+	Time    time.Time       `json:"time"`
+	ID      enode.ID        `json:"id"`
+	Seq     uint64          `json:"seq"`
+	Changes []enrAttrChange `json:"changes"`
+	Record  string          `json:"record"`
+}
+
+// enrWatchStatus 是 admin_enrWatches 中一个被监视的节点
+type enrWatchStatus struct {
+	ID          enode.ID          `json:"id"`
+	Attrs       map[string]string `json:"attrs"`    // 当前的属性值
+	Watching    []string          `json:"watching"` // 监视的属性，空表示所有属性
+	Subscribers int               `json:"subscribers"`
+	Checked     time.Time         `json:"checked,omitzero"`
+	Changed     time.Time         `json:"changed,omitzero"`
+}
+
+// enrSub 是一个监视：ch 为 nil 时是 admin_watchEnr 添加的，只记录事件
+type enrSub struct {
+	id    enode.ID
+	attrs []string
+	ch    chan<- enrChange
+}
+
+// wants 返回这个监视关心的变化
+func (s *enrSub) wants(changes []enrAttrChange) []enrAttrChange {
+	if len(s.attrs) == 0 {
+		return changes
+	}
+	var list []enrAttrChange
+	for _, c := range changes {
+		if slices.Contains(s.attrs, c.Attr) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+type enrWatched struct {
+	node    *enode.Node
+	attrs   map[string]string
+	checked time.Time
+	changed time.Time
+}
+
+// enrWatcher 定期重新解析被监视的节点记录
+type enrWatcher struct {
+	srv      *p2p.Server
+	store    *peerStore
+	events   *eventBus
+	interval time.Duration
+
+	mu     sync.Mutex
+	nodes  map[enode.ID]*enrWatched
+	subs   map[int]*enrSub
+	nextID int
+}
+
+func newENRWatcher(srv *p2p.Server, store *peerStore, events *eventBus, interval time.Duration) *enrWatcher {
+	return &enrWatcher{
+		srv:      srv,
+		store:    store,
+		events:   events,
+		interval: interval,
+		nodes:    make(map[enode.ID]*enrWatched),
+		subs:     make(map[int]*enrSub),
+	}
+}
+
+// enrAttrs 把节点记录展开为属性名 → 可读的值，seq 也作为一个属性
+func enrAttrs(n *enode.Node) map[string]string {
+	attrs := map[string]string{"seq": strconv.FormatUint(n.Seq(), 10)}
+	list := n.Record().AppendElements(nil)
+	for i := 1; i+1 < len(list); i += 2 {
+		key, _ := list[i].(string)
+		raw, _ := list[i+1].(rlp.RawValue)
+		attrs[key] = enrValue(key, raw)
+	}
+	return attrs
+}
+
+func enrValue(key string, raw rlp.RawValue) string {
+	switch key {
+	case "ip", "ip6":
+		var ip []byte
+		if rlp.DecodeBytes(raw, &ip) == nil {
+			return net.IP(ip).String()
+		}
+	case "tcp", "udp", "tcp6", "udp6":
+		var port uint16
+		if rlp.DecodeBytes(raw, &port) == nil {
+			return strconv.Itoa(int(port))
+		}
+	}
+	// 可打印的字符串（例如 id、dns）直接显示，其他值显示 RLP 编码
+	var s string
+	if rlp.DecodeBytes(raw, &s) == nil && s != "" && !strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r > 0x7e }) {
+		return s
+	}
+	return "0x" + hex.EncodeToString(raw)
+}
+
+func diffENRAttrs(old, new map[string]string) []enrAttrChange {
+	var changes []enrAttrChange
+	for k, v := range new {
+		if old[k] != v {
+			changes = append(changes, enrAttrChange{Attr: k, Old: old[k], New: v})
+		}
+	}
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, enrAttrChange{Attr: k, Old: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Attr < changes[j].Attr })
+	return changes
+}
+
+// resolveNode 解析 enode URL、ENR 或节点 ID。只有 ID 时从节点记录、连接的节点和节点发现的表中查找
+func (w *enrWatcher) resolveNode(s string) (*enode.Node, error) {
+	if strings.HasPrefix(s, "enode://") || strings.HasPrefix(s, "enr:") {
+		return enode.Parse(enode.ValidSchemes, s)
+	}
+	id, err := enode.ParseID(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的节点 %q，应为 enode URL、ENR 或节点 ID", s)
+	}
+	if rec, ok := w.store.get(id); ok && rec.Node != nil {
+		return rec.Node, nil
+	}
+	for _, p := range w.srv.Peers() {
+		if p.ID() == id && p.Node().IPAddr().IsValid() {
+			return p.Node(), nil
+		}
+	}
+	if disc := w.srv.DiscoveryV4(); disc != nil {
+		for _, bucket := range disc.TableBuckets() {
+			for _, bn := range bucket {
+				if bn.Node.ID() == id {
+					return bn.Node, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("不知道节点 %s 的地址，请提供 enode URL 或 ENR", id.TerminalString())
+}
+
+// watch 添加一个监视，返回监视的编号
+func (w *enrWatcher) watch(node string, attrs []string, ch chan<- enrChange) (int, error) {
+	if w.srv.DiscoveryV4() == nil {
+		return 0, errors.New("没有启用节点发现，无法重新解析节点记录")
+	}
+	n, err := w.resolveNode(node)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range attrs {
+		if a == "" {
+			return 0, errors.New("属性名不能为空")
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wn := w.nodes[n.ID()]
+	if wn == nil {
+		if len(w.nodes) >= enrWatchMax {
+			return 0, errENRWatchFull
+		}
+		wn = &enrWatched{node: n, attrs: enrAttrs(n)}
+		w.nodes[n.ID()] = wn
+	} else if n.Seq() > wn.node.Seq() {
+		wn.node, wn.attrs = n, enrAttrs(n)
+	}
+	w.nextID++
+	w.subs[w.nextID] = &enrSub{id: n.ID(), attrs: slices.Clone(attrs), ch: ch}
+	return w.nextID, nil
+}
+
+// unwatch 删除一个监视，节点没有其他监视时不再解析
+func (w *enrWatcher) unwatch(sub int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s := w.subs[sub]; s != nil {
+		delete(w.subs, sub)
+		w.prune(s.id)
+	}
+}
+
+// unwatchNode 删除 admin_watchEnr 对节点添加的监视，返回是否有被删除的监视
+func (w *enrWatcher) unwatchNode(id enode.ID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	found := false
+	for k, s := range w.subs {
+		if s.id == id && s.ch == nil {
+			delete(w.subs, k)
+			found = true
+		}
+	}
+	w.prune(id)
+	return found
+}
+
+// prune 删除没有监视的节点，调用方必须持有 w.mu
+func (w *enrWatcher) prune(id enode.ID) {
+	for _, s := range w.subs {
+		if s.id == id {
+			return
+		}
+	}
+	delete(w.nodes, id)
+}
+
+// nodeStatus 返回一个被监视节点的状态，调用方必须持有 w.mu
+func (w *enrWatcher) nodeStatus(id enode.ID, wn *enrWatched) enrWatchStatus {
+	st := enrWatchStatus{ID: id, Attrs: wn.attrs, Watching: []string{}, Checked: wn.checked, Changed: wn.changed}
+	all := false
+	for _, s := range w.subs {
+		if s.id != id {
+			continue
+		}
+		if s.ch != nil {
+			st.Subscribers++
+		}
+		all = all || len(s.attrs) == 0
+		for _, a := range s.attrs {
+			if !slices.Contains(st.Watching, a) {
+				st.Watching = append(st.Watching, a)
+			}
+		}
+	}
+	if all {
+		st.Watching = []string{}
+	}
+	sort.Strings(st.Watching)
+	return st
+}
+
+// subStatus 返回一个监视对应节点的状态
+func (w *enrWatcher) subStatus(sub int) *enrWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.subs[sub]
+	if s == nil || w.nodes[s.id] == nil {
+		return nil
+	}
+	st := w.nodeStatus(s.id, w.nodes[s.id])
+	return &st
+}
+
+func (w *enrWatcher) status() []enrWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]enrWatchStatus, 0, len(w.nodes))
+	for id, wn := range w.nodes {
+		list = append(list, w.nodeStatus(id, wn))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.String() < list[j].ID.String() })
+	return list
+}
+
+// check 重新解析所有被监视的节点
+func (w *enrWatcher) check() {
+	disc := w.srv.DiscoveryV4()
+	if disc == nil {
+		return
+	}
+	w.mu.Lock()
+	nodes := make([]*enode.Node, 0, len(w.nodes))
+	for _, wn := range w.nodes {
+		nodes = append(nodes, wn.node)
+	}
+	w.mu.Unlock()
+
+	queue := make(chan *enode.Node)
+	var wg sync.WaitGroup
+	for range min(enrWatchWorkers, len(nodes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				w.update(n.ID(), disc.Resolve(n))
+			}
+		}()
+	}
+	for _, n := range nodes {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// update 记录重新解析的结果，属性变化时通知监视者
+func (w *enrWatcher) update(id enode.ID, n *enode.Node) {
+	now := time.Now()
+	w.mu.Lock()
+	wn := w.nodes[id]
+	if wn == nil {
+		w.mu.Unlock()
+		return // 解析期间被删除
+	}
+	wn.checked = now
+	if n.Seq() <= wn.node.Seq() {
+		w.mu.Unlock()
+		return
+	}
+	attrs := enrAttrs(n)
+	changes := diffENRAttrs(wn.attrs, attrs)
+	first := wn.node.Seq() == 0 // enode URL 没有签名的记录，第一次解析到的记录作为基准
+	wn.node, wn.attrs = n, attrs
+	if first {
+		w.mu.Unlock()
+		return
+	}
+	wn.changed = now
+	// 只通知有监视者关心的变化
+	var wanted []enrAttrChange
+	type delivery struct {
+		ch      chan<- enrChange
+		changes []enrAttrChange
+	}
+	var deliveries []delivery
+	for _, s := range w.subs {
+		if s.id != id {
+			continue
+		}
+		list := s.wants(changes)
+		for _, c := range list {
+			if !slices.Contains(wanted, c) {
+				wanted = append(wanted, c)
+			}
+		}
+		if s.ch != nil && len(list) > 0 {
+			deliveries = append(deliveries, delivery{s.ch, list})
+		}
+	}
+	w.mu.Unlock()
+	if len(wanted) == 0 {
+		return
+	}
+	sort.Slice(wanted, func(i, j int) bool { return wanted[i].Attr < wanted[j].Attr })
+	parts := make([]string, len(wanted))
+	for i, c := range wanted {
+		parts[i] = fmt.Sprintf("%s=%s->%s", c.Attr, c.Old, c.New)
+	}
+	detail := strings.Join(parts, " ")
+	log.Printf("被监视的节点 %s 的记录已变化: %s", id.TerminalString(), detail)
+	w.events.emit(evENRChanged, id, detail)
+	for _, d := range deliveries {
+		select {
+		case d.ch <- enrChange{Time: now, ID: id, Seq: n.Seq(), Changes: d.changes, Record: n.String()}:
+		default:
+			// 订阅者处理不过来时丢弃通知，之后的通知仍然包含最新的值
+		}
+	}
+}
+
+func (w *enrWatcher) run() {
+	tick := time.NewTicker(w.interval)
+	defer tick.Stop()
+	for range tick.C {
+		w.check()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 节点内部事件类型
+const (
+	evReconnectScheduled = "reconnect.scheduled"
+	evReconnectAttempt   = "reconnect.attempt"
+	evReconnectFailed    = "reconnect.failed"
+	evReconnected        = "reconnect.ok"
+
+	evPeerAdded   = "peer.added"
+	evPeerDropped = "peer.dropped"
+	evPeerNew     = "peer.new"   // 第一次连接的节点
+	evPeerKnown   = "peer.known" // 以前连接过的节点
+	evPeerEvicted = "peer.evicted"
+	evPeerStalled = "peer.stalled"
+	evProtoStart  = "proto.start"
+	evProtoEnd    = "proto.end"
+	evGoAway      = "chat.goaway"
+)
+
+const defaultEventBuffer = 1024
+
+// nodeEvent 是节点内部产生的事件，供日志以外的观测手段消费
+type nodeEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Peer   enode.ID  `json:"peer,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// eventFilter 是 admin_recentEvents 的查询条件，零值字段不参与过滤
+type eventFilter struct {
+	Kind  string    `json:"kind"`  // 事件类型前缀，例如 "peer" 或 "reconnect.failed"
+	Peer  string    `json:"peer"`  // 节点 ID 的十六进制前缀
+	Since time.Time `json:"since"` // 只返回此时间之后的事件
+	Limit int       `json:"limit"` // 最多返回最近的多少条
+}
+
+func (f *eventFilter) match(ev *nodeEvent) bool {
+	if f.Kind != "" && !strings.HasPrefix(ev.Kind, f.Kind) {
+		return false
+	}
+	if f.Peer != "" && !strings.HasPrefix(ev.Peer.String(), strings.TrimPrefix(strings.ToLower(f.Peer), "0x")) {
+		return false
+	}
+	return f.Since.IsZero() || ev.Time.After(f.Since)
+}
+
+// eventBus 分发节点内部事件，并在环形缓冲区中保留最近的事件，
+// 以便在没有开启持久化存储时也能事后排查短暂出现的问题
+type eventBus struct {
+	feed event.Feed
+
+	mu   sync.Mutex
+	ring []nodeEvent
+	next int
+	full bool
+}
+
+func newEventBus(size int) *eventBus {
+	return &eventBus{ring: make([]nodeEvent, max(size, 1))}
+}
+
+func (b *eventBus) emit(kind string, peer enode.ID, detail string) {
+	ev := nodeEvent{Time: time.Now(), Kind: kind, Peer: peer, Detail: detail}
+	b.mu.Lock()
+	b.ring[b.next] = ev
+	b.next = (b.next + 1) % len(b.ring)
+	b.full = b.full || b.next == 0
+	b.mu.Unlock()
+	b.feed.Send(ev)
+}
+
+func (b *eventBus) subscribe(ch chan<- nodeEvent) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+// recent 按时间顺序返回缓冲区中符合条件的事件
+func (b *eventBus) recent(f eventFilter) []nodeEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []nodeEvent
+	start, n := 0, b.next
+	if b.full {
+		start, n = b.next, len(b.ring)
+	}
+	for i := 0; i < n; i++ {
+		ev := &b.ring[(start+i)%len(b.ring)]
+		if f.match(ev) {
+			list = append(list, *ev)
+		}
+	}
+	if f.Limit > 0 && len(list) > f.Limit {
+		list = list[len(list)-f.Limit:]
+	}
+	return list
+}
+
+// protocol 包装协议的 Run 函数，记录协议会话的开始和结束
+func (b *eventBus) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	name := fmt.Sprintf("%s/%d", proto.Name, proto.Version)
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		b.emit(evProtoStart, p.ID(), name)
+		err := run(p, rw)
+		b.emit(evProtoEnd, p.ID(), fmt.Sprintf("%s: %v", name, err))
+		return err
+	}
+	return proto
+}
+
+// trackPeers 把服务器的对等节点事件记录到事件总线
+func (b *eventBus) trackPeers(srv *p2p.Server) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				detail := ev.RemoteAddress
+				for _, p := range srv.Peers() {
+					if p.ID() == ev.Peer {
+						detail = fmt.Sprintf("%s inbound=%v %s", ev.RemoteAddress, p.Inbound(), p.Fullname())
+					}
+				}
+				b.emit(evPeerAdded, ev.Peer, detail)
+			case p2p.PeerEventTypeDrop:
+				b.emit(evPeerDropped, ev.Peer, ev.Error)
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
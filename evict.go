@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 连接已满时对新入站节点的处理策略
+const (
+	evictReject = "reject" // 拒绝新节点（p2p.Server 的默认行为）
+	evictUseful = "useful" // 断开最没用的已有节点：共享协议最少、流量最少、最久没有活动
+	evictIdle   = "idle"   // 断开最久没有活动的已有节点
+)
+
+const (
+	// 启用驱逐时在 MaxPeers 之外预留的名额。p2p.Server 在协议握手之前就按
+	// MaxPeers 拒绝连接，无法得知新节点的能力，所以需要先让它连上再决定断开谁。
+	evictHeadroom = 2
+	// 刚连接的节点不会被驱逐
+	evictGrace = 30 * time.Second
+)
+
+func validEvictPolicy(policy string) error {
+	switch policy {
+	case evictReject, evictUseful, evictIdle:
+		return nil
+	}
+	return fmt.Errorf("未知的驱逐策略 %q", policy)
+}
+
+// evictor 把连接数限制在 limit 以内：超出时如果新节点是支持 chat 协议的入站节点，
+// 按策略驱逐一个已有节点为它腾出位置，否则断开新节点
+type evictor struct {
+	srv    *p2p.Server
+	policy string
+	limit  int
+	usage  *usageTracker
+	store  *peerStore
+	events *eventBus
+	// 停滞分数达到 stallLimit 的节点不论策略都优先被驱逐，stallLimit 为 0 时不考虑
+	stalls     *stallTracker
+	stallLimit float64
+	// 未达到延迟 SLO 的节点在停滞的节点之后优先被驱逐，可以为 nil
+	slo *sloTracker
+	// 反复发送坏数据的节点最先被驱逐，可以为 nil
+	corrupt *corruptTracker
+}
+
+func newEvictor(policy string, limit int, usage *usageTracker, store *peerStore, events *eventBus, stalls *stallTracker, stallLimit float64) *evictor {
+	return &evictor{policy: policy, limit: limit, usage: usage, store: store, events: events, stalls: stalls, stallLimit: stallLimit}
+}
+
+func (e *evictor) run(srv *p2p.Server) {
+	e.srv = srv
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type == p2p.PeerEventTypeAdd && srv.PeerCount() > e.limit {
+				e.admit(ev.Peer)
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// admit 处理使连接数超出限制的新节点
+func (e *evictor) admit(id enode.ID) {
+	var newcomer *p2p.Peer
+	for _, p := range e.srv.Peers() {
+		if p.ID() == id {
+			newcomer = p
+		}
+	}
+	if newcomer == nil || newcomer.Info().Network.Trusted {
+		return
+	}
+	if newcomer.Inbound() && newcomer.RunningCap("chat", chatVersions) {
+		if victim := e.victim(newcomer); victim != nil {
+			log.Printf("连接已满，驱逐节点 %s (策略 %s) 为入站节点 %s 腾出位置",
+				victim.ID().TerminalString(), e.policy, newcomer.ID().TerminalString())
+			e.events.emit(evPeerEvicted, victim.ID(), fmt.Sprintf("policy=%s newcomer=%s stall=%.1f slo=%v bad=%v", e.policy, newcomer.ID().TerminalString(), e.stalls.score(victim.ID()), e.slo.violating(victim.ID()), e.corrupt.offender(victim.ID())))
+			victim.Disconnect(p2p.DiscTooManyPeers)
+			return
+		}
+	}
+	newcomer.Disconnect(p2p.DiscTooManyPeers)
+}
+
+// victim 按策略选出要驱逐的节点，没有可驱逐的节点时返回 nil
+func (e *evictor) victim(newcomer *p2p.Peer) *p2p.Peer {
+	type candidate struct {
+		peer       *p2p.Peer
+		shared     int
+		value      uint64
+		lastActive time.Time
+		stall      float64
+		slow       bool
+		bad        bool
+	}
+	var list []candidate
+	for _, p := range e.srv.Peers() {
+		if p.ID() == newcomer.ID() || p.Info().Network.Trusted {
+			continue
+		}
+		if r, ok := e.store.get(p.ID()); !ok || time.Since(r.ConnectedAt) < evictGrace {
+			continue
+		}
+		c := candidate{peer: p, value: e.usage.value(p.ID()), lastActive: e.usage.lastActive(p.ID()), slow: e.slo.violating(p.ID()), bad: e.corrupt.offender(p.ID())}
+		if e.stallLimit > 0 {
+			if s := e.stalls.score(p.ID()); s >= e.stallLimit {
+				c.stall = s
+			}
+		}
+		for _, proto := range e.srv.Protocols {
+			if p.RunningCap(proto.Name, []uint{proto.Version}) {
+				c.shared++
+			}
+		}
+		list = append(list, c)
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.bad != b.bad {
+			return a.bad
+		}
+		if a.stall != b.stall {
+			return a.stall > b.stall
+		}
+		if a.slow != b.slow {
+			return a.slow
+		}
+		if e.policy == evictUseful {
+			if a.shared != b.shared {
+				return a.shared < b.shared
+			}
+			if a.value != b.value {
+				return a.value < b.value
+			}
+		}
+		return a.lastActive.Before(b.lastActive)
+	})
+	return list[0].peer
+}
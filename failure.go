@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 错误分类：节点的启动失败和运行中的故障都带有机器可读的错误代码。启动失败时进程以代码对应的退出码
+// 退出，设置 -fatal.report 时还把代码和消息以 JSON 写入文件（例如 Kubernetes 的 /dev/termination-log）；
+// 运行中的故障（保存状态文件失败、刷新端口映射失败等）记录在 admin_health 和 RPC 地址上的 GET /health 中，
+// 恢复后标记为已恢复。有未恢复的核心故障时状态为 failing，GET /health 返回 503；只有可选组件的故障时
+// 状态为 degraded，仍然返回 200。编排系统据此区分"端口被占用，换个端口重试"和"私钥损坏，需要人工处理"。
+// 子命令的错误仍然以退出码 1 退出。
+//
+// 可选的子系统（指标服务、ASN/GeoIP 数据库、DNS 节点发现）启动失败时只记录警告和故障，节点以降级模式
+// 继续运行，admin_health 和 GET /health 的状态为 degraded；私钥、监听地址、存储等核心依赖失败时仍然退出。
+// -startup.strict 让可选子系统的失败也导致退出，适合希望配置错误尽早暴露的部署。
+type failureCode string
+
+const (
+	failConfig    failureCode = "config"    // 参数或配置文件无效
+	failKey       failureCode = "key"       // 节点私钥无法加载、派生、生成或保存
+	failBind      failureCode = "bind"      // 监听地址无法绑定
+	failNAT       failureCode = "nat"       // NAT 配置无效或端口映射失败
+	failStorage   failureCode = "storage"   // 数据目录或状态文件无法读写
+	failDiscovery failureCode = "discovery" // 节点发现（例如 DNS 节点列表）无法启动
+	failInstance  failureCode = "instance"  // 另一个实例正在使用同一个节点私钥或节点数据库
+	failInternal  failureCode = "internal"  // 其他错误
+)
+
+// failureExits 是各错误代码的退出码。1 与 log.Fatal 相同，2 与 flag 包解析失败时相同
+var failureExits = map[failureCode]int{
+	failInternal:  1,
+	failConfig:    2,
+	failKey:       10,
+	failBind:      11,
+	failNAT:       12,
+	failStorage:   13,
+	failDiscovery: 14,
+	failInstance:  15,
+}
+
+const (
+	evFault         = "fault"
+	evFaultResolved = "fault.resolved"
+)
+
+var (
+	fatalReport   = flag.String("fatal.report", "", "启动失败时把 JSON 格式的错误代码、退出码和消息写入这个文件，例如 Kubernetes 的 /dev/termination-log")
+	startupStrict = flag.Bool("startup.strict", false, "可选子系统（指标服务、-asn.db、DNS 节点发现）启动失败时也退出，而不是以降级模式继续运行")
+)
+
+// codedError 是带有错误代码的错误
+type codedError struct {
+	code failureCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode 给 err 加上错误代码，err 已经带有代码时保留原来的代码
+func withCode(code failureCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &codedError{code: code, err: err}
+}
+
+// failureCodeOf 返回 err 的错误代码，没有代码时为 failInternal
+func failureCodeOf(err error) failureCode {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	return failInternal
+}
+
+// listenFailure 区分监听失败和其他的启动错误
+func listenFailure(err error) failureCode {
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "listen" {
+		return failBind
+	}
+	return failureCodeOf(err)
+}
+
+// fatalReportData 是 -fatal.report 文件的内容
+type fatalReportData struct {
+	Code  failureCode `json:"code"`
+	Exit  int         `json:"exit"`
+	Error string      `json:"error"`
+	Time  time.Time   `json:"time"`
+}
+
+// fatalf 记录带有错误代码的启动失败，写出 -fatal.report 后以代码对应的退出码退出
+func fatalf(code failureCode, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	exit, ok := failureExits[code]
+	if !ok {
+		code, exit = failInternal, failureExits[failInternal]
+	}
+	log.Printf("启动失败 [%s]: %s", code, msg)
+	if *fatalReport != "" {
+		data, _ := json.Marshal(&fatalReportData{Code: code, Exit: exit, Error: msg, Time: time.Now()})
+		if err := os.WriteFile(*fatalReport, append(data, '\n'), 0o644); err != nil {
+			log.Printf("写入 -fatal.report 失败: %v", err)
+		}
+	}
+	os.Exit(exit)
+}
+
+// optionalComponents 是可选组件，它们的故障不影响节点收发协议消息，只使状态降级
+var optionalComponents = map[string]bool{
+	"metrics":       true,
+	"geoip":         true,
+	"discovery.dns": true,
+	"summary":       true,
+	"peers.notes":   true,
+}
+
+// faultRecord 是一个组件运行中的故障
+type faultRecord struct {
+	Component string      `json:"component"`
+	Code      failureCode `json:"code"`
+	Error     string      `json:"error"`    // 最近一次的错误
+	Optional  bool        `json:"optional"` // 可选组件的故障只使状态降级
+	Count     int         `json:"count"`
+	First     time.Time   `json:"first"`
+	Last      time.Time   `json:"last"`
+	Resolved  time.Time   `json:"resolved,omitzero"` // 恢复的时间，为空表示仍未恢复
+}
+
+// healthReport 是 admin_health 和 GET /health 的返回值
+type healthReport struct {
+	Status string        `json:"status"` // ok、degraded（只有可选组件有未恢复的故障）或 failing
+	Peers  int           `json:"peers"`
+	Faults []faultRecord `json:"faults"` // 未恢复的在前，各自按最近发生的时间从新到旧排列
+}
+
+// faultLog 按组件记录运行中的故障，同一组件的故障合并计数
+type faultLog struct {
+	events *eventBus
+
+	mu     sync.Mutex
+	faults map[string]*faultRecord
+}
+
+func newFaultLog(events *eventBus) *faultLog {
+	return &faultLog{events: events, faults: make(map[string]*faultRecord)}
+}
+
+// fail 记录组件 component 的一次故障，err 没有错误代码时使用 code
+func (f *faultLog) fail(component string, code failureCode, err error) {
+	if f == nil || err == nil {
+		return
+	}
+	code = failureCodeOf(withCode(code, err))
+	now := time.Now()
+	f.mu.Lock()
+	r := f.faults[component]
+	fresh := r == nil || !r.Resolved.IsZero()
+	if fresh {
+		r = &faultRecord{Component: component, Optional: optionalComponents[component], First: now}
+		f.faults[component] = r
+	}
+	r.Code, r.Error, r.Last = code, err.Error(), now
+	r.Count++
+	f.mu.Unlock()
+	if fresh {
+		f.events.emit(evFault, enode.ID{}, fmt.Sprintf("component=%s code=%s error=%v", component, code, err))
+	}
+}
+
+// ok 标记组件 component 已经恢复
+func (f *faultLog) ok(component string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	r := f.faults[component]
+	resolved := r != nil && r.Resolved.IsZero()
+	if resolved {
+		r.Resolved = time.Now()
+	}
+	f.mu.Unlock()
+	if resolved {
+		log.Printf("%s 已从故障中恢复", component)
+		f.events.emit(evFaultResolved, enode.ID{}, "component="+component)
+	}
+}
+
+// degrade 处理可选子系统 component 的启动失败：设置了 -startup.strict 时退出，否则记录故障后继续运行
+func (f *faultLog) degrade(component string, code failureCode, err error) {
+	if *startupStrict {
+		fatalf(failureCodeOf(withCode(code, err)), "%s: %v", component, err)
+	}
+	log.Printf("%s 启动失败，以降级模式继续运行: %v", component, err)
+	f.fail(component, code, err)
+}
+
+// health 返回节点的健康状况
+func (f *faultLog) health(srv *p2p.Server) *healthReport {
+	h := &healthReport{Status: "ok", Peers: srv.PeerCount(), Faults: []faultRecord{}}
+	if f == nil {
+		return h
+	}
+	f.mu.Lock()
+	for _, r := range f.faults {
+		h.Faults = append(h.Faults, *r)
+		switch {
+		case !r.Resolved.IsZero():
+		case !r.Optional:
+			h.Status = "failing"
+		case h.Status == "ok":
+			h.Status = "degraded"
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(h.Faults, func(i, j int) bool {
+		a, b := h.Faults[i], h.Faults[j]
+		if a.Resolved.IsZero() != b.Resolved.IsZero() {
+			return a.Resolved.IsZero()
+		}
+		return a.Last.After(b.Last)
+	})
+	return h
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var errFeatureFixed = errors.New("该功能不能在运行时切换")
+
+// feature 描述一个可选子系统的状态
+type feature struct {
+	Name       string `json:"name"`
+	Compiled   bool   `json:"compiled"`   // 是否编译进了当前二进制
+	Enabled    bool   `json:"enabled"`    // 当前是否启用
+	Toggleable bool   `json:"toggleable"` // 是否可以通过 admin_setFeature 切换
+}
+
+// featureSet 汇总可选子系统的状态，并负责可以安全地在运行时切换的那些：
+// 指标采集、消息追踪日志和 gossip 转发
+type featureSet struct {
+	discv4  bool
+	discv5  bool
+	dnsdisc bool
+	metrics *metrics.Switch // 只有以 -metrics 启动时才能切换
+	gossip  *gossipProtocol
+	trace   atomic.Bool
+	asn     bool // 加载了 -asn.db
+	zstd    bool // 启用了 zstd 载荷压缩
+}
+
+func (f *featureSet) list() []feature {
+	metricsOn := *metricsEnabled && metricsCompiled
+	if f.metrics != nil {
+		metricsOn = f.metrics.Enabled()
+	}
+	relayOn := true
+	if f.gossip != nil {
+		relayOn = f.gossip.relaying.Load()
+	}
+	return []feature{
+		{Name: "discv4", Compiled: true, Enabled: f.discv4},
+		{Name: "discv5", Compiled: true, Enabled: f.discv5},
+		{Name: "dnsdisc", Compiled: true, Enabled: f.dnsdisc},
+		{Name: "metrics", Compiled: metricsCompiled, Enabled: metricsOn, Toggleable: f.metrics != nil},
+		{Name: "rpc", Compiled: rpcCompiled, Enabled: rpcCompiled && *rpcAddr != ""},
+		{Name: "dashboard", Compiled: false},
+		{Name: "geoip", Compiled: geoipCompiled, Enabled: f.asn},
+		{Name: "zstd", Compiled: zstdCompiled, Enabled: f.zstd},
+		{Name: "trace", Compiled: true, Enabled: f.trace.Load(), Toggleable: true},
+		{Name: "gossip.relay", Compiled: true, Enabled: relayOn, Toggleable: f.gossip != nil},
+	}
+}
+
+// set 在运行时切换功能
+func (f *featureSet) set(name string, on bool) error {
+	switch name {
+	case "metrics":
+		if f.metrics == nil {
+			return fmt.Errorf("%w: 需要以 -metrics 启动节点", errFeatureFixed)
+		}
+		f.metrics.SetEnabled(on)
+	case "trace":
+		f.trace.Store(on)
+	case "gossip.relay":
+		if f.gossip == nil {
+			return errFeatureFixed
+		}
+		f.gossip.relaying.Store(on)
+		// 不再转发时只通告自己订阅的主题
+		f.gossip.interestChanged()
+	default:
+		for _, ft := range f.list() {
+			if ft.Name == name {
+				return errFeatureFixed
+			}
+		}
+		return fmt.Errorf("未知的功能 %q", name)
+	}
+	if on {
+		log.Printf("功能 %s 已启用", name)
+	} else {
+		log.Printf("功能 %s 已关闭", name)
+	}
+	return nil
+}
+
+// protocol 包装协议的 Run 函数，开启 trace 时在日志中记录每条收发的消息
+func (f *featureSet) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	name := proto.Name
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		return run(p, &tracedRW{MsgReadWriter: rw, f: f, id: p.ID(), proto: name})
+	}
+	return proto
+}
+
+type tracedRW struct {
+	p2p.MsgReadWriter
+	f     *featureSet
+	id    enode.ID
+	proto string
+}
+
+func (rw *tracedRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil && rw.f.trace.Load() {
+		log.Printf("[trace] <- %s %s code=%d size=%d", rw.id.TerminalString(), rw.proto, msg.Code, msg.Size)
+	}
+	return msg, err
+}
+
+func (rw *tracedRW) WriteMsg(msg p2p.Msg) error {
+	if rw.f.trace.Load() {
+		log.Printf("[trace] -> %s %s code=%d size=%d", rw.id.TerminalString(), rw.proto, msg.Code, msg.Size)
+	}
+	return rw.MsgReadWriter.WriteMsg(msg)
+}
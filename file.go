@@ -0,0 +1,640 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/peerstate"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// file 协议消息
+const (
+	fileHelloMsg    = 0x00
+	fileGetMsg      = 0x01
+	fileDataMsg     = 0x02
+	fileListMsg     = 0x03
+	fileManifestMsg = 0x04
+	fileGetChunkMsg = 0x05 // 响应同样是 fileDataMsg
+
+	fileMsgCount = 6
+)
+
+const (
+	fileVersion          = 1
+	fileHandshakeTimeout = 5 * time.Second
+	fileChunkSize        = 256 * 1024
+	fileMaxMsgSize       = 4 * 1024 * 1024 // 清单可能比数据块大
+	// 每个节点同时处理的下载请求数
+	fileMaxServing = 2
+	// 下载中途对方断开时等待重连的时间和一次下载中最多等待的次数
+	fileReconnectWait = 30 * time.Second
+	fileReconnects    = 3
+)
+
+var (
+	errFileNotServing = errors.New("对方未共享文件")
+	errFileNoPeer     = errors.New("节点未连接或不支持 file 协议")
+)
+
+// fileHello 是握手消息，Token 是对方签发给我们的下载令牌（可以为空）
+type fileHello struct {
+	Version  uint
+	Token    []byte
+	Compress string `rlp:"optional"` // 支持的载荷压缩算法，见 compress.go
+
+	Rest []rlp.RawValue `rlp:"tail"` // 兼容将来新增的字段
+}
+
+type fileGet struct {
+	ReqID uint64
+	Path  string
+}
+
+// fileData 是 fileGet 的响应，一个请求对应多条消息，最后一条 EOF 为 true
+type fileData struct {
+	ReqID uint64
+	Data  []byte
+	EOF   bool
+	Error string
+	Codec string `rlp:"optional"` // Data 的压缩算法，只发送给握手时协商了压缩的节点
+}
+
+// fileGetChunk 按哈希请求一个数据块
+type fileGetChunk struct {
+	ReqID uint64
+	Hash  common.Hash
+}
+
+type fileList struct {
+	ReqID uint64
+}
+
+// fileManifestResp 是 fileList 的响应
+type fileManifestResp struct {
+	ReqID    uint64
+	Manifest *fileManifest `rlp:"nil"`
+	Error    string
+}
+
+type filePeer struct {
+	peer       *p2p.Peer
+	rw         p2p.MsgReadWriter
+	authorized error // 对方是否可以从我们这里下载，nil 表示允许
+	serving    chan struct{}
+	compress   bool // 双方都支持载荷压缩
+
+	mu       sync.Mutex
+	pending  map[uint64]*fileRequest
+	listings map[uint64]chan *fileManifestResp
+}
+
+type fileRequest struct {
+	ch   chan *fileData
+	done chan struct{}
+}
+
+// fileProtocol 是演示用的文件传输协议。
+// 共享目录中的文件只提供给持有运营者签发令牌的节点，chat 等其他协议不受影响。
+type fileProtocol struct {
+	root     *os.Root // 共享目录，为 nil 时不提供下载
+	manifest *manifestBuilder
+	store    *chunkStore     // 共享文件和下载文件的数据块
+	verifier *tokenVerifier  // 为 nil 时不校验令牌
+	token    []byte          // 向对方出示的令牌
+	codec    *payloadCodec   // 为 nil 时不压缩
+	sched    *fileScheduler  // 为 nil 时不做公平调度
+	ledger   *fileLedger     // 为 nil 时不记录收支
+	slo      *sloTracker     // 跟踪每个节点的请求延迟，可以为 nil
+	corrupt  *corruptTracker // 统计校验失败的数据，可以为 nil
+	reconn   *reconnector    // 下载期间把对方标记为重要节点，断开后自动重拨，可以为 nil
+	passive  bool            // 观察模式下不应答请求，也不发起请求
+	peers    *peerstate.Set[*filePeer]
+	nextReq  atomic.Uint64
+}
+
+func newFileProtocol(key *ecdsa.PrivateKey, root *os.Root, store *chunkStore, verifier *tokenVerifier, token []byte) *fileProtocol {
+	f := &fileProtocol{
+		root:     root,
+		store:    store,
+		verifier: verifier,
+		token:    token,
+		peers:    peerstate.New[*filePeer](),
+	}
+	if root != nil {
+		f.manifest = newManifestBuilder(root, key, store)
+	}
+	return f
+}
+
+func (f *fileProtocol) protocol() p2p.Protocol {
+	return p2p.Protocol{
+		Name:    "file",
+		Version: fileVersion,
+		Length:  fileMsgCount,
+		Run:     f.peers.Run(f.handshake, f.run),
+	}
+}
+
+func (f *fileProtocol) handshake(p *p2p.Peer, rw p2p.MsgReadWriter) (*filePeer, error) {
+	errc := make(chan error, 2)
+	var theirs fileHello
+	ours := fileHello{Version: fileVersion, Token: f.token, Compress: f.codec.offer()}
+	go func() { errc <- p2p.Send(rw, fileHelloMsg, &ours) }()
+	go func() {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer msg.Discard()
+		if msg.Code != fileHelloMsg {
+			errc <- fmt.Errorf("握手阶段收到意外消息 %d", msg.Code)
+			return
+		}
+		errc <- msg.Decode(&theirs)
+	}()
+	timeout := time.NewTimer(fileHandshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, p2p.DiscReadTimeout
+		}
+	}
+	fp := &filePeer{
+		peer:     p,
+		rw:       rw,
+		serving:  make(chan struct{}, fileMaxServing),
+		pending:  make(map[uint64]*fileRequest),
+		listings: make(map[uint64]chan *fileManifestResp),
+		compress: f.codec.accepts(theirs.Compress),
+	}
+	if f.verifier != nil {
+		fp.authorized = f.verifier.verify(theirs.Token, p.ID(), time.Now())
+		if fp.authorized != nil && f.root != nil {
+			log.Printf("节点 %s 无权下载文件: %v", p.ID().TerminalString(), fp.authorized)
+		}
+	}
+	return fp, nil
+}
+
+func (f *fileProtocol) run(ctx context.Context, p *p2p.Peer, rw p2p.MsgReadWriter, fp *filePeer) error {
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > fileMaxMsgSize {
+			return fmt.Errorf("消息过大: %d", msg.Size)
+		}
+		switch msg.Code {
+		case fileGetMsg:
+			var req fileGet
+			if err := msg.Decode(&req); err != nil {
+				return err
+			}
+			if f.passive {
+				break
+			}
+			// 在独立的 goroutine 中读盘和发送，避免阻塞对方发给我们的响应
+			select {
+			case fp.serving <- struct{}{}:
+				go func() {
+					defer func() { <-fp.serving }()
+					defer f.peers.Busy(p.ID())()
+					f.serve(fp, &req)
+				}()
+			default:
+				p2p.Send(rw, fileDataMsg, &fileData{ReqID: req.ReqID, EOF: true, Error: "同时进行的请求过多"})
+			}
+		case fileDataMsg:
+			var data fileData
+			if err := msg.Decode(&data); err != nil {
+				return err
+			}
+			if data.Data, err = f.codec.decompress(data.Codec, data.Data); err != nil {
+				return err
+			}
+			f.ledger.received(p.ID(), len(data.Data))
+			fp.deliver(ctx, &data)
+		case fileGetChunkMsg:
+			var req fileGetChunk
+			if err := msg.Decode(&req); err != nil {
+				return err
+			}
+			if f.passive {
+				break
+			}
+			select {
+			case fp.serving <- struct{}{}:
+				go func() {
+					defer func() { <-fp.serving }()
+					defer f.peers.Busy(p.ID())()
+					f.serveChunk(fp, &req)
+				}()
+			default:
+				p2p.Send(rw, fileDataMsg, &fileData{ReqID: req.ReqID, EOF: true, Error: "同时进行的请求过多"})
+			}
+		case fileListMsg:
+			var req fileList
+			if err := msg.Decode(&req); err != nil {
+				return err
+			}
+			if f.passive {
+				break
+			}
+			select {
+			case fp.serving <- struct{}{}:
+				go func() {
+					defer func() { <-fp.serving }()
+					defer f.peers.Busy(p.ID())()
+					f.serveList(fp, &req)
+				}()
+			default:
+				p2p.Send(rw, fileManifestMsg, &fileManifestResp{ReqID: req.ReqID, Error: "同时进行的请求过多"})
+			}
+		case fileManifestMsg:
+			var resp fileManifestResp
+			if err := msg.Decode(&resp); err != nil {
+				return err
+			}
+			fp.mu.Lock()
+			ch := fp.listings[resp.ReqID]
+			fp.mu.Unlock()
+			if ch != nil {
+				select {
+				case ch <- &resp:
+				default:
+				}
+			}
+		default:
+			msg.Discard()
+			return fmt.Errorf("未知的消息代码 %d", msg.Code)
+		}
+		msg.Discard()
+	}
+}
+
+// serve 把请求的文件分块发送给对方
+func (f *fileProtocol) serve(fp *filePeer, req *fileGet) {
+	fail := func(err error) {
+		p2p.Send(fp.rw, fileDataMsg, &fileData{ReqID: req.ReqID, EOF: true, Error: err.Error()})
+	}
+	if f.root == nil {
+		fail(errFileNotServing)
+		return
+	}
+	if fp.authorized != nil {
+		fail(fp.authorized)
+		return
+	}
+	// os.Root 保证请求的路径不会逃出共享目录
+	file, err := f.root.Open(filepath.FromSlash(req.Path))
+	if err != nil {
+		fail(fmt.Errorf("无法打开 %s", req.Path))
+		return
+	}
+	defer file.Close()
+
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			fail(err)
+			return
+		}
+		release := f.sched.acquire(fp.peer.ID(), n)
+		err = p2p.Send(fp.rw, fileDataMsg, f.dataMsg(fp, req.ReqID, buf[:n], eof))
+		release()
+		if err != nil {
+			return
+		}
+		f.ledger.sent(fp.peer.ID(), n)
+		if eof {
+			return
+		}
+	}
+}
+
+// serveChunk 从数据块存储中返回请求的数据块。
+// 除了共享目录中的文件，下载过的数据块也可以提供给其他节点。
+func (f *fileProtocol) serveChunk(fp *filePeer, req *fileGetChunk) {
+	resp := fileData{ReqID: req.ReqID, EOF: true}
+	size := 0
+	switch {
+	case f.root == nil:
+		resp.Error = errFileNotServing.Error()
+	case fp.authorized != nil:
+		resp.Error = fp.authorized.Error()
+	default:
+		data, err := f.store.get(req.Hash)
+		if err != nil {
+			resp.Error = fmt.Sprintf("没有数据块 %x", req.Hash[:8])
+			if errors.Is(err, errChunkHash) {
+				// 本地数据块损坏，下次生成清单时重新切块
+				f.manifest.reset()
+			}
+		} else {
+			size = len(data)
+			defer f.sched.acquire(fp.peer.ID(), size)()
+			resp = *f.dataMsg(fp, req.ReqID, data, true)
+		}
+	}
+	if p2p.Send(fp.rw, fileDataMsg, &resp) == nil {
+		f.ledger.sent(fp.peer.ID(), size)
+	}
+}
+
+// dataMsg 构造一条数据响应，对方支持时压缩数据
+func (f *fileProtocol) dataMsg(fp *filePeer, reqID uint64, data []byte, eof bool) *fileData {
+	msg := &fileData{ReqID: reqID, Data: data, EOF: eof}
+	if fp.compress {
+		msg.Data, msg.Codec = f.codec.compress("file", data)
+	}
+	return msg
+}
+
+// serveList 返回共享目录的签名清单
+func (f *fileProtocol) serveList(fp *filePeer, req *fileList) {
+	resp := fileManifestResp{ReqID: req.ReqID}
+	switch {
+	case f.root == nil:
+		resp.Error = errFileNotServing.Error()
+	case fp.authorized != nil:
+		resp.Error = fp.authorized.Error()
+	default:
+		m, err := f.manifest.build()
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Manifest = m
+		}
+	}
+	p2p.Send(fp.rw, fileManifestMsg, &resp)
+}
+
+// list 请求节点 id 的共享清单并校验签名
+func (f *fileProtocol) list(ctx context.Context, id enode.ID) (*fileManifest, error) {
+	if f.passive {
+		return nil, errObserverWrite
+	}
+	fp, ok := f.peers.Get(id)
+	if !ok {
+		return nil, errFileNoPeer
+	}
+	peerCtx, _ := f.peers.Context(id)
+
+	ch := make(chan *fileManifestResp, 1)
+	reqID := f.nextReq.Add(1)
+	fp.mu.Lock()
+	fp.listings[reqID] = ch
+	fp.mu.Unlock()
+	defer func() {
+		fp.mu.Lock()
+		delete(fp.listings, reqID)
+		fp.mu.Unlock()
+	}()
+
+	start := time.Now()
+	if err := p2p.Send(fp.rw, fileListMsg, &fileList{ReqID: reqID}); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		f.slo.observe(id, "file/list", time.Since(start))
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		if resp.Manifest == nil {
+			return nil, errors.New("对方返回了空清单")
+		}
+		if err := resp.Manifest.verify(id); err != nil {
+			return nil, err
+		}
+		return resp.Manifest, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			f.slo.observe(id, "file/list", time.Since(start))
+		}
+		return nil, ctx.Err()
+	case <-peerCtx.Done():
+		return nil, errFileNoPeer
+	}
+}
+
+func (fp *filePeer) deliver(ctx context.Context, data *fileData) {
+	fp.mu.Lock()
+	req := fp.pending[data.ReqID]
+	fp.mu.Unlock()
+	if req == nil {
+		return
+	}
+	select {
+	case req.ch <- data:
+	case <-req.done:
+	case <-ctx.Done():
+	}
+}
+
+// request 发送一个请求，并把对应的 fileData 响应依次交给 handle，
+// 直到 handle 返回 true、对方返回错误或连接断开
+func (f *fileProtocol) request(ctx context.Context, id enode.ID, code uint64, build func(reqID uint64) interface{}, handle func(*fileData) (bool, error)) error {
+	if f.passive {
+		return errObserverWrite
+	}
+	fp, ok := f.peers.Get(id)
+	if !ok {
+		return errFileNoPeer
+	}
+	peerCtx, _ := f.peers.Context(id)
+	defer f.peers.Busy(id)()
+
+	req := &fileRequest{ch: make(chan *fileData, 4), done: make(chan struct{})}
+	reqID := f.nextReq.Add(1)
+	fp.mu.Lock()
+	fp.pending[reqID] = req
+	fp.mu.Unlock()
+	defer func() {
+		fp.mu.Lock()
+		delete(fp.pending, reqID)
+		fp.mu.Unlock()
+		close(req.done)
+	}()
+
+	kind := "file/get"
+	if code == fileGetChunkMsg {
+		kind = "file/chunk"
+	}
+	start, first := time.Now(), true
+	if err := p2p.Send(fp.rw, code, build(reqID)); err != nil {
+		return err
+	}
+	for {
+		select {
+		case data := <-req.ch:
+			if first {
+				f.slo.observe(id, kind, time.Since(start))
+				first = false
+			}
+			if data.Error != "" {
+				return errors.New(data.Error)
+			}
+			done, err := handle(data)
+			if err != nil || done {
+				return err
+			}
+		case <-ctx.Done():
+			if first && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				f.slo.observe(id, kind, time.Since(start))
+			}
+			return ctx.Err()
+		case <-peerCtx.Done():
+			return errFileNoPeer
+		}
+	}
+}
+
+// fetch 从节点 id 按路径流式下载 path 并写入 w
+func (f *fileProtocol) fetch(ctx context.Context, id enode.ID, path string, w io.Writer) (int64, error) {
+	var total int64
+	err := f.request(ctx, id, fileGetMsg, func(reqID uint64) interface{} {
+		return &fileGet{ReqID: reqID, Path: path}
+	}, func(data *fileData) (bool, error) {
+		n, err := w.Write(data.Data)
+		total += int64(n)
+		return data.EOF, err
+	})
+	return total, err
+}
+
+// fetchChunk 从节点 id 获取一个数据块，校验后存入本地数据块存储
+func (f *fileProtocol) fetchChunk(ctx context.Context, id enode.ID, h common.Hash) ([]byte, error) {
+	var chunk []byte
+	err := f.request(ctx, id, fileGetChunkMsg, func(reqID uint64) interface{} {
+		return &fileGetChunk{ReqID: reqID, Hash: h}
+	}, func(data *fileData) (bool, error) {
+		chunk = data.Data
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := f.store.putVerified(h, chunk); err != nil {
+		if errors.Is(err, errChunkHash) {
+			f.corrupt.badChunk(id, fmt.Sprintf("数据块 %x", h[:8]))
+		}
+		return nil, err
+	}
+	f.corrupt.verified(id)
+	return chunk, nil
+}
+
+// localChunk 从本地数据块存储读取数据块，损坏的数据块已被删除，需要重新获取
+func (f *fileProtocol) localChunk(h common.Hash) ([]byte, error) {
+	data, err := f.store.get(h)
+	if errors.Is(err, errChunkHash) {
+		log.Printf("本地数据块 %x 已损坏，重新从节点获取", h[:8])
+		f.corrupt.badLocalChunk()
+	}
+	return data, err
+}
+
+// download 按清单从节点 id 下载 path：本地已有的数据块直接从磁盘读取，
+// 其余数据块从对方获取，校验失败的数据块重新请求，最后校验整个文件的哈希。
+// 下载期间对方是重要节点，中途断开时等待重连后从当前数据块继续
+func (f *fileProtocol) download(ctx context.Context, id enode.ID, path string, w io.Writer) (int64, error) {
+	defer f.reconn.hold(id)()
+	m, err := f.list(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	entry, ok := m.find(path)
+	if !ok {
+		return 0, fmt.Errorf("对方没有共享 %s", path)
+	}
+	var (
+		h          = sha256.New()
+		total      int64
+		local      int
+		reconnects int
+	)
+	for _, ch := range entry.Chunks {
+		data, err := f.localChunk(ch)
+		if err == nil {
+			local++
+		} else {
+			for try := 0; ; {
+				data, err = f.fetchChunk(ctx, id, ch)
+				if errors.Is(err, errFileNoPeer) && reconnects < fileReconnects && f.waitPeer(ctx, id) {
+					reconnects++
+					continue
+				}
+				if err == nil || !errors.Is(err, errChunkHash) || try == fileChunkRetries || f.corrupt.offender(id) {
+					break
+				}
+				try++
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+		h.Write(data)
+		n, err := w.Write(data)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	if common.BytesToHash(h.Sum(nil)) != entry.Hash || uint64(total) != entry.Size {
+		// 每个数据块都校验通过，说明对方的清单与数据块不一致
+		f.corrupt.badFile(id, fmt.Sprintf("文件 %s", path))
+		return total, fmt.Errorf("文件 %s 校验失败", path)
+	}
+	if local > 0 {
+		log.Printf("%s: %d/%d 个数据块来自本地存储", path, local, len(entry.Chunks))
+	}
+	return total, nil
+}
+
+// waitPeer 等待断开的节点 id 被重连器重新连上，超时或没有重连器时返回 false
+func (f *fileProtocol) waitPeer(ctx context.Context, id enode.ID) bool {
+	if f.reconn == nil {
+		return false
+	}
+	log.Printf("下载中节点 %s 断开，等待重连", id.TerminalString())
+	timeout := time.NewTimer(fileReconnectWait)
+	defer timeout.Stop()
+	tick := time.NewTicker(500 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if _, ok := f.peers.Get(id); ok {
+				return true
+			}
+		case <-timeout.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
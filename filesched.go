@@ -0,0 +1,244 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// file 协议的公平调度：多个节点同时下载时，所有节点的数据块共用 -file.slots 个发送名额，
+// 按节点做差额轮询（DRR）：每轮给有等待数据块的节点增加一个 fileChunkSize 的额度，
+// 额度足够时发送一个数据块并扣除它的大小，因此每个节点得到的发送字节数大致相同，
+// 一个不断发起请求的节点不会占满上行带宽。-file.peer.rate 另外用令牌桶限制每个节点的发送速率，
+// 以牙还牙策略限速的节点使用更低的速率（见 ledger.go）。
+const fileSchedIdle = 10 * time.Minute // 这么长时间没有下载的节点不再出现在 admin_fileFairness 中
+
+// fileSchedPeerStats 是 admin_fileFairness 中一个节点的统计
+type fileSchedPeerStats struct {
+	ID      enode.ID      `json:"id"`
+	Queued  int           `json:"queued"` // 等待发送的数据块数
+	Sent    uint64        `json:"sent"`   // 已发送的数据块数
+	Bytes   uint64        `json:"bytes"`
+	AvgWait time.Duration `json:"avgWait"` // 数据块等待发送名额的平均时间
+	Last    time.Time     `json:"last"`
+}
+
+// fileSchedStats 是 admin_fileFairness 的返回值
+type fileSchedStats struct {
+	Slots    int                  `json:"slots"`
+	InFlight int                  `json:"inFlight"`
+	PeerRate string               `json:"peerRate,omitempty"`
+	Peers    []fileSchedPeerStats `json:"peers"`
+}
+
+type fileSchedReq struct {
+	size  int
+	ready chan struct{}
+	enq   time.Time
+}
+
+type fileSchedPeer struct {
+	queue   []*fileSchedReq
+	deficit int
+	tokens  float64 // 令牌桶中的字节数
+	refill  time.Time
+	sent    uint64
+	bytes   uint64
+	waited  time.Duration
+	last    time.Time
+}
+
+// fileScheduler 在节点之间公平地分配数据块的发送名额
+type fileScheduler struct {
+	slots    int
+	quantum  int
+	peerRate float64                // 每个节点每秒的字节数，0 表示不限制
+	throttle func(enode.ID) float64 // 单个节点被限速后的速率，0 表示不限速，可以为 nil
+
+	mu       sync.Mutex
+	peers    map[enode.ID]*fileSchedPeer
+	ring     []enode.ID // 有等待数据块的节点，按轮询顺序
+	next     int
+	inflight int
+	timer    *time.Timer // 所有等待的节点都被限速时，等到最早有令牌的时间
+}
+
+func newFileScheduler(slots int, peerRate float64) *fileScheduler {
+	return &fileScheduler{slots: slots, quantum: fileChunkSize, peerRate: peerRate, peers: make(map[enode.ID]*fileSchedPeer)}
+}
+
+// rate 返回节点的发送速率，0 表示不限制
+func (s *fileScheduler) rate(id enode.ID) float64 {
+	rate := s.peerRate
+	if s.throttle != nil {
+		if t := s.throttle(id); t > 0 && (rate == 0 || t < rate) {
+			rate = t
+		}
+	}
+	return rate
+}
+
+// burst 是令牌桶的容量，至少能放下一个数据块
+func burst(rate float64) float64 {
+	return max(rate, fileChunkSize)
+}
+
+// refillTokens 按速率补充令牌，调用方必须持有 s.mu
+func (sp *fileSchedPeer) refillTokens(rate float64, now time.Time) {
+	sp.tokens = min(burst(rate), sp.tokens+rate*now.Sub(sp.refill).Seconds())
+	sp.refill = now
+}
+
+// acquire 等待发送一个 size 字节的数据块，发送完成后调用返回的函数。s 可以为 nil
+func (s *fileScheduler) acquire(id enode.ID, size int) func() {
+	if s == nil {
+		return func() {}
+	}
+	now := time.Now()
+	req := &fileSchedReq{size: size, ready: make(chan struct{}), enq: now}
+	s.mu.Lock()
+	sp := s.peers[id]
+	if sp == nil {
+		s.expire(now)
+		sp = &fileSchedPeer{tokens: burst(s.rate(id)), refill: now}
+		s.peers[id] = sp
+	}
+	if len(sp.queue) == 0 {
+		s.ring = append(s.ring, id)
+	}
+	sp.queue = append(sp.queue, req)
+	s.dispatch(now)
+	s.mu.Unlock()
+
+	<-req.ready
+	return func() {
+		s.mu.Lock()
+		s.inflight--
+		s.dispatch(time.Now())
+		s.mu.Unlock()
+	}
+}
+
+// dispatch 按差额轮询发放空闲的名额，调用方必须持有 s.mu
+func (s *fileScheduler) dispatch(now time.Time) {
+	for s.inflight < s.slots && len(s.ring) > 0 {
+		granted := false
+		wake := time.Duration(-1)
+		for range len(s.ring) {
+			id := s.ring[s.next]
+			sp := s.peers[id]
+			req := sp.queue[0]
+			rate := s.rate(id)
+			if rate > 0 {
+				sp.refillTokens(rate, now)
+				if sp.tokens < float64(req.size) {
+					// 被限速的节点跳过这一轮，不累积额度
+					w := time.Duration((float64(req.size) - sp.tokens) / rate * float64(time.Second))
+					if wake < 0 || w < wake {
+						wake = w
+					}
+					s.next = (s.next + 1) % len(s.ring)
+					continue
+				}
+			}
+			if sp.deficit < req.size {
+				sp.deficit += s.quantum
+				s.next = (s.next + 1) % len(s.ring)
+				continue
+			}
+			if rate > 0 {
+				sp.tokens -= float64(req.size)
+			}
+			s.grant(sp, req, now)
+			granted = true
+			break
+		}
+		if !granted {
+			// 整轮都在限速或刚增加额度：有额度变化时继续，否则等待令牌
+			if wake >= 0 && !s.anyEligible(now) {
+				s.wakeAfter(wake)
+				return
+			}
+		}
+	}
+}
+
+// anyEligible 返回是否有节点的令牌足够发送它的下一个数据块，调用方必须持有 s.mu
+func (s *fileScheduler) anyEligible(now time.Time) bool {
+	for _, id := range s.ring {
+		sp := s.peers[id]
+		rate := s.rate(id)
+		if rate == 0 || min(burst(rate), sp.tokens+rate*now.Sub(sp.refill).Seconds()) >= float64(sp.queue[0].size) {
+			return true
+		}
+	}
+	return false
+}
+
+// grant 把一个名额发给节点的第一个数据块，调用方必须持有 s.mu
+func (s *fileScheduler) grant(sp *fileSchedPeer, req *fileSchedReq, now time.Time) {
+	sp.deficit -= req.size
+	sp.queue = sp.queue[1:]
+	sp.sent++
+	sp.bytes += uint64(req.size)
+	sp.waited += now.Sub(req.enq)
+	sp.last = now
+	s.inflight++
+	if len(sp.queue) == 0 {
+		// 没有等待的数据块时离开轮询，额度清零
+		sp.deficit = 0
+		s.ring = append(s.ring[:s.next], s.ring[s.next+1:]...)
+		if len(s.ring) > 0 {
+			s.next %= len(s.ring)
+		} else {
+			s.next = 0
+		}
+	}
+	close(req.ready)
+}
+
+func (s *fileScheduler) wakeAfter(d time.Duration) {
+	if s.timer != nil {
+		return
+	}
+	s.timer = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		s.timer = nil
+		s.dispatch(time.Now())
+		s.mu.Unlock()
+	})
+}
+
+// expire 删除空闲的节点，调用方必须持有 s.mu
+func (s *fileScheduler) expire(now time.Time) {
+	for id, sp := range s.peers {
+		if len(sp.queue) == 0 && now.Sub(sp.last) >= fileSchedIdle {
+			delete(s.peers, id)
+		}
+	}
+}
+
+func (s *fileScheduler) stats() *fileSchedStats {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &fileSchedStats{Slots: s.slots, InFlight: s.inflight, Peers: []fileSchedPeerStats{}}
+	if s.peerRate > 0 {
+		st.PeerRate = formatBitRate(s.peerRate * 8)
+	}
+	s.expire(now)
+	for id, sp := range s.peers {
+		ps := fileSchedPeerStats{ID: id, Queued: len(sp.queue), Sent: sp.sent, Bytes: sp.bytes, Last: sp.last}
+		if sp.sent > 0 {
+			ps.AvgWait = (sp.waited / time.Duration(sp.sent)).Round(time.Millisecond)
+		}
+		st.Peers = append(st.Peers, ps)
+	}
+	sort.Slice(st.Peers, func(i, j int) bool { return st.Peers[i].Bytes > st.Peers[j].Bytes })
+	return st
+}
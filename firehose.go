@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/discover/v4wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 节点发现的"消防水管"：bootnode 子命令开启 -firehose.addr 后，包装节点发现的 UDP 连接，
+// 把收发的每个 discv4 数据包解析为类型、对端地址、签名者和包含的节点（neighbors 中的端点、
+// enrresponse 中的完整节点记录），通过 WebSocket 订阅 discv4_subscribe ["packets", types]
+// 推送给外部分析工具，不需要另外运行抓包程序。没有订阅者时不解析数据包。
+// 主节点的节点发现套接字由 p2p.Server 内部持有，不对外暴露，所以只在 bootnode 子命令中提供。
+const firehoseBuffer = 256 // 每个订阅者的缓冲区，订阅者过慢时丢弃新的数据包
+
+var firehoseTypes = []string{"ping", "pong", "findnode", "neighbors", "enrrequest", "enrresponse", "invalid"}
+
+// firehoseNode 是 neighbors 数据包中的一个节点
+type firehoseNode struct {
+	ID  enode.ID `json:"id"`
+	IP  string   `json:"ip"`
+	UDP uint16   `json:"udp"`
+	TCP uint16   `json:"tcp"`
+}
+
+// firehosePacket 是推送给订阅者的一个数据包
+type firehosePacket struct {
+	Time       time.Time      `json:"time"`
+	Dir        string         `json:"dir"`  // in 或 out
+	Addr       string         `json:"addr"` // 对端的 UDP 地址
+	Type       string         `json:"type"`
+	Size       int            `json:"size"`
+	From       string         `json:"from,omitempty"` // 签名者的节点 ID，发出的数据包为本节点
+	Error      string         `json:"error,omitempty"`
+	Expiration uint64         `json:"expiration,omitempty"`
+	ENRSeq     uint64         `json:"enrSeq,omitempty"`
+	To         string         `json:"to,omitempty"`       // ping/pong 中声明的对端端点，格式为 ip:udp/tcp
+	Target     string         `json:"target,omitempty"`   // findnode 查找的目标 ID
+	ReplyTok   string         `json:"replyTok,omitempty"` // pong/enrresponse 回应的数据包哈希
+	Nodes      []firehoseNode `json:"nodes,omitempty"`
+	Record     string         `json:"record,omitempty"`  // enrresponse 中的节点记录
+	Dropped    int            `json:"dropped,omitempty"` // 上一个推送以来因订阅者过慢丢弃的数据包数
+}
+
+type firehoseSub struct {
+	types   map[string]bool // 为空表示所有类型
+	ch      chan *firehosePacket
+	dropped int
+}
+
+// firehose 把解析后的数据包分发给订阅者
+type firehose struct {
+	mu   sync.Mutex
+	subs map[int]*firehoseSub
+	next int
+}
+
+func newFirehose() *firehose {
+	return &firehose{subs: make(map[int]*firehoseSub)}
+}
+
+// subscribe 添加一个订阅者，types 为空表示所有类型
+func (f *firehose) subscribe(types []string) (int, <-chan *firehosePacket, error) {
+	sub := &firehoseSub{types: make(map[string]bool), ch: make(chan *firehosePacket, firehoseBuffer)}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if !slices.Contains(firehoseTypes, t) {
+			return 0, nil, fmt.Errorf("未知的数据包类型 %q，可选: %s", t, strings.Join(firehoseTypes, ","))
+		}
+		sub.types[t] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	f.subs[f.next] = sub
+	return f.next, sub.ch, nil
+}
+
+func (f *firehose) unsubscribe(id int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, id)
+}
+
+func (f *firehose) active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs) > 0
+}
+
+// publish 解析一个数据包并推送给订阅了它的类型的订阅者
+func (f *firehose) publish(dir string, addr netip.AddrPort, b []byte) {
+	if !f.active() {
+		return
+	}
+	pkt := decodeFirehose(b)
+	pkt.Time, pkt.Dir, pkt.Addr = time.Now(), dir, addr.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sub := range f.subs {
+		if len(sub.types) > 0 && !sub.types[pkt.Type] {
+			continue
+		}
+		p := pkt
+		if sub.dropped > 0 {
+			cp := *pkt
+			cp.Dropped = sub.dropped
+			p = &cp
+		}
+		select {
+		case sub.ch <- p:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// decodeFirehose 解析一个 discv4 数据包，无法解析时类型为 invalid
+func decodeFirehose(b []byte) *firehosePacket {
+	pkt := &firehosePacket{Size: len(b)}
+	p, from, _, err := v4wire.Decode(b)
+	if err != nil {
+		pkt.Type, pkt.Error = "invalid", err.Error()
+		return pkt
+	}
+	pkt.Type = strings.ToLower(strings.TrimSuffix(p.Name(), "/v4"))
+	pkt.From = from.ID().String()
+	switch req := p.(type) {
+	case *v4wire.Ping:
+		pkt.Expiration, pkt.ENRSeq, pkt.To = req.Expiration, req.ENRSeq, firehoseEndpoint(req.To)
+	case *v4wire.Pong:
+		pkt.Expiration, pkt.ENRSeq, pkt.To = req.Expiration, req.ENRSeq, firehoseEndpoint(req.To)
+		pkt.ReplyTok = hex.EncodeToString(req.ReplyTok)
+	case *v4wire.Findnode:
+		pkt.Expiration, pkt.Target = req.Expiration, req.Target.ID().String()
+	case *v4wire.Neighbors:
+		pkt.Expiration = req.Expiration
+		for _, n := range req.Nodes {
+			pkt.Nodes = append(pkt.Nodes, firehoseNode{ID: n.ID.ID(), IP: n.IP.String(), UDP: n.UDP, TCP: n.TCP})
+		}
+	case *v4wire.ENRRequest:
+		pkt.Expiration = req.Expiration
+	case *v4wire.ENRResponse:
+		pkt.ReplyTok = hex.EncodeToString(req.ReplyTok)
+		pkt.ENRSeq = req.Record.Seq()
+		if n, err := enode.New(enode.ValidSchemes, &req.Record); err == nil {
+			pkt.Record = n.String()
+		} else {
+			pkt.Error = "节点记录无效: " + err.Error()
+		}
+	}
+	return pkt
+}
+
+func firehoseEndpoint(e v4wire.Endpoint) string {
+	return fmt.Sprintf("%s:%d/%d", e.IP, e.UDP, e.TCP)
+}
+
+// firehoseConn 把收发的数据包交给 firehose，本身不修改、不丢弃任何数据包
+type firehoseConn struct {
+	discover.UDPConn
+	f *firehose
+}
+
+func newFirehoseConn(conn discover.UDPConn, f *firehose) *firehoseConn {
+	return &firehoseConn{UDPConn: conn, f: f}
+}
+
+func (c *firehoseConn) ReadFromUDPAddrPort(b []byte) (int, netip.AddrPort, error) {
+	n, addr, err := c.UDPConn.ReadFromUDPAddrPort(b)
+	if err == nil {
+		c.f.publish("in", addr, b[:n])
+	}
+	return n, addr, err
+}
+
+func (c *firehoseConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	n, err := c.UDPConn.WriteToUDPAddrPort(b, addr)
+	if err == nil {
+		c.f.publish("out", addr, b)
+	}
+	return n, err
+}
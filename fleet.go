@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 机群模式：大量部署的探测节点在启动时向中心协调者登记（enode、节点记录、版本和指标地址），
+// 之后定期发送心跳，协调者据此维护在线节点清单，不需要手工记录每个节点。
+// 协调者可以用 coordinator 子命令运行，接口为：
+//
+//	POST /register    fleetRegistration
+//	POST /heartbeat   fleetHeartbeat，协调者不认识该节点时返回 404，节点随即重新登记
+//	POST /deregister  fleetHeartbeat，节点正常关闭时发送
+//	GET  /nodes       []fleetMember
+//	GET  /config      signedFleetConfig，见 fleetconfig.go
+//
+// 设置了 -fleet.token 时所有请求带有 "Authorization: Bearer <token>"。
+const (
+	fleetRequestTimeout = 10 * time.Second
+	fleetMaxBody        = 64 * 1024
+)
+
+var errFleetUnknown = errors.New("协调者没有该节点的登记")
+
+// fleetRegistration 是节点登记时提交的信息
+type fleetRegistration struct {
+	ID      enode.ID  `json:"id"`
+	Name    string    `json:"name,omitempty"`
+	Enode   string    `json:"enode"`
+	ENR     string    `json:"enr"`
+	Version string    `json:"version"`
+	Build   string    `json:"build"`
+	Metrics string    `json:"metrics,omitempty"` // Prometheus 指标地址，未启用指标时为空
+	Started time.Time `json:"started"`
+}
+
+// fleetHeartbeat 是定期发送的心跳
+type fleetHeartbeat struct {
+	ID     enode.ID      `json:"id"`
+	Seq    uint64        `json:"seq"` // 节点记录的序号，变化时节点会重新登记
+	Peers  int           `json:"peers"`
+	Uptime time.Duration `json:"uptime"`
+}
+
+// fleetClient 负责登记和心跳
+type fleetClient struct {
+	url      string
+	token    string
+	name     string
+	interval time.Duration
+	srv      *p2p.Server
+	started  time.Time
+	http     http.Client
+	config   *remoteConfig // 为 nil 时不拉取远程配置
+}
+
+func newFleetClient(url, token, name string, interval time.Duration, srv *p2p.Server) *fleetClient {
+	return &fleetClient{
+		url:      strings.TrimSuffix(url, "/"),
+		token:    token,
+		name:     name,
+		interval: interval,
+		srv:      srv,
+		started:  time.Now(),
+		http:     http.Client{Timeout: fleetRequestTimeout},
+	}
+}
+
+func (f *fleetClient) registration() *fleetRegistration {
+	n := f.srv.Self()
+	reg := &fleetRegistration{
+		ID:      n.ID(),
+		Name:    f.name,
+		Enode:   n.URLv4(),
+		ENR:     n.String(),
+		Version: nodeVersion,
+		Build:   buildProfile,
+		Started: f.started,
+	}
+	if metricsCompiled && *metricsEnabled {
+		reg.Metrics = "http://" + *metricsAddr + "/metrics"
+	}
+	return reg
+}
+
+func (f *fleetClient) heartbeat() *fleetHeartbeat {
+	n := f.srv.Self()
+	return &fleetHeartbeat{ID: n.ID(), Seq: n.Seq(), Peers: f.srv.PeerCount(), Uptime: time.Since(f.started)}
+}
+
+func (f *fleetClient) post(ctx context.Context, path string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode == http.StatusNotFound && path == "/heartbeat":
+		return errFleetUnknown
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("%s: %s %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// run 登记并定期发送心跳，直到 ctx 结束。协调者不可用时按心跳间隔重试，不影响节点运行。
+func (f *fleetClient) run(ctx context.Context) {
+	if f.config != nil {
+		go f.config.run(ctx, f)
+	}
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	var (
+		registered bool
+		seq        uint64
+	)
+	for {
+		hb := f.heartbeat()
+		if registered && hb.Seq != seq {
+			// 端点或节点记录发生变化，重新登记以更新清单中的 enode 和 ENR
+			registered = false
+		}
+		if !registered {
+			if err := f.post(ctx, "/register", f.registration()); err != nil {
+				log.Printf("向协调者 %s 登记失败: %v", f.url, err)
+			} else {
+				log.Printf("已向协调者 %s 登记", f.url)
+				registered, seq = true, hb.Seq
+			}
+		} else if err := f.post(ctx, "/heartbeat", hb); err != nil {
+			log.Printf("向协调者发送心跳失败: %v", err)
+			if errors.Is(err, errFleetUnknown) {
+				registered = false
+				continue
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if registered {
+				dctx, cancel := context.WithTimeout(context.Background(), fleetRequestTimeout)
+				f.post(dctx, "/deregister", f.heartbeat())
+				cancel()
+			}
+			return
+		}
+	}
+}
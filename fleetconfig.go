@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 机群远程配置。协调者在 GET /config 提供由配置私钥签名的配置文档，机群节点以
+// -fleet.config.key 配置对应的 ID 后定期拉取，校验签名后应用：bootnodes 作为静态节点连接，
+// banlist 中的节点被拒绝连接，crawl 按计划定期爬取网络。配置的 version 必须递增，
+// 防止被替换为旧的配置。签名保证内容来自协调者，建议同时使用 https 地址。
+const defaultFleetConfigInterval = 5 * time.Minute
+
+var (
+	errFleetConfigSig = errors.New("配置不是由配置私钥签名")
+	errFleetConfigOld = errors.New("配置版本没有递增")
+)
+
+// fleetConfig 是协调者下发的配置
+type fleetConfig struct {
+	Version   uint64      `json:"version"`
+	Bootnodes []string    `json:"bootnodes,omitempty"` // enode URL，作为静态节点连接
+	Banlist   []string    `json:"banlist,omitempty"`   // 节点 ID 或 enode URL
+	Crawl     *fleetCrawl `json:"crawl,omitempty"`     // 为空时不定期爬取
+}
+
+// fleetCrawl 是定期爬取的计划，未填写的参数使用 crawl 子命令的默认值
+type fleetCrawl struct {
+	Every    string  `json:"every"`    // 两次爬取开始的间隔，例如 "6h"
+	Duration string  `json:"duration"` // 每次爬取的时长，例如 "10m"
+	Out      string  `json:"out,omitempty"`
+	PPS      float64 `json:"pps,omitempty"`
+}
+
+// signedFleetConfig 是 GET /config 的响应，Sig 是对 Config 原始字节的 Keccak256 哈希的签名
+type signedFleetConfig struct {
+	Config json.RawMessage `json:"config"`
+	Sig    hexutil.Bytes   `json:"sig"`
+}
+
+func signFleetConfig(key *ecdsa.PrivateKey, raw []byte) (*signedFleetConfig, error) {
+	sig, err := crypto.Sign(crypto.Keccak256(raw), key)
+	if err != nil {
+		return nil, err
+	}
+	return &signedFleetConfig{Config: raw, Sig: sig}, nil
+}
+
+// verify 校验签名并解析配置
+func (sc *signedFleetConfig) verify(signer enode.ID) (*fleetConfig, error) {
+	pub, err := crypto.SigToPub(crypto.Keccak256(sc.Config), sc.Sig)
+	if err != nil {
+		return nil, fmt.Errorf("无效的配置签名: %v", err)
+	}
+	if enode.PubkeyToIDV4(pub) != signer {
+		return nil, errFleetConfigSig
+	}
+	var cfg fleetConfig
+	if err := json.Unmarshal(sc.Config, &cfg); err != nil {
+		return nil, fmt.Errorf("无效的配置: %v", err)
+	}
+	return &cfg, nil
+}
+
+// parsedFleetConfig 是校验过的配置
+type parsedFleetConfig struct {
+	bootnodes []*enode.Node
+	banlist   []enode.ID
+	crawl     *crawlOptions
+	every     time.Duration
+}
+
+func (cfg *fleetConfig) parse() (*parsedFleetConfig, error) {
+	p := new(parsedFleetConfig)
+	for _, url := range cfg.Bootnodes {
+		n, err := enode.ParseV4(url)
+		if err != nil {
+			return nil, fmt.Errorf("bootnodes: %q: %v", url, err)
+		}
+		p.bootnodes = append(p.bootnodes, n)
+	}
+	for _, s := range cfg.Banlist {
+		id, err := parseNodeID(s)
+		if err != nil {
+			return nil, fmt.Errorf("banlist: %q: %v", s, err)
+		}
+		p.banlist = append(p.banlist, id)
+	}
+	if c := cfg.Crawl; c != nil {
+		every, err := time.ParseDuration(c.Every)
+		if err != nil {
+			return nil, fmt.Errorf("crawl.every: %v", err)
+		}
+		duration, err := time.ParseDuration(c.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("crawl.duration: %v", err)
+		}
+		if duration <= 0 || every < duration {
+			return nil, fmt.Errorf("crawl: every (%v) 必须不小于 duration (%v) 且 duration 大于 0", every, duration)
+		}
+		p.every = every
+		p.crawl = &crawlOptions{
+			Listen:       ":0",
+			Duration:     duration,
+			Out:          c.Out,
+			Workers:      8,
+			PPS:          100,
+			PerNode:      6,
+			Recheck:      30 * time.Minute,
+			Respect:      true,
+			BudgetMax:    5,
+			BudgetWindow: time.Hour,
+			SaveEvery:    time.Minute,
+		}
+		if p.crawl.Out == "" {
+			p.crawl.Out = "nodes.json"
+		}
+		if c.PPS > 0 {
+			p.crawl.PPS = c.PPS
+		}
+	}
+	return p, nil
+}
+
+// remoteConfig 定期拉取并应用协调者下发的配置
+type remoteConfig struct {
+	signer   enode.ID
+	interval time.Duration
+	srv      *p2p.Server
+	control  *controlHandler
+	boot     []*enode.Node // -bootnodes，配置中没有 bootnodes 时用于爬取
+	reasons  *dialReasons  // 记录静态节点的拨号来源，可以为 nil
+
+	mu        sync.Mutex
+	current   *fleetConfig
+	appliedAt time.Time
+	static    map[enode.ID]*enode.Node // 由配置添加的静态节点
+	stopCrawl context.CancelFunc
+}
+
+func newRemoteConfig(signer enode.ID, interval time.Duration, srv *p2p.Server, control *controlHandler, boot []*enode.Node) *remoteConfig {
+	return &remoteConfig{signer: signer, interval: interval, srv: srv, control: control, boot: boot, static: make(map[enode.ID]*enode.Node)}
+}
+
+func (rc *remoteConfig) fetch(ctx context.Context, f *fleetClient) (*signedFleetConfig, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url+"/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/config: %s", resp.Status)
+	}
+	var sc signedFleetConfig
+	if err := json.NewDecoder(io.LimitReader(resp.Body, fleetMaxBody)).Decode(&sc); err != nil {
+		return nil, fmt.Errorf("/config: %v", err)
+	}
+	return &sc, nil
+}
+
+// run 定期拉取配置，直到 ctx 结束
+func (rc *remoteConfig) run(ctx context.Context, f *fleetClient) {
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+	for {
+		if sc, err := rc.fetch(ctx, f); err != nil {
+			log.Printf("拉取机群配置失败: %v", err)
+		} else if err := rc.apply(ctx, sc); err != nil && !errors.Is(err, errFleetConfigOld) {
+			log.Printf("拒绝机群配置: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			rc.mu.Lock()
+			if rc.stopCrawl != nil {
+				rc.stopCrawl()
+			}
+			rc.mu.Unlock()
+			return
+		}
+	}
+}
+
+// apply 校验并应用配置，配置中有任何错误时整个配置都不生效
+func (rc *remoteConfig) apply(ctx context.Context, sc *signedFleetConfig) error {
+	cfg, err := sc.verify(rc.signer)
+	if err != nil {
+		return err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.current != nil && cfg.Version <= rc.current.Version {
+		return errFleetConfigOld
+	}
+	p, err := cfg.parse()
+	if err != nil {
+		return fmt.Errorf("版本 %d: %v", cfg.Version, err)
+	}
+
+	// 静态节点：添加新的，移除不再出现在配置中的
+	want := make(map[enode.ID]*enode.Node, len(p.bootnodes))
+	for _, n := range p.bootnodes {
+		want[n.ID()] = n
+		if _, ok := rc.static[n.ID()]; !ok {
+			rc.reasons.addStatic(n.ID(), dialFleet)
+			rc.srv.AddPeer(n)
+		}
+	}
+	for id, n := range rc.static {
+		if _, ok := want[id]; !ok {
+			go rc.srv.RemovePeer(n)
+		}
+	}
+	rc.static = want
+
+	rc.control.setBanlist(p.banlist)
+
+	if rc.stopCrawl != nil {
+		rc.stopCrawl()
+		rc.stopCrawl = nil
+	}
+	if p.crawl != nil {
+		p.crawl.Bootnodes = p.bootnodes
+		if len(p.crawl.Bootnodes) == 0 {
+			p.crawl.Bootnodes = rc.boot
+		}
+		cctx, cancel := context.WithCancel(ctx)
+		rc.stopCrawl = cancel
+		go crawlSchedule(cctx, *p.crawl, p.every)
+	}
+
+	rc.current, rc.appliedAt = cfg, time.Now()
+	log.Printf("已应用机群配置版本 %d: %d 个静态节点，%d 个禁止的节点，定期爬取: %v", cfg.Version, len(p.bootnodes), len(p.banlist), p.crawl != nil)
+	return nil
+}
+
+// crawlSchedule 立即爬取一次，之后每隔 every 爬取一次。取消 ctx 后在当前这次爬取结束时退出
+func crawlSchedule(ctx context.Context, o crawlOptions, every time.Duration) {
+	if len(o.Bootnodes) == 0 {
+		log.Printf("机群配置要求定期爬取，但没有引导节点")
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := runCrawl(o); err != nil {
+			log.Printf("定期爬取失败: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// crawlOut 返回定期爬取的结果文件，没有收到配置或配置中没有爬取计划时为默认的 nodes.json
+func (rc *remoteConfig) crawlOut() string {
+	if rc == nil {
+		return "nodes.json"
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.current == nil || rc.current.Crawl == nil || rc.current.Crawl.Out == "" {
+		return "nodes.json"
+	}
+	return rc.current.Crawl.Out
+}
+
+// fleetConfigStatus 是 admin_fleetConfig 的返回值
+type fleetConfigStatus struct {
+	Config    *fleetConfig `json:"config"`
+	AppliedAt time.Time    `json:"appliedAt,omitzero"`
+}
+
+func (rc *remoteConfig) status() *fleetConfigStatus {
+	if rc == nil {
+		return nil
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return &fleetConfigStatus{Config: rc.current, AppliedAt: rc.appliedAt}
+}
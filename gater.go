@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 规则作用的连接方向
+const (
+	gateInbound = "inbound"
+	gateDial    = "dial"
+)
+
+var errGated = errors.New("连接被门控规则拒绝")
+
+// gateRule 是一条带时间窗口的连接规则。
+//
+// 同一方向上只要有生效中的 deny 规则就拒绝；如果该方向存在 allow 规则，
+// 则只有在某条 allow 规则生效时才放行（例如 "只在维护窗口内接受入站连接"）。
+type gateRule struct {
+	ID        int       `json:"id"`
+	Direction string    `json:"direction"`       // inbound | dial
+	Action    string    `json:"action"`          // allow | deny
+	From      time.Time `json:"from,omitzero"`   // 生效起始时间，为空表示立即生效
+	Until     time.Time `json:"until,omitzero"`  // 失效时间，为空表示一直有效
+	Daily     string    `json:"daily,omitempty"` // 每日时间窗口 "HH:MM-HH:MM"（UTC），可跨越零点
+	Comment   string    `json:"comment,omitempty"`
+
+	dailyFrom, dailyUntil time.Duration
+}
+
+func (r *gateRule) validate() error {
+	if r.Direction != gateInbound && r.Direction != gateDial {
+		return fmt.Errorf("未知的方向 %q", r.Direction)
+	}
+	if r.Action != "allow" && r.Action != "deny" {
+		return fmt.Errorf("未知的动作 %q", r.Action)
+	}
+	if !r.From.IsZero() && !r.Until.IsZero() && !r.Until.After(r.From) {
+		return errors.New("until 必须晚于 from")
+	}
+	if r.Daily != "" {
+		var fh, fm, uh, um int
+		if _, err := fmt.Sscanf(r.Daily, "%d:%d-%d:%d", &fh, &fm, &uh, &um); err != nil {
+			return fmt.Errorf("无效的每日窗口 %q", r.Daily)
+		}
+		if fh > 23 || uh > 23 || fm > 59 || um > 59 || fh < 0 || uh < 0 || fm < 0 || um < 0 {
+			return fmt.Errorf("无效的每日窗口 %q", r.Daily)
+		}
+		r.dailyFrom = time.Duration(fh)*time.Hour + time.Duration(fm)*time.Minute
+		r.dailyUntil = time.Duration(uh)*time.Hour + time.Duration(um)*time.Minute
+	}
+	return nil
+}
+
+func (r *gateRule) active(now time.Time) bool {
+	if !r.From.IsZero() && now.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !now.Before(r.Until) {
+		return false
+	}
+	if r.Daily != "" {
+		now = now.UTC()
+		tod := now.Sub(now.Truncate(24 * time.Hour))
+		if r.dailyFrom <= r.dailyUntil {
+			return tod >= r.dailyFrom && tod < r.dailyUntil
+		}
+		return tod >= r.dailyFrom || tod < r.dailyUntil
+	}
+	return true
+}
+
+// gater 根据时间规则决定是否允许拨号和接受入站连接。
+// 维护模式（pause）优先于所有规则。
+type gater struct {
+	mu     sync.Mutex
+	rules  map[int]*gateRule
+	nextID int
+
+	paused        bool
+	pausedInbound bool
+}
+
+func newGater() *gater {
+	return &gater{rules: make(map[int]*gateRule)}
+}
+
+func (g *gater) addRule(r gateRule) (int, error) {
+	if err := r.validate(); err != nil {
+		return 0, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nextID++
+	r.ID = g.nextID
+	g.rules[r.ID] = &r
+	return r.ID, nil
+}
+
+func (g *gater) removeRule(id int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.rules[id]
+	delete(g.rules, id)
+	return ok
+}
+
+func (g *gater) list() []gateRule {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]gateRule, 0, len(g.rules))
+	for _, r := range g.rules {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// pause 进入维护模式：停止拨号，stopInbound 为 true 时同时拒绝入站连接。
+// 已有会话和节点发现不受影响。
+func (g *gater) pause(stopInbound bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = true
+	g.pausedInbound = stopInbound
+}
+
+// resume 退出维护模式
+func (g *gater) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = false
+	g.pausedInbound = false
+}
+
+func (g *gater) isPaused() (paused, inbound bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.pausedInbound
+}
+
+// allowed 判断某个方向在 now 时刻是否放行
+func (g *gater) allowed(direction string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused && (direction == gateDial || g.pausedInbound) {
+		return false
+	}
+	var hasAllow, allowActive bool
+	for _, r := range g.rules {
+		if r.Direction != direction {
+			continue
+		}
+		act := r.active(now)
+		switch r.Action {
+		case "deny":
+			if act {
+				return false
+			}
+		case "allow":
+			hasAllow = true
+			allowActive = allowActive || act
+		}
+	}
+	return !hasAllow || allowActive
+}
+
+func (g *gater) checkDial() error {
+	if !g.allowed(gateDial, time.Now()) {
+		return errGated
+	}
+	return nil
+}
+
+// enforceInbound 断开规则不允许的入站连接。
+// p2p.Server 没有提供入站连接的钩子，只能在节点加入后立即断开。
+func (g *gater) enforceInbound(srv *p2p.Server) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != p2p.PeerEventTypeAdd || g.allowed(gateInbound, time.Now()) {
+				continue
+			}
+			for _, p := range srv.Peers() {
+				if p.ID() == ev.Peer && p.Inbound() {
+					log.Printf("门控规则拒绝入站节点 %s (%s)", p.ID().TerminalString(), ev.RemoteAddress)
+					p.Disconnect(p2p.DiscRequested)
+				}
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
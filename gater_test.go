@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGateRuleValidate(t *testing.T) {
+	bad := []gateRule{
+		{Direction: "outbound", Action: "deny"},
+		{Direction: gateDial, Action: "block"},
+		{Direction: gateDial, Action: "deny", From: time.Unix(100, 0), Until: time.Unix(100, 0)},
+		{Direction: gateDial, Action: "deny", Daily: "9-17"},
+		{Direction: gateDial, Action: "deny", Daily: "24:00-01:00"},
+		{Direction: gateDial, Action: "deny", Daily: "08:60-09:00"},
+	}
+	g := newGater()
+	for _, r := range bad {
+		if _, err := g.addRule(r); err == nil {
+			t.Errorf("无效的规则 %+v 被接受", r)
+		}
+	}
+	if len(g.list()) != 0 {
+		t.Fatalf("无效的规则被加入: %v", g.list())
+	}
+}
+
+func TestGaterRules(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+
+	g := newGater()
+	if !g.allowed(gateInbound, at(12, 0)) || !g.allowed(gateDial, at(12, 0)) {
+		t.Fatal("没有规则时应全部放行")
+	}
+
+	// 只在维护窗口 (跨越零点的 22:00-02:00) 内接受入站连接
+	allow, err := g.addRule(gateRule{Direction: gateInbound, Action: "allow", Daily: "22:00-02:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		h, m int
+		want bool
+	}{{21, 59, false}, {22, 0, true}, {23, 30, true}, {1, 59, true}, {2, 0, false}, {12, 0, false}} {
+		if got := g.allowed(gateInbound, at(tt.h, tt.m)); got != tt.want {
+			t.Errorf("%02d:%02d 入站放行 = %v，应为 %v", tt.h, tt.m, got, tt.want)
+		}
+	}
+	if !g.allowed(gateDial, at(12, 0)) {
+		t.Fatal("入站规则影响了拨号")
+	}
+
+	// 生效中的 deny 优先于 allow
+	deny, err := g.addRule(gateRule{Direction: gateInbound, Action: "deny", From: at(23, 0), Until: at(23, 30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.allowed(gateInbound, at(23, 10)) {
+		t.Fatal("deny 规则生效时放行了入站连接")
+	}
+	if !g.allowed(gateInbound, at(23, 30)) {
+		t.Fatal("deny 规则到期后仍然拒绝")
+	}
+	if ids := g.list(); len(ids) != 2 || ids[0].ID != allow || ids[1].ID != deny {
+		t.Fatalf("规则列表 = %+v", ids)
+	}
+	if !g.removeRule(allow) || g.removeRule(allow) {
+		t.Fatal("删除规则的返回值不对")
+	}
+	if !g.allowed(gateInbound, at(12, 0)) {
+		t.Fatal("删除 allow 规则后仍然拒绝窗口外的入站连接")
+	}
+}
+
+func TestGaterPause(t *testing.T) {
+	g := newGater()
+	now := time.Now()
+	g.pause(false)
+	if g.allowed(gateDial, now) || !g.allowed(gateInbound, now) {
+		t.Fatal("维护模式应只停止拨号")
+	}
+	if err := g.checkDial(); err != errGated {
+		t.Fatalf("checkDial = %v", err)
+	}
+	g.pause(true)
+	if g.allowed(gateInbound, now) {
+		t.Fatal("stopInbound 时放行了入站连接")
+	}
+	// 维护模式优先于 allow 规则
+	g.addRule(gateRule{Direction: gateDial, Action: "allow"})
+	if g.allowed(gateDial, now) {
+		t.Fatal("维护模式下 allow 规则放行了拨号")
+	}
+	g.resume()
+	if paused, _ := g.isPaused(); paused || !g.allowed(gateDial, now) || !g.allowed(gateInbound, now) {
+		t.Fatal("退出维护模式后没有恢复")
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/peerstate"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// gossip 协议消息
+const (
+	gossipStatusMsg   = 0x00
+	gossipMsg         = 0x01
+	gossipInterestMsg = 0x02 // 只发给握手时声明了 Interest 的节点，见 gossipinterest.go
+
+	gossipMsgCount = 3
+)
+
+const (
+	gossipVersion          = 1
+	gossipHandshakeTimeout = 5 * time.Second
+	gossipMaxMsgSize       = 256 * 1024
+	gossipMaxHops          = 8
+)
+
+var errGossipVersion = errors.New("gossip 协议版本不兼容")
+
+type gossipStatus struct {
+	Version  uint
+	Compress string `rlp:"optional"` // 支持的载荷压缩算法，见 compress.go
+	Interest uint   `rlp:"optional"` // 支持的兴趣传播版本，0 表示不支持
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// gossipMessage 是在网络中泛洪转发的消息，Origin 和 Seq 一起唯一确定一条消息
+type gossipMessage struct {
+	Topic   string
+	Origin  enode.ID
+	Seq     uint64
+	Hops    uint
+	Payload []byte
+	Codec   string `rlp:"optional"` // Payload 的压缩算法，只在协商了压缩的连接上使用，转发前先解压
+	Time    uint64 `rlp:"optional"` // 发布时间（Unix 毫秒），用于判断消息是否过期，见 gossipttl.go
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+func (m *gossipMessage) id() common.Hash {
+	return crypto.Keccak256Hash(m.Origin[:], rlp.AppendUint64(nil, m.Seq), []byte(m.Topic))
+}
+
+// gossipHandler 处理收到的某个主题的消息，在协议的读循环中调用，不能阻塞
+type gossipHandler func(from enode.ID, msg *gossipMessage)
+
+type gossipPeer struct {
+	peer     *p2p.Peer
+	rw       p2p.MsgReadWriter
+	queue    chan *gossipMessage
+	urgent   chan *gossipMessage // 高优先级主题的发送队列，优先于 queue 发出
+	compress bool                // 双方都支持载荷压缩
+	// 差量编码状态，见 gossipdelta.go。deltaOut 只在对方支持且本节点配置了差量主题时创建
+	deltaIn  *deltaState
+	deltaOut *deltaState
+	// 兴趣传播状态。adC 通知 writeLoop 重新计算并发送通告，对方不支持兴趣传播时为 nil
+	interest  *peerInterest
+	adC       chan struct{}
+	adVersion uint64
+	// 写循环因发送失败退出后置位，之后不再向它排队，队列满也不记为对方的停滞
+	dead atomic.Bool
+}
+
+// gossipProtocol 是简单的主题泛洪协议：每条消息只处理一次，并转发给除来源外的所有节点
+type gossipProtocol struct {
+	self      enode.ID
+	peers     *peerstate.Set[*gossipPeer]
+	seq       atomic.Uint64
+	queueSize int // 每个节点的发送队列长度，队列满时丢弃新消息而不是阻塞转发
+	// 为 false 时只处理收到的消息，不再转发其他节点的消息（自己发布的消息照常发送）
+	relaying atomic.Bool
+	// 观察模式下只接收：不启动 writeLoop，因此不发送兴趣通告，也不转发或发布消息
+	passive bool
+	stalls  *stallTracker // 记录发送队列满的节点，可以为 nil
+	codec   *payloadCodec // 为 nil 时不压缩
+	// 使用差量编码发送的主题
+	deltaTopics map[string]bool
+	deltaMu     sync.Mutex
+	deltaStats  compressStats
+	expiry      *gossipExpiry     // 主题 TTL，为 nil 时消息不过期
+	priorities  *gossipPriorities // 主题优先级，为 nil 时所有主题都转发给全部节点
+	// 保护各节点的 peerInterest
+	interestMu      sync.RWMutex
+	interestSkipped atomic.Uint64
+
+	mu       sync.Mutex
+	seen     lru.BasicLRU[common.Hash, struct{}]
+	handlers map[string][]gossipHandler
+}
+
+// newGossipProtocol 创建 gossip 协议，seenCache 是去重缓存的条目数，queue 是每个节点的发送队列长度
+func newGossipProtocol(self enode.ID, seenCache, queue int) *gossipProtocol {
+	g := &gossipProtocol{
+		self:      self,
+		queueSize: queue,
+		peers:     peerstate.New[*gossipPeer](),
+		seen:      lru.NewBasicLRU[common.Hash, struct{}](seenCache),
+		handlers:  make(map[string][]gossipHandler),
+	}
+	// 序号从当前时间开始，避免重启后与之前发布的消息重复
+	g.seq.Store(uint64(time.Now().UnixNano()))
+	g.relaying.Store(true)
+	return g
+}
+
+func (g *gossipProtocol) protocol() p2p.Protocol {
+	return p2p.Protocol{
+		Name:    "gossip",
+		Version: gossipVersion,
+		Length:  gossipMsgCount,
+		Run:     g.peers.Run(g.handshake, g.run),
+	}
+}
+
+// subscribe 注册主题的处理函数
+func (g *gossipProtocol) subscribe(topic string, h gossipHandler) {
+	g.mu.Lock()
+	g.handlers[topic] = append(g.handlers[topic], h)
+	g.mu.Unlock()
+	g.interestChanged()
+}
+
+// publish 向网络发布一条消息
+func (g *gossipProtocol) publish(topic string, payload []byte) {
+	msg := &gossipMessage{Topic: topic, Origin: g.self, Seq: g.seq.Add(1), Payload: payload, Time: uint64(time.Now().UnixMilli())}
+	g.markSeen(msg.id())
+	g.relay(msg, enode.ID{})
+}
+
+// markSeen 记录消息，已经见过时返回 false
+func (g *gossipProtocol) markSeen(id common.Hash) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen.Contains(id) {
+		return false
+	}
+	g.seen.Add(id, struct{}{})
+	return true
+}
+
+// relay 把消息放入除 from 以外所有需要该主题的节点的发送队列，带宽紧张时低优先级主题只发给部分节点
+func (g *gossipProtocol) relay(msg *gossipMessage, from enode.ID) {
+	if g.passive {
+		return
+	}
+	var peers []*gossipPeer
+	g.peers.Range(func(p *p2p.Peer, gp *gossipPeer) bool {
+		if p.ID() != from {
+			peers = append(peers, gp)
+		}
+		return true
+	})
+	interested := peers[:0]
+	for _, gp := range peers {
+		if gp.dead.Load() {
+			continue
+		}
+		if g.wants(gp, msg.Topic) {
+			interested = append(interested, gp)
+		} else {
+			g.interestSkipped.Add(1)
+		}
+	}
+	peers = interested
+	high := g.priorities.of(msg.Topic) == prioHigh
+	for _, gp := range g.priorities.targets(msg.Topic, peers) {
+		queue := gp.queue
+		if high {
+			queue = gp.urgent
+		}
+		select {
+		case queue <- msg:
+		default:
+			g.stalls.dropped(gp.peer.ID(), "gossip")
+		}
+	}
+}
+
+func (g *gossipProtocol) handshake(p *p2p.Peer, rw p2p.MsgReadWriter) (*gossipPeer, error) {
+	errc := make(chan error, 2)
+	var theirs gossipStatus
+	ours := gossipStatus{Version: gossipVersion, Compress: g.offerEncodings(), Interest: gossipInterestVersion}
+	go func() { errc <- p2p.Send(rw, gossipStatusMsg, &ours) }()
+	go func() {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer msg.Discard()
+		if msg.Code != gossipStatusMsg {
+			errc <- fmt.Errorf("握手阶段收到意外消息 %d", msg.Code)
+			return
+		}
+		errc <- msg.Decode(&theirs)
+	}()
+	timeout := time.NewTimer(gossipHandshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, p2p.DiscReadTimeout
+		}
+	}
+	if theirs.Version != gossipVersion {
+		return nil, fmt.Errorf("%w: %d", errGossipVersion, theirs.Version)
+	}
+	gp := &gossipPeer{
+		peer:     p,
+		rw:       rw,
+		queue:    make(chan *gossipMessage, g.queueSize),
+		urgent:   make(chan *gossipMessage, g.queueSize),
+		compress: g.codec.accepts(theirs.Compress),
+		deltaIn:  newDeltaState(),
+		interest: new(peerInterest),
+	}
+	if len(g.deltaTopics) > 0 && slices.Contains(strings.Split(theirs.Compress, ","), codecDelta) {
+		gp.deltaOut = newDeltaState()
+	}
+	if theirs.Interest >= gossipInterestVersion {
+		gp.interest.supported = true
+		gp.adC = make(chan struct{}, 1)
+		gp.adC <- struct{}{} // 连接建立后首先发送自己的兴趣
+	}
+	return gp, nil
+}
+
+func (g *gossipProtocol) run(ctx context.Context, p *p2p.Peer, rw p2p.MsgReadWriter, gp *gossipPeer) error {
+	if !g.passive {
+		go g.writeLoop(ctx, gp)
+	}
+	// 新节点在发出通告前按需要所有主题处理，其他节点的通告可能因此变化
+	g.interestChanged()
+	defer g.leaveInterest(gp)
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > gossipMaxMsgSize {
+			return fmt.Errorf("消息过大: %d", msg.Size)
+		}
+		if msg.Code == gossipInterestMsg {
+			err := g.handleInterest(gp, msg)
+			msg.Discard()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Code != gossipMsg {
+			msg.Discard()
+			return fmt.Errorf("未知的消息代码 %d", msg.Code)
+		}
+		var gm gossipMessage
+		if err := msg.Decode(&gm); err != nil {
+			return err
+		}
+		msg.Discard()
+		if gm.Codec == codecDelta {
+			err = gp.deltaIn.decode(&gm)
+		} else {
+			gm.Payload, err = g.codec.decompress(gm.Codec, gm.Payload)
+		}
+		if err != nil {
+			return err
+		}
+		gm.Codec = ""
+		g.handle(p.ID(), &gm)
+	}
+}
+
+func (g *gossipProtocol) handle(from enode.ID, msg *gossipMessage) {
+	if msg.Origin == g.self || !g.markSeen(msg.id()) {
+		return
+	}
+	if age, expired := g.expiry.expired(msg, time.Now()); expired {
+		g.expiry.record(msg, age, false)
+		return
+	}
+	g.mu.Lock()
+	handlers := g.handlers[msg.Topic]
+	g.mu.Unlock()
+	for _, h := range handlers {
+		h(from, msg)
+	}
+	// 控制命令在暂停转发时也要转发，否则之后的恢复命令无法到达下游节点
+	if msg.Hops+1 < gossipMaxHops && (g.relaying.Load() || msg.Topic == topicControl) {
+		fwd := *msg
+		fwd.Hops++
+		g.relay(&fwd, from)
+	}
+}
+
+func (g *gossipProtocol) writeLoop(ctx context.Context, gp *gossipPeer) {
+	for {
+		var msg *gossipMessage
+		select {
+		case msg = <-gp.urgent:
+		default:
+			select {
+			case msg = <-gp.urgent:
+			case msg = <-gp.queue:
+			case <-gp.adC:
+				if err := g.sendInterest(gp); err != nil {
+					g.writeFailed(gp, err)
+					return
+				}
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := g.send(gp, msg); err != nil {
+			g.writeFailed(gp, err)
+			return
+		}
+	}
+}
+
+// writeFailed 在写循环退出时断开节点：没有写循环的连接收不到任何消息，
+// 继续保留只会让队列填满，并把本端的问题记成对方的停滞
+func (g *gossipProtocol) writeFailed(gp *gossipPeer, err error) {
+	gp.dead.Store(true)
+	log.Printf("向节点 %s 发送 gossip 消息失败，断开连接: %v", gp.peer.ID().TerminalString(), err)
+	gp.peer.Disconnect(p2p.DiscNetworkError)
+}
+
+// send 按连接协商的编码发送一条消息，已经过期的消息被丢弃
+func (g *gossipProtocol) send(gp *gossipPeer, msg *gossipMessage) error {
+	if age, expired := g.expiry.expired(msg, time.Now()); expired {
+		g.expiry.record(msg, age, true)
+		return nil
+	}
+	// 队列中的消息可能同时发给多个节点，编码时使用副本
+	switch {
+	case gp.deltaOut != nil && g.deltaTopics[msg.Topic]:
+		raw := len(msg.Payload)
+		msg = gp.deltaOut.encode(msg)
+		g.recordDelta(raw, len(msg.Payload))
+	case gp.compress:
+		out := *msg
+		out.Payload, out.Codec = g.codec.compress("gossip", msg.Payload)
+		msg = &out
+	}
+	return p2p.Send(gp.rw, gossipMsg, msg)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/p2ptest"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 写循环发送失败后不再向节点排队，队列满也不计入对方的停滞分数
+func TestGossipWriteFailure(t *testing.T) {
+	stalls := newStallTracker(time.Second, nil)
+	g := newGossipProtocol(enode.ID{1}, 64, 1)
+	g.stalls = stalls
+	// 观察模式的写入包装让兴趣通告的发送失败
+	s := p2ptest.Run(stalls.protocol(newObserver().protocol(g.protocol())))
+	defer s.Close()
+	if err := s.Expect(gossipStatusMsg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(gossipStatusMsg, &gossipStatus{Version: gossipVersion, Interest: gossipInterestVersion}); err != nil {
+		t.Fatal(err)
+	}
+	id := s.Peer.ID()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if gp, ok := g.peers.Get(id); ok && gp.dead.Load() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("发送失败后节点没有被标记")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for range 5 {
+		g.publish("news", []byte("x"))
+	}
+	if score := stalls.score(id); score != 0 {
+		t.Fatalf("停滞分数 = %v，写循环退出后的丢弃不应计入", score)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// gossip 的差量编码。对于频繁发布结构化状态（例如遥测数据）的主题，同一来源相邻两条消息
+// 通常只有少数字段变化，只发送与上一条的差异可以大幅减少流量。
+//
+// 差量的基准是本连接上发给对方的同一主题、同一来源的上一条消息。RLPx 连接按顺序可靠传输，
+// 对方按顺序处理每条消息，所以写入成功的消息就是对方已经确认的基准；连接断开后双方的状态都被丢弃，
+// 新连接上的第一条消息总是完整的关键帧。支持差量的节点在握手的 Compress 字段中带有 "delta"。
+const (
+	codecDelta = "delta"
+
+	// 每个连接上为差量编码保存的 (主题, 来源) 数
+	gossipDeltaStreams = 256
+	// 两个变化区间之间相同的字节少于这个数时合并为一个补丁，避免补丁本身的编码开销
+	deltaMergeGap = 8
+)
+
+// gossipDelta 是 Codec 为 delta 的消息的 Payload
+type gossipDelta struct {
+	Base    uint64 // 基准消息的 Seq，0 表示关键帧（Patches 中只有完整内容）
+	Len     uint64 // 还原后的长度
+	Patches []deltaPatch
+}
+
+type deltaPatch struct {
+	Offset uint64
+	Data   []byte
+}
+
+type deltaKey struct {
+	topic  string
+	origin enode.ID
+}
+
+// deltaBase 是一个 (主题, 来源) 上最近发送或收到的完整消息
+type deltaBase struct {
+	seq     uint64
+	payload []byte
+}
+
+// deltaState 是一个连接一个方向上的差量编码状态。发送方向只在 writeLoop 中使用，
+// 接收方向只在读循环中使用，所以不需要加锁。
+type deltaState struct {
+	streams lru.BasicLRU[deltaKey, deltaBase]
+}
+
+func newDeltaState() *deltaState {
+	return &deltaState{streams: lru.NewBasicLRU[deltaKey, deltaBase](gossipDeltaStreams)}
+}
+
+// diffPayload 计算把 base 变为 target 的补丁
+func diffPayload(base, target []byte) []deltaPatch {
+	var patches []deltaPatch
+	n := min(len(base), len(target))
+	for i := 0; i < n; {
+		if base[i] == target[i] {
+			i++
+			continue
+		}
+		start, end := i, i+1
+		for j := end; j < n; j++ {
+			if base[j] != target[j] {
+				end = j + 1
+			} else if j-end >= deltaMergeGap {
+				break
+			}
+		}
+		patches = append(patches, deltaPatch{Offset: uint64(start), Data: target[start:end]})
+		i = end
+	}
+	if len(target) > n {
+		patches = append(patches, deltaPatch{Offset: uint64(n), Data: target[n:]})
+	}
+	return patches
+}
+
+// applyDelta 在 base 上应用补丁
+func applyDelta(base []byte, d *gossipDelta) ([]byte, error) {
+	if d.Len > gossipMaxMsgSize {
+		return nil, fmt.Errorf("差量还原后过大: %d", d.Len)
+	}
+	out := make([]byte, d.Len)
+	copy(out, base)
+	for _, p := range d.Patches {
+		if p.Offset+uint64(len(p.Data)) > d.Len {
+			return nil, fmt.Errorf("差量补丁越界: offset=%d len=%d", p.Offset, len(p.Data))
+		}
+		copy(out[p.Offset:], p.Data)
+	}
+	return out, nil
+}
+
+// encode 把发给对方的消息编码为差量（或关键帧），并更新发送状态
+func (s *deltaState) encode(msg *gossipMessage) *gossipMessage {
+	key := deltaKey{msg.Topic, msg.Origin}
+	d := gossipDelta{Len: uint64(len(msg.Payload))}
+	if base, ok := s.streams.Get(key); ok {
+		d.Base = base.seq
+		d.Patches = diffPayload(base.payload, msg.Payload)
+	} else {
+		d.Patches = []deltaPatch{{Data: msg.Payload}}
+	}
+	s.streams.Add(key, deltaBase{seq: msg.Seq, payload: msg.Payload})
+	enc, _ := rlp.EncodeToBytes(&d)
+	if d.Base != 0 && len(enc) >= len(msg.Payload) {
+		// 变化太大时差量不比原文小，改为发送关键帧
+		d.Base, d.Patches = 0, []deltaPatch{{Data: msg.Payload}}
+		enc, _ = rlp.EncodeToBytes(&d)
+	}
+	out := *msg
+	out.Payload, out.Codec = enc, codecDelta
+	return &out
+}
+
+// decode 还原收到的差量消息，并更新接收状态
+func (s *deltaState) decode(msg *gossipMessage) error {
+	var d gossipDelta
+	if err := rlp.DecodeBytes(msg.Payload, &d); err != nil {
+		return fmt.Errorf("无效的差量: %v", err)
+	}
+	key := deltaKey{msg.Topic, msg.Origin}
+	var base []byte
+	if d.Base != 0 {
+		b, ok := s.streams.Get(key)
+		if !ok || b.seq != d.Base {
+			return fmt.Errorf("缺少差量基准 %s/%d", msg.Topic, d.Base)
+		}
+		base = b.payload
+	}
+	payload, err := applyDelta(base, &d)
+	if err != nil {
+		return err
+	}
+	s.streams.Add(key, deltaBase{seq: msg.Seq, payload: payload})
+	msg.Payload, msg.Codec = payload, ""
+	return nil
+}
+
+// offerEncodings 返回 gossip 握手中的 Compress 字段：压缩算法加上差量编码
+func (g *gossipProtocol) offerEncodings() string {
+	if c := g.codec.offer(); c != "" {
+		return c + "," + codecDelta
+	}
+	return codecDelta
+}
+
+// recordDelta 记录差量编码的效果
+func (g *gossipProtocol) recordDelta(raw, wire int) {
+	g.deltaMu.Lock()
+	defer g.deltaMu.Unlock()
+	g.deltaStats.Messages++
+	g.deltaStats.Raw += uint64(raw)
+	g.deltaStats.Wire += uint64(wire)
+}
+
+func (g *gossipProtocol) deltaReport() compressStats {
+	g.deltaMu.Lock()
+	defer g.deltaMu.Unlock()
+	r := g.deltaStats
+	r.Saved = int64(r.Raw) - int64(r.Wire)
+	if r.Raw > 0 {
+		r.Ratio = float64(r.Wire) / float64(r.Raw)
+	}
+	return r
+}
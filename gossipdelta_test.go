@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// deltaRoundTrip 用 enc 编码 msg，再用 dec 还原，检查还原后与原文一致
+func deltaRoundTrip(t *testing.T, enc, dec *deltaState, msg *gossipMessage) *gossipDelta {
+	t.Helper()
+	wire := enc.encode(msg)
+	if wire.Codec != codecDelta {
+		t.Fatalf("Codec = %q", wire.Codec)
+	}
+	var d gossipDelta
+	if err := rlp.DecodeBytes(wire.Payload, &d); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.decode(wire); err != nil {
+		t.Fatal(err)
+	}
+	if wire.Codec != "" || !bytes.Equal(wire.Payload, msg.Payload) {
+		t.Fatalf("还原后 = %q，应为 %q", wire.Payload, msg.Payload)
+	}
+	return &d
+}
+
+func TestGossipDeltaRoundTrip(t *testing.T) {
+	enc, dec := newDeltaState(), newDeltaState()
+	origin := enode.ID{1}
+	payloads := []string{
+		`{"cpu":10,"mem":512,"disk":"ok","uptime":1000}`,
+		`{"cpu":12,"mem":512,"disk":"ok","uptime":1060}`,
+		`{"cpu":12,"mem":640,"disk":"ok","uptime":1120,"extra":true}`,
+		`{"cpu":9}`,
+	}
+	for i, p := range payloads {
+		msg := &gossipMessage{Topic: "telemetry", Origin: origin, Seq: uint64(i + 1), Payload: []byte(p)}
+		d := deltaRoundTrip(t, enc, dec, msg)
+		if i == 0 && d.Base != 0 {
+			t.Fatal("第一条消息不是关键帧")
+		}
+		if i == 1 && (d.Base != 1 || len(d.Patches) == 0 || len(d.Patches[0].Data) >= len(p)) {
+			t.Fatalf("第二条消息的差量 = %+v", d)
+		}
+	}
+}
+
+// 不同主题和来源分别维护基准
+func TestGossipDeltaStreams(t *testing.T) {
+	enc, dec := newDeltaState(), newDeltaState()
+	a := &gossipMessage{Topic: "a", Origin: enode.ID{1}, Seq: 1, Payload: []byte("aaaaaaaaaaaaaaaaaaaaaaaa")}
+	b := &gossipMessage{Topic: "b", Origin: enode.ID{1}, Seq: 2, Payload: []byte("bbbbbbbbbbbbbbbbbbbbbbbb")}
+	c := &gossipMessage{Topic: "a", Origin: enode.ID{2}, Seq: 1, Payload: []byte("cccccccccccccccccccccccc")}
+	for _, m := range []*gossipMessage{a, b, c} {
+		if d := deltaRoundTrip(t, enc, dec, m); d.Base != 0 {
+			t.Fatalf("%s/%x 的第一条消息不是关键帧", m.Topic, m.Origin[:1])
+		}
+	}
+	next := &gossipMessage{Topic: "a", Origin: enode.ID{1}, Seq: 3, Payload: []byte("aaaaaaaaaaaaaaaaaaaaaaab")}
+	if d := deltaRoundTrip(t, enc, dec, next); d.Base != 1 {
+		t.Fatalf("基准 = %d，应为同一主题和来源的上一条消息", d.Base)
+	}
+}
+
+func TestGossipDeltaMissingBase(t *testing.T) {
+	enc := newDeltaState()
+	origin := enode.ID{1}
+	enc.encode(&gossipMessage{Topic: "t", Origin: origin, Seq: 1, Payload: bytes.Repeat([]byte("x"), 64)})
+	wire := enc.encode(&gossipMessage{Topic: "t", Origin: origin, Seq: 2, Payload: append(bytes.Repeat([]byte("x"), 63), 'y')})
+	// 接收方没有收到第一条消息
+	if err := newDeltaState().decode(wire); err == nil {
+		t.Fatal("缺少基准的差量被接受")
+	}
+}
+
+func TestApplyDeltaBounds(t *testing.T) {
+	if _, err := applyDelta(nil, &gossipDelta{Len: 4, Patches: []deltaPatch{{Offset: 2, Data: []byte("abc")}}}); err == nil {
+		t.Fatal("越界的补丁被接受")
+	}
+	if _, err := applyDelta(nil, &gossipDelta{Len: gossipMaxMsgSize + 1}); err == nil {
+		t.Fatal("过大的还原长度被接受")
+	}
+}
+
+func TestDiffPayloadMerge(t *testing.T) {
+	base := []byte("0123456789abcdefghij")
+	target := []byte("0X2345678Xabcdefghij")
+	// 两处变化相隔不到 deltaMergeGap 个字节，合并为一个补丁
+	patches := diffPayload(base, target)
+	if len(patches) != 1 || patches[0].Offset != 1 || string(patches[0].Data) != "X2345678X" {
+		t.Fatalf("补丁 = %+v", patches)
+	}
+	// 目标更短时只截断长度，不需要补丁
+	if patches := diffPayload(base, base[:5]); len(patches) != 0 {
+		t.Fatalf("截断的补丁 = %+v", patches)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// gossip 订阅兴趣传播。支持的节点在握手的 Interest 字段中声明版本，之后互相发送
+// gossipInterestMsg，列出希望收到的主题及距离（跳数）：自己订阅的主题距离为 0，
+// 为其他节点转发的主题为该节点通告的距离加一，超过 gossipMaxHops 的不再通告。
+// 转发消息时只发给通告过该主题的节点，不支持或尚未通告兴趣的节点照常收到所有消息。
+//
+// 通告给某个节点的兴趣不包括从它本身学到的主题（水平分割），兴趣撤销在环路中
+// 最多经过 gossipMaxHops 轮更新收敛。本节点连接了不支持兴趣传播的节点时，无法知道
+// 它们需要哪些主题，所以通告通配符 "*"，保证消息仍能到达它们。
+const (
+	gossipInterestVersion = 1
+	// 一次通告中最多的主题数，超过时对方视为违反协议
+	gossipMaxInterest = 1024
+	// 匹配所有主题的通配符
+	interestAll = "*"
+)
+
+// gossipInterest 是 gossipInterestMsg 的内容，每次都是完整的兴趣列表。
+// Version 在同一连接上单调递增，收到较旧的版本时忽略。
+type gossipInterest struct {
+	Version uint64
+	Topics  []interestTopic
+
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+type interestTopic struct {
+	Topic string
+	Hops  uint
+}
+
+// interestPeer 是 admin_gossipInterest 中单个节点的兴趣
+type interestPeer struct {
+	ID        enode.ID        `json:"id"`
+	Supported bool            `json:"supported"`
+	Version   uint64          `json:"version"`
+	Topics    map[string]uint `json:"topics,omitempty"`
+	Sent      map[string]uint `json:"sent,omitempty"` // 最近一次通告给它的主题
+}
+
+type interestReport struct {
+	Skipped uint64         `json:"skipped"` // 因对方没有兴趣而没有发送的消息副本数
+	Peers   []interestPeer `json:"peers"`
+}
+
+// peerInterest 是从一个节点收到的兴趣，除 supported 外受 gossipProtocol.interestMu 保护
+type peerInterest struct {
+	supported bool // 对方在握手时声明了兴趣传播
+	version   uint64
+	topics    map[string]uint // 为 nil 表示还没有收到通告
+	gone      bool            // 连接已经结束，不再参与计算
+	sent      map[string]uint // 最近一次通告给它的主题，只在它的 writeLoop 中写入
+}
+
+// wants 判断是否应该把主题的消息发给 gp
+func (g *gossipProtocol) wants(gp *gossipPeer, topic string) bool {
+	if !gp.interest.supported {
+		return true
+	}
+	g.interestMu.RLock()
+	defer g.interestMu.RUnlock()
+	t := gp.interest.topics
+	if t == nil {
+		return true
+	}
+	_, ok := t[topic]
+	if !ok {
+		_, ok = t[interestAll]
+	}
+	return ok
+}
+
+// interestChanged 通知所有支持兴趣传播的节点重新计算通告
+func (g *gossipProtocol) interestChanged() {
+	g.peers.Range(func(p *p2p.Peer, gp *gossipPeer) bool {
+		if gp.interest.supported {
+			select {
+			case gp.adC <- struct{}{}:
+			default:
+			}
+		}
+		return true
+	})
+}
+
+// advertisement 计算通告给 to 的兴趣
+func (g *gossipProtocol) advertisement(to *gossipPeer) map[string]uint {
+	ad := make(map[string]uint)
+	g.mu.Lock()
+	for topic := range g.handlers {
+		ad[topic] = 0
+	}
+	g.mu.Unlock()
+	if !g.relaying.Load() {
+		return ad
+	}
+	learn := func(topic string, hops uint) {
+		if hops >= gossipMaxHops {
+			return
+		}
+		if cur, ok := ad[topic]; !ok || hops < cur {
+			ad[topic] = hops
+		}
+	}
+	g.interestMu.RLock()
+	defer g.interestMu.RUnlock()
+	g.peers.Range(func(p *p2p.Peer, gp *gossipPeer) bool {
+		switch {
+		case gp == to, gp.interest.gone:
+		case !gp.interest.supported:
+			learn(interestAll, 1)
+		case gp.interest.topics == nil:
+			// 还没有收到通告，暂时当作需要所有主题
+			learn(interestAll, 1)
+		default:
+			for topic, hops := range gp.interest.topics {
+				learn(topic, hops+1)
+			}
+		}
+		return true
+	})
+	return ad
+}
+
+// sendInterest 在兴趣发生变化时向 gp 发送新的通告，只在 gp 的 writeLoop 中调用
+func (g *gossipProtocol) sendInterest(gp *gossipPeer) error {
+	ad := g.advertisement(gp)
+	if gp.interest.sent != nil && equalInterest(ad, gp.interest.sent) {
+		return nil
+	}
+	gp.adVersion++
+	msg := gossipInterest{Version: gp.adVersion, Topics: make([]interestTopic, 0, len(ad))}
+	for topic, hops := range ad {
+		msg.Topics = append(msg.Topics, interestTopic{topic, hops})
+	}
+	sort.Slice(msg.Topics, func(i, j int) bool { return msg.Topics[i].Topic < msg.Topics[j].Topic })
+	if err := p2p.Send(gp.rw, gossipInterestMsg, &msg); err != nil {
+		return err
+	}
+	g.interestMu.Lock()
+	gp.interest.sent = ad
+	g.interestMu.Unlock()
+	return nil
+}
+
+func equalInterest(a, b map[string]uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for topic, hops := range a {
+		if h, ok := b[topic]; !ok || h != hops {
+			return false
+		}
+	}
+	return true
+}
+
+// handleInterest 处理收到的兴趣通告
+func (g *gossipProtocol) handleInterest(gp *gossipPeer, msg p2p.Msg) error {
+	if !gp.interest.supported {
+		return fmt.Errorf("未声明兴趣传播的节点发送了兴趣通告")
+	}
+	var in gossipInterest
+	if err := msg.Decode(&in); err != nil {
+		return err
+	}
+	if len(in.Topics) > gossipMaxInterest {
+		return fmt.Errorf("兴趣通告中的主题过多: %d", len(in.Topics))
+	}
+	topics := make(map[string]uint, len(in.Topics))
+	for _, t := range in.Topics {
+		topics[t.Topic] = t.Hops
+	}
+	g.interestMu.Lock()
+	if in.Version <= gp.interest.version && gp.interest.topics != nil {
+		g.interestMu.Unlock()
+		return nil
+	}
+	gp.interest.version, gp.interest.topics = in.Version, topics
+	g.interestMu.Unlock()
+	g.interestChanged()
+	return nil
+}
+
+// leaveInterest 在连接结束时把节点排除在兴趣计算之外。不支持兴趣传播的节点离开后，
+// 其他节点可能不再需要通配符
+func (g *gossipProtocol) leaveInterest(gp *gossipPeer) {
+	g.interestMu.Lock()
+	gp.interest.gone = true
+	g.interestMu.Unlock()
+	g.interestChanged()
+}
+
+func (g *gossipProtocol) interestReport() interestReport {
+	r := interestReport{Skipped: g.interestSkipped.Load()}
+	g.interestMu.RLock()
+	defer g.interestMu.RUnlock()
+	g.peers.Range(func(p *p2p.Peer, gp *gossipPeer) bool {
+		ip := interestPeer{ID: p.ID(), Supported: gp.interest.supported}
+		if gp.interest.supported {
+			ip.Version, ip.Topics, ip.Sent = gp.interest.version, gp.interest.topics, gp.interest.sent
+		}
+		r.Peers = append(r.Peers, ip)
+		return true
+	})
+	sort.Slice(r.Peers, func(i, j int) bool { return r.Peers[i].ID.String() < r.Peers[j].ID.String() })
+	return r
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// gossip 主题优先级。发送队列平均占用率达到 gossipPressureFill 时认为带宽紧张：
+// 高优先级主题照常转发给所有节点，并且使用单独的发送队列优先发出；低优先级主题只转发给
+// 随机选出的 -gossip.fanout 个节点，依靠其他节点继续传播。未配置的主题为普通优先级，
+// 始终转发给所有节点。
+type gossipPriority uint8
+
+const (
+	prioNormal gossipPriority = iota
+	prioHigh
+	prioLow
+)
+
+const gossipPressureFill = 0.5
+
+var prioNames = [...]string{"normal", "high", "low"}
+
+func (p gossipPriority) String() string { return prioNames[p] }
+
+func (p gossipPriority) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+
+// priorityStats 是一个主题的转发统计
+type priorityStats struct {
+	Priority gossipPriority `json:"priority"`
+	Relayed  uint64         `json:"relayed"` // 转发的消息数
+	Sampled  uint64         `json:"sampled"` // 因带宽紧张只转发给部分节点的消息数
+	Skipped  uint64         `json:"skipped"` // 因此少发送的副本数
+}
+
+// parseTopicPriorities 解析 -gossip.priority 参数，格式为 topic=high|low,...
+func parseTopicPriorities(s string) (map[string]gossipPriority, error) {
+	prios := make(map[string]gossipPriority)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		topic, v, ok := strings.Cut(item, "=")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("无效的主题优先级 %q，格式为 topic=high|low", item)
+		}
+		switch v {
+		case "high":
+			prios[topic] = prioHigh
+		case "low":
+			prios[topic] = prioLow
+		case "normal":
+			prios[topic] = prioNormal
+		default:
+			return nil, fmt.Errorf("主题 %s 的优先级 %q 无效，可选 high|low|normal", topic, v)
+		}
+	}
+	return prios, nil
+}
+
+// gossipPriorities 保存主题优先级配置和转发统计
+type gossipPriorities struct {
+	topics map[string]gossipPriority
+	fanout int // 带宽紧张时低优先级消息转发的节点数
+
+	mu    sync.Mutex
+	stats map[string]*priorityStats
+}
+
+func newGossipPriorities(topics map[string]gossipPriority, fanout int) *gossipPriorities {
+	return &gossipPriorities{topics: topics, fanout: max(fanout, 1), stats: make(map[string]*priorityStats)}
+}
+
+func (p *gossipPriorities) of(topic string) gossipPriority {
+	if p == nil {
+		return prioNormal
+	}
+	return p.topics[topic]
+}
+
+// underPressure 判断发送队列的平均占用率是否达到 gossipPressureFill
+func underPressure(targets []*gossipPeer) bool {
+	var used, total int
+	for _, gp := range targets {
+		used += len(gp.queue)
+		total += cap(gp.queue)
+	}
+	return total > 0 && float64(used) >= float64(total)*gossipPressureFill
+}
+
+// targets 按主题优先级选出要转发的节点，可能打乱 peers 的顺序。只统计配置了优先级的主题
+func (p *gossipPriorities) targets(topic string, peers []*gossipPeer) []*gossipPeer {
+	if p == nil {
+		return peers
+	}
+	prio, ok := p.topics[topic]
+	if !ok {
+		return peers
+	}
+	sampled := prio == prioLow && len(peers) > p.fanout && underPressure(peers)
+	if sampled {
+		rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats[topic]
+	if s == nil {
+		s = &priorityStats{Priority: prio}
+		p.stats[topic] = s
+	}
+	s.Relayed++
+	if !sampled {
+		return peers
+	}
+	s.Sampled++
+	s.Skipped += uint64(len(peers) - p.fanout)
+	return peers[:p.fanout]
+}
+
+func (p *gossipPriorities) report() map[string]priorityStats {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	report := make(map[string]priorityStats, len(p.topics))
+	for topic, prio := range p.topics {
+		report[topic] = priorityStats{Priority: prio}
+	}
+	for topic, s := range p.stats {
+		report[topic] = *s
+	}
+	return report
+}
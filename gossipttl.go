@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gossip 消息的有效期。发布者在消息的 Time 字段中记录发布时间，每个节点按自己配置的
+// 主题 TTL 判断消息是否过期：过期的消息不再交给处理函数、也不再转发，在发送队列中等待
+// 过久而过期的消息同样被丢弃。网络分区恢复时，双方积压的旧消息因此不会重新泛洪。
+// 旧版本节点发布的消息没有 Time 字段，永不过期。
+const (
+	// 发布时间比本地时间晚这么多的消息视为时钟错误，按过期处理，防止伪造时间延长消息寿命
+	gossipClockSkew = time.Minute
+	// -gossip.ttl 中匹配所有其他主题的通配符
+	gossipTTLDefault = "*"
+)
+
+// expiryStats 是一个主题上的过期统计
+type expiryStats struct {
+	TTL          time.Duration `json:"ttl"`
+	Expired      uint64        `json:"expired"`      // 收到时已经过期而被丢弃的消息数
+	QueueExpired uint64        `json:"queueExpired"` // 在发送队列中过期而没有发出的消息数
+	MaxAge       time.Duration `json:"maxAge"`       // 被丢弃的消息中最大的年龄
+	Last         time.Time     `json:"last,omitempty"`
+}
+
+// gossipExpiry 保存主题的 TTL 配置和过期统计
+type gossipExpiry struct {
+	ttls map[string]time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*expiryStats
+}
+
+// parseTopicTTLs 解析 -gossip.ttl 参数，格式为 topic=duration,...，topic 为 * 时匹配其他所有主题
+func parseTopicTTLs(s string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		topic, v, ok := strings.Cut(item, "=")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("无效的主题 TTL %q，格式为 topic=duration", item)
+		}
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("主题 %s 的 TTL: %v", topic, err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("主题 %s 的 TTL 必须大于 0", topic)
+		}
+		ttls[topic] = ttl
+	}
+	return ttls, nil
+}
+
+func newGossipExpiry(ttls map[string]time.Duration) *gossipExpiry {
+	return &gossipExpiry{ttls: ttls, stats: make(map[string]*expiryStats)}
+}
+
+// ttl 返回主题的 TTL，0 表示不过期
+func (e *gossipExpiry) ttl(topic string) time.Duration {
+	if e == nil {
+		return 0
+	}
+	if ttl, ok := e.ttls[topic]; ok {
+		return ttl
+	}
+	return e.ttls[gossipTTLDefault]
+}
+
+// expired 判断消息在 now 时是否已经过期
+func (e *gossipExpiry) expired(msg *gossipMessage, now time.Time) (time.Duration, bool) {
+	ttl := e.ttl(msg.Topic)
+	if ttl == 0 || msg.Time == 0 {
+		return 0, false
+	}
+	age := now.Sub(time.UnixMilli(int64(msg.Time)))
+	return age, age > ttl || age < -gossipClockSkew
+}
+
+// record 记录一条被丢弃的过期消息，queued 表示消息是在发送队列中过期的
+func (e *gossipExpiry) record(msg *gossipMessage, age time.Duration, queued bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stats[msg.Topic]
+	if s == nil {
+		s = &expiryStats{TTL: e.ttl(msg.Topic)}
+		e.stats[msg.Topic] = s
+	}
+	if queued {
+		s.QueueExpired++
+	} else {
+		s.Expired++
+	}
+	s.MaxAge = max(s.MaxAge, age)
+	s.Last = time.Now()
+}
+
+// report 返回每个主题的 TTL 和过期统计，包括配置了 TTL 但还没有消息过期的主题
+func (e *gossipExpiry) report() map[string]expiryStats {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	report := make(map[string]expiryStats, len(e.ttls)+len(e.stats))
+	for topic, ttl := range e.ttls {
+		report[topic] = expiryStats{TTL: ttl}
+	}
+	for topic, s := range e.stats {
+		report[topic] = *s
+	}
+	return report
+}
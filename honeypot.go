@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover/v4wire"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 爬虫蜜罐检测：有些节点专门用来诱捕爬虫，对 FINDNODE 返回伪造的邻居。
+// honeypotConn 包装爬虫的 UDP 连接，记录发出的 FINDNODE 目标和收到的 NEIGHBORS 响应，
+// 出现以下不合理的响应时把响应方标记为疑似蜜罐：
+//
+//   - duplicate-entries：一个响应中同一个 ID 出现多次，或很多 ID 共用一个端点
+//   - perfect-distance：返回的节点与随机目标的公共前缀长得不可能（真实网络中约为 log2(节点数) 位）
+//   - static-set：对不同的目标总是返回同一组完整的邻居
+//   - shared-set：多个响应方对不同的目标返回完全相同的一组完整邻居
+//
+// 疑似蜜罐以及只由蜜罐报告过的节点不计入爬取结果，单独写入 <out>.honeypots.json。
+const (
+	discv4Neighbors = 4
+
+	honeyFullSet       = 16 // 完整的 FINDNODE 响应（一个 k 桶）
+	honeyMinPerfect    = 8  // 至少这么多节点才判断 perfect-distance
+	honeyPerfectPrefix = 32 // 公共前缀位数的中位数达到这个值时认为不可能
+	honeySameEndpoint  = 4  // 一个响应中这么多 ID 共用一个端点时认为是伪造的
+	honeyRepeat        = 3  // static-set/shared-set 需要的不同目标数或响应方数
+	honeyMaxReporters  = 4  // 每个节点最多记录的报告方数
+	honeyMaxTracked    = 1 << 20
+)
+
+// honeypotRecord 是 <out>.honeypots.json 中的一个疑似蜜罐
+type honeypotRecord struct {
+	Addr      string         `json:"addr"`
+	Reasons   map[string]int `json:"reasons"` // 原因 → 次数
+	Responses int            `json:"responses"`
+	Flagged   time.Time      `json:"flagged"`
+}
+
+// honeyResponse 是发往一个端点的 FINDNODE 及其（可能分成多个数据包的）响应
+type honeyResponse struct {
+	from   enode.ID
+	target enode.ID
+	ids    []enode.ID
+	eps    map[netip.AddrPort]int // 响应中的端点 → ID 数
+}
+
+// honeypotConn 在爬虫的 UDP 连接上检测蜜罐
+type honeypotConn struct {
+	*politeConn
+
+	mu        sync.Mutex
+	pending   map[netip.AddrPort]*honeyResponse
+	sets      map[[32]byte]map[enode.ID]enode.ID // 完整邻居集合的指纹 → 响应方 → 目标
+	targets   map[enode.ID]map[[32]byte]map[enode.ID]bool
+	responses map[enode.ID]int
+	addrs     map[enode.ID]netip.AddrPort // 响应方的地址
+	flagged   map[enode.ID]*honeypotRecord
+	reporters map[enode.ID][]enode.ID // 节点 → 报告过它的响应方
+}
+
+func newHoneypotConn(conn *politeConn) *honeypotConn {
+	return &honeypotConn{
+		politeConn: conn,
+		pending:    make(map[netip.AddrPort]*honeyResponse),
+		sets:       make(map[[32]byte]map[enode.ID]enode.ID),
+		targets:    make(map[enode.ID]map[[32]byte]map[enode.ID]bool),
+		responses:  make(map[enode.ID]int),
+		addrs:      make(map[enode.ID]netip.AddrPort),
+		flagged:    make(map[enode.ID]*honeypotRecord),
+		reporters:  make(map[enode.ID][]enode.ID),
+	}
+}
+
+func (c *honeypotConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	if len(b) > discv4HeadSize && b[discv4HeadSize] == discv4Findnode {
+		if pkt, _, _, err := v4wire.Decode(b); err == nil {
+			if req, ok := pkt.(*v4wire.Findnode); ok {
+				c.mu.Lock()
+				c.finish(addr)
+				c.pending[addr] = &honeyResponse{target: req.Target.ID(), eps: make(map[netip.AddrPort]int)}
+				c.mu.Unlock()
+			}
+		}
+	}
+	return c.politeConn.WriteToUDPAddrPort(b, addr)
+}
+
+func (c *honeypotConn) ReadFromUDPAddrPort(b []byte) (int, netip.AddrPort, error) {
+	n, addr, err := c.politeConn.ReadFromUDPAddrPort(b)
+	if err == nil && n > discv4HeadSize && b[discv4HeadSize] == discv4Neighbors {
+		if pkt, from, _, derr := v4wire.Decode(b[:n]); derr == nil {
+			if resp, ok := pkt.(*v4wire.Neighbors); ok {
+				c.neighbors(addr, from.ID(), resp.Nodes)
+			}
+		}
+	}
+	return n, addr, err
+}
+
+// neighbors 把一个 NEIGHBORS 数据包加入对应 FINDNODE 的响应
+func (c *honeypotConn) neighbors(addr netip.AddrPort, from enode.ID, nodes []v4wire.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.pending[addr]
+	if r == nil {
+		return // 没有对应的请求
+	}
+	r.from = from
+	for _, n := range nodes {
+		id := n.ID.ID()
+		r.ids = append(r.ids, id)
+		if ip, ok := netip.AddrFromSlice(n.IP); ok {
+			r.eps[netip.AddrPortFrom(ip.Unmap(), n.UDP)]++
+		}
+		if reps := c.reporters[id]; len(reps) < honeyMaxReporters && !slices.Contains(reps, from) && len(c.reporters) < honeyMaxTracked {
+			c.reporters[id] = append(reps, from)
+		}
+	}
+}
+
+// flag 把响应方标记为疑似蜜罐，调用方必须持有 c.mu
+func (c *honeypotConn) flag(id enode.ID, reason string) {
+	rec := c.flagged[id]
+	if rec == nil {
+		rec = &honeypotRecord{Addr: c.addrs[id].String(), Reasons: make(map[string]int), Flagged: time.Now()}
+		c.flagged[id] = rec
+	}
+	rec.Reasons[reason]++
+}
+
+// finish 检查发往 addr 的上一个 FINDNODE 的完整响应，调用方必须持有 c.mu
+func (c *honeypotConn) finish(addr netip.AddrPort) {
+	r := c.pending[addr]
+	delete(c.pending, addr)
+	if r == nil || len(r.ids) == 0 {
+		return
+	}
+	c.responses[r.from]++
+	c.addrs[r.from] = addr
+	if rec := c.flagged[r.from]; rec != nil {
+		rec.Responses = c.responses[r.from]
+	}
+
+	ids := slices.Clone(r.ids)
+	slices.SortFunc(ids, func(a, b enode.ID) int { return bytes.Compare(a[:], b[:]) })
+	dup := len(slices.Compact(slices.Clone(ids))) < len(ids)
+	for _, count := range r.eps {
+		dup = dup || count >= honeySameEndpoint
+	}
+	if dup {
+		c.flag(r.from, "duplicate-entries")
+	}
+
+	if len(ids) >= honeyMinPerfect {
+		prefixes := make([]int, len(ids))
+		for i, id := range ids {
+			prefixes[i] = 256 - enode.LogDist(id, r.target)
+		}
+		slices.Sort(prefixes)
+		if prefixes[len(prefixes)/2] >= honeyPerfectPrefix {
+			c.flag(r.from, "perfect-distance")
+		}
+	}
+
+	if len(ids) < honeyFullSet || len(c.sets) >= honeyMaxTracked {
+		return
+	}
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write(id[:])
+	}
+	var fp [32]byte
+	h.Sum(fp[:0])
+	// 同一个响应方对不同目标返回同一组邻居
+	byFP := c.targets[r.from]
+	if byFP == nil {
+		byFP = make(map[[32]byte]map[enode.ID]bool)
+		c.targets[r.from] = byFP
+	}
+	if byFP[fp] == nil {
+		byFP[fp] = make(map[enode.ID]bool)
+	}
+	byFP[fp][r.target] = true
+	if len(byFP[fp]) >= honeyRepeat {
+		c.flag(r.from, "static-set")
+	}
+	// 不同的响应方对不同目标返回同一组邻居
+	owners := c.sets[fp]
+	if owners == nil {
+		owners = make(map[enode.ID]enode.ID)
+		c.sets[fp] = owners
+	}
+	owners[r.from] = r.target
+	distinct := make(map[enode.ID]bool)
+	for _, target := range owners {
+		distinct[target] = true
+	}
+	if len(owners) >= honeyRepeat && len(distinct) >= honeyRepeat {
+		for owner := range owners {
+			c.flag(owner, "shared-set")
+		}
+	}
+}
+
+// isHoneypot 返回节点是否被标记为疑似蜜罐
+func (c *honeypotConn) isHoneypot(id enode.ID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flagged[id] != nil
+}
+
+func (c *honeypotConn) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.flagged)
+}
+
+// excluded 结束所有未完成的响应，返回疑似蜜罐和只由蜜罐报告过的节点
+func (c *honeypotConn) excluded() (honeypots map[enode.ID]*honeypotRecord, tainted map[enode.ID]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr := range c.pending {
+		c.finish(addr)
+	}
+	tainted = make(map[enode.ID]bool)
+	for id, reps := range c.reporters {
+		only := len(reps) > 0
+		for _, rep := range reps {
+			only = only && c.flagged[rep] != nil
+		}
+		if only {
+			tainted[id] = true
+		}
+	}
+	honeypots = make(map[enode.ID]*honeypotRecord, len(c.flagged))
+	for id, rec := range c.flagged {
+		cp := *rec
+		cp.Responses = c.responses[id]
+		honeypots[id] = &cp
+	}
+	return honeypots, tainted
+}
+
+// honeypotPath 返回疑似蜜罐的输出文件，例如 nodes.json → nodes.honeypots.json
+func honeypotPath(out string) string {
+	return strings.TrimSuffix(out, ".json") + ".honeypots.json"
+}
+
+func saveHoneypots(path string, honeypots map[enode.ID]*honeypotRecord) error {
+	data, err := json.MarshalIndent(honeypots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// honeypotSummary 返回按原因统计的疑似蜜罐数，用于日志
+func honeypotSummary(honeypots map[enode.ID]*honeypotRecord) string {
+	counts := make(map[string]int)
+	for _, rec := range honeypots {
+		for reason := range rec.Reasons {
+			counts[reason]++
+		}
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason, n := range counts {
+		reasons = append(reasons, fmt.Sprintf("%s=%d", reason, n))
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, " ")
+}
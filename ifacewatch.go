@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/p2p/nat"
+)
+
+// 网络接口变化：笔记本切换 Wi-Fi、虚拟机迁移后本机地址会变，p2p.Server 要到下一次
+// 外部 IP 检查（两分钟一次）或重启后才会更新节点记录。监视器定期比较各网卡的地址，
+// 发现变化时立即重新确定公告的端点：通过 UPnP/NAT-PMP 重新查询外部 IP 并刷新端口映射，
+// 没有端口映射时把新的本机地址作为后备 IP；随后向已连接的节点和路由表中的节点发送 ping，
+// 对方从 pong 中的记录序号得知我们的记录已更新并重新获取，相当于重新公告端点。
+// 网卡断开时同时向 recoveryTracker 报告一次中断。
+const (
+	evIfaceChanged = "net.interface_changed"
+
+	ifaceNATTimeout    = 10 * time.Second
+	ifaceMappingName   = "devp2p-demo"
+	ifaceMappingLife   = 10 * time.Minute
+	ifaceAnnouncePeers = 16 // 路由表中最多 ping 的节点数（不含已连接的节点）
+)
+
+// ifaceStatus 是 admin_interfaces 的返回值
+type ifaceStatus struct {
+	Addrs      map[string][]string `json:"addrs"` // 网卡 → 地址
+	Changes    uint64              `json:"changes"`
+	LastChange time.Time           `json:"lastChange,omitzero"`
+	Added      []string            `json:"added,omitempty"`   // 最近一次变化新增的地址
+	Removed    []string            `json:"removed,omitempty"` // 最近一次变化移除的地址
+	Endpoint   string              `json:"endpoint"`          // 当前公告的端点
+	Seq        uint64              `json:"seq"`
+}
+
+// ifaceWatch 监视网卡地址变化并重新公告端点
+type ifaceWatch struct {
+	srv      *p2p.Server
+	events   *eventBus
+	recovery *recoveryTracker
+	poll     time.Duration
+	faults   *faultLog // 记录刷新端口映射的故障，可以为 nil
+
+	mu      sync.Mutex
+	addrs   map[string][]netip.Addr
+	changes uint64
+	last    time.Time
+	added   []netip.Addr
+	removed []netip.Addr
+}
+
+func newIfaceWatch(srv *p2p.Server, events *eventBus, recovery *recoveryTracker, poll time.Duration) *ifaceWatch {
+	return &ifaceWatch{srv: srv, events: events, recovery: recovery, poll: poll, addrs: interfaceAddrs()}
+}
+
+// interfaceAddrs 返回已启用、有载波的非回环网卡上的单播地址（不含链路本地地址）
+func interfaceAddrs() map[string][]netip.Addr {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	addrs := make(map[string][]netip.Addr)
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagLoopback != 0 || ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagRunning == 0 {
+			continue
+		}
+		list, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		var ips []netip.Addr
+		for _, a := range list {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipnet.IP)
+			if ok && !ip.Unmap().IsLinkLocalUnicast() {
+				ips = append(ips, ip.Unmap())
+			}
+		}
+		slices.SortFunc(ips, func(a, b netip.Addr) int { return a.Compare(b) })
+		addrs[ifi.Name] = ips
+	}
+	return addrs
+}
+
+// diffAddrs 比较两次的地址，返回新增和移除的地址以及断开的网卡
+func diffAddrs(old, cur map[string][]netip.Addr) (added, removed []netip.Addr, down []string) {
+	all := func(m map[string][]netip.Addr) map[netip.Addr]bool {
+		set := make(map[netip.Addr]bool)
+		for _, ips := range m {
+			for _, ip := range ips {
+				set[ip] = true
+			}
+		}
+		return set
+	}
+	before, after := all(old), all(cur)
+	for ip := range after {
+		if !before[ip] {
+			added = append(added, ip)
+		}
+	}
+	for ip := range before {
+		if !after[ip] {
+			removed = append(removed, ip)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			down = append(down, name)
+		}
+	}
+	cmp := func(a, b netip.Addr) int { return a.Compare(b) }
+	slices.SortFunc(added, cmp)
+	slices.SortFunc(removed, cmp)
+	sort.Strings(down)
+	return added, removed, down
+}
+
+func addrStrings(ips []netip.Addr) []string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
+
+// preferredAddr 选择新的后备 IP：优先选新增的地址，公网地址优先于私有地址，IPv4 优先
+func preferredAddr(added []netip.Addr, cur map[string][]netip.Addr) (netip.Addr, bool) {
+	rank := func(ip netip.Addr) int {
+		r := 0
+		if ip.IsPrivate() {
+			r += 2
+		}
+		if !ip.Is4() {
+			r++
+		}
+		return r
+	}
+	pick := func(ips []netip.Addr) (best netip.Addr, ok bool) {
+		for _, ip := range ips {
+			if !ok || rank(ip) < rank(best) {
+				best, ok = ip, true
+			}
+		}
+		return best, ok
+	}
+	if ip, ok := pick(added); ok {
+		return ip, true
+	}
+	var all []netip.Addr
+	for _, ips := range cur {
+		all = append(all, ips...)
+	}
+	slices.SortFunc(all, func(a, b netip.Addr) int { return a.Compare(b) })
+	return pick(all)
+}
+
+// listenPort 返回监听的 TCP 端口，服务启动后 ListenAddr 是实际监听的地址
+func (w *ifaceWatch) listenPort() int {
+	_, port, _ := net.SplitHostPort(w.srv.ListenAddr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// reevaluate 重新确定公告的端点
+func (w *ifaceWatch) reevaluate(added []netip.Addr, cur map[string][]netip.Addr) {
+	ln := w.srv.LocalNode()
+	switch natm := w.srv.NAT.(type) {
+	case nil:
+		// 没有端口映射：新的本机地址作为后备 IP，之后 pong 中的外部地址会覆盖它
+		if ip, ok := preferredAddr(added, cur); ok {
+			ln.SetFallbackIP(ip.AsSlice())
+		}
+	case nat.ExtIP:
+		// 外部 IP 由 -nat extip 指定，不随网卡变化
+	default:
+		port := w.listenPort()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ip, err := natm.ExternalIP()
+			if err != nil {
+				log.Printf("网络变化后查询外部 IP 失败 (%v): %v", natm, err)
+				w.faults.fail("nat", failNAT, err)
+				return
+			}
+			ln.SetStaticIP(ip)
+			if port == 0 {
+				w.faults.ok("nat")
+				return
+			}
+			failed := false
+			if ext, err := natm.AddMapping("TCP", port, port, ifaceMappingName, ifaceMappingLife); err == nil {
+				ln.Set(enr.TCP(ext))
+			} else {
+				log.Printf("网络变化后刷新 TCP 端口映射失败: %v", err)
+				w.faults.fail("nat", failNAT, err)
+				failed = true
+			}
+			if ext, err := natm.AddMapping("UDP", port, port, ifaceMappingName, ifaceMappingLife); err == nil {
+				ln.SetFallbackUDP(int(ext))
+			} else {
+				log.Printf("网络变化后刷新 UDP 端口映射失败: %v", err)
+				w.faults.fail("nat", failNAT, err)
+				failed = true
+			}
+			if !failed {
+				w.faults.ok("nat")
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(ifaceNATTimeout):
+			log.Printf("网络变化后 %v 在 %v 内没有响应，稍后由端口映射循环重试", natm, ifaceNATTimeout)
+		}
+	}
+}
+
+// announce 向已连接的节点和路由表中的节点发送 ping，让它们获取更新后的记录
+func (w *ifaceWatch) announce() int {
+	disc := w.srv.DiscoveryV4()
+	if disc == nil {
+		return 0
+	}
+	targets := make(map[enode.ID]*enode.Node)
+	for _, p := range w.srv.Peers() {
+		if n := p.Node(); n.UDP() != 0 {
+			targets[n.ID()] = n
+		}
+	}
+	extra := 0
+	for _, bucket := range disc.TableBuckets() {
+		for _, bn := range bucket {
+			if _, ok := targets[bn.Node.ID()]; !ok && extra < ifaceAnnouncePeers {
+				targets[bn.Node.ID()] = bn.Node
+				extra++
+			}
+		}
+	}
+	for _, n := range targets {
+		go disc.Ping(n)
+	}
+	return len(targets)
+}
+
+func (w *ifaceWatch) check() {
+	cur := interfaceAddrs()
+	if cur == nil {
+		return
+	}
+	w.mu.Lock()
+	added, removed, down := diffAddrs(w.addrs, cur)
+	if len(added) == 0 && len(removed) == 0 && len(down) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	w.addrs = cur
+	w.changes++
+	w.last = time.Now()
+	w.added, w.removed = added, removed
+	w.mu.Unlock()
+
+	log.Printf("网络接口变化：新增 [%s]，移除 [%s]，重新公告端点", strings.Join(addrStrings(added), " "), strings.Join(addrStrings(removed), " "))
+	if len(down) > 0 {
+		w.recovery.outage("interface-down:" + strings.Join(down, ","))
+	}
+	old := w.srv.LocalNode().Node()
+	w.reevaluate(added, cur)
+	n := w.srv.LocalNode().Node()
+	pinged := w.announce()
+	ep := endpointString(n)
+	if n.Seq() != old.Seq() {
+		log.Printf("公告的端点 %s → %s (seq %d)，已通知 %d 个节点", endpointString(old), ep, n.Seq(), pinged)
+	}
+	w.events.emit(evIfaceChanged, enode.ID{}, fmt.Sprintf("added=%s removed=%s endpoint=%s", strings.Join(addrStrings(added), ","), strings.Join(addrStrings(removed), ","), ep))
+}
+
+// endpointString 返回节点记录中的 IP:TCP 端口
+func endpointString(n *enode.Node) string {
+	if ep, ok := n.TCPEndpoint(); ok {
+		return ep.String()
+	}
+	return "(none)"
+}
+
+func (w *ifaceWatch) status() *ifaceStatus {
+	if w == nil {
+		return nil
+	}
+	n := w.srv.LocalNode().Node()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := &ifaceStatus{
+		Addrs:      make(map[string][]string, len(w.addrs)),
+		Changes:    w.changes,
+		LastChange: w.last,
+		Added:      addrStrings(w.added),
+		Removed:    addrStrings(w.removed),
+		Endpoint:   endpointString(n),
+		Seq:        n.Seq(),
+	}
+	for name, ips := range w.addrs {
+		st.Addrs[name] = addrStrings(ips)
+	}
+	return st
+}
+
+func (w *ifaceWatch) run() {
+	tick := time.NewTicker(w.poll)
+	defer tick.Stop()
+	for range tick.C {
+		w.check()
+	}
+}
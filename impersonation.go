@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 冒充检测：节点 ID 就是公钥，同一个 ID 出现在多个地址上通常意味着私钥被复制或盗用，
+// 静态节点的地址上出现了另一个 ID 则说明对方换了私钥（或地址被别人占用）。两种情况都会
+// 打印告警、发出 peer.impersonation 事件并记录在 admin_impersonation 中；
+// 开启 -guard.refuse 后，在 -guard.window 内拒绝（断开）有歧义的节点的连接，防止实验中的身份混淆。
+//
+// 地址来源：每个会话的远端 IP、出站连接和 chat 握手告知的可拨号端点，以及节点发现路由表中的记录。
+const (
+	evPeerImpersonation = "peer.impersonation"
+
+	guardScanInterval = time.Minute
+	guardMaxAlerts    = 100
+	guardMaxTracked   = 65536
+)
+
+// 告警类型
+const (
+	guardMultiAddress = "multi-address" // 同一 ID 在窗口内来自多个 IP
+	guardKeyChanged   = "key-changed"   // 静态节点的端点上出现了另一个 ID
+)
+
+// guardAlert 是 admin_impersonation 中的一条告警
+type guardAlert struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	ID       enode.ID  `json:"id"`                // 有歧义的节点
+	Expected enode.ID  `json:"expected,omitzero"` // key-changed：静态节点原来的 ID
+	Addrs    []string  `json:"addrs"`             // multi-address：窗口内出现过的 IP；key-changed：端点
+	Refused  bool      `json:"refused,omitempty"`
+}
+
+type guardConfig struct {
+	Window    time.Duration
+	Endpoints int // 窗口内同一 ID 的不同 IP 数达到这个值时告警
+	Refuse    bool
+}
+
+// impersonationGuard 检测节点 ID 与地址之间不一致的对应关系
+type impersonationGuard struct {
+	cfg    guardConfig
+	srv    *p2p.Server
+	events *eventBus
+	static map[netip.AddrPort]enode.ID // 静态节点的 TCP 端点 → ID
+
+	mu       sync.Mutex
+	seen     map[enode.ID]map[netip.Addr]time.Time
+	suspects map[enode.ID]time.Time // 有歧义的节点及其告警时间
+	alerts   []guardAlert
+}
+
+func newImpersonationGuard(cfg guardConfig, srv *p2p.Server, events *eventBus, static []*enode.Node) *impersonationGuard {
+	g := &impersonationGuard{
+		cfg:      cfg,
+		srv:      srv,
+		events:   events,
+		static:   make(map[netip.AddrPort]enode.ID),
+		seen:     make(map[enode.ID]map[netip.Addr]time.Time),
+		suspects: make(map[enode.ID]time.Time),
+	}
+	for _, n := range static {
+		if ep, ok := n.TCPEndpoint(); ok {
+			g.static[netip.AddrPortFrom(ep.Addr().Unmap(), ep.Port())] = n.ID()
+		}
+	}
+	return g
+}
+
+// alert 记录告警，调用方必须持有 g.mu
+func (g *impersonationGuard) alert(a guardAlert) {
+	if last, ok := g.suspects[a.ID]; ok && a.Time.Sub(last) < g.cfg.Window {
+		return // 窗口内已经告警过
+	}
+	g.suspects[a.ID] = a.Time
+	if len(g.alerts) == guardMaxAlerts {
+		g.alerts = g.alerts[1:]
+	}
+	g.alerts = append(g.alerts, a)
+	detail := fmt.Sprintf("kind=%s addrs=%s", a.Kind, strings.Join(a.Addrs, ","))
+	if a.Kind == guardKeyChanged {
+		log.Printf("警告：静态节点 %s 的端点 %s 上出现了另一个节点 %s，对方可能更换了私钥", a.Expected.TerminalString(), a.Addrs[0], a.ID.TerminalString())
+		detail += " expected=" + a.Expected.String()
+	} else {
+		log.Printf("警告：节点 %s 在 %v 内从 %d 个不同地址连接 (%s)，私钥可能被复制或盗用", a.ID.TerminalString(), g.cfg.Window, len(a.Addrs), strings.Join(a.Addrs, ", "))
+	}
+	g.events.emit(evPeerImpersonation, a.ID, detail)
+}
+
+// sawAddr 记录一次来自 ip 的会话，调用方必须持有 g.mu
+func (g *impersonationGuard) sawAddr(id enode.ID, ip netip.Addr, now time.Time) {
+	ips, ok := g.seen[id]
+	if !ok {
+		if len(g.seen) >= guardMaxTracked {
+			g.expire(now)
+			if len(g.seen) >= guardMaxTracked {
+				return
+			}
+		}
+		ips = make(map[netip.Addr]time.Time)
+		g.seen[id] = ips
+	}
+	ips[ip.Unmap()] = now
+	for addr, t := range ips {
+		if now.Sub(t) >= g.cfg.Window {
+			delete(ips, addr)
+		}
+	}
+	if len(ips) >= g.cfg.Endpoints {
+		addrs := make([]string, 0, len(ips))
+		for addr := range ips {
+			addrs = append(addrs, addr.String())
+		}
+		sort.Strings(addrs)
+		g.alert(guardAlert{Time: now, Kind: guardMultiAddress, ID: id, Addrs: addrs})
+	}
+}
+
+// sawEndpoint 记录 id 可以通过 ep 拨号，调用方必须持有 g.mu
+func (g *impersonationGuard) sawEndpoint(id enode.ID, ep netip.AddrPort, now time.Time) {
+	ep = netip.AddrPortFrom(ep.Addr().Unmap(), ep.Port())
+	if want, ok := g.static[ep]; ok && want != id {
+		g.alert(guardAlert{Time: now, Kind: guardKeyChanged, ID: id, Expected: want, Addrs: []string{ep.String()}})
+	}
+}
+
+// expire 删除窗口外的记录，调用方必须持有 g.mu
+func (g *impersonationGuard) expire(now time.Time) {
+	for id, ips := range g.seen {
+		for addr, t := range ips {
+			if now.Sub(t) >= g.cfg.Window {
+				delete(ips, addr)
+			}
+		}
+		if len(ips) == 0 {
+			delete(g.seen, id)
+		}
+	}
+	for id, t := range g.suspects {
+		if now.Sub(t) >= g.cfg.Window {
+			delete(g.suspects, id)
+		}
+	}
+}
+
+// dialable 记录节点告知的可拨号端点（见 peerStore.setDialable）。g 可以为 nil
+func (g *impersonationGuard) dialable(n *enode.Node) {
+	if g == nil {
+		return
+	}
+	ep, ok := n.TCPEndpoint()
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	g.sawEndpoint(n.ID(), ep, time.Now())
+	_, suspect := g.suspects[n.ID()]
+	g.mu.Unlock()
+	// 端点在握手中才得知，此时节点已经连上
+	if suspect && g.cfg.Refuse {
+		for _, p := range g.srv.Peers() {
+			if p.ID() == n.ID() {
+				go g.connected(p)
+			}
+		}
+	}
+}
+
+// connected 检查新会话，开启 refuse 时断开有歧义的节点
+func (g *impersonationGuard) connected(p *p2p.Peer) {
+	ip, ok := addrIP(p.RemoteAddr())
+	if !ok {
+		return
+	}
+	now := time.Now()
+	g.mu.Lock()
+	g.sawAddr(p.ID(), ip, now)
+	if !p.Inbound() {
+		if ep, ok := p.Node().TCPEndpoint(); ok {
+			g.sawEndpoint(p.ID(), ep, now)
+		}
+	}
+	suspect := false
+	if t, ok := g.suspects[p.ID()]; ok && now.Sub(t) < g.cfg.Window {
+		suspect = true
+	}
+	refuse := suspect && g.cfg.Refuse && !p.Info().Network.Static
+	for i := len(g.alerts) - 1; refuse && i >= 0; i-- {
+		if g.alerts[i].ID == p.ID() {
+			g.alerts[i].Refused = true
+			break
+		}
+	}
+	g.mu.Unlock()
+	if refuse {
+		log.Printf("拒绝有歧义的节点 %s (%v)", p.ID().TerminalString(), p.RemoteAddr())
+		p.Disconnect(p2p.DiscUnexpectedIdentity)
+	}
+}
+
+// scan 检查节点发现路由表中的记录并清理过期的记录
+func (g *impersonationGuard) scan() {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire(now)
+	disc := g.srv.DiscoveryV4()
+	if disc == nil || len(g.static) == 0 {
+		return
+	}
+	for _, bucket := range disc.TableBuckets() {
+		for _, n := range bucket {
+			if ep, ok := n.Node.TCPEndpoint(); ok {
+				g.sawEndpoint(n.Node.ID(), ep, now)
+			}
+		}
+	}
+}
+
+func (g *impersonationGuard) report() []guardAlert {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]guardAlert{}, g.alerts...)
+}
+
+func (g *impersonationGuard) run() {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := g.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	tick := time.NewTicker(guardScanInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != p2p.PeerEventTypeAdd {
+				continue
+			}
+			for _, p := range g.srv.Peers() {
+				if p.ID() == ev.Peer {
+					g.connected(p)
+				}
+			}
+		case <-tick.C:
+			g.scan()
+		case <-sub.Err():
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+var errInboundReserved = errors.New("剩余名额为入站连接保留")
+
+// inboundReserve 为入站连接保留一部分名额，避免主动拨号（包括重连和目标连接数管理
+// 发起的拨号）占满所有名额，导致 NAT 后面的节点无法连接到我们
+type inboundReserve struct {
+	srv         *p2p.Server
+	maxOutbound int
+}
+
+// newInboundReserve 为入站连接保留 maxPeers 的 percent%
+func newInboundReserve(srv *p2p.Server, maxPeers, percent int) (*inboundReserve, error) {
+	if percent <= 0 || percent >= 100 {
+		return nil, fmt.Errorf("入站保留比例必须在 1-99 之间: %d", percent)
+	}
+	reserved := (maxPeers*percent + 99) / 100
+	return &inboundReserve{srv: srv, maxOutbound: maxPeers - reserved}, nil
+}
+
+// dialRatio 返回 p2p.Config.DialRatio，使调度器的动态拨号名额（srv.MaxPeers / DialRatio）
+// 不超过非保留名额。srv.MaxPeers 可能包含驱逐用的余量，比 -peers.max 大，必须按它计算
+func (r *inboundReserve) dialRatio() int {
+	maxPeers := r.srv.MaxPeers
+	if r.maxOutbound == 0 {
+		return maxPeers + 1
+	}
+	return (maxPeers + r.maxOutbound - 1) / r.maxOutbound
+}
+
+// checkDial 在出站连接数达到上限后拒绝所有拨号
+func (r *inboundReserve) checkDial() error {
+	if r == nil {
+		return nil
+	}
+	outbound := 0
+	for _, p := range r.srv.Peers() {
+		if !p.Inbound() {
+			outbound++
+		}
+	}
+	if outbound >= r.maxOutbound {
+		return errInboundReserved
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 调度器的动态拨号名额按 srv.MaxPeers / DialRatio 计算，srv.MaxPeers 包含驱逐余量时
+// 也不能超过非保留名额
+func TestInboundReserveDialRatio(t *testing.T) {
+	for _, tt := range []struct{ maxPeers, headroom, percent int }{
+		{50, 0, 30},
+		{50, evictHeadroom, 30},
+		{10, evictHeadroom, 50},
+		{3, evictHeadroom, 99},
+	} {
+		srv := &p2p.Server{Config: p2p.Config{MaxPeers: tt.maxPeers + tt.headroom}}
+		r, err := newInboundReserve(srv, tt.maxPeers, tt.percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ratio := r.dialRatio()
+		if dials := srv.MaxPeers / ratio; dials > r.maxOutbound {
+			t.Errorf("%+v: 动态拨号名额 %d 超过非保留名额 %d", tt, dials, r.maxOutbound)
+		}
+	}
+}
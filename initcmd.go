@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// initCmd 引导新用户完成首次配置：生成节点私钥、写出配置文件、检查端口和引导节点，
+// 最后打印本节点的 enode URL。默认交互式询问，-y 时直接使用参数中的值。
+func initCmd(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	keyFile := fs.String("nodekey", "nodekey", "节点私钥文件，不存在时生成")
+	out := fs.String("config", "config.json", "要写出的配置文件")
+	addr := fs.String("addr", ":30303", "监听地址")
+	boot := fs.String("bootnodes", "", "引导节点 enode URLs，逗号分隔")
+	natFlag := fs.String("nat", "any", "端口映射方式")
+	yes := fs.Bool("y", false, "不询问，直接使用参数中的值")
+	force := fs.Bool("force", false, "覆盖已存在的配置文件")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	if !*yes {
+		in := bufio.NewReader(os.Stdin)
+		fmt.Fprintln(stdout, "初始化 devp2p 演示节点，直接回车使用方括号中的默认值")
+		*keyFile = ask(in, "节点私钥文件", *keyFile)
+		*addr = ask(in, "监听地址", *addr)
+		*natFlag = ask(in, "端口映射方式 (any|none|upnp|pmp|extip:<IP>|stun)", *natFlag)
+		*boot = ask(in, "引导节点 enode URLs（逗号分隔，可以为空）", *boot)
+		*out = ask(in, "配置文件", *out)
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		log.Fatalf("配置文件 %s 已存在，使用 -force 覆盖", *out)
+	}
+	_, existed := os.Stat(*keyFile)
+	key := loadOrGenerateNodeKey(*keyFile)
+	if existed == nil {
+		fmt.Fprintf(stdout, "使用已有的节点私钥 %s\n", *keyFile)
+	} else {
+		fmt.Fprintf(stdout, "已生成节点私钥 %s\n", *keyFile)
+	}
+
+	values := map[string]string{
+		"nodekey":   *keyFile,
+		"addr":      *addr,
+		"nat":       *natFlag,
+		"bootnodes": *boot,
+	}
+	if err := writeConfigFile(*out, values); err != nil {
+		log.Fatalf("写入配置文件失败: %v", err)
+	}
+	fmt.Fprintf(stdout, "已写入配置文件 %s\n", *out)
+
+	// 检查结果只作为提示，不影响初始化
+	fmt.Fprintln(stdout, "检查监听端口...")
+	if err := probeListen(*addr); err != nil {
+		fmt.Fprintf(stdout, "  ✗ 无法绑定 %s: %v\n", *addr, err)
+	} else {
+		fmt.Fprintf(stdout, "  ✓ %s 可以绑定 (TCP/UDP)\n", *addr)
+	}
+	if nodes := parseBootnodes(*boot); len(nodes) > 0 {
+		fmt.Fprintln(stdout, "检查引导节点...")
+		for _, n := range nodes {
+			if rtt, err := probeBootnode(key, n); err != nil {
+				fmt.Fprintf(stdout, "  ✗ %s: %v\n", n.ID().TerminalString(), err)
+			} else {
+				fmt.Fprintf(stdout, "  ✓ %s 可达 (%v)\n", n.ID().TerminalString(), rtt.Round(time.Millisecond))
+			}
+		}
+	}
+
+	ip, port := net.IPv4(127, 0, 0, 1), 30303
+	if host, p, err := net.SplitHostPort(*addr); err == nil {
+		if parsed := net.ParseIP(host); parsed != nil && !parsed.IsUnspecified() {
+			ip = parsed
+		}
+		port, _ = strconv.Atoi(p)
+	}
+	if ext, ok := strings.CutPrefix(*natFlag, "extip:"); ok {
+		if parsed := net.ParseIP(ext); parsed != nil {
+			ip = parsed
+		}
+	}
+	fmt.Fprintf(stdout, "\n本节点的 enode URL（其他节点可以把它作为引导节点）:\n%s\n", enode.NewV4(&key.PublicKey, ip, port, port).URLv4())
+	fmt.Fprintf(stdout, "\n启动节点: go run . -config %s\n", *out)
+}
+
+// ask 打印提示并读取一行输入，输入为空时返回默认值
+func ask(in *bufio.Reader, prompt, def string) string {
+	fmt.Fprintf(stdout, "%s [%s]: ", prompt, def)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(stdout)
+		return def
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// 重复实例检测：同一台主机上两个进程使用同一个节点私钥或节点数据库时，它们在网络中是同一个身份，
+// 会互相顶替对方的连接（对方看到的是同一个节点 ID 反复重连），同时写坏节点数据库。启动时在
+// <nodekey>.lock 和 <nodedb>.lock 上加文件锁（进程退出后由系统释放），锁文件中记录持有者的
+// PID 和监听地址：
+//
+//   - 锁被另一个进程持有时拒绝启动（错误代码 instance），说明对方的 PID 和地址；
+//     设置了 -instance.takeover 并且对方的监听端口可以连接时，向它发送 SIGTERM，
+//     等它退出（锁被释放）后接管
+//   - 拿到了锁但锁文件中还有记录，说明上一个实例没有正常退出；记录的监听端口仍然可以连接时，
+//     可能是另一台主机或容器通过共享存储在使用同一身份（这类文件系统上的锁不一定可靠），同样拒绝启动
+//   - 否则接管锁文件，正常退出时清空记录
+const (
+	instanceProbeTimeout = time.Second
+	// -instance.takeover 等待另一个实例退出的时间，需要覆盖它的优雅关闭
+	instanceTakeoverWait = 30 * time.Second
+	instancePollInterval = 200 * time.Millisecond
+)
+
+var instanceTakeover = flag.Bool("instance.takeover", false, "另一个实例正在使用同一个节点私钥或节点数据库时，让它退出（SIGTERM）后接管，而不是拒绝启动")
+
+var errInstanceRunning = errors.New("正在被另一个实例使用")
+
+// instanceInfo 是锁文件的内容
+type instanceInfo struct {
+	PID     int       `json:"pid"`
+	Addr    string    `json:"addr,omitempty"` // P2P 监听地址
+	RPC     string    `json:"rpc,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+func (i *instanceInfo) String() string {
+	if i.PID == 0 {
+		return "PID 未知"
+	}
+	s := fmt.Sprintf("PID %d", i.PID)
+	if i.Addr != "" {
+		s += "，监听 " + i.Addr
+	}
+	if i.RPC != "" {
+		s += "，RPC " + i.RPC
+	}
+	return s + "，启动于 " + i.Started.Format(time.DateTime)
+}
+
+// instanceLock 是一个已经加锁的锁文件
+type instanceLock struct {
+	what string // 被保护的资源，用于日志
+	lock *flock.Flock
+	info instanceInfo
+}
+
+// lockInstance 为 path 处的 what（节点私钥文件或节点数据库目录）加锁，addr 为本实例的 P2P 监听地址
+func lockInstance(what, path, addr string) (*instanceLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, withCode(failStorage, err)
+	}
+	l := &instanceLock{what: what, lock: flock.New(path + ".lock")}
+	ok, err := l.lock.TryLock()
+	if err != nil {
+		return nil, withCode(failStorage, fmt.Errorf("%s 加锁失败: %v", what, err))
+	}
+	prev := readInstanceInfo(l.lock.Path())
+	if !ok {
+		if err := l.takeover(prev); err != nil {
+			return nil, err
+		}
+	} else if prev != nil && prev.PID != os.Getpid() {
+		if probeInstance(prev.Addr) {
+			l.lock.Unlock()
+			return nil, withCode(failInstance, fmt.Errorf("%s 的锁文件记录的实例（%v）已不持有锁，但它的监听端口仍然可以连接，"+
+				"可能是另一台主机或容器通过共享存储在使用同一身份；确认后删除 %s", what, prev, l.lock.Path()))
+		}
+		log.Printf("%s 的上一个实例（%v）没有正常退出，接管它留下的锁文件", what, prev)
+	}
+	l.info = instanceInfo{PID: os.Getpid(), Addr: addr, Started: time.Now()}
+	l.write()
+	return l, nil
+}
+
+// takeover 处理锁被另一个进程持有的情况：没有设置 -instance.takeover 时拒绝启动，否则让对方退出后加锁
+func (l *instanceLock) takeover(other *instanceInfo) error {
+	if other == nil {
+		// 对方刚拿到锁还没有写入记录
+		other = &instanceInfo{}
+	}
+	if !*instanceTakeover {
+		return withCode(failInstance, fmt.Errorf("%s %w（%v）：两个进程使用同一身份会互相顶替连接、写坏节点数据库，"+
+			"先停止它，或者用 -instance.takeover 接管", l.what, errInstanceRunning, other))
+	}
+	// 只在确认对方就是节点实例时发送信号，以免 PID 属于其他命名空间中无关的进程
+	if other.PID <= 0 || other.PID == os.Getpid() || !probeInstance(other.Addr) {
+		return withCode(failInstance, fmt.Errorf("%s %w（%v），但无法确认它的监听端口，不能接管", l.what, errInstanceRunning, other))
+	}
+	proc, err := os.FindProcess(other.PID)
+	if err == nil {
+		err = proc.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		return withCode(failInstance, fmt.Errorf("%s %w（%v），通知它退出失败: %v", l.what, errInstanceRunning, other, err))
+	}
+	log.Printf("%s %v（%v），已通知它退出，等待接管", l.what, errInstanceRunning, other)
+	deadline := time.Now().Add(instanceTakeoverWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(instancePollInterval)
+		if ok, err := l.lock.TryLock(); err != nil {
+			return withCode(failStorage, fmt.Errorf("%s 加锁失败: %v", l.what, err))
+		} else if ok {
+			log.Printf("已接管 %s（PID %d 已退出）", l.what, other.PID)
+			return nil
+		}
+	}
+	return withCode(failInstance, fmt.Errorf("%s 的另一个实例（PID %d）在 %v 内没有退出", l.what, other.PID, instanceTakeoverWait))
+}
+
+// setAddrs 在服务启动后更新记录中的实际监听地址。l 可以为 nil
+func (l *instanceLock) setAddrs(addr, rpc string) {
+	if l == nil {
+		return
+	}
+	l.info.Addr, l.info.RPC = addr, rpc
+	l.write()
+}
+
+func (l *instanceLock) write() {
+	data, _ := json.Marshal(&l.info)
+	// 原地写入而不是先写临时文件再重命名，锁在文件本身上
+	if err := os.WriteFile(l.lock.Path(), append(data, '\n'), 0o644); err != nil {
+		log.Printf("写入锁文件 %s 失败: %v", l.lock.Path(), err)
+	}
+}
+
+// release 在正常退出时清空记录并释放锁。锁文件本身保留，删除它会让等待中的进程锁住已删除的文件。
+// l 可以为 nil
+func (l *instanceLock) release() {
+	if l == nil {
+		return
+	}
+	if err := os.Truncate(l.lock.Path(), 0); err != nil {
+		log.Printf("清空锁文件 %s 失败: %v", l.lock.Path(), err)
+	}
+	l.lock.Unlock()
+}
+
+// readInstanceInfo 读取锁文件中的记录，文件为空或无法解析时返回 nil
+func readInstanceInfo(path string) *instanceInfo {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var info instanceInfo
+	if json.Unmarshal(data, &info) != nil {
+		return nil
+	}
+	return &info
+}
+
+// probeInstance 检查 addr 上是否有进程在监听，未指定主机时连接本机
+func probeInstance(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" || port == "0" {
+		return false
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), instanceProbeTimeout)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	interopConnectTimeout = 15 * time.Second
+	interopReplyTimeout   = 5 * time.Second
+	// 发送单向消息（对方不应答）后观察对方是否断开连接的时间
+	interopObserveWait = time.Second
+	// interop 发布 gossip 消息使用的主题，不会被正常节点处理
+	interopTopic = "interop/ping"
+)
+
+var errInteropTimeout = errors.New("等待消息超时")
+
+// interopResult 是一种消息的兼容性测试结果
+type interopResult struct {
+	Protocol string `json:"protocol"`
+	Version  uint   `json:"version"`
+	Message  string `json:"message"`
+	Result   string `json:"result"` // pass、fail 或 skip
+	Detail   string `json:"detail,omitempty"`
+}
+
+// interopRun 是对一个参考节点的测试过程。每个子协议的 Run 函数执行各自的脚本，
+// 完成后阻塞到所有脚本结束：任何一个子协议返回都会导致整个连接断开。
+type interopRun struct {
+	self  enode.ID
+	token []byte // 可选的下载令牌
+	mu    sync.Mutex
+	res   []interopResult
+	doneC chan string   // 完成脚本的子协议名
+	exit  chan struct{} // 关闭后所有子协议返回
+}
+
+func (r *interopRun) add(proto string, version uint, msg string, err error, detail string) {
+	res := interopResult{Protocol: proto, Version: version, Message: msg, Result: "pass", Detail: detail}
+	if err != nil {
+		res.Result, res.Detail = "fail", err.Error()
+	}
+	r.mu.Lock()
+	r.res = append(r.res, res)
+	r.mu.Unlock()
+}
+
+func (r *interopRun) skip(proto string, version uint, msg, detail string) {
+	r.mu.Lock()
+	r.res = append(r.res, interopResult{Protocol: proto, Version: version, Message: msg, Result: "skip", Detail: detail})
+	r.mu.Unlock()
+}
+
+func (r *interopRun) protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{Name: "chat", Version: chatVersion, Length: chatMsgCount, Run: r.wrap("chat", r.chat)},
+		{Name: "gossip", Version: gossipVersion, Length: gossipMsgCount, Run: r.wrap("gossip", r.gossip)},
+		{Name: "file", Version: fileVersion, Length: fileMsgCount, Run: r.wrap("file", r.file)},
+		{Name: "conf", Version: confVersion, Length: confMsgCount, Run: r.wrap("conf", r.conf)},
+	}
+}
+
+// interopConn 由一个 goroutine 持续读取子协议的消息，脚本按超时从 in 中取消息，
+// 超时后不会留下仍在读取的 ReadMsg
+type interopConn struct {
+	rw  p2p.MsgReadWriter
+	in  chan p2p.Msg
+	err error // in 关闭后有效
+}
+
+func newInteropConn(rw p2p.MsgReadWriter) *interopConn {
+	c := &interopConn{rw: rw, in: make(chan p2p.Msg, 16)}
+	go func() {
+		defer close(c.in)
+		for {
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				c.err = err
+				return
+			}
+			c.in <- msg
+		}
+	}()
+	return c
+}
+
+// read 在超时内读取一条消息
+func (c *interopConn) read(timeout time.Duration) (p2p.Msg, error) {
+	select {
+	case msg, ok := <-c.in:
+		if !ok {
+			return p2p.Msg{}, fmt.Errorf("对方断开连接: %v", c.err)
+		}
+		return msg, nil
+	case <-time.After(timeout):
+		return p2p.Msg{}, errInteropTimeout
+	}
+}
+
+// expect 读取一条代码为 code 的消息并解码到 val
+func (c *interopConn) expect(code uint64, val any) error {
+	msg, err := c.read(interopReplyTimeout)
+	if err == errInteropTimeout {
+		return fmt.Errorf("%v 内没有收到应答", interopReplyTimeout)
+	} else if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != code {
+		return fmt.Errorf("期望消息 %d，收到 %d", code, msg.Code)
+	}
+	if err := msg.Decode(val); err != nil {
+		return fmt.Errorf("解码失败: %v", err)
+	}
+	return nil
+}
+
+// quiet 检查对方在一段时间内没有断开连接（用于没有应答的消息），期间收到的消息被丢弃
+func (c *interopConn) quiet() error {
+	deadline := time.Now().Add(interopObserveWait)
+	for {
+		msg, err := c.read(time.Until(deadline))
+		if err == errInteropTimeout {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		msg.Discard()
+	}
+}
+
+// wrap 在脚本结束后继续丢弃收到的消息直到测试结束，避免阻塞其他子协议
+func (r *interopRun) wrap(name string, script func(p *p2p.Peer, c *interopConn) error) func(*p2p.Peer, p2p.MsgReadWriter) error {
+	return func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		c := newInteropConn(rw)
+		err := script(p, c)
+		r.doneC <- name
+		if err != nil {
+			return err
+		}
+		go func() {
+			for msg := range c.in {
+				msg.Discard()
+			}
+		}()
+		<-r.exit
+		return nil
+	}
+}
+
+func (r *interopRun) chat(p *p2p.Peer, c *interopConn) error {
+	go p2p.Send(c.rw, chatStatusMsg, &chatStatus{Version: chatVersion, Name: "interop"})
+	var theirs chatStatus
+	err := c.expect(chatStatusMsg, &theirs)
+	if err == nil && theirs.Version != chatVersion {
+		err = fmt.Errorf("%w: %d", errChatVersion, theirs.Version)
+	}
+	r.add("chat", chatVersion, "status", err, fmt.Sprintf("name=%q", theirs.Name))
+	if err != nil {
+		r.skip("chat", chatVersion, "text", "握手失败")
+		r.skip("chat", chatVersion, "goaway", "握手失败")
+		return err
+	}
+	err = p2p.Send(c.rw, chatTextMsg, encodeChatText(chatVersion, "interop 兼容性测试"))
+	if err == nil {
+		err = c.quiet()
+	}
+	r.add("chat", chatVersion, "text", err, "")
+	err = p2p.Send(c.rw, chatGoAwayMsg, &chatGoAway{Reason: "interop"})
+	if err == nil {
+		err = c.quiet()
+	}
+	r.add("chat", chatVersion, "goaway", err, "")
+	return nil
+}
+
+func (r *interopRun) gossip(p *p2p.Peer, c *interopConn) error {
+	go p2p.Send(c.rw, gossipStatusMsg, &gossipStatus{Version: gossipVersion})
+	var theirs gossipStatus
+	err := c.expect(gossipStatusMsg, &theirs)
+	if err == nil && theirs.Version != gossipVersion {
+		err = fmt.Errorf("%w: %d", errGossipVersion, theirs.Version)
+	}
+	r.add("gossip", gossipVersion, "status", err, "")
+	if err != nil {
+		r.skip("gossip", gossipVersion, "message", "握手失败")
+		return err
+	}
+	msg := &gossipMessage{Topic: interopTopic, Origin: r.self, Seq: uint64(time.Now().UnixNano()), Payload: []byte("ping")}
+	err = p2p.Send(c.rw, gossipMsg, msg)
+	if err == nil {
+		err = c.quiet()
+	}
+	r.add("gossip", gossipVersion, "message", err, "")
+	return nil
+}
+
+// conf 只检查握手和 ping/pong，保留的消息代码由运行中的节点在 -conform.every 的检查中测试，
+// 不通过时会断开整个测试连接
+func (r *interopRun) conf(p *p2p.Peer, c *interopConn) error {
+	go p2p.Send(c.rw, confStatusMsg, &confStatus{Version: confVersion})
+	var theirs confStatus
+	err := c.expect(confStatusMsg, &theirs)
+	if err == nil && theirs.Version != confVersion {
+		err = fmt.Errorf("%w: %d", errConfVersion, theirs.Version)
+	}
+	r.add("conf", confVersion, "status", err, "")
+	if err != nil {
+		r.skip("conf", confVersion, "ping", "握手失败")
+		r.skip("conf", confVersion, "ping-extra", "握手失败")
+		return err
+	}
+	extra, _ := rlp.EncodeToBytes("future")
+	for i, tail := range [][]rlp.RawValue{nil, {extra}} {
+		name := "ping"
+		if tail != nil {
+			name = "ping-extra"
+		}
+		nonce := uint64(time.Now().UnixNano()) + uint64(i)
+		err := p2p.Send(c.rw, confPingMsg, &confPing{Nonce: nonce, Rest: tail})
+		var pong confPong
+		if err == nil {
+			err = c.expect(confPongMsg, &pong)
+		}
+		if err == nil && pong.Nonce != nonce {
+			err = fmt.Errorf("pong 的 Nonce 为 %d，期望 %d", pong.Nonce, nonce)
+		}
+		r.add("conf", confVersion, name, err, "")
+	}
+	return nil
+}
+
+func (r *interopRun) file(p *p2p.Peer, c *interopConn) error {
+	const v = fileVersion
+	go p2p.Send(c.rw, fileHelloMsg, &fileHello{Version: fileVersion, Token: r.token})
+	var theirs fileHello
+	err := c.expect(fileHelloMsg, &theirs)
+	if err == nil && theirs.Version != fileVersion {
+		err = fmt.Errorf("file 协议版本不兼容: %d", theirs.Version)
+	}
+	r.add("file", v, "hello", err, "")
+	if err != nil {
+		for _, m := range []string{"list/manifest", "get/data", "getchunk/data"} {
+			r.skip("file", v, m, "握手失败")
+		}
+		return err
+	}
+
+	// 清单：对方未共享文件时应答带有错误信息，同样符合协议
+	var resp fileManifestResp
+	err = p2p.Send(c.rw, fileListMsg, &fileList{ReqID: 1})
+	if err == nil {
+		err = c.expect(fileManifestMsg, &resp)
+	}
+	switch {
+	case err == nil && resp.ReqID != 1:
+		err = fmt.Errorf("ReqID 为 %d，期望 1", resp.ReqID)
+	case err == nil && resp.Manifest != nil:
+		err = resp.Manifest.verify(p.ID())
+	}
+	detail := resp.Error
+	if err == nil && resp.Manifest != nil {
+		detail = fmt.Sprintf("%d 个文件", len(resp.Manifest.Entries))
+	}
+	r.add("file", v, "list/manifest", err, detail)
+	if err != nil {
+		r.skip("file", v, "get/data", "清单请求失败")
+		r.skip("file", v, "getchunk/data", "清单请求失败")
+		return nil
+	}
+
+	var entry manifestEntry
+	if resp.Manifest != nil && len(resp.Manifest.Entries) > 0 {
+		entry = resp.Manifest.Entries[0]
+	}
+	// 下载清单中的第一个文件并校验哈希；没有清单时请求一个不存在的路径，期望收到错误应答
+	path := entry.Path
+	if path == "" {
+		path = "interop-does-not-exist"
+	}
+	detail, err = interopGet(c, path, entry)
+	r.add("file", v, "get/data", err, detail)
+	if err != nil {
+		r.skip("file", v, "getchunk/data", "文件请求失败")
+		return nil
+	}
+
+	var chunk common.Hash
+	if len(entry.Chunks) > 0 {
+		chunk = entry.Chunks[0]
+	}
+	var data fileData
+	err = p2p.Send(c.rw, fileGetChunkMsg, &fileGetChunk{ReqID: 3, Hash: chunk})
+	if err == nil {
+		err = c.expect(fileDataMsg, &data)
+	}
+	switch {
+	case err == nil && (data.ReqID != 3 || !data.EOF):
+		err = fmt.Errorf("应答 ReqID=%d EOF=%v，期望 ReqID=3 EOF=true", data.ReqID, data.EOF)
+	case err == nil && data.Error == "" && common.Hash(sha256.Sum256(data.Data)) != chunk:
+		err = fmt.Errorf("数据块哈希不符")
+	}
+	r.add("file", v, "getchunk/data", err, data.Error)
+	return nil
+}
+
+// interopGet 请求文件直到 EOF。entry 不为空时校验内容哈希。
+func interopGet(c *interopConn, path string, entry manifestEntry) (string, error) {
+	if err := p2p.Send(c.rw, fileGetMsg, &fileGet{ReqID: 2, Path: path}); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	var size uint64
+	for {
+		var data fileData
+		if err := c.expect(fileDataMsg, &data); err != nil {
+			return "", err
+		}
+		if data.ReqID != 2 {
+			return "", fmt.Errorf("ReqID 为 %d，期望 2", data.ReqID)
+		}
+		if data.Error != "" {
+			if !data.EOF {
+				return data.Error, fmt.Errorf("错误应答没有设置 EOF")
+			}
+			if entry.Path != "" {
+				return "", fmt.Errorf("下载清单中的文件失败: %s", data.Error)
+			}
+			return data.Error, nil
+		}
+		h.Write(data.Data)
+		size += uint64(len(data.Data))
+		if data.EOF {
+			break
+		}
+	}
+	if entry.Path == "" {
+		return "", fmt.Errorf("不存在的路径 %q 返回了数据", path)
+	}
+	if size != entry.Size || common.BytesToHash(h.Sum(nil)) != entry.Hash {
+		return "", fmt.Errorf("文件内容与清单不符")
+	}
+	return fmt.Sprintf("%s %d 字节", path, size), nil
+}
+
+// interopTest 连接参考节点并运行全部脚本
+func interopTest(target *enode.Node, token []byte) ([]interopResult, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	r := &interopRun{self: enode.PubkeyToIDV4(&key.PublicKey), token: token, doneC: make(chan string, 3), exit: make(chan struct{})}
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		MaxPeers:    1,
+		NoDiscovery: true,
+		Name:        "devp2p-demo-interop/" + nodeVersion,
+		Protocols:   r.protocols(),
+	}}
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	defer srv.Stop()
+
+	events := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(events)
+	defer sub.Unsubscribe()
+	srv.AddPeer(target)
+
+	timeout := time.NewTimer(interopConnectTimeout)
+	defer timeout.Stop()
+	var caps []p2p.Cap
+	for caps == nil {
+		select {
+		case ev := <-events:
+			if ev.Peer != target.ID() {
+				continue
+			}
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				for _, p := range srv.Peers() {
+					if p.ID() == target.ID() {
+						caps = append([]p2p.Cap{}, p.Caps()...)
+					}
+				}
+			case p2p.PeerEventTypeDrop:
+				return nil, fmt.Errorf("连接被断开: %s", ev.Error)
+			}
+		case <-timeout.C:
+			return nil, fmt.Errorf("%v 内未能连接参考节点", interopConnectTimeout)
+		}
+	}
+
+	// 只有双方都支持的子协议才会运行，其余的记为 skip 并列出对方支持的版本
+	running := 0
+	for _, proto := range r.protocols() {
+		var theirs []uint
+		for _, c := range caps {
+			if c.Name == proto.Name {
+				theirs = append(theirs, c.Version)
+			}
+		}
+		switch {
+		case len(theirs) == 0:
+			r.skip(proto.Name, proto.Version, "*", "对方不支持该协议")
+		default:
+			shared := false
+			for _, v := range theirs {
+				shared = shared || v == proto.Version
+			}
+			if shared {
+				running++
+			} else {
+				r.skip(proto.Name, proto.Version, "*", fmt.Sprintf("没有共同版本，对方支持 %v", theirs))
+			}
+		}
+	}
+	for running > 0 {
+		select {
+		case <-r.doneC:
+			running--
+		case ev := <-events:
+			if ev.Type == p2p.PeerEventTypeDrop && ev.Peer == target.ID() {
+				close(r.exit)
+				// 等待已经开始的脚本记录各自的失败
+				time.Sleep(100 * time.Millisecond)
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				return r.res, fmt.Errorf("测试过程中连接被断开: %s", ev.Error)
+			}
+		case <-time.After(4 * interopReplyTimeout):
+			close(r.exit)
+			return r.res, fmt.Errorf("测试脚本超时")
+		}
+	}
+	close(r.exit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.res, nil
+}
+
+func interopCmd(args []string) {
+	fs := flag.NewFlagSet("interop", flag.ExitOnError)
+	out := fs.String("out", "", "把兼容性报告写入 JSON 文件")
+	tokenFile := fs.String("token", "", "参考节点签发的下载令牌文件（用于测试文件下载）")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法: interop [参数] <参考节点 enode URL>")
+		fs.PrintDefaults()
+	}
+	localizeFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	target, err := enode.Parse(enode.ValidSchemes, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("无效的节点 %q: %v", fs.Arg(0), err)
+	}
+	var token []byte
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if token, err = decodeToken(string(data)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results, err := interopTest(target, token)
+	// 各子协议的脚本并发执行，报告按协议分组，组内保持执行顺序
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Protocol < results[j].Protocol })
+	failed := 0
+	for _, res := range results {
+		if res.Result == "fail" {
+			failed++
+		}
+		fmt.Fprintf(stdout, "%-4s %s/%d %-14s %s\n", res.Result, res.Protocol, res.Version, res.Message, res.Detail)
+	}
+	if *out != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if err := os.WriteFile(*out, data, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
+		log.Fatalf("兼容性测试未完成: %v", err)
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d 项不兼容\n", failed)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stdout, "全部 %d 项通过或跳过\n", len(results))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 从种子确定性地派生节点私钥：同一个种子（例如助记词）和序号总是得到同一个身份，
+// 测试机群的每个节点只需要不同的 -key.index，重新构建或重新部署后身份不变，
+// 也不需要分发私钥文件。派生方式为
+//
+//	k = Keccak256(keySeedDomain || 种子 || 序号 (8 字节大端) || 计数 (4 字节大端))
+//
+// 计数从 0 开始，k 不是有效的 secp256k1 私钥时加一重试（概率约 2^-128）。
+// 种子中的连续空白视为一个空格，首尾空白被忽略，方便粘贴助记词。
+// 知道种子的人可以得到所有序号的私钥，只适合测试网络。
+const keySeedDomain = "devp2p-demo/nodekey/v1"
+
+var errEmptySeed = errors.New("种子为空")
+
+func deriveNodeKey(seed string, index uint64) (*ecdsa.PrivateKey, error) {
+	seed = strings.Join(strings.Fields(seed), " ")
+	if seed == "" {
+		return nil, errEmptySeed
+	}
+	buf := make([]byte, 0, len(keySeedDomain)+len(seed)+12)
+	buf = append(buf, keySeedDomain...)
+	buf = append(buf, seed...)
+	buf = binary.BigEndian.AppendUint64(buf, index)
+	for counter := uint32(0); ; counter++ {
+		key, err := crypto.ToECDSA(crypto.Keccak256(binary.BigEndian.AppendUint32(buf, counter)))
+		if err == nil {
+			return key, nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// file 协议的收支记录：按节点统计我们发给对方和从对方收到的文件数据字节数，断开重连后继续累计。
+// 开启 -file.tft（以牙还牙）后，从我们这里下载超过 -file.tft.free 免费额度、但回馈的数据
+// 不到下载量 -file.tft.ratio 倍的节点被限速到 -file.tft.rate（通过公平调度的令牌桶），
+// 对方开始回馈数据后自动解除，演示 devp2p 上的激励机制。
+const (
+	evPeerThrottled   = "peer.throttled"
+	evPeerUnthrottled = "peer.unthrottled"
+
+	ledgerIdle = 24 * time.Hour // 这么长时间没有收发数据的节点被删除
+)
+
+type tftConfig struct {
+	Enabled bool
+	Free    uint64  // 免费额度（字节）
+	Ratio   float64 // 回馈不到下载量的这个倍数时限速
+	Rate    float64 // 限速后的速率（字节/秒）
+}
+
+// ledgerEntry 是 admin_fileBalances 中一个节点的收支
+type ledgerEntry struct {
+	ID        enode.ID  `json:"id"`
+	Sent      uint64    `json:"sent"`     // 我们发给对方的字节数
+	Received  uint64    `json:"received"` // 对方发给我们的字节数
+	Balance   int64     `json:"balance"`  // Received - Sent，负数表示对方欠我们
+	Ratio     float64   `json:"ratio"`    // Received / Sent
+	Throttled bool      `json:"throttled"`
+	Last      time.Time `json:"last"`
+}
+
+// fileLedger 记录每个节点的收支
+type fileLedger struct {
+	cfg    tftConfig
+	events *eventBus
+
+	mu    sync.Mutex
+	peers map[enode.ID]*ledgerEntry
+}
+
+func newFileLedger(cfg tftConfig, events *eventBus) *fileLedger {
+	return &fileLedger{cfg: cfg, events: events, peers: make(map[enode.ID]*ledgerEntry)}
+}
+
+// entry 返回节点的记录，调用方必须持有 l.mu
+func (l *fileLedger) entry(id enode.ID, now time.Time) *ledgerEntry {
+	e := l.peers[id]
+	if e == nil {
+		for other, old := range l.peers {
+			if now.Sub(old.Last) >= ledgerIdle {
+				delete(l.peers, other)
+			}
+		}
+		e = &ledgerEntry{ID: id}
+		l.peers[id] = e
+	}
+	e.Last = now
+	return e
+}
+
+// poor 返回节点是否回馈太少，调用方必须持有 l.mu
+func (l *fileLedger) poor(e *ledgerEntry) bool {
+	return l.cfg.Enabled && e.Sent > l.cfg.Free && float64(e.Received) < l.cfg.Ratio*float64(e.Sent)
+}
+
+// update 记录收发的字节数，限速状态变化时记录日志和事件
+func (l *fileLedger) update(id enode.ID, sent, received int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	e := l.entry(id, time.Now())
+	was := e.Throttled
+	e.Sent += uint64(sent)
+	e.Received += uint64(received)
+	e.Throttled = l.poor(e)
+	now, s, r := e.Throttled, e.Sent, e.Received
+	l.mu.Unlock()
+	if was == now {
+		return
+	}
+	detail := fmt.Sprintf("sent=%d received=%d", s, r)
+	if now {
+		log.Printf("节点 %s 下载了 %d 字节但只回馈了 %d 字节，限速到 %s", id.TerminalString(), s, r, formatBitRate(l.cfg.Rate*8))
+		l.events.emit(evPeerThrottled, id, detail)
+	} else {
+		log.Printf("节点 %s 的回馈已足够，解除限速", id.TerminalString())
+		l.events.emit(evPeerUnthrottled, id, detail)
+	}
+}
+
+func (l *fileLedger) sent(id enode.ID, n int)     { l.update(id, n, 0) }
+func (l *fileLedger) received(id enode.ID, n int) { l.update(id, 0, n) }
+
+// rate 返回节点被限速后的速率，0 表示不限速。l 可以为 nil
+func (l *fileLedger) rate(id enode.ID) float64 {
+	if l == nil || !l.cfg.Enabled {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e := l.peers[id]; e != nil && e.Throttled {
+		return l.cfg.Rate
+	}
+	return 0
+}
+
+func (l *fileLedger) balances() []ledgerEntry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]ledgerEntry, 0, len(l.peers))
+	for _, e := range l.peers {
+		c := *e
+		c.Balance = int64(c.Received) - int64(c.Sent)
+		if c.Sent > 0 {
+			c.Ratio = float64(c.Received) / float64(c.Sent)
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Balance < list[j].Balance })
+	return list
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 端口冲突时回退：设置 -addr.fallback 后，如果 -addr 的 TCP 或 UDP 端口已被占用，改用同一主机上
+// 一个随机的空闲端口（TCP 和 UDP 相同）启动，而不是直接退出。节点记录中的端口由 p2p.Server 按实际
+// 监听的端口设置，admin_listenPort 返回实际使用的端口，在 CI 中同时运行很多实例时不必为每个实例分配端口。
+// 检查端口和启动服务器之间端口仍可能被别的进程抢走，这时照常启动失败。
+var addrFallback = flag.Bool("addr.fallback", false, "-addr 的端口被占用时改用随机的空闲端口，而不是启动失败")
+
+// 寻找 TCP 和 UDP 都空闲的随机端口的最大尝试次数
+const listenFallbackTries = 10
+
+// listenPortInfo 是 admin_listenPort 的返回值
+type listenPortInfo struct {
+	Configured string `json:"configured"` // -addr
+	Addr       string `json:"addr"`       // 实际监听的地址
+	TCP        int    `json:"tcp"`
+	UDP        int    `json:"udp,omitempty"` // 关闭节点发现时为 0
+	Fallback   bool   `json:"fallback"`
+	Reason     string `json:"reason,omitempty"` // 回退的原因
+}
+
+// chooseListenAddr 返回启动时使用的监听地址：addr 可以绑定或没有设置 fallback 时原样返回，
+// 否则返回同一主机上随机的空闲端口和 addr 不能使用的原因
+func chooseListenAddr(addr string, fallback bool) (chosen, reason string, err error) {
+	busy := probeListen(addr)
+	if busy == nil || !fallback {
+		return addr, "", nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+	for range listenFallbackTries {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+		if err != nil {
+			return "", "", err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		// 随机的 TCP 端口对应的 UDP 端口不一定空闲
+		candidate := net.JoinHostPort(host, strconv.Itoa(port))
+		if probeListen(candidate) == nil {
+			return candidate, busy.Error(), nil
+		}
+	}
+	return "", "", fmt.Errorf("%v，尝试 %d 次都没有找到 TCP 和 UDP 都空闲的端口", busy, listenFallbackTries)
+}
+
+func newListenPortInfo(srv *p2p.Server, configured, reason string) *listenPortInfo {
+	info := &listenPortInfo{Configured: configured, Addr: srv.ListenAddr, UDP: srv.Self().UDP(), Fallback: reason != "", Reason: reason}
+	if _, port, err := net.SplitHostPort(srv.ListenAddr); err == nil {
+		info.TCP, _ = strconv.Atoi(port)
+	}
+	return info
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 就近连接：-peers.local 为附近的节点保留一部分名额，改善 chat 等演示协议的交互延迟，其余名额
+// 留给其他节点以保持网络的多样性。TCP 建连时间（约为一次往返）不超过 -peers.local.rtt，或者按
+// -asn.db 查到的国家是 -peers.local.country 的节点算作附近的节点。
+//
+// 还没有测量过的节点在拨号时先建立 TCP 连接测出往返时间再决定：附近的名额未满时接受附近的节点，
+// 其他名额未满时接受其他节点，否则关闭连接。只限制节点发现找到的节点，重连、静态节点和入站连接
+// 不受影响，但占用名额。附近的节点不够时附近的名额会空着。
+var (
+	peersLocal        = flag.Int("peers.local", 0, "为附近的节点（见 -peers.local.rtt、-peers.local.country）保留的名额百分比，其余名额留给其他节点，0 表示不考虑位置")
+	peersLocalRTT     = flag.Duration("peers.local.rtt", 50*time.Millisecond, "TCP 建连时间（约为一次往返）不超过这个值的节点算作附近的节点")
+	peersLocalCountry = flag.String("peers.local.country", "", "这个国家代码（例如 DE）的节点也算作附近的节点，按 -asn.db 查询")
+)
+
+var (
+	errLocalFull   = errors.New("附近节点的名额已满")
+	errFarReserved = errors.New("剩余名额为附近的节点保留")
+)
+
+const (
+	// 测量结果保留的时间，之后重新测量
+	localityRTTExpiry = 24 * time.Hour
+	// 最多保留的测量结果数
+	localityMaxRTT = 4096
+)
+
+type localitySample struct {
+	rtt time.Duration
+	at  time.Time
+}
+
+// localityPolicy 按位置分配动态拨号的名额
+type localityPolicy struct {
+	srv       *p2p.Server
+	nearSlots int
+	farSlots  int
+	maxRTT    time.Duration
+	country   string
+	db        *asnDB // 为 nil 时不按国家判断
+
+	mu  sync.Mutex
+	rtt map[enode.ID]localitySample
+}
+
+// localityPeer 是 admin_locality 中一个已连接的节点
+type localityPeer struct {
+	ID      enode.ID      `json:"id"`
+	RTT     time.Duration `json:"rtt,omitempty"` // 没有测量过时为 0
+	Country string        `json:"country,omitempty"`
+	Near    bool          `json:"near"`
+}
+
+// localityStatus 是 admin_locality 的返回值
+type localityStatus struct {
+	NearSlots int            `json:"nearSlots"`
+	FarSlots  int            `json:"farSlots"`
+	Near      int            `json:"near"`
+	Far       int            `json:"far"`
+	MaxRTT    time.Duration  `json:"maxRtt"`
+	Country   string         `json:"country,omitempty"`
+	Peers     []localityPeer `json:"peers"`
+}
+
+// newLocalityPolicy 为附近的节点保留 maxPeers 的 percent%
+func newLocalityPolicy(srv *p2p.Server, maxPeers, percent int, maxRTT time.Duration, country string, db *asnDB) (*localityPolicy, error) {
+	if percent <= 0 || percent >= 100 {
+		return nil, fmt.Errorf("附近节点的名额比例必须在 1-99 之间: %d", percent)
+	}
+	if country != "" && db == nil {
+		return nil, errors.New("按国家判断附近的节点需要 -asn.db")
+	}
+	near := (maxPeers*percent + 99) / 100
+	return &localityPolicy{
+		srv:       srv,
+		nearSlots: near,
+		farSlots:  maxPeers - near,
+		maxRTT:    maxRTT,
+		country:   strings.ToUpper(country),
+		db:        db,
+		rtt:       make(map[enode.ID]localitySample),
+	}, nil
+}
+
+// countryOf 返回 ip 所属的国家代码，查不到时为空
+func (l *localityPolicy) countryOf(ip netip.Addr) string {
+	if l.db == nil {
+		return ""
+	}
+	if r := l.db.lookup(ip); r != nil {
+		return r.country
+	}
+	return ""
+}
+
+// classify 返回节点是否在附近，known 为 false 表示还不知道
+func (l *localityPolicy) classify(id enode.ID, ip netip.Addr) (near, known bool) {
+	if l.country != "" && ip.IsValid() && l.countryOf(ip) == l.country {
+		return true, true
+	}
+	l.mu.Lock()
+	s, ok := l.rtt[id]
+	l.mu.Unlock()
+	if !ok || time.Since(s.at) > localityRTTExpiry {
+		return false, false
+	}
+	return s.rtt <= l.maxRTT, true
+}
+
+// counts 返回已连接的附近节点和其他节点的数量
+func (l *localityPolicy) counts() (near, far int) {
+	for _, p := range l.srv.Peers() {
+		ip, _ := addrIP(p.RemoteAddr())
+		if n, _ := l.classify(p.ID(), ip); n {
+			near++
+		} else {
+			far++
+		}
+	}
+	return near, far
+}
+
+// admit 判断类别为 near 的节点能否占用一个名额
+func (l *localityPolicy) admit(near bool) error {
+	nearCount, farCount := l.counts()
+	if near && nearCount >= l.nearSlots {
+		return errLocalFull
+	}
+	if !near && farCount >= l.farSlots {
+		return errFarReserved
+	}
+	return nil
+}
+
+// checkDial 在拨号前用已知的位置检查名额，返回 false 表示需要建立 TCP 连接后再判断
+func (l *localityPolicy) checkDial(n *enode.Node) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+	ip, _ := netip.AddrFromSlice(n.IP())
+	near, known := l.classify(n.ID(), ip.Unmap())
+	if !known {
+		return false, nil
+	}
+	return true, l.admit(near)
+}
+
+// dialed 记录 TCP 建连时间，checked 为 false 时按测量结果检查名额，不能接受时关闭连接
+func (l *localityPolicy) dialed(n *enode.Node, fd net.Conn, rtt time.Duration, checked bool) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if len(l.rtt) >= localityMaxRTT {
+		for id, s := range l.rtt {
+			if time.Since(s.at) > localityRTTExpiry || len(l.rtt) >= localityMaxRTT {
+				delete(l.rtt, id)
+			}
+		}
+	}
+	l.rtt[n.ID()] = localitySample{rtt: rtt, at: time.Now()}
+	l.mu.Unlock()
+	if checked {
+		return nil
+	}
+	if err := l.admit(rtt <= l.maxRTT); err != nil {
+		fd.Close()
+		return fmt.Errorf("%w (建连 %v)", err, rtt.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// status 返回名额的使用情况，附近的节点排在前面
+func (l *localityPolicy) status() *localityStatus {
+	if l == nil {
+		return nil
+	}
+	st := &localityStatus{NearSlots: l.nearSlots, FarSlots: l.farSlots, MaxRTT: l.maxRTT, Country: l.country, Peers: []localityPeer{}}
+	for _, p := range l.srv.Peers() {
+		ip, _ := addrIP(p.RemoteAddr())
+		lp := localityPeer{ID: p.ID(), Country: l.countryOf(ip)}
+		lp.Near, _ = l.classify(p.ID(), ip)
+		l.mu.Lock()
+		if s, ok := l.rtt[p.ID()]; ok {
+			lp.RTT = s.rtt
+		}
+		l.mu.Unlock()
+		if lp.Near {
+			st.Near++
+		} else {
+			st.Far++
+		}
+		st.Peers = append(st.Peers, lp)
+	}
+	sort.Slice(st.Peers, func(i, j int) bool {
+		a, b := st.Peers[i], st.Peers[j]
+		if a.Near != b.Near {
+			return a.Near
+		}
+		return a.RTT < b.RTT
+	})
+	return st
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 日志语言：-log.lang en（或环境变量 DEMO_LOG_LANG=en）时把日志翻译为英文，方便不读中文的运维人员
+// 和按英文关键字编写的运维手册、告警规则。代码中的日志仍然用中文写，标准库 log 的输出经过
+// logTranslator，按 logCatalogEN 中的格式字符串匹配每一行并换成英文，参数本身（例如嵌在日志中的
+// 错误消息）也会再翻译一次。目录中没有的日志原样输出。子命令在终端上的输出（写入 stdout 和 stderr）、
+// 子命令列表和所有参数的帮助文字按同一个目录翻译。子命令不解析 -log.lang，只读取环境变量。
+// 摘要报告等写入文件的内容和 RPC 的返回值不翻译。
+const logLangEnv = "DEMO_LOG_LANG"
+
+// stdout 和 stderr 是子命令输出文字的位置，选择英文时经过翻译
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// langTranslator 是当前语言的翻译，为 nil 时不翻译
+var langTranslator *logTranslator
+
+var logLang = flag.String("log.lang", "", "日志语言: zh|en，默认读取环境变量 "+logLangEnv+"，都没有设置时为 zh")
+
+// logLangs 是可选的日志语言和对应的翻译目录，zh 不需要翻译
+var logLangs = map[string]map[string]string{
+	"zh": nil,
+	"en": logCatalogEN,
+}
+
+// logDateLen 是标准库 log 默认的 "2006/01/02 15:04:05 " 前缀的长度
+const logDateLen = len("2006/01/02 15:04:05 ")
+
+// setLogLang 切换日志语言，lang 为空时不做改变
+func setLogLang(lang string) error {
+	if lang == "" {
+		return nil
+	}
+	catalog, ok := logLangs[lang]
+	if !ok {
+		return fmt.Errorf("未知的日志语言 %q，可选 zh|en", lang)
+	}
+	if catalog == nil {
+		log.SetOutput(os.Stderr)
+		stdout, stderr, langTranslator = os.Stdout, os.Stderr, nil
+		return nil
+	}
+	langTranslator = newLogTranslator(os.Stderr, catalog)
+	log.SetOutput(langTranslator)
+	stdout = &textTranslator{out: os.Stdout, t: langTranslator}
+	stderr = &textTranslator{out: os.Stderr, t: langTranslator}
+	localizeFlags(flag.CommandLine)
+	return nil
+}
+
+// localizeFlags 把参数的帮助文字换成当前语言，子命令在定义完参数、解析之前调用
+func localizeFlags(fs *flag.FlagSet) {
+	if langTranslator == nil {
+		return
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		f.Usage = langTranslator.translateText(f.Usage)
+	})
+	fs.SetOutput(stderr)
+}
+
+// commandUsage 返回子命令的说明
+func commandUsage(usage string) string {
+	if langTranslator == nil {
+		return usage
+	}
+	return langTranslator.translateText(usage)
+}
+
+// logPattern 是一个格式字符串对应的匹配规则
+type logPattern struct {
+	prefix  string // 第一个格式动词之前的文字，用于快速排除
+	literal int    // 格式字符串中文字的长度，越长越优先匹配
+	re      *regexp.Regexp
+	to      string
+}
+
+// logTranslator 逐行翻译标准库 log 的输出
+type logTranslator struct {
+	out      io.Writer
+	patterns []*logPattern
+}
+
+func newLogTranslator(out io.Writer, catalog map[string]string) *logTranslator {
+	t := &logTranslator{out: out}
+	for from, to := range catalog {
+		t.patterns = append(t.patterns, compileLogPattern(from, to))
+	}
+	// 文字多的格式更具体，先匹配，避免 "%s: %v" 这样的格式抢先匹配
+	sort.Slice(t.patterns, func(i, j int) bool {
+		a, b := t.patterns[i], t.patterns[j]
+		if a.literal != b.literal {
+			return a.literal > b.literal
+		}
+		return a.re.String() < b.re.String()
+	})
+	return t
+}
+
+// logVerb 匹配格式动词，包括 %[n]v 形式的参数序号
+var logVerb = regexp.MustCompile(`%(?:%|(?:\[(\d+)\])?[-+# 0]*\d*(?:\.\d+)?[a-zA-Z])`)
+
+// compileLogPattern 把格式字符串转换为正则表达式，每个格式动词匹配任意文字
+func compileLogPattern(from, to string) *logPattern {
+	p := &logPattern{to: to}
+	var re strings.Builder
+	re.WriteString(`(?s)^`)
+	last, first := 0, true
+	for _, loc := range logVerb.FindAllStringIndex(from, -1) {
+		text := from[last:loc[0]]
+		re.WriteString(regexp.QuoteMeta(text))
+		p.literal += len(text)
+		if verb := from[loc[0]:loc[1]]; verb == "%%" {
+			re.WriteString("%")
+			p.literal++
+		} else {
+			if first {
+				p.prefix = strings.ReplaceAll(from[:loc[0]], "%%", "%")
+				first = false
+			}
+			re.WriteString("(.*?)")
+		}
+		last = loc[1]
+	}
+	re.WriteString(regexp.QuoteMeta(from[last:]) + "$")
+	p.literal += len(from) - last
+	if first {
+		p.prefix = strings.ReplaceAll(from, "%%", "%")
+	}
+	p.re = regexp.MustCompile(re.String())
+	return p
+}
+
+// translate 翻译一条消息，depth 限制参数的递归翻译层数
+func (t *logTranslator) translate(msg string, depth int) string {
+	for _, p := range t.patterns {
+		if !strings.HasPrefix(msg, p.prefix) {
+			continue
+		}
+		m := p.re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		args := m[1:]
+		if depth > 0 {
+			for i, a := range args {
+				// %-14s 这样带宽度的参数会带上空格，翻译去掉空格后的文字
+				trimmed := strings.Trim(a, " ")
+				if trimmed == "" {
+					continue
+				}
+				at := strings.Index(a, trimmed)
+				args[i] = a[:at] + t.translate(trimmed, depth-1) + a[at+len(trimmed):]
+			}
+		}
+		return renderLogPattern(p.to, args)
+	}
+	return msg
+}
+
+// renderLogPattern 把参数按格式动词的位置（或 %[n] 指定的序号）填入英文格式
+func renderLogPattern(format string, args []string) string {
+	var sb strings.Builder
+	last, next := 0, 0
+	for _, m := range logVerb.FindAllStringSubmatchIndex(format, -1) {
+		sb.WriteString(format[last:m[0]])
+		last = m[1]
+		if format[m[0]:m[1]] == "%%" {
+			sb.WriteByte('%')
+			continue
+		}
+		if m[2] >= 0 {
+			n, _ := strconv.Atoi(format[m[2]:m[3]])
+			next = n - 1
+		}
+		if next >= 0 && next < len(args) {
+			sb.WriteString(args[next])
+		}
+		next++
+	}
+	sb.WriteString(format[last:])
+	return sb.String()
+}
+
+// translateText 翻译不是格式字符串的文字，目录中的 %% 对应文字中的 %
+func (t *logTranslator) translateText(s string) string {
+	return t.translate(s, 0)
+}
+
+// textTranslator 翻译 fmt.Fprint* 的输出，每次写入是一次调用格式化的完整文字
+type textTranslator struct {
+	out io.Writer
+	t   *logTranslator
+}
+
+func (w *textTranslator) Write(b []byte) (int, error) {
+	trimmed := bytes.TrimRight(b, "\n")
+	text := w.t.translate(string(trimmed), 2) + string(b[len(trimmed):])
+	if _, err := io.WriteString(w.out, text); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Write 实现 io.Writer，标准库 log 每次调用写入完整的一条日志
+func (t *logTranslator) Write(b []byte) (int, error) {
+	if len(b) <= logDateLen {
+		return t.out.Write(b)
+	}
+	msg := string(bytes.TrimSuffix(b[logDateLen:], []byte("\n")))
+	line := string(b[:logDateLen]) + t.translate(msg, 2) + "\n"
+	if _, err := io.WriteString(t.out, line); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,841 @@
+package main
+
+// logCatalogEN 是日志、错误消息、子命令输出和参数帮助的英文翻译，键是代码中的格式字符串，不是格式字符串的
+// 文字中的 % 写成 %%。新增中文文字时在这里补上英文，参数的顺序不同时用 %[n]v 指定，见 loglang.go
+var logCatalogEN = map[string]string{
+	// abtest.go
+	"A/B 实验身份 %s: %s 名称 %q ENR %v": "A/B experiment identity %s: %s name %q ENR %v",
+	"A/B 实验 %s: 当前 %d 个节点，累计 %d 个 (入站 %d 出站 %d)，每小时 %.1f 个，平均会话 %v": "A/B experiment %s: %d peers now, %d total (inbound %d outbound %d), %.1f per hour, average session %v",
+	"不连接 A/B 实验中的另一个身份":           "not connecting to the other identity of the A/B experiment",
+	"无效的 ENR 条目 %q，格式为 key=value": "invalid ENR entry %q, expected key=value",
+	"ENR 条目 %q 由节点自己维护，不能修改":      "ENR entry %q is maintained by the node itself and cannot be changed",
+
+	// affinity.go
+	"重启后先重拨 %d 个历史上最稳定的节点":            "redialing the %d historically most stable peers after restart",
+	"历史节点重拨结束：%d 个中连上了 %d 个，第一个用时 %v": "historical peer redial finished: connected %d of %d, first after %v",
+	"重启后在节点发现之前先重拨的历史节点数（按有用的会话数和累计连接时长排名，需要 -peers.history），0 表示不重拨": "number of historical peers to redial after restart before node discovery (ranked by useful sessions and total connected time, requires -peers.history), 0 disables redialing",
+
+	// asn.go
+	"%s:%d: 无效的记录": "%s:%d: invalid record",
+
+	// asn_minimal.go
+	"minimal 构建不包含 ASN 数据库 (-asn.db)": "the minimal build does not include the ASN database (-asn.db)",
+
+	// bandwidth.go
+	"可用带宽 %s 低于 %s，暂停处理协议 %s 的消息": "available bandwidth %s is below %s, pausing protocol %s messages",
+	"可用带宽恢复到 %s，恢复处理协议 %s 的消息":    "available bandwidth recovered to %s, resuming protocol %s messages",
+	"无效的带宽 %q": "invalid bandwidth %q",
+	"无效的带宽 %q，单位为 bit、kbit、mbit 或 gbit": "invalid bandwidth %q, unit must be bit, kbit, mbit or gbit",
+	"无效的带宽规则 %q，格式为 proto<rate":         "invalid bandwidth rule %q, expected proto<rate",
+	"带宽规则中的协议 %s 不存在":                   "protocol %s in bandwidth rule does not exist",
+	"协议 %s: %v":                         "protocol %s: %v",
+
+	// blackhole.go
+	"节点发现已恢复：收到 %d/%d 个 pong，此前 %v 没有任何 UDP 回应": "discovery recovered: received %d/%d pongs after %v without any UDP reply",
+	"警告：%v 内发出的 %d 个节点发现 ping 没有收到任何回应":         "warning: none of the %[2]d discovery pings sent within %[1]v got a reply",
+	"UDP 出站（或回程）很可能被防火墙丢弃，节点将无法发现新的对等节点，":       "outbound UDP (or the return path) is probably dropped by a firewall; the node will not discover new peers,",
+	"请检查 UDP 端口 %s 的出入站规则":                      "check inbound and outbound rules for UDP port %s",
+
+	// bootnode.go
+	"-watch.window、-watch.subnet、-watch.malformed 必须大于 0，-watch.endpoints 至少为 2": "-watch.window, -watch.subnet and -watch.malformed must be greater than 0, -watch.endpoints at least 2",
+	"加载引导节点私钥失败: %v":                         "failed to load bootnode key: %v",
+	"打开告警文件失败: %v":                           "failed to open alert file: %v",
+	"[watch] %s %s: %d 个 (窗口 %v) %s 抑制 %d 次": "[watch] %s %s: %d (window %v) %s suppressed %d times",
+	"无效的监听地址: %v":                            "invalid listen address: %v",
+	"监听 UDP 失败: %v":                          "failed to listen on UDP: %v",
+	"打开节点数据库失败: %v":                          "failed to open node database: %v",
+	"无效的 -extip: %q":                         "invalid -extip: %q",
+	"启动节点发现数据包推送失败: %v":                      "failed to start discovery packet firehose: %v",
+	"启动节点发现失败: %v":                           "failed to start discovery: %v",
+	"引导节点已启动: %s":                            "bootnode started: %s",
+	"关闭引导节点...":                              "shutting down bootnode...",
+	"UDP 监听地址":                               "UDP listen address",
+	"引导节点私钥文件，不存在时自动生成":                      "bootnode private key file, generated if missing",
+	"节点数据库目录，为空时只保存在内存中":                     "node database directory, kept in memory only if empty",
+	"在节点记录中公告的外部 IP":                         "external IP announced in the node record",
+	"异常检测的统计窗口":                              "statistics window for anomaly detection",
+	"每个窗口内来自同一子网的数据包数告警阈值":                   "alert threshold for packets from the same subnet per window",
+	"每个窗口内格式错误的数据包数告警阈值":                     "alert threshold for malformed packets per window",
+	"每个窗口内同一节点 ID 的不同 IP 数告警阈值":              "alert threshold for distinct IPs of the same node ID per window",
+	"同一告警的最短间隔":                              "minimum interval between repeats of the same alert",
+	"以 JSON 行追加写入告警的文件，为空时只写日志":              "file to append alerts to as JSON lines, log only if empty",
+	"通过 WebSocket 推送解析后的节点发现数据包的监听地址（discv4_subscribe），为空时不开启": "listen address for pushing decoded discovery packets over WebSocket (discv4_subscribe), disabled if empty",
+
+	// budget.go
+	"该节点在当前窗口内的重试次数已用完": "retry budget for this node is exhausted in the current window",
+
+	// capspin.go
+	"断开节点 %s：要求 %s，对方通告的能力为 %v": "disconnecting %s: requires %s, peer advertised %v",
+	"能力版本要求: %v":                "capability version requirements: %v",
+	"无效的能力版本 %q，格式为 协议/版本":      "invalid capability version %q, expected proto/version",
+	"协议 %s 重复出现":                "protocol %s listed more than once",
+
+	// chat.go
+	"握手阶段收到意外消息 %d":         "unexpected message %d during handshake",
+	"消息过大: %d":              "message too large: %d",
+	"[chat] %s: %s (延迟 %v)": "[chat] %s: %s (latency %v)",
+	"未知的消息代码 %d":            "unknown message code %d",
+	"节点 %s 即将下线 (%s)，推荐了 %d 个替代节点，加入拨号候选 %d 个": "peer %s is going offline (%s), recommended %d replacement peers, %d queued as dial candidates",
+	"发送下线通知超时":     "timed out sending goodbye notice",
+	"chat 协议版本不兼容": "incompatible chat protocol version",
+
+	// checkconfig.go
+	"无效的 IP 地址 %q": "invalid IP address %q",
+	"无效的端口 %q":     "invalid port %q",
+	"发现 %d 个问题":    "found %d problems",
+	"配置检查通过":       "configuration check passed",
+
+	// chunkstore.go
+	"数据块内容与哈希不符": "chunk content does not match its hash",
+
+	// commands.go
+	"必须指定 -holder": "-holder is required",
+	"无效的持有者: %v":   "invalid holder: %v",
+	"加载节点密钥失败: %v": "failed to load node key: %v",
+	"签发令牌失败: %v":   "failed to issue token: %v",
+	"运行只提供节点发现的引导节点，监视并告警异常流量（子网突发、畸形数据包、节点 ID 冲突）": "run a discovery-only bootnode that monitors and alerts on abnormal traffic (subnet bursts, malformed packets, node ID conflicts)",
+	"检查节点参数（与启动节点时相同）但不启动节点，发现问题时退出码为 1":            "check node flags (same as when starting the node) without starting it, exit code 1 if problems are found",
+	"只做 RLPx 握手和 Hello 交换，按实现特征为节点聚类（不依赖客户端名称）":     "perform only the RLPx handshake and Hello exchange and cluster nodes by implementation traits (independent of client name)",
+	"首次运行向导：生成节点私钥和配置文件，检查端口与引导节点":                  "first-run wizard: generate a node key and config file, check ports and bootnodes",
+	"连接参考节点，按脚本交换所有演示协议的消息并输出逐项的兼容性报告":              "connect to a reference node, exchange scripted messages of all demo protocols and print an itemized compatibility report",
+	"为节点签发文件下载令牌": "issue a file download token for a node",
+	"用管理员私钥签发运营者控制命令（暂停 gossip、全网断开节点、关闭节点），通过 admin_control 发布": "sign operator control commands with the admin key (pause gossip, drop a peer network-wide, shut down nodes), published via admin_control",
+	"运行机群协调者：接收节点登记和心跳，在 /nodes 提供在线节点清单":                        "run the fleet coordinator: accept node registrations and heartbeats, serve the list of online nodes at /nodes",
+	"通过 discv4 爬取网络中的节点记录，带有限速和 nocrawl 排除等礼貌控制":                 "crawl node records over discv4, with politeness controls such as rate limits and nocrawl exclusion",
+	"查看节点发现的数据库：inspect 列出节点记录和存活统计，stats 汇总大小和按最近 pong 时间的分布":   "inspect the discovery database: inspect lists node records and liveness stats, stats summarizes size and the distribution by last pong time",
+	"运行环境自检：端口、NAT、引导节点、时钟和节点数据库":                                "self-check the environment: ports, NAT, bootnodes, clock and node database",
+	"输出协议状态机的转换图（Graphviz DOT 格式），用于文档":                          "print the protocol state machine transition graph (Graphviz DOT) for documentation",
+	"输出或校验所有协议消息的标准 RLP 编码（供其他语言的实现做兼容性测试）":                      "print or verify the canonical RLP encoding of all protocol messages (for compatibility tests of other implementations)",
+	"未知的子命令 %q，可用的子命令:":                                          "unknown subcommand %q, available subcommands:",
+	"签发令牌的节点私钥文件，需与提供文件的节点一致":                                    "node key file used to sign the token, must match the node serving the files",
+	"令牌持有者的节点 ID 或 enode URL":                                    "node ID or enode URL of the token holder",
+	"令牌有效期": "token lifetime",
+
+	// compress.go
+	"解压失败: %v": "decompression failed: %v",
+	"未知的压缩算法":  "unknown compression algorithm",
+
+	// compress_minimal.go
+	"minimal 构建不包含 zstd 压缩，使用 -compress none": "the minimal build does not include zstd compression, use -compress none",
+
+	// config.go
+	"解析配置文件 %s 失败: %v":             "failed to parse config file %s: %v",
+	"配置文件 %s: 未知的参数 %q":            "config file %s: unknown flag %q",
+	"配置文件 %s: 参数 %q: %v":           "config file %s: flag %q: %v",
+	"配置文件 (JSON，参数名到值的映射)，命令行参数优先": "config file (JSON, map of flag names to values), command line flags take precedence",
+
+	// conform.go
+	"conf 协议版本不兼容":            "incompatible conf protocol version",
+	"连接已断开":                   "connection closed",
+	"收到保留的消息代码后断开了连接":         "disconnected after receiving a reserved message code",
+	"%v 内没有收到 pong":           "no pong within %v",
+	"收到保留的消息代码后没有应答 ping: %v": "no ping reply after a reserved message code: %v",
+	"节点 %s 没有通过一致性检查 %s: %s":  "peer %s failed conformance check %s: %s",
+	"每隔多久对支持 conf 协议的节点做一次一致性检查（ping 应答、未知字段、保留的消息代码），0 表示只应答不检查": "how often to run conformance checks against peers supporting the conf protocol (ping replies, unknown fields, reserved message codes), 0 only answers without checking",
+	"一致性检查中 ping 的应答时限": "reply deadline for pings in conformance checks",
+
+	// content.go
+	"扫描共享目录失败: %v":     "failed to scan shared directory: %v",
+	"公告新共享的内容 %s (%x)": "announcing newly shared content %s (%x)",
+
+	// control.go
+	"drop-peer 缺少目标节点":                                  "drop-peer is missing the target node",
+	"拒绝连接的时间超过 %v":                                      "refusal period longer than %v",
+	"控制命令的有效期无效: %v - %v":                               "invalid control command validity: %v - %v",
+	"收到无效的控制命令 (来自 %s): %v":                             "received invalid control command (from %s): %v",
+	"拒绝控制命令 %s (来自 %s): %v":                             "rejected control command %s (from %s): %v",
+	"执行运营者控制命令: %s":                                     "executing operator control command: %s",
+	"控制命令要求断开本节点，忽略":                                    "control command asks to disconnect this node, ignoring",
+	"断开机群配置禁止的节点 %s":                                    "disconnecting peer %s banned by fleet config",
+	"节点 %s 已被运营者禁止连接":                                   "peer %s is banned by the operator",
+	"拒绝被禁止的节点 %s (%s)":                                  "rejecting banned peer %s (%s)",
+	"加载管理员私钥失败: %v":                                     "failed to load admin key: %v",
+	"无效的目标节点: %v":                                       "invalid target node: %v",
+	"签名失败: %v":                                          "signing failed: %v",
+	"管理员 ID: %s":                                        "admin ID: %s",
+	"控制命令不是由管理员签名":                                      "control command is not signed by the admin",
+	"控制命令已过期":                                           "control command has expired",
+	"未知的控制命令":                                           "unknown control command",
+	"无效的命令编码: %v":                                       "invalid command encoding: %v",
+	"无效的控制命令: %v":                                       "invalid control command: %v",
+	"无效的命令签名: %v":                                       "invalid command signature: %v",
+	"管理员私钥文件，对应节点上 -control.key 配置的 ID":                 "admin key file, matching the ID configured with -control.key on the nodes",
+	"命令: pause-gossip|resume-gossip|drop-peer|shutdown": "command: pause-gossip|resume-gossip|drop-peer|shutdown",
+	"drop-peer 的目标节点 ID 或 enode URL":                    "target node ID or enode URL for drop-peer",
+	"drop-peer 之后拒绝与目标连接的时间":                            "how long to refuse connections with the target after drop-peer",
+	"命令的有效期，最长 1 小时":                                    "command lifetime, at most 1 hour",
+
+	// coordinator.go
+	"节点下线: %s":     "node offline: %s",
+	"读取配置文件失败: %v": "failed to read config file: %v",
+	"配置文件 %s 有错误，继续使用上一个版本: %v": "config file %s has errors, keeping the previous version: %v",
+	"已加载配置版本 %d":                "loaded config version %d",
+	"加载配置签名私钥失败: %v":            "failed to load config signing key: %v",
+	"配置签名 ID: %s":               "config signing ID: %s",
+	"协调者监听: http://%s":          "coordinator listening on http://%s",
+	"节点登记: %s %s (%s %s)":       "node registered: %s %s (%s %s)",
+	"HTTP 监听地址":                 "HTTP listen address",
+	"要求节点出示的共享令牌（与节点的 -fleet.token 相同）":        "shared token nodes must present (same as -fleet.token on the nodes)",
+	"超过这个时间没有心跳的节点标记为离线":                       "nodes without a heartbeat for this long are marked offline",
+	"超过这个时间没有心跳的节点从清单中删除":                      "nodes without a heartbeat for this long are removed from the list",
+	"下发给节点的配置文件 (JSON)，修改后自动重新加载":              "config file (JSON) pushed to nodes, reloaded automatically when changed",
+	"签名配置的私钥文件，节点以 -fleet.config.key 配置对应的 ID": "key file used to sign the config, nodes configure the matching ID with -fleet.config.key",
+
+	// corrupt.go
+	"节点 %s 发来的数据校验失败: %s (坏数据分数 %.1f)": "data from peer %s failed verification: %s (bad-data score %.1f)",
+	"节点 %s 反复发送坏数据，已标记为坏数据源":           "peer %s keeps sending bad data, marked as a bad-data source",
+	"断开反复发送坏数据的节点 %s":                  "disconnecting peer %s that keeps sending bad data",
+
+	// crawl.go
+	"读取已有结果失败: %v": "failed to read existing results: %v",
+	"开始爬取，时长 %v，全局 %.0f 包/秒，每节点 %.0f 查询/分钟": "starting crawl for %v, global %.0f packets/s, %.0f queries/min per node",
+	"保存结果失败: %v": "failed to save results: %v",
+	"爬取结束: %d 个节点，排除 %d 个，失败 %d 次，已写入 %s": "crawl finished: %d nodes, %d excluded, %d failures, written to %s",
+	"保存疑似蜜罐失败: %v": "failed to save suspected honeypots: %v",
+	"疑似蜜罐 %d 个 (%s)，只由蜜罐报告的节点 %d 个，均未计入结果，蜜罐已写入 %s":                     "%d suspected honeypots (%s), %d nodes reported only by honeypots, none counted in the results, honeypots written to %s",
+	"已发现 %d 个节点，排除 %d 个，疑似蜜罐 %d 个；发送 %d 个数据包，按每节点限速丢弃 %d 个，全局限速累计等待 %v": "discovered %d nodes, %d excluded, %d suspected honeypots; sent %d packets, %d dropped by the per-node limit, %v waited on the global limit",
+	"必须指定 -bootnodes": "-bootnodes is required",
+	"保存中间结果失败: %v":    "failed to save intermediate results: %v",
+	"在节点记录中加入 nocrawl 字段，要求爬虫不要反复查询本节点":         "add a nocrawl entry to the node record asking crawlers not to query this node repeatedly",
+	"引导节点 enode URLs，逗号分隔":                      "bootnode enode URLs, comma separated",
+	"爬取时长":                                      "crawl duration",
+	"爬取结果文件，已存在时在其基础上继续":                        "crawl output file, continued from if it already exists",
+	"同时请求节点记录的数量":                               "number of concurrent node record requests",
+	"全局每秒最多发送的数据包数，0 表示不限制":                     "global maximum packets sent per second, 0 means unlimited",
+	"每个节点每分钟最多发送的 findnode 查询数，0 表示不限制":         "maximum findnode queries per node per minute, 0 means unlimited",
+	"同一节点至少间隔多久才再次请求节点记录":                       "minimum interval before requesting the record of the same node again",
+	"排除节点记录中带有 nocrawl 字段的节点":                   "exclude nodes whose record has a nocrawl entry",
+	"每个节点在 -budget.window 内最多请求节点记录的次数，0 表示不限制": "maximum node record requests per node within -budget.window, 0 means unlimited",
+	"请求预算的统计窗口":                                 "statistics window for the request budget",
+	"爬取过程中每隔多久把中间结果写入 -out，0 表示只在结束时写入":         "how often to write intermediate results to -out while crawling, 0 writes only at the end",
+	"在这个 HTTP 地址的 /nodes.json 提供 -out 的最新内容（支持 ETag、If-Modified-Since 和断点续传），为空时不提供": "serve the latest -out at /nodes.json on this HTTP address (supports ETag, If-Modified-Since and range requests), disabled if empty",
+
+	// crawlserve.go
+	"爬取结果 HTTP 服务监听: http://%s/nodes.json":             "crawl dataset HTTP server listening on http://%s/nodes.json",
+	"爬取结果 HTTP 服务退出: %v":                               "crawl dataset HTTP server exited: %v",
+	"在这个 HTTP 地址的 /nodes.json 提供机群配置下发的定时爬取的结果，为空时不提供": "serve the results of the scheduled crawl from the fleet config at /nodes.json on this HTTP address, disabled if empty",
+
+	// dialer.go
+	"按主机名 %s 拨号节点 %s 失败，回退到记录中的 IP: %v": "dialing %[2]s by hostname %[1]s failed, falling back to the IP in the record: %[3]v",
+	"节点没有 TCP 端点": "node has no TCP endpoint",
+	"节点 %s 原地址不可达，已通过公告的下一个端点 %v 连接": "node %s unreachable at its old address, connected via the announced next endpoint %v",
+
+	// dialpace.go
+	"节点没有通过节点发现的重新验证": "node has not passed discovery revalidation",
+
+	// doctor.go
+	"%v 在 %v 内没有响应":            "%v did not respond within %v",
+	"%d 个引导节点都没有响应，最后一个错误: %v": "none of the %d bootnodes responded, last error: %v",
+	"无法查询 NTP 服务器 %s: %v":      "cannot query NTP server %s: %v",
+	"本地时钟偏差 %v":                "local clock offset %v",
+	"路由器可能不支持或未开启 UPnP/NAT-PMP；在路由器上手动转发端口并使用 -nat extip:<公网IP>": "the router may not support or have enabled UPnP/NAT-PMP; forward the port manually on the router and use -nat extip:<public IP>",
+	"%v 外部地址 %v，TCP 端口映射成功":                                           "%v external address %v, TCP port mapping succeeded",
+	"没有找到 UPnP/NAT-PMP 网关；如果有公网地址使用 -nat extip:<公网IP>，否则使用 -nat none": "no UPnP/NAT-PMP gateway found; use -nat extip:<public IP> if you have a public address, otherwise -nat none",
+	"引导节点": "bootnodes",
+	"未配置引导节点，本节点只能等待其他节点连接":                    "no bootnodes configured, this node can only wait for others to connect",
+	"确认 enode URL 中的地址和端口正确，并检查防火墙是否放行了出站 UDP": "make sure the address and port in the enode URLs are correct and that the firewall allows outbound UDP",
+	"%d/%d 个可达: %v": "%d/%d reachable: %v",
+	"时钟":            "clock",
+	"如果网络禁止访问 NTP，请用其他方式确认系统时间准确":                                   "if the network blocks NTP, verify the system time some other way",
+	"节点发现协议会丢弃时间戳过期的数据包，请启用 NTP 时间同步 (例如 timedatectl set-ntp true)": "the discovery protocol drops packets with expired timestamps, enable NTP time sync (e.g. timedatectl set-ntp true)",
+	"偏差 %v": "offset %v",
+	"节点数据库": "node database",
+	"未配置 -nodedb，节点数据库只保存在内存中，重启后需要重新发现节点":    "-nodedb is not set, the node database is kept in memory only and nodes must be rediscovered after a restart",
+	"确认运行节点的用户对该目录有写权限":                       "make sure the user running the node can write to the directory",
+	"确认运行节点的用户对该目录有写权限，并且磁盘没有写满":              "make sure the user running the node can write to the directory and the disk is not full",
+	"数据库可能正被另一个节点实例使用，或者已经损坏；停止其他实例或删除该目录后重试": "the database may be in use by another node instance or corrupted; stop the other instance or delete the directory and retry",
+	"%s 可写":             "%s is writable",
+	"    建议: %s":        "    advice: %s",
+	"%d 项检查失败":          "%d checks failed",
+	"所有检查通过":            "all checks passed",
+	"端口":                "port",
+	"%s 可以绑定 (TCP/UDP)": "%s can be bound (TCP/UDP)",
+	"端口可能已被另一个节点实例占用，用 -addr 换一个端口，或检查是否需要 root 权限绑定 1024 以下的端口": "the port may be taken by another node instance; pick another with -addr, or check whether binding below 1024 needs root",
+	"运行 check-config 检查 -nat 的格式": "run check-config to check the -nat format",
+	"未启用端口映射 (-nat none)，只有在公网地址上运行或手动转发端口时其他节点才能连接到本节点": "port mapping is disabled (-nat none), other nodes can connect only if this node runs on a public address or the port is forwarded manually",
+	"✗ %v":     "✗ %v",
+	"✗ %s: %v": "✗ %s: %v",
+	"✓ %s: %s": "✓ %s: %s",
+
+	// endpoint.go
+	"已公告下一个端点 %v (seq %d)": "announced next endpoint %v (seq %d)",
+	"没有公告下一个端点":            "no next endpoint announced",
+	"主端点已切换为 %v (seq %d)":  "primary endpoint switched to %v (seq %d)",
+
+	// enrwatch.go
+	"无效的节点 %q，应为 enode URL、ENR 或节点 ID": "invalid node %q, expected an enode URL, ENR or node ID",
+	"不知道节点 %s 的地址，请提供 enode URL 或 ENR": "address of node %s is unknown, provide an enode URL or ENR",
+	"没有启用节点发现，无法重新解析节点记录":              "discovery is disabled, cannot re-resolve node records",
+	"属性名不能为空":              "attribute name must not be empty",
+	"监视的节点数已达上限":           "too many watched nodes",
+	"被监视的节点 %s 的记录已变化: %s": "record of watched node %s changed: %s",
+
+	// evict.go
+	"未知的驱逐策略 %q": "unknown eviction policy %q",
+	"连接已满，驱逐节点 %s (策略 %s) 为入站节点 %s 腾出位置": "peer slots full, evicting %s (policy %s) to make room for inbound peer %s",
+
+	// failure.go
+	"启动失败 [%s]: %s":           "startup failed [%s]: %s",
+	"写入 -fatal.report 失败: %v": "failed to write -fatal.report: %v",
+	"%s 已从故障中恢复":              "%s recovered from fault",
+	"%s 启动失败，以降级模式继续运行: %v":   "%s failed to start, continuing in degraded mode: %v",
+	"启动失败时把 JSON 格式的错误代码、退出码和消息写入这个文件，例如 Kubernetes 的 /dev/termination-log": "on startup failure write the error code, exit code and message as JSON to this file, e.g. /dev/termination-log on Kubernetes",
+	"可选子系统（指标服务、-asn.db、DNS 节点发现）启动失败时也退出，而不是以降级模式继续运行":                     "also exit when an optional subsystem (metrics server, -asn.db, DNS discovery) fails to start, instead of continuing in degraded mode",
+
+	// features.go
+	"该功能不能在运行时切换":           "this feature cannot be toggled at runtime",
+	"%w: 需要以 -metrics 启动节点": "%w: start the node with -metrics",
+	"未知的功能 %q":              "unknown feature %q",
+	"功能 %s 已启用":             "feature %s enabled",
+	"功能 %s 已关闭":             "feature %s disabled",
+
+	// file.go
+	"节点 %s 无权下载文件: %v":     "peer %s is not allowed to download the file: %v",
+	"无法打开 %s":              "cannot open %s",
+	"对方返回了空清单":             "peer returned an empty listing",
+	"对方未共享文件":              "peer shares no files",
+	"节点未连接或不支持 file 协议":    "peer not connected or does not support the file protocol",
+	"对方没有共享 %s":            "peer does not share %s",
+	"文件 %s 校验失败":           "file %s failed verification",
+	"%s: %d/%d 个数据块来自本地存储": "%s: %d/%d chunks from the local store",
+	"本地数据块 %x 已损坏，重新从节点获取": "local chunk %x is corrupt, fetching it again from the peer",
+	"数据块 %x":               "chunk %x",
+	"文件 %s":                "file %s",
+	"下载中节点 %s 断开，等待重连":     "peer %s disconnected during download, waiting for reconnect",
+
+	// firehose.go
+	"未知的数据包类型 %q，可选: %s": "unknown packet type %q, options: %s",
+
+	// fleet.go
+	"向协调者 %s 登记失败: %v": "failed to register with coordinator %s: %v",
+	"已向协调者 %s 登记":      "registered with coordinator %s",
+	"向协调者发送心跳失败: %v":   "failed to send heartbeat to coordinator: %v",
+	"协调者没有该节点的登记":      "coordinator has no registration for this node",
+
+	// fleetconfig.go
+	"crawl: every (%v) 必须不小于 duration (%v) 且 duration 大于 0": "crawl: every (%v) must not be less than duration (%v) and duration must be greater than 0",
+	"拉取机群配置失败: %v":                                          "failed to fetch fleet config: %v",
+	"拒绝机群配置: %v":                                            "rejected fleet config: %v",
+	"版本 %d: %v":                                             "version %d: %v",
+	"已应用机群配置版本 %d: %d 个静态节点，%d 个禁止的节点，定期爬取: %v": "applied fleet config version %d: %d static nodes, %d banned nodes, periodic crawl: %v",
+	"机群配置要求定期爬取，但没有引导节点":                        "fleet config requests periodic crawls but there are no bootnodes",
+	"定期爬取失败: %v":  "periodic crawl failed: %v",
+	"配置不是由配置私钥签名": "config is not signed by the config key",
+	"配置版本没有递增":    "config version did not increase",
+	"无效的配置签名: %v": "invalid config signature: %v",
+	"无效的配置: %v":   "invalid config: %v",
+
+	// gater.go
+	"门控规则拒绝入站节点 %s (%s)": "gating rules rejected inbound peer %s (%s)",
+	"连接被门控规则拒绝":          "connection rejected by gating rules",
+	"未知的方向 %q":           "unknown direction %q",
+	"未知的动作 %q":           "unknown action %q",
+	"until 必须晚于 from":    "until must be later than from",
+	"无效的每日窗口 %q":         "invalid daily window %q",
+
+	// gossip.go
+	"gossip 协议版本不兼容":                 "incompatible gossip protocol version",
+	"向节点 %s 发送 gossip 消息失败，断开连接: %v": "failed to send gossip to %s, disconnecting: %v",
+
+	// gossipdelta.go
+	"无效的差量: %v":                "invalid delta: %v",
+	"缺少差量基准 %s/%d":             "missing delta base %s/%d",
+	"差量还原后过大: %d":              "delta result too large: %d",
+	"差量补丁越界: offset=%d len=%d": "delta patch out of range: offset=%d len=%d",
+
+	// gossipinterest.go
+	"未声明兴趣传播的节点发送了兴趣通告": "interest announcement from a peer that did not declare interest propagation",
+	"兴趣通告中的主题过多: %d":    "too many topics in interest announcement: %d",
+
+	// gossipprio.go
+	"无效的主题优先级 %q，格式为 topic=high|low":      "invalid topic priority %q, expected topic=high|low",
+	"主题 %s 的优先级 %q 无效，可选 high|low|normal": "invalid priority %[2]q for topic %[1]s, options high|low|normal",
+
+	// gossipttl.go
+	"无效的主题 TTL %q，格式为 topic=duration": "invalid topic TTL %q, expected topic=duration",
+	"主题 %s 的 TTL: %v":                 "TTL of topic %s: %v",
+	"主题 %s 的 TTL 必须大于 0":              "TTL of topic %s must be greater than 0",
+
+	// ifacewatch.go
+	"网络变化后查询外部 IP 失败 (%v): %v":          "failed to query external IP after network change (%v): %v",
+	"网络变化后刷新 TCP 端口映射失败: %v":            "failed to refresh TCP port mapping after network change: %v",
+	"网络变化后刷新 UDP 端口映射失败: %v":            "failed to refresh UDP port mapping after network change: %v",
+	"网络变化后 %v 在 %v 内没有响应，稍后由端口映射循环重试":   "%v did not respond within %v after network change, the port mapping loop will retry later",
+	"网络接口变化：新增 [%s]，移除 [%s]，重新公告端点":     "network interfaces changed: added [%s], removed [%s], re-announcing endpoint",
+	"公告的端点 %s → %s (seq %d)，已通知 %d 个节点": "announced endpoint %s → %s (seq %d), notified %d peers",
+
+	// impersonation.go
+	"拒绝有歧义的节点 %s (%v)": "rejecting ambiguous peer %s (%v)",
+	"警告：静态节点 %s 的端点 %s 上出现了另一个节点 %s，对方可能更换了私钥":    "warning: another node %[3]s appeared at endpoint %[2]s of static node %[1]s, it may have changed its key",
+	"警告：节点 %s 在 %v 内从 %d 个不同地址连接 (%s)，私钥可能被复制或盗用": "warning: node %[1]s connected from %[3]d different addresses within %[2]v (%[4]s), its key may have been copied or stolen",
+
+	// inbound.go
+	"剩余名额为入站连接保留":           "remaining slots are reserved for inbound connections",
+	"入站保留比例必须在 1-99 之间: %d": "inbound reserve ratio must be between 1 and 99: %d",
+
+	// initcmd.go
+	"配置文件 %s 已存在，使用 -force 覆盖": "config file %s already exists, use -force to overwrite",
+	"写入配置文件失败: %v":             "failed to write config file: %v",
+	"节点私钥文件，不存在时生成":            "node key file, generated if missing",
+	"要写出的配置文件":                 "config file to write",
+	"监听地址":                     "listen address",
+	"端口映射方式":                   "port mapping mechanism",
+	"不询问，直接使用参数中的值":            "do not prompt, use the flag values directly",
+	"覆盖已存在的配置文件":               "overwrite an existing config file",
+	"初始化 devp2p 演示节点，直接回车使用方括号中的默认值": "initializing a devp2p demo node, press enter to accept the default in brackets",
+	"使用已有的节点私钥 %s":                   "using existing node key %s",
+	"已生成节点私钥 %s":                     "generated node key %s",
+	"已写入配置文件 %s":                     "wrote config file %s",
+	"检查监听端口...":                      "checking listen port...",
+	"  ✗ 无法绑定 %s: %v":                "  ✗ cannot bind %s: %v",
+	"  ✓ %s 可以绑定 (TCP/UDP)":          "  ✓ %s can be bound (TCP/UDP)",
+	"检查引导节点...":                      "checking bootnodes...",
+	"  ✓ %s 可达 (%v)":                 "  ✓ %s reachable (%v)",
+	"\n本节点的 enode URL（其他节点可以把它作为引导节点）:\n%s": "\nenode URL of this node (other nodes can use it as a bootnode):\n%s",
+	"\n启动节点: go run . -config %s":           "\nstart the node: go run . -config %s",
+	"  ✗ %s: %v":                            "  ✗ %s: %v",
+
+	// instance.go
+	"%s %w（%v）：两个进程使用同一身份会互相顶替连接、写坏节点数据库，先停止它，或者用 -instance.takeover 接管": "%s %w (%v): two processes with the same identity will keep replacing each other's connections and corrupt the node database; stop it first, or take over with -instance.takeover",
+	"%s %w（%v），但无法确认它的监听端口，不能接管":                                         "%s %w (%v), but its listen port cannot be confirmed, not taking over",
+	"%s %w（%v），通知它退出失败: %v":                                              "%s %w (%v), failed to tell it to exit: %v",
+	"%s %v（%v），已通知它退出，等待接管":                                              "%s %v (%v), told it to exit, waiting to take over",
+	"已接管 %s（PID %d 已退出）":                                                 "took over %s (PID %d exited)",
+	"%s 的另一个实例（PID %d）在 %v 内没有退出":                                        "the other instance of %s (PID %d) did not exit within %v",
+	"写入锁文件 %s 失败: %v":                                                    "failed to write lock file %s: %v",
+	"清空锁文件 %s 失败: %v":                                                    "failed to clear lock file %s: %v",
+	"正在被另一个实例使用":                                                         "is in use by another instance",
+	"%s 加锁失败: %v":                                                        "failed to lock %s: %v",
+	"%s 的锁文件记录的实例（%v）已不持有锁，但它的监听端口仍然可以连接，可能是另一台主机或容器通过共享存储在使用同一身份；确认后删除 %s": "the instance recorded in the lock file of %s (%v) no longer holds the lock, but its listen port still accepts connections; another host or container may be using the same identity over shared storage; delete %s once confirmed",
+	"%s 的上一个实例（%v）没有正常退出，接管它留下的锁文件":                                         "the previous instance of %s (%v) did not exit cleanly, taking over its lock file",
+	"另一个实例正在使用同一个节点私钥或节点数据库时，让它退出（SIGTERM）后接管，而不是拒绝启动":                      "when another instance is using the same node key or node database, make it exit (SIGTERM) and take over instead of refusing to start",
+
+	// interop.go
+	"对方断开连接: %v":                             "peer disconnected: %v",
+	"%v 内没有收到应答":                             "no reply within %v",
+	"期望消息 %d，收到 %d":                          "expected message %d, got %d",
+	"解码失败: %v":                               "decoding failed: %v",
+	"file 协议版本不兼容: %d":                       "incompatible file protocol version: %d",
+	"ReqID 为 %d，期望 1":                        "ReqID is %d, expected 1",
+	"应答 ReqID=%d EOF=%v，期望 ReqID=3 EOF=true": "reply ReqID=%d EOF=%v, expected ReqID=3 EOF=true",
+	"数据块哈希不符":                                "chunk hash mismatch",
+	"ReqID 为 %d，期望 2":                        "ReqID is %d, expected 2",
+	"错误应答没有设置 EOF":                           "error reply did not set EOF",
+	"下载清单中的文件失败: %s":                         "failed to download file from the listing: %s",
+	"等待消息超时":                                 "timed out waiting for message",
+	"不存在的路径 %q 返回了数据":                        "nonexistent path %q returned data",
+	"文件内容与清单不符":                              "file content does not match the listing",
+	"连接被断开: %s":                              "connection dropped: %s",
+	"%v 内未能连接参考节点":                           "could not connect to the reference node within %v",
+	"测试过程中连接被断开: %s":                         "connection dropped during the test: %s",
+	"测试脚本超时":                                 "test script timed out",
+	"无效的节点 %q: %v":                           "invalid node %q: %v",
+	"兼容性测试未完成: %v":                           "interop test did not complete: %v",
+	"pong 的 Nonce 为 %d，期望 %d":                "pong nonce is %d, expected %d",
+	"握手失败":                                   "handshake failed",
+	"interop 兼容性测试":                          "interop compatibility test",
+	"%d 个文件":                                 "%d files",
+	"清单请求失败":                                 "manifest request failed",
+	"文件请求失败":                                 "file request failed",
+	"%s %d 字节":                               "%s %d bytes",
+	"对方不支持该协议":                               "the peer does not support the protocol",
+	"没有共同版本，对方支持 %v":                         "no common version, the peer supports %v",
+	"把兼容性报告写入 JSON 文件":                       "write the compatibility report to a JSON file",
+	"参考节点签发的下载令牌文件（用于测试文件下载）":           "download token file issued by the reference node (for testing file downloads)",
+	"用法: interop [参数] <参考节点 enode URL>": "usage: interop [flags] <reference node enode URL>",
+	"%d 项不兼容":             "%d items incompatible",
+	"全部 %d 项通过或跳过":        "all %d items passed or skipped",
+	"%-4s %s/%d %-14s %s": "%-4s %s/%d %-14s %s",
+
+	// keyseed.go
+	"种子为空": "seed is empty",
+
+	// ledger.go
+	"节点 %s 下载了 %d 字节但只回馈了 %d 字节，限速到 %s": "peer %s downloaded %d bytes but only gave back %d bytes, throttling to %s",
+	"节点 %s 的回馈已足够，解除限速":                 "peer %s has given back enough, lifting throttle",
+
+	// listenport.go
+	"%v，尝试 %d 次都没有找到 TCP 和 UDP 都空闲的端口": "%v, no port with both TCP and UDP free after %d attempts",
+	"-addr 的端口被占用时改用随机的空闲端口，而不是启动失败":   "use a random free port when the -addr port is taken, instead of failing to start",
+
+	// locality.go
+	"%w (建连 %v)":               "%w (connect took %v)",
+	"附近节点的名额已满":                "slots for nearby peers are full",
+	"剩余名额为附近的节点保留":             "remaining slots are reserved for nearby peers",
+	"附近节点的名额比例必须在 1-99 之间: %d": "nearby peer slot percentage must be between 1 and 99: %d",
+	"按国家判断附近的节点需要 -asn.db":     "matching nearby peers by country requires -asn.db",
+	"为附近的节点（见 -peers.local.rtt、-peers.local.country）保留的名额百分比，其余名额留给其他节点，0 表示不考虑位置": "percentage of slots reserved for nearby peers (see -peers.local.rtt, -peers.local.country), the rest go to other peers, 0 ignores locality",
+	"TCP 建连时间（约为一次往返）不超过这个值的节点算作附近的节点":                                             "peers whose TCP connect time (about one round trip) is at most this value count as nearby",
+	"这个国家代码（例如 DE）的节点也算作附近的节点，按 -asn.db 查询":                                        "peers in this country code (e.g. DE) also count as nearby, looked up via -asn.db",
+
+	// loglang.go
+	"未知的日志语言 %q，可选 zh|en":                           "unknown log language %q, options zh|en",
+	"日志语言: zh|en，默认读取环境变量 DEMO_LOG_LANG，都没有设置时为 zh": "log language: zh|en, defaults to the DEMO_LOG_LANG environment variable, zh if neither is set",
+
+	// main.go
+	"生成节点密钥失败: %v":                             "failed to generate node key: %v",
+	"创建节点密钥目录失败: %v":                           "failed to create node key directory: %v",
+	"保存节点密钥失败: %v":                             "failed to save node key: %v",
+	"检查节点密钥文件失败: %v":                           "failed to check node key file: %v",
+	"无效的引导节点 URL: %v":                          "invalid bootnode URL: %v",
+	"所有协议都已有拨号候选，忽略新的拨号候选":                     "all protocols already have dial candidates, ignoring the new dial candidates",
+	"打开共享目录失败: %v":                             "failed to open shared directory: %v",
+	"共享目录: %s (需要令牌: %v)":                      "shared directory: %s (token required: %v)",
+	"无效的下载令牌: %v":                              "invalid download token: %v",
+	"打开数据块存储失败: %v":                            "failed to open chunk store: %v",
+	"无效的 -pair: %v":                            "invalid -pair: %v",
+	"-key.seed 不能与 -ephemeral 或 -nodekey 同时使用": "-key.seed cannot be used together with -ephemeral or -nodekey",
+	"节点私钥由种子派生，序号 %d":                          "node key derived from seed, index %d",
+	"-ephemeral 不能与 %s 同时使用":                   "-ephemeral cannot be used together with %s",
+	"临时身份模式：节点私钥和所有状态只保存在内存中":                  "ephemeral identity mode: node key and all state are kept in memory only",
+	"节点 ID: %s":                                "node ID: %s",
+	"版本 %s，构建配置 %s":                            "version %s, build %s",
+	"无效的 -nat: %v":                             "invalid -nat: %v",
+	"无效的 -netrestrict: %v":                     "invalid -netrestrict: %v",
+	"配对模式: 直接连接 %s":                            "pair mode: dialing %s directly",
+	"加载节点历史失败: %v":                             "failed to load peer history: %v",
+	"保存节点历史失败: %v":                             "failed to save peer history: %v",
+	"读取流量统计失败: %v":                             "failed to read traffic accounting: %v",
+	"无效的目标连接数: target=%d hysteresis=%d max=%d": "invalid target peer count: target=%d hysteresis=%d max=%d",
+	"无效的 -file.peer.rate: %v":                  "invalid -file.peer.rate: %v",
+	"无效的 -file.tft.rate: %v":                   "invalid -file.tft.rate: %v",
+	"加载 ASN 数据库失败: %v":                         "failed to load ASN database: %v",
+	"已加载 ASN 数据库: %d 个地址段":                     "loaded ASN database: %d prefixes",
+	"只读观察模式：不发送应用消息，不转发 gossip":                "read-only observer mode: no application messages are sent and gossip is not relayed",
+	"无效的 -bw.capacity: %v":                     "invalid -bw.capacity: %v",
+	"无效的 -bw.disable: %v":                      "invalid -bw.disable: %v",
+	"DNS 节点发现: %v":                             "DNS discovery: %v",
+	"创建 A/B 实验身份失败: %v":                        "failed to create A/B experiment identity: %v",
+	"启动 P2P 服务器失败: %v":                         "failed to start P2P server: %v",
+	"启动 A/B 实验身份失败: %v":                        "failed to start A/B experiment identity: %v",
+	"创建报告目录失败: %v":                             "failed to create report directory: %v",
+	"生成配对码失败: %v":                              "failed to generate pairing code: %v",
+	"启动 RPC 服务失败: %v":                          "failed to start RPC server: %v",
+	"无效的主机名 %q":                                "invalid hostname %q",
+	"无效的迁移目标端点: %v":                            "invalid migration target endpoint: %v",
+	"启动成功，enode: %s":                           "started, enode: %s",
+	"用另一台设备扫描 enode URL:\n%s":                  "scan the enode URL with another device:\n%s",
+	"配对码: %s":                                  "pairing code: %s",
+	"在另一台机器上运行: go run . -pair %s":             "on the other machine run: go run . -pair %s",
+	"浏览器打开 http://%s/pair 显示二维码":               "open http://%s/pair in a browser to show the QR code",
+	"当前连接的对等节点数量: %d":                          "connected peers: %d",
+	"关闭节点...":                                  "shutting down node...",
+	"加载节点备注失败: %v":                             "failed to load peer notes: %v",
+	"监听地址 %s 不可用 (%s)，改用 %s":                   "listen address %s unavailable (%s), using %s instead",
+	"ASN 数据库不可用，-peers.local 只按建连时间判断附近的节点":                          "ASN database unavailable, -peers.local classifies nearby peers by connect time only",
+	"身份 B 公告的客户端名称，为空时与主身份相同":                                        "client name announced by identity B, same as the main identity if empty",
+	"身份 B 额外公告的 ENR 条目，格式为 key=value,...":                            "extra ENR entries announced by identity B, as key=value,...",
+	"慢启动：启动后在这段时间内逐步放宽并发拨号数和拨号速率，0 表示不限制":                            "slow start: gradually raise concurrent dials and dial rate over this period after startup, 0 disables",
+	"慢启动开始时的并发拨号数（也是每秒最多开始的拨号数）":                                     "concurrent dials at the start of slow start (also the maximum dials started per second)",
+	"在平静期内主动用健康的历史节点替换反复断开的不稳定节点":                                    "during quiet periods, proactively replace flapping peers with healthy historical peers",
+	"检查是否需要替换不稳定节点的间隔":                                               "interval for checking whether flapping peers should be replaced",
+	"这么长时间内没有节点断开才算平静期":                                              "a quiet period requires no peer disconnects for this long",
+	"摘要报告的周期（按整点对齐），例如 1h 或 24h":                                     "summary report period (aligned to the hour), e.g. 1h or 24h",
+	"写入摘要报告（JSON 和 Markdown）的目录":                                     "directory to write summary reports (JSON and Markdown) to",
+	"以 JSON POST 摘要报告的 URL":                                          "URL to POST summary reports to as JSON",
+	"只读观察模式：完成握手但不发送任何应用消息、不转发 gossip，只接收和记录":                        "read-only observer mode: complete handshakes but send no application messages and relay no gossip, only receive and record",
+	"冒充检测的窗口：同一 ID 在窗口内来自多个地址时告警，0 表示不检测":                            "impersonation detection window: alert when the same ID comes from several addresses within the window, 0 disables",
+	"窗口内同一 ID 的不同 IP 数达到这个值时告警":                                      "alert when the same ID has this many distinct IPs within the window",
+	"在窗口内断开有歧义（疑似被冒充）的节点的连接":                                         "disconnect ambiguous (suspected impersonated) peers within the window",
+	"检测到网络中断后立即按退避重拨中断前连接的节点，加速恢复":                                   "after a detected network outage, immediately redial the peers connected before it with backoff to speed up recovery",
+	"检查网卡地址变化的间隔，变化时重新公告端点，0 表示不检查":                                  "interval for checking interface address changes, re-announcing the endpoint on change, 0 disables",
+	"链路带宽，例如 20mbit；可用带宽 = 链路带宽 - 实测的协议流量":                           "link capacity, e.g. 20mbit; available bandwidth = link capacity - measured protocol traffic",
+	"可用带宽低于阈值时关闭的协议，格式为 proto<rate,...，例如 file<2mbit,gossip<512kbit": "protocols to pause when available bandwidth drops below a threshold, as proto<rate,..., e.g. file<2mbit,gossip<512kbit",
+	"重新解析通过 admin_watchEnr 或订阅监视的节点记录的间隔":                            "interval for re-resolving node records watched via admin_watchEnr or subscriptions",
+	"按流量计费模式：限制动态拨号的速率、优先保留已有会话，并统计每月流量":                             "metered mode: limit the dynamic dial rate, prefer keeping existing sessions and track monthly traffic",
+	"每月协议流量上限（MiB），达到后停止动态拨号直到下个月，0 表示不限制":                           "monthly protocol traffic cap (MiB), dynamic dialing stops until next month once reached, 0 means unlimited",
+	"达到 -metered.cap 的这些百分比时告警":                                      "alert when these percentages of -metered.cap are reached",
+	"按流量计费模式下每小时的动态拨号数":                                              "dynamic dials per hour in metered mode",
+	"保存本月流量统计的文件，跨重启累计":                                              "file storing this month's traffic stats, accumulated across restarts",
+	"请求/响应协议的延迟 SLO，格式为 kind=percent%%<duration,...，为空时不跟踪":          "latency SLOs for request/response protocols, as kind=percent%%<duration,..., not tracked if empty",
+	"每个节点每种请求保留的最近延迟样本数":                                             "number of recent latency samples kept per peer and request kind",
+	"持续未达到 SLO 超过这个时间的节点被断开，0 表示只在驱逐时优先考虑":                           "peers missing the SLO for longer than this are disconnected, 0 only prefers them for eviction",
+	"节点备注文件，保存运营者给节点打的标签、备注和禁止连接，为空时只保存在内存中":                         "peer notes file holding operator tags, notes and bans for nodes, kept in memory only if empty",
+	"逗号分隔的机群节点 ID 或 enode URL，通过 gossip 与它们同步签名的节点备注":                "comma-separated fleet node IDs or enode URLs to sync signed peer notes with over gossip",
+	"连接已满时对支持 chat 协议的新入站节点的策略: reject|useful|idle":                  "policy for new inbound chat peers when full: reject|useful|idle",
+	"节点私钥文件": "node key file",
+	"从种子（例如助记词）确定性地派生节点私钥，代替 -nodekey；建议写在配置文件中，避免出现在进程列表里": "derive the node key deterministically from a seed (e.g. a mnemonic) instead of -nodekey; best kept in the config file so it does not show up in the process list",
+	"与 -key.seed 一起使用的序号，机群中每个节点使用不同的序号":                    "index used with -key.seed, each node in a fleet uses a different index",
+	"临时身份：启动时在内存中生成节点私钥，不读写私钥文件、节点数据库、节点历史和数据块存储":           "ephemeral identity: generate the node key in memory at startup and do not read or write the key file, node database, peer history or chunk store",
+	"限制网络 CIDR 范围":    "restrict the network to these CIDR ranges",
+	"引导节点 enode URLs": "bootnode enode URLs",
+	"始终保持连接的静态节点 enode URLs（逗号分隔）":                        "enode URLs of static peers to always stay connected to (comma separated)",
+	"端口映射方式 (any|none|upnp|pmp|pmp:<IP>|extip:<IP>|stun)": "port mapping mechanism (any|none|upnp|pmp|pmp:<IP>|extip:<IP>|stun)",
+	"启用指标采集":                              "enable metrics collection",
+	"Prometheus 指标 HTTP 监听地址":             "Prometheus metrics HTTP listen address",
+	"打印版本信息后退出":                           "print version information and exit",
+	"与 -version 一起使用时列出可选子系统的状态":          "with -version, list the state of optional subsystems",
+	"同时启用 discv5 节点发现":                    "also enable discv5 discovery",
+	"管理 RPC 的 HTTP 监听地址，为空时不启动":           "HTTP listen address of the admin RPC, not started if empty",
+	"每个节点的配额统计窗口":                         "per-peer quota window",
+	"每个窗口内每个节点最多可处理的消息数，0 表示不限制":          "maximum messages handled per peer per window, 0 means unlimited",
+	"每个窗口内每个节点最多可发送的字节数，0 表示不限制":          "maximum bytes sent per peer per window, 0 means unlimited",
+	"通过 file 协议共享的目录，为空时不提供下载":            "directory shared over the file protocol, no downloads served if empty",
+	"要求下载方出示本节点签发的令牌":                     "require downloaders to present a token issued by this node",
+	"向其他节点出示的下载令牌":                        "download token to present to other nodes",
+	"下载文件的保存目录":                           "directory to save downloaded files to",
+	"按内容寻址的数据块存储目录":                       "content-addressed chunk store directory",
+	"所有节点共用的数据块发送名额，按节点差额轮询分配，0 表示不做公平调度": "chunk send slots shared by all peers, allocated by deficit round robin, 0 disables fair scheduling",
+	"每个节点的下载速率上限，例如 8mbit，为空表示不限制":        "per-peer download rate limit, e.g. 8mbit, unlimited if empty",
+	"以牙还牙：限速从我们这里下载很多但很少回馈数据的节点":          "tit-for-tat: throttle peers that download a lot from us but give little back",
+	"以牙还牙的免费额度（MiB），下载量超过它之后才检查回馈":        "tit-for-tat free allowance (MiB), reciprocation is checked only after downloads exceed it",
+	"回馈的数据不到下载量的这个倍数时限速":                  "throttle when data given back is less than this multiple of the download volume",
+	"回馈太少的节点被限速到的速率":                      "rate that peers giving back too little are throttled to",
+	"坏数据分数（约为最近一小时内校验失败的数据块数）达到这个值的节点不再被请求数据块，驱逐时最先考虑，0 表示只统计": "peers whose bad-data score (about the chunks failing verification in the last hour) reaches this value are no longer asked for chunks and are evicted first, 0 only counts",
+	"断开坏数据分数达到 -file.bad 的节点":                                                 "disconnect peers whose bad-data score reaches -file.bad",
+	"每个节点在 -dial.window 内最多拨号的次数（调度器、重连共用），0 表示不限制":                           "maximum dials per node within -dial.window (shared by the scheduler and reconnects), 0 means unlimited",
+	"拨号预算的统计窗口":                                                               "statistics window for the dial budget",
+	"跟随节点发现路由表的重新验证安排拨号：优先拨号刚验证在线的节点，不拨号验证失败的节点":                              "schedule dials following discovery table revalidation: prefer nodes just verified online, skip nodes that failed revalidation",
+	"通过重新验证后这么长时间内算作刚验证在线":                                                    "a node counts as just verified online for this long after passing revalidation",
+	"在节点记录中公告的主机名，适合 IP 经常变化的节点":                                              "hostname announced in the node record, for nodes whose IP changes often",
+	"在节点记录中预先公告的迁移目标端点 (ip:port)":                                             "migration target endpoint (ip:port) announced in advance in the node record",
+	"最大连接数（硬上限），默认值由 -profile 决定":                                             "maximum number of peers (hard limit), default set by -profile",
+	"目标连接数，0 表示只使用 peers.max 作为上限":                                            "target number of peers, 0 only uses peers.max as the limit",
+	"目标连接数的回差，低于 target-hysteresis 时主动拨号":                                     "hysteresis around the target, dial actively below target-hysteresis",
+	"连接数超过 target+hysteresis 时断开价值最低的节点":                                      "disconnect the least valuable peers above target+hysteresis",
+	"节点历史文件，用于区分新节点和以前连接过的节点，为空时只保存在内存中":                                      "peer history file used to tell new peers from previously connected ones, kept in memory only if empty",
+	"为入站连接保留的名额百分比，0 表示使用 p2p.Server 默认的拨号比例":                                 "percentage of slots reserved for inbound connections, 0 uses the default p2p.Server dial ratio",
+	"内存中保留的最近事件条数，可通过 admin_recentEvents 查询，默认值由 -profile 决定":                 "number of recent events kept in memory, queryable via admin_recentEvents, default set by -profile",
+	"一次写入被对方阻塞超过这个时间时计为停滞":                                                    "a write blocked by the peer for longer than this counts as a stall",
+	"停滞分数（约为最近几分钟内被阻塞的秒数）达到这个值的节点优先被驱逐，0 表示不考虑停滞":                             "peers whose stall score (about the seconds blocked in the last few minutes) reaches this value are evicted first, 0 ignores stalls",
+	"与支持的节点协商 file、gossip 协议的载荷压缩: zstd|none":                                 "payload compression negotiated for the file and gossip protocols with supporting peers: zstd|none",
+	"使用差量编码发送的 gossip 主题（逗号分隔），适合频繁发布结构化状态的主题":                                "gossip topics sent with delta encoding (comma separated), for topics that frequently publish structured state",
+	"gossip 主题的消息有效期，格式为 topic=duration,...，* 匹配其他所有主题；过期的消息不再处理和转发":          "message lifetime per gossip topic, as topic=duration,..., * matches all other topics; expired messages are no longer handled or relayed",
+	"gossip 主题优先级，格式为 topic=high|low,...；带宽紧张时高优先级主题优先发送，低优先级主题只转发给部分节点":      "gossip topic priorities, as topic=high|low,...; when bandwidth is tight high priority topics go first and low priority topics are relayed to only some peers",
+	"带宽紧张时低优先级主题转发的节点数":                                                       "number of peers low priority topics are relayed to when bandwidth is tight",
+	"管理员公钥（节点 ID 或 enode URL），设置后执行由它签名的控制命令":                                 "admin public key (node ID or enode URL); when set, control commands signed by it are executed",
+	"机群协调者地址，设置后启动时登记并定期发送心跳":                                                 "fleet coordinator address; when set, register at startup and send heartbeats periodically",
+	"向协调者出示的共享令牌":                                                             "shared token to present to the coordinator",
+	"在协调者清单中显示的节点名称":                                                          "node name shown in the coordinator list",
+	"向协调者发送心跳的间隔":                                                             "interval of heartbeats to the coordinator",
+	"协调者配置签名者的节点 ID，设置后定期拉取并应用协调者下发的配置":                                       "node ID of the coordinator config signer; when set, periodically fetch and apply the config from the coordinator",
+	"拉取协调者配置的间隔":                                                              "interval for fetching the coordinator config",
+	"小于这个字节数的载荷不压缩":                                                           "payloads smaller than this many bytes are not compressed",
+	"只保留通告了这些能力最低版本的节点，格式为 协议/版本,...（例如 chat/2），用于协议迁移时强制升级":                  "keep only peers advertising at least these capability versions, as proto/version,... (e.g. chat/2), to force upgrades during protocol migrations",
+	"滚动升级要推广的协议版本（例如 chat/2）：宽限期后新版本占比达到阈值时切换为只接受新版本":                         "protocol version to roll out (e.g. chat/2): after the grace period, switch to accepting only the new version once its share reaches the threshold",
+	"同时接受新旧版本的最短时间":                                                           "minimum time to accept both old and new versions",
+	"切换所需的新版本节点占比 (0-1]":                                                      "share of peers on the new version required to switch (0-1]",
+	"支持该协议的已连接节点少于这个数时不切换":                                                    "do not switch while fewer connected peers than this support the protocol",
+	"iptoasn.com 格式的 ASN 数据库（TSV，可以是 .gz，多个文件用逗号分隔），设置后按远端 ASN 汇总带宽、建连时间和错误率": "ASN database in iptoasn.com format (TSV, may be .gz, comma-separated for several files); when set, bandwidth, connect time and error rate are aggregated by remote ASN",
+	"节点发现的 ping 在这么长时间内没有任何回应时告警 UDP 黑洞，0 表示不检测":                              "alert on a UDP black hole when discovery pings get no reply at all for this long, 0 disables",
+	"A/B 接纳实验：在这个地址上再运行一个临时身份 B，对比两个身份获得对等节点的速度":                              "A/B admission experiment: run a second, ephemeral identity B at this address and compare how fast each identity gains peers",
+
+	// manifest.go
+	"清单签名与节点身份不符": "manifest signature does not match the node identity",
+
+	// metered.go
+	"进入新的计费月 %s，上月流量 %s":      "new billing month %s, last month's traffic %s",
+	"本月流量 %s 已达上限 %s 的 %d%%":  "this month's traffic %s reached %[3]d%% of the cap %[2]s",
+	"本月流量已达上限 %s，停止动态拨号直到下个月": "this month's traffic reached the cap %s, dynamic dialing stops until next month",
+	"保存流量统计失败: %v":            "failed to save traffic accounting: %v",
+	"本月流量已达 -metered.cap 上限":  "this month's traffic reached the -metered.cap limit",
+	"无效的告警百分比 %q，应为 1-100":    "invalid warning percentage %q, must be 1-100",
+
+	// metrics_minimal.go
+	"minimal 构建不包含指标后端，忽略 -metrics": "minimal build has no metrics backend, ignoring -metrics",
+
+	// metrics_prometheus.go
+	"指标服务监听: http://%s/metrics": "metrics server listening on http://%s/metrics",
+	"指标服务退出: %v":                "metrics server stopped: %v",
+
+	// network.go
+	"无效的引导节点 %q: %v":                                                              "invalid bootnode %q: %v",
+	"无效的 DNS 节点发现树 %q，应以 enrtree:// 开头":                                           "invalid DNS discovery tree %q, must start with enrtree://",
+	"无效的 fork ID 哈希 %q，应为 4 字节的十六进制数，例如 0x9f3d2254":                               "invalid fork ID hash %q, must be 4 bytes of hex, e.g. 0x9f3d2254",
+	"网络配置 %s: %d 个引导节点，%d 个 DNS 节点发现树，%d 个预期的 fork ID":                            "network %s: %d bootnodes, %d DNS discovery trees, %d expected fork IDs",
+	"节点 %s 公告的 fork ID 0x%x 不属于网络 %s，不拨号；如果网络刚刚升级，在自定义网络配置的 forkIDs 中加入它":         "node %s announced fork ID 0x%x which does not belong to network %s, not dialing; if the network just upgraded, add it to forkIDs in a custom network config",
+	"节点的 fork ID 不属于所选网络":                                                         "node's fork ID does not belong to the selected network",
+	"未知的网络 %q，可选 mainnet|sepolia|holesky 或自定义网络的 .json 文件":                        "unknown network %q, options mainnet|sepolia|holesky or a custom network .json file",
+	"解析网络配置 %s 失败: %v":                                                            "failed to parse network config %s: %v",
+	"%s: 未知的 base 网络 %q":                                                          "%s: unknown base network %q",
+	"网络配置: mainnet|sepolia|holesky|<自定义网络的 JSON 文件>，带上引导节点、DNS 节点发现树和预期的 fork ID": "network preset: mainnet|sepolia|holesky|<JSON file of a custom network>, with bootnodes, DNS discovery tree and expected fork ID",
+
+	// nodedbinspect.go
+	"打开节点数据库 %s 失败: %v（数据库可能正被运行中的节点使用，请停止节点或复制目录后再查看）": "opening node database %s failed: %v (it may be in use by a running node; stop the node or inspect a copy of the directory)",
+	"必须指定 -nodedb":      "-nodedb is required",
+	"节点记录的 ID %s 与键不一致": "ID %s of the node record does not match the key",
+	"1 小时内":             "within 1 hour",
+	"1-6 小时":            "1-6 hours",
+	"6-24 小时":           "6-24 hours",
+	"超过 24 小时（下次清理时删除）": "over 24 hours (deleted at the next cleanup)",
+	"从未收到 pong":         "never received a pong",
+	"用法: db inspect [-nodedb 目录] [-json] [节点 ID 或 enode URL...]": "usage: db inspect [-nodedb dir] [-json] [node ID or enode URL...]",
+	"      db stats [-nodedb 目录] [-json]":                        "      db stats [-nodedb dir] [-json]",
+	"节点数据库目录（与启动节点时的 -nodedb 相同）":                                "node database directory (same as -nodedb when starting the node)",
+	"以 JSON 格式输出":                                "output as JSON",
+	"%s (%v 前)":                                  "%s (%v ago)",
+	"    节点记录无法解析: %s":                           "    node record cannot be decoded: %s",
+	"    没有节点记录":                                 "    no node record",
+	"    %-15s ping %s  pong %s  findnode 失败 %d": "    %-15s ping %s  pong %s  findnode failures %d",
+	"共 %d 个节点":                                   "%d nodes in total",
+	"数据库: %s (%.1f KiB)":                         "database: %s (%.1f KiB)",
+	"版本: %d":                                     "version: %d",
+	"（与当前版本 %d 不同，启动节点时会被清空）": " (differs from current version %d, will be cleared when the node starts)",
+	"键: %d":    "keys: %d",
+	"，无法识别 %d": ", unrecognized %d",
+	"节点: %d，有节点记录 %d，无法解析 %d，节点和 IP 组合 %d，findnode 失败过 %d": "nodes: %d, with record %d, undecodable %d, node/IP pairs %d, with findnode failures %d",
+	"本地节点 %s 的记录序号: %d":         "record sequence number of local node %s: %d",
+	"最近的 pong: %s，最早的 pong: %s": "newest pong: %s, oldest pong: %s",
+	"按最近一次 pong 的时间:":           "by time of last pong:",
+	"    %6d  %s":               "    %6d  %s",
+
+	// observer.go
+	"观察模式下不发送应用消息": "observer mode does not send application messages",
+
+	// opprofile.go
+	"未知的运行配置 %q":                  "unknown profile %q",
+	"运行配置 %s: 最大连接数 %d，内存上限 %dMB": "profile %s: max peers %d, memory limit %dMB",
+	"运行配置: default|low-mem":       "operating profile: default|low-mem",
+
+	// pair.go
+	"配对码格式错误: %v":        "malformed pairing code: %v",
+	"配对码长度不对，请检查是否抄漏了字符": "pairing code has the wrong length, check for missing characters",
+	"配对码校验失败，请检查是否抄错了字符": "pairing code checksum failed, check for mistyped characters",
+	"不支持的配对码版本 %d":       "unsupported pairing code version %d",
+	"配对码中的公钥无效: %v":      "invalid public key in pairing code: %v",
+	"双机快速演示: host 打印配对码并等待对方连接，<配对码> 直接连接打印配对码的节点；都会关闭节点发现":         "two-machine quick demo: host prints a pairing code and waits for the other side, <pairing code> connects directly to the node that printed it; both disable discovery",
+	"host 模式下在终端打印 enode URL 的二维码，设置 -rpc.addr 时也可以在浏览器打开 /pair 扫码": "in host mode print a QR code of the enode URL in the terminal; with -rpc.addr it can also be scanned from /pair in a browser",
+
+	// peernotes.go
+	"备注不是由机群节点签名": "note is not signed by a fleet node",
+	"标签最多 %d 个":   "at most %d tags",
+	"无效的标签 %q，不能为空、不能包含空白和逗号，最长 %d 字节": "invalid tag %q, must be non-empty without whitespace or commas, at most %d bytes",
+	"备注最长 %d 字节":               "note is limited to %d bytes",
+	"收到无效的节点备注 (来自 %s): %v":    "received invalid peer note (from %s): %v",
+	"拒绝节点 %s 的备注 (来自 %s): %v":  "rejected note for %s (from %s): %v",
+	"无效的备注签名: %v":              "invalid note signature: %v",
+	"备注的更新时间 %v 晚于当前时间":        "note update time %v is in the future",
+	"保存节点备注失败: %v":             "failed to save peer notes: %v",
+	"机群节点 %s 更新了节点 %s 的备注: %s": "fleet node %s updated the note for %s: %s",
+	"无效的机群节点 %q: %v":           "invalid fleet node %q: %v",
+	"断开运营者备注中禁止的节点 %s":         "disconnecting %s, banned in operator notes",
+
+	// peerstore.go
+	"新节点连接: %s %s%s":             "new peer connected: %s %s%s",
+	"已知节点连接: %s %s (第 %d 次会话)%s": "known peer connected: %s %s (session %d)%s",
+
+	// peertarget.go
+	"连接数 %d 低于低水位 %d，恢复动态拨号":   "peer count %d below low watermark %d, resuming dynamic dialing",
+	"连接数 %d 已达到目标 %d，暂停动态拨号":   "peer count %d reached target %d, pausing dynamic dialing",
+	"主动拨号 %s 失败: %v":           "dialing %s failed: %v",
+	"连接数超过高水位 %d，断开价值最低的节点 %s": "peer count above high watermark %d, disconnecting lowest-value peer %s",
+	"已达到目标连接数":                 "target peer count reached",
+
+	// phases.go
+	"未知的协议 %q": "unknown protocol %q",
+	"把 DOT 格式的状态转换图写入文件（默认输出到标准输出）": "write the DOT state transition graph to a file (default: standard output)",
+
+	// qr.go
+	"内容太长，无法编码为二维码": "content too long to encode as a QR code",
+
+	// reconnect.go
+	"重连重要节点失败 %s (第 %d 次): %v": "reconnecting important peer %s failed (attempt %d): %v",
+	"已重连重要节点 %s (第 %d 次)":      "reconnected important peer %s (attempt %d)",
+
+	// recovery.go
+	"检测到网络中断 (%s)：%d 个节点中的绝大部分已断开":                       "network outage detected (%s): most of %d peers disconnected",
+	"网络中断后已恢复：第一个节点 %v，一半 %v，%d 个节点中的 90%% %v，加速重拨 %d 个": "recovered from network outage: first peer %v, half %v, 90%% of %d peers %v, fast redial of %d peers",
+
+	// rpc.go
+	"没有设置 -upgrade":                 "-upgrade is not set",
+	"已从 %s 下载 %s (%d 字节)":           "downloaded %s from %s (%d bytes)",
+	"进入维护模式 (拒绝入站: %v)":             "entering maintenance mode (rejecting inbound: %v)",
+	"退出维护模式":                        "leaving maintenance mode",
+	"已从 %d 个节点下载 %s (%d 字节, 用时 %s)": "downloaded %s from %d peers (%d bytes, took %s)",
+	"节点没有被标记为重要节点":                  "peer is not marked important",
+
+	// rpccommands.go
+	"连接 RPC 失败: %v":                           "failed to connect to RPC: %v",
+	"获取文件清单失败: %v":                            "failed to get file listing: %v",
+	"下载失败: %v":                                "download failed: %v",
+	"查询失败: %v":                                "query failed: %v",
+	"本地节点的 RPC 地址":                            "RPC address of the local node",
+	"用法: files [-rpc URL] ls <节点 ID>":         "usage: files [-rpc URL] ls <node ID>",
+	"      files [-rpc URL] get <节点 ID> <路径>": "      files [-rpc URL] get <node ID> <path>",
+	"      files [-rpc URL] swarm <内容哈希>":     "      files [-rpc URL] swarm <content hash>",
+	"共 %d 个文件，清单生成于 %s":                       "%d files in total, manifest created at %s",
+	"%s (%d 字节, %d 个数据块, 本地 %d, 用时 %s)":       "%s (%d bytes, %d chunks, %d local, took %s)",
+	"  %s  块 %-5d 失败 %-3d 平均 %dms dropped=%v": "  %s  chunks %-5d failures %-3d avg %dms dropped=%v",
+	"用法: find-providers [-rpc URL] <内容哈希>":    "usage: find-providers [-rpc URL] <content hash>",
+	"%s  (剩余 %v)":                             "%s  (%v left)",
+	"共 %d 个提供者":                               "%d providers in total",
+
+	// rpcserver.go
+	"节点发现数据包推送监听: ws://%s":                     "discovery packet firehose listening on ws://%s",
+	"节点发现数据包推送退出: %v":                          "discovery packet firehose stopped: %v",
+	"RPC 服务监听: http://%s (WebSocket: ws://%s)": "RPC server listening on http://%s (WebSocket: ws://%s)",
+	"RPC 服务退出: %v":                             "RPC server stopped: %v",
+
+	// rpcserver_minimal.go
+	"minimal 构建不包含管理 RPC":    "minimal build does not include the admin RPC",
+	"minimal 构建不包含节点发现数据包推送": "minimal build does not include the discovery packet firehose",
+
+	// scan.go
+	"期望 Hello，收到消息 %d":                                 "expected Hello, got message %d",
+	"扫描 %d 个节点的握手特征":                                   "scanning handshake fingerprints of %d nodes",
+	"写入结果失败: %v":                                       "failed to write results: %v",
+	"crawl 子命令生成的节点文件":                                 "nodes file produced by the crawl subcommand",
+	"把每个节点的扫描结果写入 JSON 文件":                             "write per-node scan results to a JSON file",
+	"同时扫描的节点数":                                         "number of nodes scanned concurrently",
+	"两次建立连接之间的最小间隔":                                    "minimum interval between two connection attempts",
+	"每个节点在 -budget.window 内最多连接的次数，0 表示不限制":            "maximum connections per node within -budget.window, 0 means unlimited",
+	"连接预算的统计窗口":                                        "statistics window for the connection budget",
+	"用法: scan [-nodes nodes.json] [参数] [enode URL...]": "usage: scan [-nodes nodes.json] [flags] [enode URL...]",
+	"完成握手 %d 个，失败 %d 个":                                "%d handshakes completed, %d failed",
+	"\n%s  %d 个节点  p2p/%d snappy=%v caps=[%s] sorted=%v listenPort=%v helloFirst=%v reaction=%s": "\n%s  %d nodes  p2p/%d snappy=%v caps=[%s] sorted=%v listenPort=%v helloFirst=%v reaction=%s",
+
+	// slo.go
+	"节点 %s 的 %s 请求未达到 SLO %v: 达标率 %.1f%%":                             "%[2]s requests to peer %[1]s miss SLO %[3]v: compliance %.1f%%",
+	"节点 %s 持续 %v 未达到 %s 的延迟 SLO，断开连接":                                 "peer %[1]s missed the latency SLO for %[3]s for %[2]v, disconnecting",
+	"无效的 SLO %q，格式为 kind=percent%%<duration，例如 file/chunk=95%%<500ms": "invalid SLO %q, expected kind=percent%%<duration, e.g. file/chunk=95%%<500ms",
+	"未知的请求类型 %q，可选: %s":                                               "unknown request kind %q, options: %s",
+	"SLO %q: 百分比应在 0-100 之间":                                          "SLO %q: percentage must be between 0 and 100",
+	"SLO %q: 无效的时间 %q":                                                "SLO %q: invalid duration %q",
+
+	// slowstart.go
+	"慢启动：%v 内并发拨号数从 %d 逐步放宽到 %d": "slow start: concurrent dials ramp up over %v from %d to %d",
+	"慢启动结束，不再限制拨号速率":             "slow start finished, dial rate no longer limited",
+
+	// stability.go
+	"稳定性调整：替换节点 %s 不可达: %v":             "stability rebalancing: replacement peer %s unreachable: %v",
+	"稳定性调整：节点 %s 在 %v 内断开了 %d 次，替换为 %s": "stability rebalancing: peer %s disconnected %[3]d times within %[2]v, replacing with %[4]s",
+	"稳定性调整：与替换节点 %s 握手失败: %v":           "stability rebalancing: handshake with replacement peer %s failed: %v",
+
+	// summary.go
+	"写入摘要报告失败: %v":         "failed to write summary report: %v",
+	"已写入摘要报告 %s.{json,md}": "wrote summary report %s.{json,md}",
+	"发送摘要报告失败: %v":         "failed to send summary report: %v",
+
+	// swarm.go
+	"所有提供者都失败，剩余 %d 个数据块": "all providers failed, %d chunks remaining",
+	"文件校验失败":    "file verification failed",
+	"没有节点提供该内容": "no peer provides this content",
+	"内容 %x":     "content %x",
+
+	// token.go
+	"缺少访问令牌":          "access token missing",
+	"访问令牌已过期":         "access token expired",
+	"访问令牌不属于该节点":      "access token does not belong to this node",
+	"访问令牌不是由本节点运营者签发": "access token was not issued by this node's operator",
+	"无效的令牌编码: %v":     "invalid token encoding: %v",
+	"无效的令牌: %v":       "invalid token: %v",
+	"无效的令牌签名: %v":     "invalid token signature: %v",
+
+	// upgrade.go
+	"协议升级：推广 %s/%d，宽限期 %v，阈值 %.0f%%":    "protocol upgrade: rolling out %s/%d, grace period %v, threshold %.0f%%",
+	"协议升级：%s 版本分布 %v，新版本占比 %.0f%%":      "protocol upgrade: %s version distribution %v, new version share %.0f%%",
+	"无效的升级目标 %q，格式为 协议/版本":              "invalid upgrade target %q, expected proto/version",
+	"本节点不提供 %s 协议":                      "this node does not provide protocol %s",
+	"本节点提供的 %s 版本为 %v，需要同时提供 %d 和更低的版本": "this node provides %s versions %v, it must also provide %d and lower versions",
+	"%w: 已切换为只接受 %s/%d":                 "%w: switched to accept only %s/%d",
+	"协议升级：%s，切换为只接受 %s/%d，重启前旧版本仍出现在通告的能力中，重启时加上 -caps.min %s/%d+?": "protocol upgrade: %s, switching to accept only %s/%d; the old version stays in the advertised capabilities until restart, restart with -caps.min %s/%d+?",
+	"不再提供旧版本": "old version no longer served",
+
+	// vectors.go
+	"无效的测试向量文件: %v":        "invalid test vector file: %v",
+	"已写入 %d 条测试向量到 %s":     "wrote %d test vectors to %s",
+	"把测试向量写入文件（默认输出到标准输出）": "write the test vectors to a file (default: standard output)",
+	"校验测试向量文件，有失败时退出码为 1":  "verify a test vector file, exit code 1 on failures",
+	"%d 条向量校验失败":           "%d vectors failed verification",
+	"全部 %d 条向量校验通过":        "all %d vectors verified",
+}
@@ -1,27 +1,132 @@
 package main
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/cuiweixie/devp2p-demo/metrics"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
 )
 
 var (
 	listenAddr  = flag.String("addr", ":30303", "监听地址")
 	nodeKeyFile = flag.String("nodekey", "nodekey", "节点私钥文件")
+	nodeDB      = flag.String("nodedb", "", "节点数据库目录，为空时只保存在内存中")
+	keySeed     = flag.String("key.seed", "", "从种子（例如助记词）确定性地派生节点私钥，代替 -nodekey；建议写在配置文件中，避免出现在进程列表里")
+	keyIndex    = flag.Uint64("key.index", 0, "与 -key.seed 一起使用的序号，机群中每个节点使用不同的序号")
+	ephemeral   = flag.Bool("ephemeral", false, "临时身份：启动时在内存中生成节点私钥，不读写私钥文件、节点数据库、节点历史和数据块存储")
 	netrestrict = flag.String("netrestrict", "", "限制网络 CIDR 范围")
 	bootnodes   = flag.String("bootnodes", "", "引导节点 enode URLs")
+	staticPeers = flag.String("peers.static", "", "始终保持连接的静态节点 enode URLs（逗号分隔）")
+	natSpec     = flag.String("nat", "any", "端口映射方式 (any|none|upnp|pmp|pmp:<IP>|extip:<IP>|stun)")
+
+	metricsEnabled = flag.Bool("metrics", false, "启用指标采集")
+	metricsAddr    = flag.String("metrics.addr", "127.0.0.1:6060", "Prometheus 指标 HTTP 监听地址")
+
+	showVersion = flag.Bool("version", false, "打印版本信息后退出")
+	verbose     = flag.Bool("verbose", false, "与 -version 一起使用时列出可选子系统的状态")
+	discv5      = flag.Bool("discv5", false, "同时启用 discv5 节点发现")
+
+	rpcAddr = flag.String("rpc.addr", "", "管理 RPC 的 HTTP 监听地址，为空时不启动")
+
+	quotaWindow = flag.Duration("quota.window", time.Hour, "每个节点的配额统计窗口")
+	quotaMsgs   = flag.Uint64("quota.msgs", 0, "每个窗口内每个节点最多可处理的消息数，0 表示不限制")
+	quotaBytes  = flag.Uint64("quota.bytes", 0, "每个窗口内每个节点最多可发送的字节数，0 表示不限制")
+
+	fileDir       = flag.String("file.dir", "", "通过 file 协议共享的目录，为空时不提供下载")
+	fileAuth      = flag.Bool("file.auth", true, "要求下载方出示本节点签发的令牌")
+	fileToken     = flag.String("file.token", "", "向其他节点出示的下载令牌")
+	fileDownloads = flag.String("file.downloads", "downloads", "下载文件的保存目录")
+	fileStore     = flag.String("file.store", "chunks", "按内容寻址的数据块存储目录")
+	fileSlots     = flag.Int("file.slots", 4, "所有节点共用的数据块发送名额，按节点差额轮询分配，0 表示不做公平调度")
+	filePeerRate  = flag.String("file.peer.rate", "", "每个节点的下载速率上限，例如 8mbit，为空表示不限制")
+	fileTFT       = flag.Bool("file.tft", false, "以牙还牙：限速从我们这里下载很多但很少回馈数据的节点")
+	fileTFTFree   = flag.Int("file.tft.free", 16, "以牙还牙的免费额度（MiB），下载量超过它之后才检查回馈")
+	fileTFTRatio  = flag.Float64("file.tft.ratio", 0.5, "回馈的数据不到下载量的这个倍数时限速")
+	fileTFTRate   = flag.String("file.tft.rate", "1mbit", "回馈太少的节点被限速到的速率")
+	fileBad       = flag.Float64("file.bad", 3, "坏数据分数（约为最近一小时内校验失败的数据块数）达到这个值的节点不再被请求数据块，驱逐时最先考虑，0 表示只统计")
+	fileBadDrop   = flag.Bool("file.bad.drop", false, "断开坏数据分数达到 -file.bad 的节点")
+
+	dialBudgetMax    = flag.Int("dial.budget", 0, "每个节点在 -dial.window 内最多拨号的次数（调度器、重连共用），0 表示不限制")
+	dialBudgetWindow = flag.Duration("dial.window", time.Hour, "拨号预算的统计窗口")
+	dialPace         = flag.Bool("dial.pace", false, "跟随节点发现路由表的重新验证安排拨号：优先拨号刚验证在线的节点，不拨号验证失败的节点")
+	dialPaceFresh    = flag.Duration("dial.pace.fresh", 5*time.Minute, "通过重新验证后这么长时间内算作刚验证在线")
+	enrDNS           = flag.String("enr.dns", "", "在节点记录中公告的主机名，适合 IP 经常变化的节点")
+	nextEndpointAddr = flag.String("endpoint.next", "", "在节点记录中预先公告的迁移目标端点 (ip:port)")
+
+	maxPeers          = flag.Int("peers.max", 50, "最大连接数（硬上限），默认值由 -profile 决定")
+	peersTarget       = flag.Int("peers.target", 0, "目标连接数，0 表示只使用 peers.max 作为上限")
+	peersHysteresis   = flag.Int("peers.hysteresis", 2, "目标连接数的回差，低于 target-hysteresis 时主动拨号")
+	peersShed         = flag.Bool("peers.shed", false, "连接数超过 target+hysteresis 时断开价值最低的节点")
+	peersHistory      = flag.String("peers.history", "", "节点历史文件，用于区分新节点和以前连接过的节点，为空时只保存在内存中")
+	peersInbound      = flag.Int("peers.inbound", 0, "为入站连接保留的名额百分比，0 表示使用 p2p.Server 默认的拨号比例")
+	eventBuffer       = flag.Int("events.buffer", defaultEventBuffer, "内存中保留的最近事件条数，可通过 admin_recentEvents 查询，默认值由 -profile 决定")
+	stallThreshold    = flag.Duration("stall.threshold", 250*time.Millisecond, "一次写入被对方阻塞超过这个时间时计为停滞")
+	stallEvict        = flag.Float64("stall.evict", 10, "停滞分数（约为最近几分钟内被阻塞的秒数）达到这个值的节点优先被驱逐，0 表示不考虑停滞")
+	compressAlgo      = flag.String("compress", defaultCompress, "与支持的节点协商 file、gossip 协议的载荷压缩: zstd|none")
+	gossipDeltaTopics = flag.String("gossip.delta", "", "使用差量编码发送的 gossip 主题（逗号分隔），适合频繁发布结构化状态的主题")
+	gossipTTL         = flag.String("gossip.ttl", "", "gossip 主题的消息有效期，格式为 topic=duration,...，* 匹配其他所有主题；过期的消息不再处理和转发")
+	gossipPrio        = flag.String("gossip.priority", "", "gossip 主题优先级，格式为 topic=high|low,...；带宽紧张时高优先级主题优先发送，低优先级主题只转发给部分节点")
+	gossipFanout      = flag.Int("gossip.fanout", 4, "带宽紧张时低优先级主题转发的节点数")
+	controlKey        = flag.String("control.key", "", "管理员公钥（节点 ID 或 enode URL），设置后执行由它签名的控制命令")
+	fleetURL          = flag.String("fleet.url", "", "机群协调者地址，设置后启动时登记并定期发送心跳")
+	fleetToken        = flag.String("fleet.token", "", "向协调者出示的共享令牌")
+	fleetName         = flag.String("fleet.name", "", "在协调者清单中显示的节点名称")
+	fleetInterval     = flag.Duration("fleet.interval", 30*time.Second, "向协调者发送心跳的间隔")
+	fleetConfigKey    = flag.String("fleet.config.key", "", "协调者配置签名者的节点 ID，设置后定期拉取并应用协调者下发的配置")
+	fleetConfigEvery  = flag.Duration("fleet.config.interval", defaultFleetConfigInterval, "拉取协调者配置的间隔")
+	compressMin       = flag.Int("compress.min", defaultCompressMin, "小于这个字节数的载荷不压缩")
+	capsMin           = flag.String("caps.min", "", "只保留通告了这些能力最低版本的节点，格式为 协议/版本,...（例如 chat/2），用于协议迁移时强制升级")
+	upgradeTarget     = flag.String("upgrade", "", "滚动升级要推广的协议版本（例如 chat/2）：宽限期后新版本占比达到阈值时切换为只接受新版本")
+	upgradeGrace      = flag.Duration("upgrade.grace", 24*time.Hour, "同时接受新旧版本的最短时间")
+	upgradeThreshold  = flag.Float64("upgrade.threshold", 0.9, "切换所需的新版本节点占比 (0-1]")
+	upgradePeers      = flag.Int("upgrade.peers", 3, "支持该协议的已连接节点少于这个数时不切换")
+	asnDBPath         = flag.String("asn.db", "", "iptoasn.com 格式的 ASN 数据库（TSV，可以是 .gz，多个文件用逗号分隔），设置后按远端 ASN 汇总带宽、建连时间和错误率")
+	discBlackhole     = flag.Duration("disc.blackhole", 2*time.Minute, "节点发现的 ping 在这么长时间内没有任何回应时告警 UDP 黑洞，0 表示不检测")
+	abAddr            = flag.String("ab.addr", "", "A/B 接纳实验：在这个地址上再运行一个临时身份 B，对比两个身份获得对等节点的速度")
+	abName            = flag.String("ab.name", "", "身份 B 公告的客户端名称，为空时与主身份相同")
+	abENR             = flag.String("ab.enr", "", "身份 B 额外公告的 ENR 条目，格式为 key=value,...")
+	slowStartRamp     = flag.Duration("slowstart", 0, "慢启动：启动后在这段时间内逐步放宽并发拨号数和拨号速率，0 表示不限制")
+	slowStartDials    = flag.Int("slowstart.dials", 2, "慢启动开始时的并发拨号数（也是每秒最多开始的拨号数）")
+	stabilityRebal    = flag.Bool("stability.rebalance", false, "在平静期内主动用健康的历史节点替换反复断开的不稳定节点")
+	stabilityInterval = flag.Duration("stability.interval", 5*time.Minute, "检查是否需要替换不稳定节点的间隔")
+	stabilityCalm     = flag.Duration("stability.calm", 10*time.Minute, "这么长时间内没有节点断开才算平静期")
+	reportEvery       = flag.Duration("report.every", time.Hour, "摘要报告的周期（按整点对齐），例如 1h 或 24h")
+	reportDir         = flag.String("report.dir", "", "写入摘要报告（JSON 和 Markdown）的目录")
+	reportWebhook     = flag.String("report.webhook", "", "以 JSON POST 摘要报告的 URL")
+	observeOnly       = flag.Bool("observe", false, "只读观察模式：完成握手但不发送任何应用消息、不转发 gossip，只接收和记录")
+	guardWindow       = flag.Duration("guard.window", 10*time.Minute, "冒充检测的窗口：同一 ID 在窗口内来自多个地址时告警，0 表示不检测")
+	guardEndpoints    = flag.Int("guard.endpoints", 2, "窗口内同一 ID 的不同 IP 数达到这个值时告警")
+	guardRefuse       = flag.Bool("guard.refuse", false, "在窗口内断开有歧义（疑似被冒充）的节点的连接")
+	recoveryRedial    = flag.Bool("recovery.redial", false, "检测到网络中断后立即按退避重拨中断前连接的节点，加速恢复")
+	ifacePoll         = flag.Duration("iface.poll", 5*time.Second, "检查网卡地址变化的间隔，变化时重新公告端点，0 表示不检查")
+	bwCapacity        = flag.String("bw.capacity", "", "链路带宽，例如 20mbit；可用带宽 = 链路带宽 - 实测的协议流量")
+	bwDisable         = flag.String("bw.disable", "", "可用带宽低于阈值时关闭的协议，格式为 proto<rate,...，例如 file<2mbit,gossip<512kbit")
+	enrWatchEvery     = flag.Duration("enr.watch.interval", time.Minute, "重新解析通过 admin_watchEnr 或订阅监视的节点记录的间隔")
+	metered           = flag.Bool("metered", false, "按流量计费模式：限制动态拨号的速率、优先保留已有会话，并统计每月流量")
+	meteredCap        = flag.Int("metered.cap", 0, "每月协议流量上限（MiB），达到后停止动态拨号直到下个月，0 表示不限制")
+	meteredWarn       = flag.String("metered.warn", "50,80,95", "达到 -metered.cap 的这些百分比时告警")
+	meteredDials      = flag.Float64("metered.dials", 12, "按流量计费模式下每小时的动态拨号数")
+	meteredStateFile  = flag.String("metered.state", "", "保存本月流量统计的文件，跨重启累计")
+	sloTargets        = flag.String("slo", "file/get=95%<1s,file/chunk=95%<500ms,file/list=95%<1s", "请求/响应协议的延迟 SLO，格式为 kind=percent%<duration,...，为空时不跟踪")
+	sloWindow         = flag.Int("slo.window", 50, "每个节点每种请求保留的最近延迟样本数")
+	sloDrop           = flag.Duration("slo.drop", 0, "持续未达到 SLO 超过这个时间的节点被断开，0 表示只在驱逐时优先考虑")
+	peersNotes        = flag.String("peers.notes", "", "节点备注文件，保存运营者给节点打的标签、备注和禁止连接，为空时只保存在内存中")
+	peersNotesSync    = flag.String("peers.notes.sync", "", "逗号分隔的机群节点 ID 或 enode URL，通过 gossip 与它们同步签名的节点备注")
+	peersEvict        = flag.String("peers.evict", evictReject, "连接已满时对支持 chat 协议的新入站节点的策略: reject|useful|idle")
 )
 
 // 加载或生成节点私钥
@@ -30,30 +135,51 @@ func loadOrGenerateNodeKey(path string) *ecdsa.PrivateKey {
 		// 文件存在，加载私钥
 		key, err := crypto.LoadECDSA(path)
 		if err != nil {
-			log.Fatalf("加载节点密钥失败: %v", err)
+			fatalf(failKey, "加载节点密钥失败: %v", err)
 		}
 		return key
 	} else if os.IsNotExist(err) {
 		// 文件不存在，生成新私钥
 		key, err := crypto.GenerateKey()
 		if err != nil {
-			log.Fatalf("生成节点密钥失败: %v", err)
+			fatalf(failKey, "生成节点密钥失败: %v", err)
 		}
 		// 确保目录存在
 		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			log.Fatalf("创建节点密钥目录失败: %v", err)
+			fatalf(failKey, "创建节点密钥目录失败: %v", err)
 		}
 		// 保存私钥到文件
 		if err := crypto.SaveECDSA(path, key); err != nil {
-			log.Fatalf("保存节点密钥失败: %v", err)
+			fatalf(failKey, "保存节点密钥失败: %v", err)
 		}
 		return key
 	} else {
-		log.Fatalf("检查节点密钥文件失败: %v", err)
+		fatalf(failKey, "检查节点密钥文件失败: %v", err)
 		return nil
 	}
 }
 
+// 与 -ephemeral 冲突的参数，它们都会在磁盘上保存状态
+var ephemeralExclusive = []string{"nodekey", "nodedb", "peers.history", "file.store", "metered.state", "peers.notes"}
+
+// ephemeralConflicts 返回显式设置过（命令行或配置文件）且与 -ephemeral 冲突的参数
+func ephemeralConflicts(fs *flag.FlagSet) []string {
+	var set []string
+	fs.Visit(func(f *flag.Flag) {
+		if slices.Contains(ephemeralExclusive, f.Name) {
+			set = append(set, "-"+f.Name)
+		}
+	})
+	return set
+}
+
+// isFlagSet 判断参数是否显式设置过
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
 // 解析引导节点
 func parseBootnodes(urls string) []*enode.Node {
 	if urls == "" {
@@ -74,38 +200,699 @@ func parseBootnodes(urls string) []*enode.Node {
 	return nodes
 }
 
+// addDialCandidates 把节点发现以外的拨号候选挂到一个还没有 DialCandidates 的协议上，
+// p2p.Server 会把所有协议的 DialCandidates 并入拨号调度，挂在哪个协议上都一样
+func addDialCandidates(protos []p2p.Protocol, it enode.Iterator) {
+	for i := len(protos) - 1; i >= 0; i-- {
+		if protos[i].DialCandidates == nil {
+			protos[i].DialCandidates = it
+			return
+		}
+	}
+	log.Printf("所有协议都已有拨号候选，忽略新的拨号候选")
+}
+
+// 订阅对等节点事件并更新相关指标
+func watchPeerEvents(srv *p2p.Server, m metrics.Metrics) {
+	var (
+		added   = m.Counter("demo/peers/added")
+		dropped = m.Counter("demo/peers/dropped")
+		peers   = m.Gauge("demo/peers/count")
+	)
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				added.Inc(1)
+			case p2p.PeerEventTypeDrop:
+				dropped.Inc(1)
+			}
+			peers.Set(int64(srv.PeerCount()))
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// 根据命令行参数创建 file 协议
+func setupFileProtocol(nodeKey *ecdsa.PrivateKey) *fileProtocol {
+	var root *os.Root
+	if *fileDir != "" {
+		var err error
+		if root, err = os.OpenRoot(*fileDir); err != nil {
+			fatalf(failStorage, "打开共享目录失败: %v", err)
+		}
+		log.Printf("共享目录: %s (需要令牌: %v)", *fileDir, *fileAuth)
+	}
+	var verifier *tokenVerifier
+	if *fileAuth {
+		verifier = &tokenVerifier{issuer: enode.PubkeyToIDV4(&nodeKey.PublicKey)}
+	}
+	var token []byte
+	if *fileToken != "" {
+		var err error
+		if token, err = decodeToken(*fileToken); err != nil {
+			fatalf(failConfig, "无效的下载令牌: %v", err)
+		}
+	}
+	store, err := newChunkStore(*fileStore)
+	if err != nil {
+		fatalf(failStorage, "打开数据块存储失败: %v", err)
+	}
+	return newFileProtocol(nodeKey, root, store, verifier, token)
+}
+
 func main() {
+	if err := setLogLang(os.Getenv(logLangEnv)); err != nil {
+		fatalf(failConfig, "%v", err)
+	}
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+	// -h 在解析到它时打印帮助，这时 -log.lang 已经解析，先按它切换语言
+	printUsage := flag.Usage
+	flag.Usage = func() {
+		setLogLang(*logLang)
+		printUsage()
+	}
 	flag.Parse()
+	if *configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, *configFile); err != nil {
+			fatalf(failConfig, "%v", err)
+		}
+	}
+	if err := setLogLang(*logLang); err != nil {
+		fatalf(failConfig, "%v", err)
+	}
 
-	// 加载或生成节点私钥
-	nodeKey := loadOrGenerateNodeKey(*nodeKeyFile)
+	profile, err := applyProfile(flag.CommandLine, *profileName)
+	if err != nil {
+		fatalf(failConfig, "%v", err)
+	}
+	network, err := applyNetwork(flag.CommandLine, *networkFlag)
+	if err != nil {
+		fatalf(failConfig, "%v", err)
+	}
+	features := &featureSet{discv4: true, discv5: *discv5, dnsdisc: network != nil && len(network.DNS) > 0, zstd: zstdCompiled && *compressAlgo == codecZstd}
+	var pairPeer *enode.Node
+	if *pairFlag != "" {
+		if *pairFlag != pairHost {
+			if pairPeer, err = decodePairCode(*pairFlag); err != nil {
+				fatalf(failConfig, "无效的 -pair: %v", err)
+			}
+		}
+		features.discv4, features.discv5, features.dnsdisc = false, false, false
+		network = nil
+	}
+	if *showVersion {
+		printVersion(*verbose, features)
+		return
+	}
+
+	// 故障记录最先创建，可选子系统的启动失败记录在这里
+	events := newEventBus(*eventBuffer)
+	faults := newFaultLog(events)
+
+	// 指标需要在启动服务器之前启用
+	m := setupMetrics(faults)
+	if *metricsEnabled && metricsCompiled {
+		features.metrics = metrics.NewSwitch(m)
+		m = features.metrics
+	}
+
+	// 加载或生成节点私钥，同一私钥和节点数据库只允许一个实例使用
+	var nodeKey *ecdsa.PrivateKey
+	var locks []*instanceLock
+	if *keySeed != "" {
+		if *ephemeral || isFlagSet(flag.CommandLine, "nodekey") {
+			fatalf(failConfig, "-key.seed 不能与 -ephemeral 或 -nodekey 同时使用")
+		}
+		if nodeKey, err = deriveNodeKey(*keySeed, *keyIndex); err != nil {
+			fatalf(failKey, "-key.seed: %v", err)
+		}
+		log.Printf("节点私钥由种子派生，序号 %d", *keyIndex)
+	} else if *ephemeral {
+		if set := ephemeralConflicts(flag.CommandLine); len(set) > 0 {
+			fatalf(failConfig, "-ephemeral 不能与 %s 同时使用", strings.Join(set, "、"))
+		}
+		if nodeKey, err = crypto.GenerateKey(); err != nil {
+			fatalf(failKey, "生成节点密钥失败: %v", err)
+		}
+		// 数据块只保存在内存中，节点数据库和节点历史保持默认的内存模式
+		*fileStore = ""
+		log.Printf("临时身份模式：节点私钥和所有状态只保存在内存中")
+	} else {
+		lock, err := lockInstance("节点私钥 "+*nodeKeyFile, *nodeKeyFile, *listenAddr)
+		if err != nil {
+			fatalf(failureCodeOf(err), "%v", err)
+		}
+		locks = append(locks, lock)
+		nodeKey = loadOrGenerateNodeKey(*nodeKeyFile)
+	}
+	if *nodeDB != "" {
+		lock, err := lockInstance("节点数据库 "+*nodeDB, filepath.Clean(*nodeDB), *listenAddr)
+		if err != nil {
+			fatalf(failureCodeOf(err), "%v", err)
+		}
+		locks = append(locks, lock)
+	}
+	defer func() {
+		for _, l := range locks {
+			l.release()
+		}
+	}()
 	nodeID := enode.PubkeyToIDV4(&nodeKey.PublicKey)
 	log.Printf("节点 ID: %s", nodeID.String())
+	log.Printf("版本 %s，构建配置 %s", nodeVersion, buildProfile)
+
+	// 所有出站拨号都经过门控检查
+	gate := newGater()
+	dialer := newNodeDialer(gate)
+	setup := newSetupTracker(m)
+	dialer.setup = setup
+	dialer.budget = newDialBudget(*dialBudgetMax, *dialBudgetWindow)
+	dialer.slow = newSlowStart(*slowStartRamp, *slowStartDials)
+	dialer.network = network.filter(m)
+
+	// 启用驱逐时由 evictor 执行 peers.max，p2p.Server 的上限留出余量
+	if err := validEvictPolicy(*peersEvict); err != nil {
+		fatalf(failConfig, "%v", err)
+	}
+	serverMaxPeers := *maxPeers
+	if *peersEvict != evictReject {
+		serverMaxPeers += evictHeadroom
+	}
+
+	natm, err := nat.Parse(*natSpec)
+	if err != nil {
+		fatalf(failNAT, "无效的 -nat: %v", err)
+	}
+	var restrict *netutil.Netlist
+	if *netrestrict != "" {
+		if restrict, err = netutil.ParseNetlist(*netrestrict); err != nil {
+			fatalf(failConfig, "无效的 -netrestrict: %v", err)
+		}
+	}
+
+	listen, fallbackReason, err := chooseListenAddr(*listenAddr, *addrFallback)
+	if err != nil {
+		fatalf(failBind, "-addr: %v", err)
+	}
+	if fallbackReason != "" {
+		log.Printf("监听地址 %s 不可用 (%s)，改用 %s", *listenAddr, fallbackReason, listen)
+	}
 
 	// 创建本地节点配置
 	cfg := p2p.Config{
 		PrivateKey:     nodeKey,
-		MaxPeers:       50,
+		MaxPeers:       serverMaxPeers,
 		Name:           "minimal-devp2p-node",
-		ListenAddr:     *listenAddr,
-		NAT:            nat.Any(),
+		ListenAddr:     listen,
+		NAT:            natm,
+		NetRestrict:    restrict,
 		NoDiscovery:    false,
 		DiscoveryV4:    true,
+		DiscoveryV5:    *discv5,
 		BootstrapNodes: parseBootnodes(*bootnodes),
+		StaticNodes:    parseBootnodes(*staticPeers),
+		NodeDatabase:   *nodeDB,
+		Dialer:         dialer,
+	}
+	// 配对模式只和配对的节点连接
+	if *pairFlag != "" {
+		cfg.NoDiscovery, cfg.DiscoveryV4, cfg.DiscoveryV5, cfg.BootstrapNodes = true, false, false, nil
+		if pairPeer != nil {
+			cfg.StaticNodes = append(cfg.StaticNodes, pairPeer)
+			log.Printf("配对模式: 直接连接 %s", pairPeer.URLv4())
+		}
 	}
 
 	// 创建 P2P 服务器
 	srv := p2p.Server{Config: cfg}
+	if *peersInbound > 0 {
+		slots, err := newInboundReserve(&srv, *maxPeers, *peersInbound)
+		if err != nil {
+			fatalf(failConfig, "%v", err)
+		}
+		srv.DialRatio = slots.dialRatio()
+		dialer.slots = slots
+	}
+	history, err := loadPeerHistory(*peersHistory)
+	if err != nil {
+		fatalf(failStorage, "加载节点历史失败: %v", err)
+	}
+	store := newPeerStore(history)
+	store.faults = faults
+	defer func() {
+		// 服务器已经停止，把仍在进行的会话计入历史
+		store.closeSessions()
+		if err := history.save(); err != nil {
+			log.Printf("保存节点历史失败: %v", err)
+		}
+	}()
+	reasons := newDialReasons(cfg.BootstrapNodes, cfg.StaticNodes, m)
+	dialer.reasons = reasons
+	store.reasons = reasons
+	var guard *impersonationGuard
+	if *guardWindow > 0 {
+		guard = newImpersonationGuard(guardConfig{Window: *guardWindow, Endpoints: *guardEndpoints, Refuse: *guardRefuse}, &srv, events, cfg.StaticNodes)
+		store.guard = guard
+	}
+	chat := newChatProtocol(&srv, store, events)
+	chat.reasons = reasons
+	usage := newUsageTracker(quotaConfig{Window: *quotaWindow, MaxMsgs: *quotaMsgs, MaxBytes: *quotaBytes}, m)
+	reasons.traffic = usage.value
+	var mm *meteredMode
+	if *metered {
+		warn, err := parseMeteredWarn(*meteredWarn)
+		if err != nil {
+			fatalf(failConfig, "-metered.warn: %v", err)
+		}
+		mm, err = newMeteredMode(meteredConfig{Cap: uint64(*meteredCap) << 20, Warn: warn, Dials: *meteredDials, State: *meteredStateFile}, usage, events, m)
+		if err != nil {
+			fatalf(failStorage, "读取流量统计失败: %v", err)
+		}
+		mm.faults = faults
+		dialer.metered = mm
+	}
+	files := setupFileProtocol(nodeKey)
+	reconn := newReconnector(&srv, dialer, events)
+	reconn.store = store
+	files.reconn = reconn
+	var target *peerTarget
+	if *peersTarget > 0 {
+		if *peersTarget > *maxPeers || *peersHysteresis < 0 {
+			fatalf(failConfig, "无效的目标连接数: target=%d hysteresis=%d max=%d", *peersTarget, *peersHysteresis, *maxPeers)
+		}
+		target = newPeerTarget(*peersTarget, *peersHysteresis, *peersShed, dialer, store, usage)
+		dialer.target = target
+	}
+	gossip := newGossipProtocol(enode.PubkeyToIDV4(&nodeKey.PublicKey), profile.gossipSeenCache, profile.gossipQueue)
+	features.gossip = gossip
+	stalls := newStallTracker(*stallThreshold, events)
+	var slo *sloTracker
+	if *sloTargets != "" {
+		targets, err := parseSLOTargets(*sloTargets)
+		if err != nil {
+			fatalf(failConfig, "-slo: %v", err)
+		}
+		slo = newSLOTracker(targets, *sloWindow, *sloDrop, events, m)
+		files.slo = slo
+	}
+	gossip.stalls = stalls
+	codec, err := newPayloadCodec(*compressAlgo, *compressMin, fileMaxMsgSize, m)
+	if err != nil {
+		fatalf(failConfig, "-compress: %v", err)
+	}
+	files.codec = codec
+	if *fileSlots > 0 {
+		var rate float64
+		if *filePeerRate != "" {
+			if rate, err = parseBitRate(*filePeerRate); err != nil {
+				fatalf(failConfig, "无效的 -file.peer.rate: %v", err)
+			}
+		}
+		files.sched = newFileScheduler(*fileSlots, rate/8)
+	}
+	tft := tftConfig{Enabled: *fileTFT, Free: uint64(*fileTFTFree) << 20, Ratio: *fileTFTRatio}
+	if tft.Enabled {
+		rate, err := parseBitRate(*fileTFTRate)
+		if err != nil {
+			fatalf(failConfig, "无效的 -file.tft.rate: %v", err)
+		}
+		tft.Rate = rate / 8
+	}
+	files.ledger = newFileLedger(tft, events)
+	files.corrupt = newCorruptTracker(*fileBad, *fileBadDrop, events, m)
+	files.corrupt.srv = &srv
+	if files.sched != nil {
+		files.sched.throttle = files.ledger.rate
+	}
+	gossip.codec = codec
+	gossip.deltaTopics = make(map[string]bool)
+	for _, topic := range strings.Split(*gossipDeltaTopics, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			gossip.deltaTopics[topic] = true
+		}
+	}
+	if *gossipTTL != "" {
+		ttls, err := parseTopicTTLs(*gossipTTL)
+		if err != nil {
+			fatalf(failConfig, "-gossip.ttl: %v", err)
+		}
+		gossip.expiry = newGossipExpiry(ttls)
+	}
+	if *gossipPrio != "" {
+		prios, err := parseTopicPriorities(*gossipPrio)
+		if err != nil {
+			fatalf(failConfig, "-gossip.priority: %v", err)
+		}
+		gossip.priorities = newGossipPriorities(prios, *gossipFanout)
+	}
+	// 中断信号和 shutdown 控制命令都会关闭节点
+	interrupt := make(chan os.Signal, 1)
+	var admin enode.ID
+	if *controlKey != "" {
+		if admin, err = parseNodeID(*controlKey); err != nil {
+			fatalf(failConfig, "-control.key: %v", err)
+		}
+	}
+	control := newControlHandler(admin, gossip.self, &srv, gossip, events, func() {
+		select {
+		case interrupt <- syscall.SIGTERM:
+		default:
+		}
+	})
+	dialer.control = control
+	notes, err := loadPeerNotes(*peersNotes, nodeKey, events)
+	if err != nil {
+		fatalf(failStorage, "加载节点备注失败: %v", err)
+	}
+	notes.onBan = func(id enode.ID) { disconnectPeer(&srv, id) }
+	notes.faults = faults
+	if *peersNotesSync != "" {
+		fleet, err := parseFleetIDs(*peersNotesSync)
+		if err != nil {
+			fatalf(failConfig, "-peers.notes.sync: %v", err)
+		}
+		notes.startSync(fleet, gossip)
+	}
+	control.notes = notes
+	store.notes = notes
+	pins, err := parseCapPins(*capsMin)
+	if err != nil {
+		fatalf(failConfig, "-caps.min: %v", err)
+	}
+	pinner := newCapPinner(&srv, events, pins)
+	var upgrade *upgradeController
+	if *upgradeTarget != "" {
+		name, version, err := parseUpgrade(*upgradeTarget)
+		if err != nil {
+			fatalf(failConfig, "-upgrade: %v", err)
+		}
+		upgrade = newUpgradeController(upgradeConfig{Name: name, Version: version, Grace: *upgradeGrace, Threshold: *upgradeThreshold, MinPeers: *upgradePeers}, &srv, pinner)
+	}
+	content := newContentIndex(gossip, files, srv.Self)
+	conform := newConformTracker(*conformEvery, *conformPing, events)
+	phases := protocolPhases{"chat": chat.peers, "file": files.peers, "gossip": gossip.peers, "conf": conform.peers}
+	var asn *asnTracker
+	if *asnDBPath != "" {
+		if db, err := loadASNDB(*asnDBPath); err != nil {
+			faults.degrade("geoip", failStorage, err)
+		} else {
+			log.Printf("已加载 ASN 数据库: %d 个地址段", len(db.ranges))
+			asn = newASNTracker(db, m)
+			dialer.asn = asn
+			features.asn = true
+		}
+	}
+	if *peersLocal > 0 {
+		var db *asnDB
+		country := *peersLocalCountry
+		if asn != nil {
+			db = asn.db
+		} else if *asnDBPath != "" && country != "" {
+			log.Printf("ASN 数据库不可用，-peers.local 只按建连时间判断附近的节点")
+			country = ""
+		}
+		local, err := newLocalityPolicy(&srv, *maxPeers, *peersLocal, *peersLocalRTT, country, db)
+		if err != nil {
+			fatalf(failConfig, "-peers.local: %v", err)
+		}
+		dialer.local = local
+	}
+	var obs *observer
+	if *observeOnly {
+		obs = newObserver()
+		gossip.relaying.Store(false)
+		gossip.passive = true
+		files.passive = true
+		chat.passive = true
+		conform.passive = true
+		log.Println("只读观察模式：不发送应用消息，不转发 gossip")
+	}
+	var bandwidth *bandwidthGovernor
+	if *bwDisable != "" {
+		capacity, err := parseBitRate(*bwCapacity)
+		if err != nil {
+			fatalf(failConfig, "无效的 -bw.capacity: %v", err)
+		}
+		rules, err := parseBandwidthRules(*bwDisable)
+		if err != nil {
+			fatalf(failConfig, "无效的 -bw.disable: %v", err)
+		}
+		bandwidth = newBandwidthGovernor(usage, events, capacity, rules)
+	}
+	protos := pinnedProtocols(append(chat.protocols(), files.protocol(), gossip.protocol(), conform.protocol()), pins)
+	if it, err := network.dialCandidates(dialer.network); err != nil {
+		faults.degrade("discovery.dns", failDiscovery, err)
+		features.dnsdisc = false
+	} else if it != nil {
+		addDialCandidates(protos, it)
+	}
+	if *dialPace {
+		dialer.pace = newDialPacer(&srv, *dialPaceFresh, m)
+		addDialCandidates(protos, dialer.pace.candidates())
+	}
+	for _, proto := range protos {
+		proto = setup.protocol(events.protocol(usage.protocol(stalls.protocol(features.protocol(bandwidth.protocol(upgrade.protocol(proto)))))))
+		if asn != nil {
+			proto = asn.protocol(proto)
+		}
+		// 观察模式的包装必须在最外层
+		if obs != nil {
+			proto = obs.protocol(proto)
+		}
+		srv.Protocols = append(srv.Protocols, proto)
+	}
+	var affinity *peerAffinity
+	if *peersAffinity > 0 && *peersHistory != "" {
+		affinity = newPeerAffinity(&srv, dialer, history, events, *peersAffinity)
+		dialer.affinity = affinity
+	}
+	var abSrv *p2p.Server
+	if *abAddr != "" {
+		abSrv, err = newABServer(cfg, *abAddr, *abName, gate, enode.PubkeyToIDV4(&nodeKey.PublicKey), func(b *p2p.Server) []p2p.Protocol {
+			chunks, _ := newChunkStore("")
+			bfiles := newFileProtocol(b.PrivateKey, nil, chunks, nil, nil)
+			bfiles.codec = codec
+			bgossip := newGossipProtocol(enode.PubkeyToIDV4(&b.PrivateKey.PublicKey), profile.gossipSeenCache, profile.gossipQueue)
+			bgossip.codec = codec
+			return append(newChatProtocol(b, newPeerStore(nil), events).protocols(), bfiles.protocol(), bgossip.protocol())
+		})
+		if err != nil {
+			fatalf(failKey, "创建 A/B 实验身份失败: %v", err)
+		}
+		dialer.sibling = enode.PubkeyToIDV4(&abSrv.PrivateKey.PublicKey)
+	}
 
 	// 启动 P2P 服务器
 	if err := srv.Start(); err != nil {
-		log.Fatalf("启动 P2P 服务器失败: %v", err)
+		fatalf(listenFailure(err), "启动 P2P 服务器失败: %v", err)
 	}
 	defer srv.Stop()
+	for _, l := range locks {
+		l.setAddrs(srv.ListenAddr, *rpcAddr)
+	}
+	if affinity != nil {
+		go affinity.run()
+	}
+	var ab *abExperiment
+	if abSrv != nil {
+		entries, err := parseENREntries(*abENR)
+		if err != nil {
+			fatalf(failConfig, "-ab.enr: %v", err)
+		}
+		if err := abSrv.Start(); err != nil {
+			fatalf(listenFailure(err), "启动 A/B 实验身份失败: %v", err)
+		}
+		defer abSrv.Stop()
+		ab = newABExperiment(newABArm("A", &srv, nil), newABArm("B", abSrv, entries))
+		go ab.run()
+	}
+
+	go watchPeerEvents(&srv, m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if mm != nil {
+		meteredCtx, stopMetered := context.WithCancel(ctx)
+		meteredDone := make(chan struct{})
+		go func() {
+			mm.run(meteredCtx)
+			close(meteredDone)
+		}()
+		// 关闭时保存最后的流量统计
+		defer func() {
+			stopMetered()
+			<-meteredDone
+		}()
+	}
+	go content.run(ctx)
+	go store.track(&srv, events)
+	go events.trackPeers(&srv)
+	go gate.enforceInbound(&srv)
+	go control.enforce(&srv)
+	if *peersNotesSync != "" {
+		go notes.run(ctx)
+	}
+	go pinner.enforce()
+	if guard != nil {
+		go guard.run()
+	}
+	if asn != nil {
+		go asn.track(&srv)
+	}
+	if upgrade != nil {
+		go upgrade.run()
+	}
+	stability := newStabilityTracker(stabilityConfig{Rebalance: *stabilityRebal, Interval: *stabilityInterval, Calm: *stabilityCalm}, &srv, dialer, store, events)
+	go stability.run()
+	recovery := newRecoveryTracker(&srv, dialer, store, events, *recoveryRedial, m)
+	go recovery.run()
+	if bandwidth != nil {
+		go bandwidth.run()
+	}
+	var iface *ifaceWatch
+	if *ifacePoll > 0 {
+		iface = newIfaceWatch(&srv, events, recovery, *ifacePoll)
+		iface.faults = faults
+		go iface.run()
+	}
+	if dialer.pace != nil {
+		go dialer.pace.run(ctx)
+	}
+	if slo != nil {
+		go slo.run(&srv)
+	}
+	var blackhole *blackholeWatch
+	if *discBlackhole > 0 {
+		blackhole = newBlackholeWatch(&srv, events, cfg.BootstrapNodes, *discBlackhole, m)
+		go blackhole.run(ctx)
+	}
+	if *peersEvict != evictReject {
+		ev := newEvictor(*peersEvict, *maxPeers, usage, store, events, stalls, *stallEvict)
+		ev.slo = slo
+		ev.corrupt = files.corrupt
+		go ev.run(&srv)
+	}
+
+	var summary *summaryCollector
+	if *reportDir != "" || *reportWebhook != "" {
+		if *reportDir != "" {
+			if err := os.MkdirAll(*reportDir, 0o755); err != nil {
+				fatalf(failStorage, "创建报告目录失败: %v", err)
+			}
+		}
+		summary = newSummaryCollector(summaryConfig{Every: *reportEvery, Dir: *reportDir, Webhook: *reportWebhook}, &srv, usage, reasons)
+		summary.faults = faults
+		summaryCtx, stopSummary := context.WithCancel(ctx)
+		summaryDone := make(chan struct{})
+		go func() {
+			summary.run(summaryCtx)
+			close(summaryDone)
+		}()
+		// 关闭时等待最后一份部分报告写出
+		defer func() {
+			stopSummary()
+			<-summaryDone
+		}()
+	}
+
+	var remote *remoteConfig
+	if *fleetURL != "" {
+		fleet := newFleetClient(*fleetURL, *fleetToken, *fleetName, *fleetInterval, &srv)
+		if *fleetConfigKey != "" {
+			signer, err := parseNodeID(*fleetConfigKey)
+			if err != nil {
+				fatalf(failConfig, "-fleet.config.key: %v", err)
+			}
+			remote = newRemoteConfig(signer, *fleetConfigEvery, &srv, control, cfg.BootstrapNodes)
+			remote.reasons = reasons
+			fleet.config = remote
+		}
+		fleetCtx, stopFleet := context.WithCancel(ctx)
+		fleetDone := make(chan struct{})
+		go func() {
+			fleet.run(fleetCtx)
+			close(fleetDone)
+		}()
+		// 关闭时先等待注销请求发出
+		defer func() {
+			stopFleet()
+			<-fleetDone
+		}()
+	}
+	if *crawlServe != "" {
+		startCrawlServer(*crawlServe, remote.crawlOut)
+	}
+
+	// 重要节点断线自动重连
+	reconn.start()
+	defer reconn.stop()
+
+	if target != nil {
+		target.start(&srv)
+		defer target.stop()
+	}
+
+	port := newListenPortInfo(&srv, *listenAddr, fallbackReason)
+
+	var pair *pairInfo
+	if *pairFlag == pairHost {
+		self, err := pairNode(srv.Self(), srv.ListenAddr)
+		if err == nil {
+			pair, err = newPairInfo(self)
+		}
+		if err != nil {
+			fatalf(failInternal, "生成配对码失败: %v", err)
+		}
+	}
+
+	if *rpcAddr != "" {
+		enr := newENRWatcher(&srv, store, events, *enrWatchEvery)
+		go enr.run()
+		api := &adminAPI{srv: &srv, gater: gate, chat: chat, usage: usage, files: files, content: content, target: target, events: events, features: features, phases: phases, stalls: stalls, codec: codec, gossip: gossip, control: control, remote: remote, history: history, pinner: pinner, upgrade: upgrade, asn: asn, blackhole: blackhole, ab: ab, stability: stability, summary: summary, observer: obs, guard: guard, recovery: recovery, iface: iface, bandwidth: bandwidth, enr: enr, dialer: dialer, reasons: reasons, metered: mm, pace: dialer.pace, slo: slo, pair: pair, notes: notes, setup: setup, port: port, local: dialer.local, conform: conform, faults: faults, affinity: affinity, reconn: reconn}
+		stopRPC, err := startRPC(*rpcAddr, api)
+		if err != nil {
+			fatalf(listenFailure(err), "启动 RPC 服务失败: %v", err)
+		}
+		defer stopRPC()
+	}
 
 	// 打印节点信息
 	localNode := srv.LocalNode()
+	if *enrDNS != "" {
+		if !validHostname(*enrDNS) {
+			fatalf(failConfig, "无效的主机名 %q", *enrDNS)
+		}
+		localNode.Set(dnsName(*enrDNS))
+	}
+	if *crawlOptOut {
+		localNode.Set(noCrawl{})
+	}
+	if *nextEndpointAddr != "" {
+		ep, err := parseEndpoint(*nextEndpointAddr)
+		if err != nil {
+			fatalf(failConfig, "无效的迁移目标端点: %v", err)
+		}
+		announceNextEndpoint(localNode, ep)
+	}
 	log.Printf("启动成功，enode: %s", localNode.Node().URLv4())
+	if pair != nil {
+		if *pairQR {
+			log.Printf("用另一台设备扫描 enode URL:\n%s", pair.qr.terminal())
+		}
+		log.Printf("配对码: %s", pair.Code)
+		log.Printf("在另一台机器上运行: go run . -pair %s", pair.Code)
+		if *rpcAddr != "" && rpcCompiled {
+			log.Printf("浏览器打开 http://%s/pair 显示二维码", *rpcAddr)
+		}
+	}
 
 	// 定期打印连接的对等节点信息
 	go func() {
@@ -116,8 +903,9 @@ func main() {
 	}()
 
 	// 等待中断信号退出
-	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-interrupt
 	log.Println("关闭节点...")
+	phases.drainAll(&srv)
+	chat.goAway("shutdown")
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var errManifestSigner = errors.New("清单签名与节点身份不符")
+
+// manifestEntry 描述共享目录中的一个文件。
+// Hash 是整个文件内容的 SHA-256，Chunks 是按 fileChunkSize 切分后各数据块的哈希。
+type manifestEntry struct {
+	Path   string        `json:"path"`
+	Size   uint64        `json:"size"`
+	Hash   common.Hash   `json:"hash"`
+	Chunks []common.Hash `json:"chunks"`
+}
+
+// fileManifest 是共享目录的文件清单，由提供文件的节点签名
+type fileManifest struct {
+	Created uint64          `json:"created"`
+	Entries []manifestEntry `json:"entries"`
+	Sig     []byte          `json:"-"`
+}
+
+func (m *fileManifest) sigHash() []byte {
+	payload, _ := rlp.EncodeToBytes([]interface{}{m.Created, m.Entries})
+	return crypto.Keccak256(payload)
+}
+
+func (m *fileManifest) sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(m.sigHash(), key)
+	m.Sig = sig
+	return err
+}
+
+// verify 检查清单确实由 signer 签发
+func (m *fileManifest) verify(signer enode.ID) error {
+	pub, err := crypto.SigToPub(m.sigHash(), m.Sig)
+	if err != nil {
+		return err
+	}
+	if enode.PubkeyToIDV4(pub) != signer {
+		return errManifestSigner
+	}
+	return nil
+}
+
+// find 按路径查找清单条目
+func (m *fileManifest) find(path string) (manifestEntry, bool) {
+	for _, e := range m.Entries {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return manifestEntry{}, false
+}
+
+type cachedHash struct {
+	size    int64
+	modTime time.Time
+	hash    common.Hash
+	chunks  []common.Hash
+}
+
+// manifestBuilder 遍历共享目录生成清单，同时把文件切块存入数据块存储。
+// 按大小和修改时间缓存结果，避免每次 LIST 都重新读取所有文件。
+type manifestBuilder struct {
+	root  *os.Root
+	key   *ecdsa.PrivateKey
+	store *chunkStore
+
+	mu     sync.Mutex
+	hashes map[string]cachedHash
+}
+
+func newManifestBuilder(root *os.Root, key *ecdsa.PrivateKey, store *chunkStore) *manifestBuilder {
+	return &manifestBuilder{root: root, key: key, store: store, hashes: make(map[string]cachedHash)}
+}
+
+// reset 清空缓存，下次生成清单时重新读取所有文件（例如数据块存储中的数据被删除后）
+func (b *manifestBuilder) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	clear(b.hashes)
+}
+
+func (b *manifestBuilder) build() (*fileManifest, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m := &fileManifest{Created: uint64(time.Now().Unix())}
+	seen := make(map[string]bool)
+	fsys := b.root.FS()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c, ok := b.hashes[path]
+		if !ok || c.size != info.Size() || !c.modTime.Equal(info.ModTime()) {
+			h, chunks, err := ingestFile(fsys, path, b.store)
+			if err != nil {
+				return err
+			}
+			c = cachedHash{size: info.Size(), modTime: info.ModTime(), hash: h, chunks: chunks}
+			b.hashes[path] = c
+		}
+		seen[path] = true
+		m.Entries = append(m.Entries, manifestEntry{Path: path, Size: uint64(c.size), Hash: c.hash, Chunks: c.chunks})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for path := range b.hashes {
+		if !seen[path] {
+			delete(b.hashes, path)
+		}
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, m.sign(b.key)
+}
+
+// ingestFile 计算文件哈希并把文件切块存入 store，返回文件哈希和各数据块哈希
+func ingestFile(fsys fs.FS, path string, store *chunkStore) (common.Hash, []common.Hash, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	defer f.Close()
+
+	var (
+		h      = sha256.New()
+		chunks []common.Hash
+		buf    = make([]byte, fileChunkSize)
+	)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			ch, perr := store.put(buf[:n])
+			if perr != nil {
+				return common.Hash{}, nil, perr
+			}
+			chunks = append(chunks, ch)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+	}
+	return common.BytesToHash(h.Sum(nil)), chunks, nil
+}
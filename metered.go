@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 按流量计费的连接（手机热点、按量付费的云主机等）：开启 -metered 后，
+// p2p.Server 拨号调度器发起的动态拨号按 -metered.dials 每小时的速率排队，不再频繁用新连接
+// 替换已有会话；排队的拨号占着调度器的名额，调度器也就不再从节点发现中取新节点，
+// 节点发现的查找随之减少。重连等本节点自己发起的拨号不受影响，以保住已有的会话。
+// 同时按自然月累计协议消息的收发字节数（不含 RLPx 握手和节点发现的开销），达到
+// -metered.cap 的各个 -metered.warn 百分比时告警，达到上限后停止所有动态拨号直到下个月。
+const (
+	evMeteredWarning = "metered.warning"
+	evMeteredCap     = "metered.cap"
+
+	meteredSample   = time.Minute
+	meteredBurst    = 3 // 动态拨号令牌桶的容量
+	meteredMonthFmt = "2006-01"
+)
+
+var errMeteredCap = errors.New("本月流量已达 -metered.cap 上限")
+
+type meteredConfig struct {
+	Cap   uint64  // 每月字节数上限，0 表示不限制
+	Warn  []int   // 告警的百分比，从小到大
+	Dials float64 // 每小时的动态拨号数
+	State string  // 保存本月用量的文件，为空时只保存在内存中
+}
+
+// parseMeteredWarn 解析 -metered.warn 参数，例如 50,80,95
+func parseMeteredWarn(s string) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pct, err := strconv.Atoi(strings.TrimSuffix(item, "%"))
+		if err != nil || pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("无效的告警百分比 %q，应为 1-100", item)
+		}
+		list = append(list, pct)
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+// meteredState 是 -metered.state 文件的内容
+type meteredState struct {
+	Month  string `json:"month"`
+	Bytes  uint64 `json:"bytes"`
+	Warned int    `json:"warned"` // 本月已告警的最高百分比
+}
+
+// meteredStatus 是 admin_metered 的返回值
+type meteredStatus struct {
+	Month        string  `json:"month"`
+	Bytes        uint64  `json:"bytes"`
+	Cap          uint64  `json:"cap,omitempty"`
+	Percent      float64 `json:"percent,omitempty"`
+	Warned       int     `json:"warned,omitempty"`
+	Over         bool    `json:"over"`
+	DialsPerHour float64 `json:"dialsPerHour"`
+	Waiting      int     `json:"waiting"` // 排队等待的动态拨号数
+}
+
+// meteredMode 限制动态拨号并统计每月流量
+type meteredMode struct {
+	cfg    meteredConfig
+	usage  *usageTracker
+	events *eventBus
+	gauge  metrics.Gauge
+	faults *faultLog // 记录保存流量统计的故障，可以为 nil
+
+	mu      sync.Mutex
+	state   meteredState
+	last    protoUsage
+	tokens  float64
+	refill  time.Time
+	waiting int
+	changed chan struct{} // 上限状态变化时关闭
+}
+
+func newMeteredMode(cfg meteredConfig, usage *usageTracker, events *eventBus, m metrics.Metrics) (*meteredMode, error) {
+	mm := &meteredMode{
+		cfg:     cfg,
+		usage:   usage,
+		events:  events,
+		gauge:   m.Gauge("demo/metered/bytes"),
+		state:   meteredState{Month: time.Now().Format(meteredMonthFmt)},
+		tokens:  meteredBurst,
+		refill:  time.Now(),
+		changed: make(chan struct{}),
+	}
+	if cfg.State != "" {
+		data, err := os.ReadFile(cfg.State)
+		switch {
+		case err == nil:
+			var st meteredState
+			if err := json.Unmarshal(data, &st); err != nil {
+				return nil, fmt.Errorf("%s: %v", cfg.State, err)
+			}
+			if st.Month == mm.state.Month {
+				mm.state = st
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+	return mm, nil
+}
+
+// over 返回本月流量是否已达上限，调用方必须持有 mm.mu
+func (mm *meteredMode) over() bool {
+	return mm.cfg.Cap > 0 && mm.state.Bytes >= mm.cfg.Cap
+}
+
+// wait 等待一个动态拨号的令牌，流量达到上限时一直等到下个月。mm 可以为 nil
+func (mm *meteredMode) wait(ctx context.Context) error {
+	if mm == nil {
+		return nil
+	}
+	mm.mu.Lock()
+	mm.waiting++
+	defer func() {
+		mm.mu.Lock()
+		mm.waiting--
+		mm.mu.Unlock()
+	}()
+	for {
+		now := time.Now()
+		mm.tokens = min(meteredBurst, mm.tokens+mm.cfg.Dials/3600*now.Sub(mm.refill).Seconds())
+		mm.refill = now
+		var delay time.Duration
+		switch {
+		case mm.over():
+			delay = -1
+		case mm.tokens >= 1:
+			mm.tokens--
+			mm.mu.Unlock()
+			return nil
+		default:
+			delay = time.Duration((1 - mm.tokens) / mm.cfg.Dials * float64(time.Hour))
+		}
+		changed := mm.changed
+		mm.mu.Unlock()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if delay >= 0 {
+			timer = time.NewTimer(delay)
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			mm.mu.Lock()
+			over := mm.over()
+			mm.mu.Unlock()
+			if over {
+				return errMeteredCap
+			}
+			return ctx.Err()
+		case <-changed:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		mm.mu.Lock()
+	}
+}
+
+// sample 累计本月的流量，跨月时清零，达到告警百分比时记录日志和事件
+func (mm *meteredMode) sample() {
+	u := mm.usage.totals()
+	now := time.Now()
+	mm.mu.Lock()
+	wasOver := mm.over()
+	if month := now.Format(meteredMonthFmt); month != mm.state.Month {
+		log.Printf("进入新的计费月 %s，上月流量 %s", month, formatBytes(mm.state.Bytes))
+		mm.state = meteredState{Month: month}
+	}
+	mm.state.Bytes += u.BytesIn - mm.last.BytesIn + u.BytesOut - mm.last.BytesOut
+	mm.last = u
+	var crossed []int
+	if mm.cfg.Cap > 0 {
+		pct := float64(mm.state.Bytes) / float64(mm.cfg.Cap) * 100
+		for _, w := range mm.cfg.Warn {
+			if w > mm.state.Warned && pct >= float64(w) {
+				crossed = append(crossed, w)
+				mm.state.Warned = w
+			}
+		}
+	}
+	isOver, st := mm.over(), mm.state
+	if isOver != wasOver {
+		close(mm.changed)
+		mm.changed = make(chan struct{})
+	}
+	mm.mu.Unlock()
+	mm.gauge.Set(int64(st.Bytes))
+
+	if len(crossed) > 0 {
+		w := crossed[len(crossed)-1]
+		log.Printf("本月流量 %s 已达上限 %s 的 %d%%", formatBytes(st.Bytes), formatBytes(mm.cfg.Cap), w)
+		mm.events.emit(evMeteredWarning, enode.ID{}, fmt.Sprintf("percent=%d bytes=%d cap=%d", w, st.Bytes, mm.cfg.Cap))
+	}
+	if isOver && !wasOver {
+		log.Printf("本月流量已达上限 %s，停止动态拨号直到下个月", formatBytes(mm.cfg.Cap))
+		mm.events.emit(evMeteredCap, enode.ID{}, fmt.Sprintf("bytes=%d cap=%d", st.Bytes, mm.cfg.Cap))
+	}
+	if mm.cfg.State != "" {
+		if err := mm.save(st); err != nil {
+			log.Printf("保存流量统计失败: %v", err)
+			mm.faults.fail("metered.state", failStorage, err)
+		} else {
+			mm.faults.ok("metered.state")
+		}
+	}
+}
+
+func (mm *meteredMode) save(st meteredState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := mm.cfg.State + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, mm.cfg.State)
+}
+
+// formatBytes 以 KiB、MiB 或 GiB 显示字节数
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+}
+
+func (mm *meteredMode) status() *meteredStatus {
+	if mm == nil {
+		return nil
+	}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	st := &meteredStatus{
+		Month:        mm.state.Month,
+		Bytes:        mm.state.Bytes,
+		Cap:          mm.cfg.Cap,
+		Warned:       mm.state.Warned,
+		Over:         mm.over(),
+		DialsPerHour: mm.cfg.Dials,
+		Waiting:      mm.waiting,
+	}
+	if mm.cfg.Cap > 0 {
+		st.Percent = float64(int(float64(mm.state.Bytes)/float64(mm.cfg.Cap)*1000)) / 10
+	}
+	return st
+}
+
+// run 定期更新流量，ctx 结束时保存最后的统计
+func (mm *meteredMode) run(ctx context.Context) {
+	mm.mu.Lock()
+	mm.last = mm.usage.totals()
+	mm.mu.Unlock()
+	tick := time.NewTicker(meteredSample)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			mm.sample()
+		case <-ctx.Done():
+			mm.sample()
+			return
+		}
+	}
+}
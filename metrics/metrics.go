@@ -0,0 +1,49 @@
+// Package metrics 定义节点内部使用的指标接口。
+//
+// 节点中的所有埋点都只依赖这里的接口，默认提供 Prometheus 和空实现两种后端。
+// 使用其他指标系统（statsd、OpenTelemetry 等）的嵌入方只需实现 Metrics 接口即可桥接，
+// 无需修改节点代码。
+package metrics
+
+import "time"
+
+// Counter 是只增不减的计数器。
+type Counter interface {
+	Inc(delta int64)
+}
+
+// Gauge 是可以任意设置的瞬时值。
+type Gauge interface {
+	Set(value int64)
+}
+
+// Histogram 记录一组观测值的分布。
+type Histogram interface {
+	Observe(value int64)
+}
+
+// Metrics 按名称创建（或取回已存在的）指标。
+// 名称使用 "/" 分隔的层级形式，例如 "demo/peers/dropped"，具体后端负责转换格式。
+// 同一名称多次调用必须返回同一个指标。
+type Metrics interface {
+	Counter(name string) Counter
+	Gauge(name string) Gauge
+	Histogram(name string) Histogram
+}
+
+// ObserveSince 以毫秒为单位记录从 start 到现在经过的时间。
+func ObserveSince(h Histogram, start time.Time) {
+	h.Observe(time.Since(start).Milliseconds())
+}
+
+// Noop 是不做任何事情的指标实现，未启用指标时使用。
+var Noop Metrics = noop{}
+
+type noop struct{}
+
+func (noop) Counter(string) Counter     { return noop{} }
+func (noop) Gauge(string) Gauge         { return noop{} }
+func (noop) Histogram(string) Histogram { return noop{} }
+func (noop) Inc(int64)                  {}
+func (noop) Set(int64)                  {}
+func (noop) Observe(int64)              {}
@@ -0,0 +1,54 @@
+//go:build !minimal
+
+package metrics
+
+import (
+	"net/http"
+
+	gethmetrics "github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+)
+
+// Prometheus 基于 go-ethereum 的指标注册表实现 Metrics，
+// 并以 Prometheus 文本格式导出（同时包含 p2p 库自带的指标）。
+type Prometheus struct {
+	reg gethmetrics.Registry
+}
+
+// NewPrometheus 创建 Prometheus 后端并启用 go-ethereum 指标系统。
+// 必须在启动 P2P 服务器之前调用，否则 p2p 库内部的流量计量不会生效。
+func NewPrometheus() *Prometheus {
+	gethmetrics.Enable()
+	return &Prometheus{reg: gethmetrics.DefaultRegistry}
+}
+
+func (p *Prometheus) Counter(name string) Counter {
+	return promCounter{gethmetrics.GetOrRegisterCounter(name, p.reg)}
+}
+
+func (p *Prometheus) Gauge(name string) Gauge {
+	return promGauge{gethmetrics.GetOrRegisterGauge(name, p.reg)}
+}
+
+func (p *Prometheus) Histogram(name string) Histogram {
+	return promHistogram{gethmetrics.GetOrRegisterHistogramLazy(name, p.reg, func() gethmetrics.Sample {
+		return gethmetrics.NewExpDecaySample(1028, 0.015)
+	})}
+}
+
+// Handler 返回以 Prometheus 格式输出所有指标的 HTTP 处理器。
+func (p *Prometheus) Handler() http.Handler {
+	return prometheus.Handler(p.reg)
+}
+
+type promCounter struct{ c *gethmetrics.Counter }
+
+func (c promCounter) Inc(delta int64) { c.c.Inc(delta) }
+
+type promGauge struct{ g *gethmetrics.Gauge }
+
+func (g promGauge) Set(value int64) { g.g.Update(value) }
+
+type promHistogram struct{ h gethmetrics.Histogram }
+
+func (h promHistogram) Observe(value int64) { h.h.Update(value) }
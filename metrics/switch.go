@@ -0,0 +1,68 @@
+package metrics
+
+import "sync/atomic"
+
+// Switch 包装另一个 Metrics，可以在运行时暂停和恢复采集。
+// 暂停期间所有更新都被丢弃，已经采集的值保持不变。
+type Switch struct {
+	m       Metrics
+	enabled atomic.Bool
+}
+
+// NewSwitch 创建处于启用状态的 Switch。
+func NewSwitch(m Metrics) *Switch {
+	s := &Switch{m: m}
+	s.enabled.Store(true)
+	return s
+}
+
+// SetEnabled 启用或暂停采集。
+func (s *Switch) SetEnabled(on bool) { s.enabled.Store(on) }
+
+// Enabled 返回当前是否在采集。
+func (s *Switch) Enabled() bool { return s.enabled.Load() }
+
+func (s *Switch) Counter(name string) Counter {
+	return switchCounter{s, s.m.Counter(name)}
+}
+
+func (s *Switch) Gauge(name string) Gauge {
+	return switchGauge{s, s.m.Gauge(name)}
+}
+
+func (s *Switch) Histogram(name string) Histogram {
+	return switchHistogram{s, s.m.Histogram(name)}
+}
+
+type switchCounter struct {
+	s *Switch
+	c Counter
+}
+
+func (c switchCounter) Inc(delta int64) {
+	if c.s.Enabled() {
+		c.c.Inc(delta)
+	}
+}
+
+type switchGauge struct {
+	s *Switch
+	g Gauge
+}
+
+func (g switchGauge) Set(value int64) {
+	if g.s.Enabled() {
+		g.g.Set(value)
+	}
+}
+
+type switchHistogram struct {
+	s *Switch
+	h Histogram
+}
+
+func (h switchHistogram) Observe(value int64) {
+	if h.s.Enabled() {
+		h.h.Observe(value)
+	}
+}
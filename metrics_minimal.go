@@ -0,0 +1,19 @@
+//go:build minimal
+
+package main
+
+import (
+	"log"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+)
+
+const metricsCompiled = false
+
+// minimal 构建不包含 Prometheus 后端
+func setupMetrics(*faultLog) metrics.Metrics {
+	if *metricsEnabled {
+		log.Printf("minimal 构建不包含指标后端，忽略 -metrics")
+	}
+	return metrics.Noop
+}
@@ -0,0 +1,37 @@
+//go:build !minimal
+
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+)
+
+const metricsCompiled = true
+
+// 根据命令行参数创建指标后端，启用时同时启动 Prometheus HTTP 服务。
+// HTTP 服务无法监听时节点以降级模式运行，指标照常采集，只是无法抓取
+func setupMetrics(faults *faultLog) metrics.Metrics {
+	if !*metricsEnabled {
+		return metrics.Noop
+	}
+	prom := metrics.NewPrometheus()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prom.Handler())
+	ln, err := net.Listen("tcp", *metricsAddr)
+	if err != nil {
+		faults.degrade("metrics", failBind, err)
+		return prom
+	}
+	log.Printf("指标服务监听: http://%s/metrics", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("指标服务退出: %v", err)
+			faults.fail("metrics", failInternal, err)
+		}
+	}()
+	return prom
+}
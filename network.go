@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// networkProfile 是一个以太坊网络的接入参数：引导节点、DNS 节点发现树（EIP-1459）和预期的
+// fork ID 哈希（EIP-2124）。没有显式设置 -bootnodes 时使用网络配置的引导节点；DNS 树中的节点
+// 作为额外的拨号候选；节点记录的 eth 字段中 fork ID 不在预期列表里的节点（其他网络或分叉出去的链）
+// 不拨号，没有 eth 字段的节点（例如其他演示节点）不检查。
+//
+// 自定义网络写成 JSON 文件，base 指定一个内置网络时在它的基础上追加各个列表：
+//
+//	{"name":"mynet","base":"sepolia","bootnodes":["enode://..."],"dns":["enrtree://..."],"forkIDs":["0xed88b5fd"]}
+type networkProfile struct {
+	Name      string   `json:"name"`
+	Base      string   `json:"base,omitempty"`
+	Bootnodes []string `json:"bootnodes,omitempty"`
+	DNS       []string `json:"dns,omitempty"`
+	ForkIDs   []string `json:"forkIDs,omitempty"` // 为空时不检查 fork ID
+}
+
+var networkFlag = flag.String("network", "", "网络配置: mainnet|sepolia|holesky|<自定义网络的 JSON 文件>，带上引导节点、DNS 节点发现树和预期的 fork ID")
+
+// 内置网络的 fork ID 哈希按 go-ethereum 的分叉计划从创世区块排到最新的分叉，同步中的节点公告的
+// 较早哈希也属于同一网络。网络升级后 go-ethereum 还不知道的新哈希需要在自定义网络的 forkIDs 中补充。
+var networkProfiles = map[string]networkProfile{
+	"mainnet": {
+		Name:      "mainnet",
+		Bootnodes: params.MainnetBootnodes,
+		DNS:       []string{params.KnownDNSNetwork(params.MainnetGenesisHash, "all")},
+		ForkIDs: []string{
+			"0xfc64ec04", "0x97c2c34c", "0x91d1f948", "0x7a64da13", "0x3edd5b10", "0xa00bc324", "0x668db0af",
+			"0x879d6e30", "0xe029e991", "0x0eb440f6", "0xb715077d", "0x20c327fc", "0xf0afd0e3", "0xdce96c2d",
+			"0x9f3d2254",
+			"0xc376cf8b", // Prague，go-ethereum v1.15.7 发布时主网还没有确定激活时间
+		},
+	},
+	"sepolia": {
+		Name:      "sepolia",
+		Bootnodes: params.SepoliaBootnodes,
+		DNS:       []string{params.KnownDNSNetwork(params.SepoliaGenesisHash, "all")},
+		ForkIDs:   []string{"0xfe3366e7", "0xb96cbd13", "0xf7f9bc08", "0x88cf81d9", "0xed88b5fd"},
+	},
+	"holesky": {
+		Name:      "holesky",
+		Bootnodes: params.HoleskyBootnodes,
+		DNS:       []string{params.KnownDNSNetwork(params.HoleskyGenesisHash, "all")},
+		ForkIDs:   []string{"0xc61a6098", "0xfd4f016b", "0x9b192ad0", "0xdfbd9bed"},
+	},
+}
+
+var errForkMismatch = errors.New("节点的 fork ID 不属于所选网络")
+
+// loadNetworkProfile 返回内置网络或从文件读取自定义网络，name 为空时返回 nil
+func loadNetworkProfile(name string) (*networkProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if p, ok := networkProfiles[name]; ok {
+		return &p, nil
+	}
+	if !strings.HasSuffix(name, ".json") {
+		return nil, fmt.Errorf("未知的网络 %q，可选 mainnet|sepolia|holesky 或自定义网络的 .json 文件", name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var custom networkProfile
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("解析网络配置 %s 失败: %v", name, err)
+	}
+	p := custom
+	if custom.Base != "" {
+		base, ok := networkProfiles[custom.Base]
+		if !ok {
+			return nil, fmt.Errorf("%s: 未知的 base 网络 %q", name, custom.Base)
+		}
+		p = base
+		if custom.Name != "" {
+			p.Name = custom.Name
+		}
+		p.Base = custom.Base
+		p.Bootnodes = append(append([]string(nil), base.Bootnodes...), custom.Bootnodes...)
+		p.DNS = append(append([]string(nil), base.DNS...), custom.DNS...)
+		p.ForkIDs = append(append([]string(nil), base.ForkIDs...), custom.ForkIDs...)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(name, ".json")
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &p, nil
+}
+
+func (p *networkProfile) validate() error {
+	for _, url := range p.Bootnodes {
+		if _, err := enode.ParseV4(url); err != nil {
+			return fmt.Errorf("无效的引导节点 %q: %v", url, err)
+		}
+	}
+	for _, url := range p.DNS {
+		if !strings.HasPrefix(url, "enrtree://") {
+			return fmt.Errorf("无效的 DNS 节点发现树 %q，应以 enrtree:// 开头", url)
+		}
+	}
+	for _, s := range p.ForkIDs {
+		if _, err := parseForkHash(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseForkHash(s string) ([4]byte, error) {
+	var h [4]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("无效的 fork ID 哈希 %q，应为 4 字节的十六进制数，例如 0x9f3d2254", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// applyNetwork 读取 -network 选中的网络，没有显式设置 -bootnodes 时使用网络的引导节点
+func applyNetwork(fs *flag.FlagSet, name string) (*networkProfile, error) {
+	p, err := loadNetworkProfile(name)
+	if p == nil || err != nil {
+		return nil, err
+	}
+	if !isFlagSet(fs, "bootnodes") {
+		fs.Set("bootnodes", strings.Join(p.Bootnodes, ","))
+	}
+	log.Printf("网络配置 %s: %d 个引导节点，%d 个 DNS 节点发现树，%d 个预期的 fork ID", p.Name, len(p.Bootnodes), len(p.DNS), len(p.ForkIDs))
+	return p, nil
+}
+
+// ethEntry 是节点记录中的 eth 字段，见 EIP-2124
+type ethEntry struct {
+	ForkID struct {
+		Hash [4]byte
+		Next uint64
+	}
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+func (ethEntry) ENRKey() string { return "eth" }
+
+// networkFilter 按节点记录中的 fork ID 过滤拨号候选
+type networkFilter struct {
+	name     string
+	forks    map[[4]byte]bool
+	rejected metrics.Counter
+
+	mu      sync.Mutex
+	unknown map[[4]byte]bool // 已经记录过日志的未知哈希
+}
+
+// filter 返回按 fork ID 过滤节点的检查，p 为 nil 或没有预期的 fork ID 时返回 nil
+func (p *networkProfile) filter(m metrics.Metrics) *networkFilter {
+	if p == nil || len(p.ForkIDs) == 0 {
+		return nil
+	}
+	f := &networkFilter{
+		name:     p.Name,
+		forks:    make(map[[4]byte]bool),
+		rejected: m.Counter("demo/network/fork_rejected"),
+		unknown:  make(map[[4]byte]bool),
+	}
+	for _, s := range p.ForkIDs {
+		h, _ := parseForkHash(s)
+		f.forks[h] = true
+	}
+	return f
+}
+
+// accept 判断节点是否属于所选网络，没有 eth 字段的节点总是接受
+func (f *networkFilter) accept(n *enode.Node) bool {
+	var eth ethEntry
+	if n.Load(&eth) != nil || f.forks[eth.ForkID.Hash] {
+		return true
+	}
+	f.rejected.Inc(1)
+	f.mu.Lock()
+	first := !f.unknown[eth.ForkID.Hash]
+	f.unknown[eth.ForkID.Hash] = true
+	f.mu.Unlock()
+	if first {
+		log.Printf("节点 %s 公告的 fork ID 0x%x 不属于网络 %s，不拨号；如果网络刚刚升级，在自定义网络配置的 forkIDs 中加入它",
+			n.ID().TerminalString(), eth.ForkID.Hash, f.name)
+	}
+	return false
+}
+
+// checkDial 拒绝拨号其他网络的节点。f 可以为 nil
+func (f *networkFilter) checkDial(n *enode.Node) error {
+	if f == nil || f.accept(n) {
+		return nil
+	}
+	return errForkMismatch
+}
+
+// dialCandidates 返回 DNS 节点发现树中属于所选网络的节点，没有配置 DNS 树时返回 nil
+func (p *networkProfile) dialCandidates(f *networkFilter) (enode.Iterator, error) {
+	if p == nil || len(p.DNS) == 0 {
+		return nil, nil
+	}
+	it, err := dnsdisc.NewClient(dnsdisc.Config{}).NewIterator(p.DNS...)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		it = enode.Filter(it, f.accept)
+	}
+	return it, nil
+}
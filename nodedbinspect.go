@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// db 子命令直接以只读方式打开 -nodedb 的 LevelDB，按 go-ethereum p2p/enode 的键格式解析：
+//
+//	version                    数据库版本（varint）
+//	n:<ID>:v4                  节点记录（RLP）
+//	n:<ID>:v4:<IP>:<字段>      lastping、lastpong（Unix 秒，varint）、findfail、seq
+//	n:<ID>:v5:<IP>:findfail    discv5 的 findnode 失败次数
+//	local:<ID>:seq             本地节点记录的序号
+//
+// enode.DB 没有提供遍历的接口，所以不经过它。LevelDB 同时只能被一个进程打开，查看运行中节点的
+// 数据库需要先停止节点，或者复制目录后查看副本。
+const (
+	// 与 go-ethereum p2p/enode 的 dbVersion 一致，版本不同时节点启动会清空数据库
+	nodeDBVersion = 9
+	// 最后一次 pong 超过这个时间的节点会被节点的定期清理删除
+	nodeDBExpiration = 24 * time.Hour
+)
+
+// nodeDBEndpoint 是节点在一个 IP 上的存活统计
+type nodeDBEndpoint struct {
+	IP          netip.Addr `json:"ip"`
+	LastPing    time.Time  `json:"lastPing,omitzero"` // 最后一次收到对方 ping 的时间
+	LastPong    time.Time  `json:"lastPong,omitzero"` // 最后一次收到对方 pong 的时间
+	FindFails   int64      `json:"findFails,omitempty"`
+	FindFailsV5 int64      `json:"findFailsV5,omitempty"`
+}
+
+// nodeDBEntry 是数据库中的一个节点
+type nodeDBEntry struct {
+	ID        enode.ID          `json:"id"`
+	Seq       uint64            `json:"seq"`
+	Record    string            `json:"record,omitempty"` // 没有节点记录时为空（只有存活统计）
+	URL       string            `json:"enode,omitempty"`
+	Error     string            `json:"error,omitempty"` // 节点记录无法解析的原因
+	Endpoints []*nodeDBEndpoint `json:"endpoints"`
+
+	endpoints map[netip.Addr]*nodeDBEndpoint
+}
+
+// lastPong 返回所有 IP 中最近的 pong 时间
+func (e *nodeDBEntry) lastPong() time.Time {
+	var t time.Time
+	for _, ep := range e.Endpoints {
+		if ep.LastPong.After(t) {
+			t = ep.LastPong
+		}
+	}
+	return t
+}
+
+// nodeDBContents 是整个数据库的内容
+type nodeDBContents struct {
+	Version int64
+	Keys    int
+	Unknown int // 无法识别的键
+	Local   map[enode.ID]uint64
+	Nodes   []*nodeDBEntry // 按最近的 pong 时间从新到旧排列
+}
+
+// nodeDBAgeBucket 是 db stats 中按最近 pong 时间统计的一档
+type nodeDBAgeBucket struct {
+	Label string `json:"label"`
+	Nodes int    `json:"nodes"`
+}
+
+// nodeDBStats 是 db stats 的输出
+type nodeDBStats struct {
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"` // 目录中所有文件的字节数
+	Version     int64             `json:"version"`
+	Keys        int               `json:"keys"`
+	Unknown     int               `json:"unknown,omitempty"`
+	Nodes       int               `json:"nodes"`
+	Records     int               `json:"records"`            // 有节点记录的节点数
+	Undecodable int               `json:"undecodable"`        // 节点记录无法解析的节点数
+	Endpoints   int               `json:"endpoints"`          // 节点和 IP 的组合数
+	FindFails   int               `json:"findFails"`          // findnode 失败过的节点数
+	LocalSeq    map[string]uint64 `json:"localSeq,omitempty"` // 本地节点记录的序号
+	Oldest      time.Time         `json:"oldestPong,omitzero"`
+	Newest      time.Time         `json:"newestPong,omitzero"`
+	Age         []nodeDBAgeBucket `json:"age"`
+}
+
+// openNodeDB 以只读方式打开节点数据库
+func openNodeDB(path string) (*leveldb.DB, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		if _, statErr := os.Stat(path); statErr != nil {
+			return nil, statErr
+		}
+		return nil, fmt.Errorf("打开节点数据库 %s 失败: %v（数据库可能正被运行中的节点使用，请停止节点或复制目录后再查看）", path, err)
+	}
+	return db, nil
+}
+
+// readNodeDB 遍历数据库中的所有键
+func readNodeDB(db *leveldb.DB) *nodeDBContents {
+	c := &nodeDBContents{Local: make(map[enode.ID]uint64)}
+	nodes := make(map[enode.ID]*nodeDBEntry)
+	entry := func(id enode.ID) *nodeDBEntry {
+		e := nodes[id]
+		if e == nil {
+			e = &nodeDBEntry{ID: id, Endpoints: []*nodeDBEndpoint{}, endpoints: make(map[netip.Addr]*nodeDBEndpoint)}
+			nodes[id] = e
+		}
+		return e
+	}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		c.Keys++
+		key, value := it.Key(), it.Value()
+		switch {
+		case string(key) == "version":
+			c.Version, _ = binary.Varint(value)
+		case bytes.HasPrefix(key, []byte("local:")):
+			rest := key[len("local:"):]
+			if len(rest) != len(enode.ID{})+len(":seq") || string(rest[len(enode.ID{}):]) != ":seq" {
+				c.Unknown++
+				continue
+			}
+			seq, _ := binary.Uvarint(value)
+			c.Local[enode.ID(rest[:len(enode.ID{})])] = seq
+		case bytes.HasPrefix(key, []byte("n:")):
+			if !parseNodeDBItem(key[len("n:"):], value, entry) {
+				c.Unknown++
+			}
+		default:
+			c.Unknown++
+		}
+	}
+	for _, e := range nodes {
+		c.Nodes = append(c.Nodes, e)
+	}
+	sort.Slice(c.Nodes, func(i, j int) bool {
+		a, b := c.Nodes[i].lastPong(), c.Nodes[j].lastPong()
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return bytes.Compare(c.Nodes[i].ID[:], c.Nodes[j].ID[:]) < 0
+	})
+	return c
+}
+
+// parseNodeDBItem 解析 "n:" 之后的键，不能识别时返回 false
+func parseNodeDBItem(key, value []byte, entry func(enode.ID) *nodeDBEntry) bool {
+	idLen := len(enode.ID{})
+	if len(key) < idLen+len(":v4") || key[idLen] != ':' {
+		return false
+	}
+	id := enode.ID(key[:idLen])
+	root, rest := string(key[idLen+1:idLen+3]), key[idLen+3:]
+	if root != "v4" && root != "v5" {
+		return false
+	}
+	if len(rest) == 0 {
+		if root != "v4" {
+			return false
+		}
+		e := entry(id)
+		var r enr.Record
+		if err := rlp.DecodeBytes(value, &r); err != nil {
+			e.Error = err.Error()
+			return true
+		}
+		e.Seq = r.Seq()
+		n, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			e.Error = err.Error()
+			return true
+		}
+		if n.ID() != id {
+			e.Error = fmt.Sprintf("节点记录的 ID %s 与键不一致", n.ID().TerminalString())
+		}
+		e.Record, e.URL = n.String(), n.URLv4()
+		return true
+	}
+	// ":" + 16 字节 IP + ":" + 字段
+	if len(rest) < 1+16+1 || rest[0] != ':' || rest[17] != ':' {
+		return false
+	}
+	ip := netip.AddrFrom16([16]byte(rest[1:17])).Unmap()
+	field := string(rest[18:])
+	e := entry(id)
+	if root == "v4" && field == "seq" {
+		// 按节点 ID 记录在零地址上，与节点记录中的序号相同
+		e.Seq, _ = binary.Uvarint(value)
+		return true
+	}
+	ep := e.endpoints[ip]
+	if ep == nil {
+		ep = &nodeDBEndpoint{IP: ip}
+		e.endpoints[ip] = ep
+		e.Endpoints = append(e.Endpoints, ep)
+	}
+	v, _ := binary.Varint(value)
+	switch {
+	case root == "v5" && field == "findfail":
+		ep.FindFailsV5 = v
+	case root == "v5":
+		return false
+	case field == "lastping":
+		ep.LastPing = time.Unix(v, 0)
+	case field == "lastpong":
+		ep.LastPong = time.Unix(v, 0)
+	case field == "findfail":
+		ep.FindFails = v
+	default:
+		return false
+	}
+	return true
+}
+
+// stats 汇总数据库的大小和节点按最近 pong 时间的分布
+func (c *nodeDBContents) stats(path string, now time.Time) *nodeDBStats {
+	st := &nodeDBStats{Path: path, Version: c.Version, Keys: c.Keys, Unknown: c.Unknown, Nodes: len(c.Nodes)}
+	filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				st.Size += info.Size()
+			}
+		}
+		return nil
+	})
+	for id, seq := range c.Local {
+		if st.LocalSeq == nil {
+			st.LocalSeq = make(map[string]uint64)
+		}
+		st.LocalSeq[id.String()] = seq
+	}
+	st.Age = []nodeDBAgeBucket{
+		{Label: "1 小时内"},
+		{Label: "1-6 小时"},
+		{Label: "6-24 小时"},
+		{Label: "超过 24 小时（下次清理时删除）"},
+		{Label: "从未收到 pong"},
+	}
+	for _, e := range c.Nodes {
+		if e.Record != "" || e.Error != "" {
+			st.Records++
+		}
+		if e.Error != "" {
+			st.Undecodable++
+		}
+		st.Endpoints += len(e.Endpoints)
+		for _, ep := range e.Endpoints {
+			if ep.FindFails > 0 || ep.FindFailsV5 > 0 {
+				st.FindFails++
+				break
+			}
+		}
+		pong := e.lastPong()
+		if pong.IsZero() {
+			st.Age[4].Nodes++
+			continue
+		}
+		if st.Oldest.IsZero() || pong.Before(st.Oldest) {
+			st.Oldest = pong
+		}
+		if pong.After(st.Newest) {
+			st.Newest = pong
+		}
+		switch age := now.Sub(pong); {
+		case age < time.Hour:
+			st.Age[0].Nodes++
+		case age < 6*time.Hour:
+			st.Age[1].Nodes++
+		case age < nodeDBExpiration:
+			st.Age[2].Nodes++
+		default:
+			st.Age[3].Nodes++
+		}
+	}
+	return st
+}
+
+func dbCmd(args []string) {
+	usage := func() {
+		fmt.Fprintln(stderr, "用法: db inspect [-nodedb 目录] [-json] [节点 ID 或 enode URL...]")
+		fmt.Fprintln(stderr, "      db stats [-nodedb 目录] [-json]")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	name := args[0]
+	if name != "inspect" && name != "stats" {
+		usage()
+	}
+	fs := flag.NewFlagSet("db "+name, flag.ExitOnError)
+	path := fs.String("nodedb", "", "节点数据库目录（与启动节点时的 -nodedb 相同）")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	localizeFlags(fs)
+	fs.Parse(args[1:])
+
+	if *path == "" {
+		log.Fatal("必须指定 -nodedb")
+	}
+	db, err := openNodeDB(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := readNodeDB(db)
+	db.Close()
+
+	if name == "stats" {
+		st := c.stats(*path, time.Now())
+		if *asJSON {
+			printJSON(st)
+			return
+		}
+		printNodeDBStats(st)
+		return
+	}
+
+	nodes := c.Nodes
+	if fs.NArg() > 0 {
+		want := make(map[enode.ID]bool)
+		for _, arg := range fs.Args() {
+			id, err := parseNodeID(arg)
+			if err != nil {
+				log.Fatalf("无效的节点 %q: %v", arg, err)
+			}
+			want[id] = true
+		}
+		nodes = nil
+		for _, e := range c.Nodes {
+			if want[e.ID] {
+				nodes = append(nodes, e)
+			}
+		}
+	}
+	if *asJSON {
+		printJSON(nodes)
+		return
+	}
+	printNodeDBEntries(nodes, time.Now())
+}
+
+func printJSON(v any) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// nodeDBTime 格式化时间并附带距今的时长
+func nodeDBTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%v 前)", t.Format(time.DateTime), now.Sub(t).Round(time.Second))
+}
+
+func printNodeDBEntries(nodes []*nodeDBEntry, now time.Time) {
+	for _, e := range nodes {
+		fmt.Fprintf(stdout, "%s  seq=%d\n", e.ID, e.Seq)
+		switch {
+		case e.Error != "":
+			fmt.Fprintf(stdout, "    节点记录无法解析: %s\n", e.Error)
+		case e.Record == "":
+			fmt.Fprintln(stdout, "    没有节点记录")
+		default:
+			fmt.Fprintf(stdout, "    %s\n    %s\n", e.URL, e.Record)
+		}
+		for _, ep := range e.Endpoints {
+			fmt.Fprintf(stdout, "    %-15s ping %s  pong %s  findnode 失败 %d", ep.IP, nodeDBTime(ep.LastPing, now), nodeDBTime(ep.LastPong, now), ep.FindFails)
+			if ep.FindFailsV5 > 0 {
+				fmt.Fprintf(stdout, " (v5 %d)", ep.FindFailsV5)
+			}
+			fmt.Fprintln(stdout)
+		}
+	}
+	fmt.Fprintf(stdout, "共 %d 个节点\n", len(nodes))
+}
+
+func printNodeDBStats(st *nodeDBStats) {
+	fmt.Fprintf(stdout, "数据库: %s (%.1f KiB)\n", st.Path, float64(st.Size)/1024)
+	fmt.Fprintf(stdout, "版本: %d", st.Version)
+	if st.Version != nodeDBVersion {
+		fmt.Fprintf(stdout, "（与当前版本 %d 不同，启动节点时会被清空）", nodeDBVersion)
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintf(stdout, "键: %d", st.Keys)
+	if st.Unknown > 0 {
+		fmt.Fprintf(stdout, "，无法识别 %d", st.Unknown)
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintf(stdout, "节点: %d，有节点记录 %d，无法解析 %d，节点和 IP 组合 %d，findnode 失败过 %d\n", st.Nodes, st.Records, st.Undecodable, st.Endpoints, st.FindFails)
+	for id, seq := range st.LocalSeq {
+		fmt.Fprintf(stdout, "本地节点 %s 的记录序号: %d\n", id, seq)
+	}
+	if !st.Newest.IsZero() {
+		fmt.Fprintf(stdout, "最近的 pong: %s，最早的 pong: %s\n", st.Newest.Format(time.DateTime), st.Oldest.Format(time.DateTime))
+	}
+	fmt.Fprintln(stdout, "按最近一次 pong 的时间:")
+	for _, b := range st.Age {
+		fmt.Fprintf(stdout, "    %6d  %s\n", b.Nodes, b.Label)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// nodeQueue 是一个由外部填充的 enode.Iterator，可以作为协议的 DialCandidates，
+// 把协议得知的节点（例如其他节点推荐的替代节点）交给拨号调度器。
+// 队列有长度上限，节点可能来自不可信的对方，已在队列中的节点不重复加入。
+type nodeQueue struct {
+	max int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*enode.Node
+	queued map[enode.ID]bool
+	cur    *enode.Node
+	closed bool
+}
+
+// newNodeQueue 创建最多容纳 max 个节点的队列
+func newNodeQueue(max int) *nodeQueue {
+	q := &nodeQueue{max: max, queued: make(map[enode.ID]bool)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push 把节点加入队列，返回实际加入的个数。已在队列中的节点不重复加入，队列已满或已关闭时忽略
+func (q *nodeQueue) push(nodes ...*enode.Node) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0
+	}
+	added := 0
+	for _, n := range nodes {
+		if len(q.queue) >= q.max {
+			break
+		}
+		if q.queued[n.ID()] {
+			continue
+		}
+		q.queued[n.ID()] = true
+		q.queue = append(q.queue, n)
+		added++
+	}
+	if added > 0 {
+		q.cond.Broadcast()
+	}
+	return added
+}
+
+// Next 阻塞直到有新节点或迭代器被关闭
+func (q *nodeQueue) Next() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.queue) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		q.cur = nil
+		return false
+	}
+	q.cur, q.queue = q.queue[0], q.queue[1:]
+	delete(q.queued, q.cur.ID())
+	return true
+}
+
+func (q *nodeQueue) Node() *enode.Node {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.cur
+}
+
+func (q *nodeQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func testNodes(t *testing.T, n int) []*enode.Node {
+	t.Helper()
+	nodes := make([]*enode.Node, n)
+	for i, u := range testProviderURLs(t, n) {
+		nodes[i] = enode.MustParseV4(u)
+	}
+	return nodes
+}
+
+func TestNodeQueuePush(t *testing.T) {
+	q := newNodeQueue(3)
+	nodes := testNodes(t, 5)
+	if n := q.push(nodes[0], nodes[1], nodes[0]); n != 2 {
+		t.Fatalf("加入 %d 个，重复的节点应被忽略", n)
+	}
+	if n := q.push(nodes[2:]...); n != 1 {
+		t.Fatalf("加入 %d 个，队列上限为 3", n)
+	}
+	for _, want := range nodes[:3] {
+		if !q.Next() || q.Node() != want {
+			t.Fatalf("Next 得到 %v，应为 %v", q.Node(), want)
+		}
+	}
+	// 取出后的节点可以再次加入
+	if n := q.push(nodes[0]); n != 1 {
+		t.Fatalf("取出的节点再次加入 %d 个", n)
+	}
+	if !q.Next() || q.Node() != nodes[0] {
+		t.Fatal("再次加入的节点没有被取出")
+	}
+}
+
+func TestNodeQueueNextBlocks(t *testing.T) {
+	q := newNodeQueue(4)
+	node := testNodes(t, 1)[0]
+	got := make(chan *enode.Node, 1)
+	go func() {
+		if q.Next() {
+			got <- q.Node()
+		}
+	}()
+	select {
+	case n := <-got:
+		t.Fatalf("空队列的 Next 返回了 %v", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.push(node)
+	select {
+	case n := <-got:
+		if n != node {
+			t.Fatalf("Next 得到 %v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("加入节点后 Next 没有返回")
+	}
+}
+
+func TestNodeQueueClose(t *testing.T) {
+	q := newNodeQueue(4)
+	q.push(testNodes(t, 1)...)
+	done := make(chan bool, 1)
+	q.Next()
+	go func() { done <- q.Next() }()
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("关闭后 Next 返回 true")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close 没有唤醒阻塞的 Next")
+	}
+	if q.Node() != nil {
+		t.Fatal("关闭后 Node 不为 nil")
+	}
+	if n := q.push(testNodes(t, 1)...); n != 0 {
+		t.Fatalf("关闭后加入了 %d 个节点", n)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 只读观察模式：节点照常拨号、接受连接并完成各协议的握手，但不发送任何应用消息，
+// 也不转发 gossip，只接收和记录，适合不干扰网络的测量部署。这一点由构造保证：各协议的 passive
+// 字段关闭所有发送路径（gossip 不启动写循环、不发兴趣通告也不转发，file 不应答也不发起请求，
+// chat 不广播、不发下线通知，conf 不做检查），连接照常保持。每个协议最外层（最靠近网络）的
+// MsgReadWriter 另外只放行握手消息，作为兜底：遗漏的写入返回 errObserverWrite 并计入 suppressed。
+var errObserverWrite = errors.New("观察模式下不发送应用消息")
+
+// observerHandshakes 是每个协议的握手消息代码，观察模式下只允许发送这些消息，
+// 带宽规则关闭协议时也只放行这些消息
+var observerHandshakes = map[string]uint64{
+	"chat":   chatStatusMsg,
+	"conf":   confStatusMsg,
+	"file":   fileHelloMsg,
+	"gossip": gossipStatusMsg,
+}
+
+// observerStatus 是 admin_observer 的返回值，键为 "协议/消息代码"
+type observerStatus struct {
+	Received   map[string]uint64 `json:"received"`
+	Suppressed map[string]uint64 `json:"suppressed"`
+}
+
+// observer 拦截所有非握手消息的写入，并记录收到的消息
+type observer struct {
+	mu         sync.Mutex
+	received   map[string]uint64
+	suppressed map[string]uint64
+}
+
+func newObserver() *observer {
+	return &observer{received: make(map[string]uint64), suppressed: make(map[string]uint64)}
+}
+
+// protocol 包装协议的 Run 函数，必须是最后一层包装，保证没有写入能绕过它
+func (o *observer) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	name := proto.Name
+	handshake, ok := observerHandshakes[name]
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		return run(p, &observerRW{MsgReadWriter: rw, o: o, proto: name, handshake: handshake, hasHandshake: ok})
+	}
+	return proto
+}
+
+func (o *observer) status() *observerStatus {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := &observerStatus{Received: make(map[string]uint64, len(o.received)), Suppressed: make(map[string]uint64, len(o.suppressed))}
+	for k, v := range o.received {
+		s.Received[k] = v
+	}
+	for k, v := range o.suppressed {
+		s.Suppressed[k] = v
+	}
+	return s
+}
+
+type observerRW struct {
+	p2p.MsgReadWriter
+	o            *observer
+	proto        string
+	handshake    uint64
+	hasHandshake bool
+	shook        atomic.Bool // 握手消息只允许发送一次
+}
+
+func (rw *observerRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil {
+		rw.o.mu.Lock()
+		rw.o.received[fmt.Sprintf("%s/%#x", rw.proto, msg.Code)]++
+		rw.o.mu.Unlock()
+	}
+	return msg, err
+}
+
+func (rw *observerRW) WriteMsg(msg p2p.Msg) error {
+	if rw.hasHandshake && msg.Code == rw.handshake && rw.shook.CompareAndSwap(false, true) {
+		return rw.MsgReadWriter.WriteMsg(msg)
+	}
+	msg.Discard()
+	rw.o.mu.Lock()
+	rw.o.suppressed[fmt.Sprintf("%s/%#x", rw.proto, msg.Code)]++
+	rw.o.mu.Unlock()
+	return errObserverWrite
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/p2ptest"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 最外层的写入包装只放行一次握手消息，其余写入返回 errObserverWrite 并计数
+func TestObserverRWBackstop(t *testing.T) {
+	o := newObserver()
+	fake := p2ptest.NewFakePeer()
+	rw := &observerRW{MsgReadWriter: fake, o: o, proto: "chat", handshake: chatStatusMsg, hasHandshake: true}
+
+	if err := p2p.Send(rw, chatStatusMsg, &chatStatus{Version: chatVersion}); err != nil {
+		t.Fatalf("握手消息被拦截: %v", err)
+	}
+	if err := p2p.Send(rw, chatStatusMsg, &chatStatus{Version: chatVersion}); !errors.Is(err, errObserverWrite) {
+		t.Fatalf("第二条握手消息的错误 = %v，应为 errObserverWrite", err)
+	}
+	if err := p2p.Send(rw, chatTextMsg, &chatText{Text: "hi"}); !errors.Is(err, errObserverWrite) {
+		t.Fatalf("文本消息的错误 = %v，应为 errObserverWrite", err)
+	}
+	if sent := fake.Sent(); len(sent) != 1 || sent[0].Code != chatStatusMsg {
+		t.Fatalf("发出的消息 = %+v，应只有握手消息", sent)
+	}
+	st := o.status()
+	if st.Suppressed["chat/0x0"] != 1 || st.Suppressed["chat/0x1"] != 1 {
+		t.Fatalf("suppressed = %v", st.Suppressed)
+	}
+}
+
+// 观察模式下 gossip 只完成握手：不发兴趣通告，不转发收到的消息，也不发布自己的消息，
+// 兜底的写入包装不应拦截到任何写入
+func TestGossipPassive(t *testing.T) {
+	o := newObserver()
+	g := newGossipProtocol(enode.ID{1}, 64, 16)
+	g.passive = true
+	g.subscribe("news", func(enode.ID, *gossipMessage) {})
+	s := p2ptest.Run(o.protocol(g.protocol()))
+	defer s.Close()
+
+	if err := s.Expect(gossipStatusMsg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(gossipStatusMsg, &gossipStatus{Version: gossipVersion, Interest: gossipInterestVersion}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(gossipMsg, &gossipMessage{Topic: "news", Origin: enode.ID{2}, Seq: 1, Payload: []byte("x"), Time: uint64(time.Now().UnixMilli())}); err != nil {
+		t.Fatal(err)
+	}
+	g.publish("news", []byte("y"))
+
+	s.Timeout = 300 * time.Millisecond
+	if err := s.Expect(gossipMsg, nil); !errors.Is(err, p2ptest.ErrTimeout) {
+		t.Fatalf("观察模式下收到了 gossip 发出的消息: %v", err)
+	}
+	if st := o.status(); len(st.Suppressed) != 0 {
+		t.Fatalf("发送路径没有关闭，写入被兜底拦截: %v", st.Suppressed)
+	}
+	if st := o.status(); st.Received["gossip/0x1"] != 1 {
+		t.Fatalf("received = %v", st.Received)
+	}
+}
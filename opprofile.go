@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+)
+
+// nodeProfile 是一组相互协调的资源参数。连接数决定了每个节点的协议状态和发送队列的总量，
+// 缓存和缓冲区按同样的比例缩小，避免只调小其中一项而让其他部分成为瓶颈。
+type nodeProfile struct {
+	maxPeers        int
+	eventBuffer     int
+	gossipSeenCache int
+	gossipQueue     int   // 每个 gossip 节点的发送队列长度
+	memoryLimit     int64 // Go 运行时的软内存上限（字节），0 表示不限制
+	gcPercent       int   // 0 表示使用运行时默认值
+}
+
+var nodeProfiles = map[string]nodeProfile{
+	"default": {
+		maxPeers:        50,
+		eventBuffer:     defaultEventBuffer,
+		gossipSeenCache: 16384,
+		gossipQueue:     256,
+	},
+	// 适合树莓派一类作为网络探针的设备：约 100MB 内存
+	"low-mem": {
+		maxPeers:        12,
+		eventBuffer:     128,
+		gossipSeenCache: 2048,
+		gossipQueue:     32,
+		memoryLimit:     96 << 20,
+		gcPercent:       50,
+	},
+}
+
+var profileName = flag.String("profile", "default", "运行配置: default|low-mem")
+
+// applyProfile 返回选中的运行配置，并把它的默认值应用到没有显式设置的参数上
+func applyProfile(fs *flag.FlagSet, name string) (nodeProfile, error) {
+	p, ok := nodeProfiles[name]
+	if !ok {
+		return nodeProfile{}, fmt.Errorf("未知的运行配置 %q", name)
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for flagName, value := range map[string]int{"peers.max": p.maxPeers, "events.buffer": p.eventBuffer} {
+		if !explicit[flagName] {
+			fs.Set(flagName, strconv.Itoa(value))
+		}
+	}
+	if p.memoryLimit > 0 {
+		debug.SetMemoryLimit(p.memoryLimit)
+	}
+	if p.gcPercent > 0 {
+		debug.SetGCPercent(p.gcPercent)
+	}
+	if name != "default" {
+		log.Printf("运行配置 %s: 最大连接数 %d，内存上限 %dMB", name, *maxPeers, p.memoryLimit>>20)
+	}
+	return p, nil
+}
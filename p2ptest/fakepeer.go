@@ -0,0 +1,139 @@
+package p2ptest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Message 是一条待发送的消息，Data 会被 RLP 编码。
+type Message struct {
+	Code uint64
+	Data any
+}
+
+// Responder 根据协议发出的消息生成应答，返回 nil 表示不应答。
+type Responder func(msg p2p.Msg) []Message
+
+// SentMsg 是协议通过 FakePeer 发出的一条消息。
+type SentMsg struct {
+	Code    uint64
+	Payload []byte
+	Time    time.Time
+}
+
+// Decode 把消息内容解码到 val。
+func (m *SentMsg) Decode(val any) error {
+	return rlp.DecodeBytes(m.Payload, val)
+}
+
+// FakePeer 是按脚本应答的 p2p.MsgReadWriter，在协议处理函数看来就是远端节点：
+// 协议写入的消息被记录下来，并交给按消息代码注册的 Responder 生成应答；
+// 协议读取时依次得到 Queue 预先放入的消息和各次应答。Close 之后读写都返回 p2p.ErrPipeClosed。
+type FakePeer struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	responses map[uint64]Responder
+	inbox     []p2p.Msg
+	sent      []SentMsg
+	closed    bool
+}
+
+// NewFakePeer 创建没有任何应答规则的 FakePeer。
+func NewFakePeer() *FakePeer {
+	f := &FakePeer{responses: make(map[uint64]Responder)}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// On 注册收到 code 消息时的应答规则，后注册的规则覆盖之前的。
+func (f *FakePeer) On(code uint64, r Responder) *FakePeer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[code] = r
+	return f
+}
+
+// Reply 是 On 的简化形式：每次收到 code 消息都回复固定的消息。
+func (f *FakePeer) Reply(code uint64, replies ...Message) *FakePeer {
+	return f.On(code, func(p2p.Msg) []Message { return replies })
+}
+
+// Queue 放入协议接下来会读到的消息，例如对方先发送的握手消息。
+func (f *FakePeer) Queue(msgs ...Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enqueue(msgs)
+}
+
+// enqueue 编码并放入消息，调用方必须持有 f.mu
+func (f *FakePeer) enqueue(msgs []Message) error {
+	for _, m := range msgs {
+		data, err := rlp.EncodeToBytes(m.Data)
+		if err != nil {
+			return fmt.Errorf("p2ptest: 编码消息 %d 失败: %v", m.Code, err)
+		}
+		f.inbox = append(f.inbox, p2p.Msg{
+			Code:       m.Code,
+			Size:       uint32(len(data)),
+			Payload:    bytes.NewReader(data),
+			ReceivedAt: time.Now(),
+		})
+	}
+	f.cond.Broadcast()
+	return nil
+}
+
+// ReadMsg 实现 p2p.MsgReader，没有消息时阻塞直到有新消息或 Close。
+func (f *FakePeer) ReadMsg() (p2p.Msg, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.inbox) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if f.closed {
+		return p2p.Msg{}, p2p.ErrPipeClosed
+	}
+	msg := f.inbox[0]
+	f.inbox = f.inbox[1:]
+	return msg, nil
+}
+
+// WriteMsg 实现 p2p.MsgWriter：记录消息并按规则生成应答。
+func (f *FakePeer) WriteMsg(msg p2p.Msg) error {
+	payload, err := io.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return p2p.ErrPipeClosed
+	}
+	f.sent = append(f.sent, SentMsg{Code: msg.Code, Payload: payload, Time: time.Now()})
+	if r := f.responses[msg.Code]; r != nil {
+		replies := r(p2p.Msg{Code: msg.Code, Size: uint32(len(payload)), Payload: bytes.NewReader(payload)})
+		return f.enqueue(replies)
+	}
+	return nil
+}
+
+// Sent 返回协议迄今发出的所有消息。
+func (f *FakePeer) Sent() []SentMsg {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SentMsg(nil), f.sent...)
+}
+
+// Close 模拟断开连接，阻塞中的 ReadMsg 会返回 p2p.ErrPipeClosed。
+func (f *FakePeer) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
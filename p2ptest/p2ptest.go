@@ -0,0 +1,153 @@
+// Package p2ptest 提供驱动 devp2p 子协议处理函数的测试工具。
+//
+// 编写子协议的单元测试时，通常需要一个内存中的消息管道、一个不依赖网络的 *p2p.Peer，
+// 以及收发、断言消息的辅助函数。这些样板代码原本散落在 go-ethereum 各个包的测试里，
+// 这里把它们整理成可以直接导入的包：
+//
+//   - Run 在内存管道上启动协议的 Run 函数，返回可以从远端收发消息的 Session
+//   - FakePeer 是按脚本应答的 p2p.MsgReadWriter，适合测试主动发起请求的一方
+//   - NewPeer 创建带有随机节点 ID 的 *p2p.Peer
+package p2ptest
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DefaultTimeout 是 Session 等待消息和协议退出的默认时间。
+const DefaultTimeout = 2 * time.Second
+
+// ErrTimeout 在等待消息或协议退出超时时返回。
+var ErrTimeout = errors.New("p2ptest: 等待超时")
+
+// NewPeer 创建一个带有随机节点 ID 的 *p2p.Peer，不对应任何真实连接。
+func NewPeer(name string, caps ...p2p.Cap) *p2p.Peer {
+	var id enode.ID
+	rand.Read(id[:])
+	return p2p.NewPeer(id, name, caps)
+}
+
+// Session 是在内存管道上运行的一个协议实例。测试代码扮演远端节点，
+// 通过 Send 向协议发送消息，通过 Expect 读取并检查协议发出的消息。
+type Session struct {
+	Peer    *p2p.Peer
+	Remote  *p2p.MsgPipeRW // 远端（测试代码）一侧的管道
+	Timeout time.Duration
+
+	local *p2p.MsgPipeRW
+	done  chan error
+	err   error
+}
+
+// Run 在内存管道上启动 proto.Run，返回远端一侧的 Session。
+func Run(proto p2p.Protocol) *Session {
+	return RunPeer(proto, NewPeer("p2ptest", p2p.Cap{Name: proto.Name, Version: proto.Version}))
+}
+
+// RunPeer 与 Run 相同，但使用调用方提供的节点。
+func RunPeer(proto p2p.Protocol, peer *p2p.Peer) *Session {
+	local, remote := p2p.MsgPipe()
+	s := &Session{Peer: peer, Remote: remote, Timeout: DefaultTimeout, local: local, done: make(chan error, 1)}
+	go func() {
+		err := proto.Run(peer, local)
+		local.Close()
+		s.done <- err
+	}()
+	return s
+}
+
+// Send 以 RLP 编码 data 并发送给协议。
+func (s *Session) Send(code uint64, data any) error {
+	return p2p.Send(s.Remote, code, data)
+}
+
+// Expect 读取协议发出的下一条消息，检查消息代码并解码到 into（可以为 nil）。
+func (s *Session) Expect(code uint64, into any) error {
+	msg, err := s.read()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != code {
+		return fmt.Errorf("p2ptest: 期望消息 %d，收到 %d", code, msg.Code)
+	}
+	if into == nil {
+		return nil
+	}
+	if err := msg.Decode(into); err != nil {
+		return fmt.Errorf("p2ptest: 解码消息 %d 失败: %v", code, err)
+	}
+	return nil
+}
+
+// ExpectMsg 读取下一条消息并与 content 的 RLP 编码逐字节比较。
+func (s *Session) ExpectMsg(code uint64, content any) error {
+	want, err := rlp.EncodeToBytes(content)
+	if err != nil {
+		return err
+	}
+	msg, err := s.read()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+	if msg.Code != code {
+		return fmt.Errorf("p2ptest: 期望消息 %d，收到 %d", code, msg.Code)
+	}
+	got, err := io.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	if string(got) != string(want) {
+		return fmt.Errorf("p2ptest: 消息 %d 内容不符\n收到: %x\n期望: %x", code, got, want)
+	}
+	return nil
+}
+
+// read 在超时内读取一条消息
+func (s *Session) read() (p2p.Msg, error) {
+	type result struct {
+		msg p2p.Msg
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		msg, err := s.Remote.ReadMsg()
+		ch <- result{msg, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-time.After(s.Timeout):
+		// 关闭管道以结束挂起的读取
+		s.Remote.Close()
+		return p2p.Msg{}, ErrTimeout
+	}
+}
+
+// Wait 等待协议的 Run 函数返回，并返回它的错误。
+func (s *Session) Wait() error {
+	if s.done == nil {
+		return s.err
+	}
+	select {
+	case s.err = <-s.done:
+		s.done = nil
+		return s.err
+	case <-time.After(s.Timeout):
+		return ErrTimeout
+	}
+}
+
+// Close 关闭管道（相当于远端断开连接），并等待协议退出。
+func (s *Session) Close() error {
+	s.Remote.Close()
+	return s.Wait()
+}
@@ -0,0 +1,170 @@
+package p2ptest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+const (
+	pingMsg = 0x00
+	pongMsg = 0x01
+	quitMsg = 0x02
+)
+
+var errQuit = errors.New("收到 quit")
+
+// echoProtocol 把每个 ping 的内容原样放进 pong 回复，收到 quit 时返回 errQuit
+var echoProtocol = p2p.Protocol{
+	Name:    "echo",
+	Version: 1,
+	Length:  3,
+	Run: func(_ *p2p.Peer, rw p2p.MsgReadWriter) error {
+		for {
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				return err
+			}
+			switch msg.Code {
+			case pingMsg:
+				var s string
+				if err := msg.Decode(&s); err != nil {
+					return err
+				}
+				if err := p2p.Send(rw, pongMsg, s); err != nil {
+					return err
+				}
+			case quitMsg:
+				msg.Discard()
+				return errQuit
+			default:
+				msg.Discard()
+			}
+		}
+	},
+}
+
+func TestSession(t *testing.T) {
+	s := Run(echoProtocol)
+	defer s.Close()
+
+	if err := s.Send(pingMsg, "a"); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := s.Expect(pongMsg, &got); err != nil || got != "a" {
+		t.Fatalf("Expect = %q, %v", got, err)
+	}
+	if err := s.Send(pingMsg, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ExpectMsg(pongMsg, "c"); err == nil {
+		t.Fatal("内容不同的消息通过了 ExpectMsg")
+	}
+	if err := s.Send(pingMsg, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expect(pingMsg, nil); err == nil {
+		t.Fatal("消息代码不同时 Expect 没有返回错误")
+	}
+	if err := s.Send(quitMsg, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); !errors.Is(err, errQuit) {
+		t.Fatalf("Wait = %v，应为协议返回的错误", err)
+	}
+	// 协议退出后再次 Wait 返回同一个错误
+	if err := s.Wait(); !errors.Is(err, errQuit) {
+		t.Fatalf("第二次 Wait = %v", err)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	s := Run(echoProtocol)
+	s.Timeout = 50 * time.Millisecond
+	if err := s.Expect(pongMsg, nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expect = %v，应为 ErrTimeout", err)
+	}
+	// 超时会关闭管道，协议因读取失败而退出
+	if err := s.Wait(); !errors.Is(err, p2p.ErrPipeClosed) {
+		t.Fatalf("Wait = %v", err)
+	}
+}
+
+func TestFakePeer(t *testing.T) {
+	f := NewFakePeer().On(pingMsg, func(msg p2p.Msg) []Message {
+		var s string
+		msg.Decode(&s)
+		return []Message{{Code: pongMsg, Data: s + "!"}}
+	})
+	if err := f.Queue(Message{Code: quitMsg, Data: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(f, pingMsg, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	// 先读到预先放入的消息，再读到应答
+	if msg, err := f.ReadMsg(); err != nil || msg.Code != quitMsg {
+		t.Fatalf("第一条消息 = %d, %v", msg.Code, err)
+	}
+	msg, err := f.ReadMsg()
+	if err != nil || msg.Code != pongMsg {
+		t.Fatalf("第二条消息 = %d, %v", msg.Code, err)
+	}
+	var reply string
+	if err := msg.Decode(&reply); err != nil || reply != "hi!" {
+		t.Fatalf("应答 = %q, %v", reply, err)
+	}
+
+	sent := f.Sent()
+	var s string
+	if len(sent) != 1 || sent[0].Code != pingMsg || sent[0].Decode(&s) != nil || s != "hi" {
+		t.Fatalf("记录的消息 = %+v", sent)
+	}
+
+	// 阻塞中的 ReadMsg 在 Close 后返回
+	errc := make(chan error, 1)
+	go func() {
+		_, err := f.ReadMsg()
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	f.Close()
+	if err := <-errc; !errors.Is(err, p2p.ErrPipeClosed) {
+		t.Fatalf("Close 后 ReadMsg = %v", err)
+	}
+	if err := p2p.Send(f, pingMsg, "x"); !errors.Is(err, p2p.ErrPipeClosed) {
+		t.Fatalf("Close 后 WriteMsg = %v", err)
+	}
+}
+
+// Reply 按顺序回复全部固定的消息
+func TestFakePeerReply(t *testing.T) {
+	f := NewFakePeer().Reply(pingMsg, Message{Code: pongMsg, Data: "1"}, Message{Code: pongMsg, Data: "2"})
+	if err := p2p.Send(f, pingMsg, "x"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1", "2"} {
+		msg, err := f.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if err := msg.Decode(&got); err != nil || got != want {
+			t.Fatalf("应答 = %q, %v，应为 %q", got, err, want)
+		}
+	}
+}
+
+func TestNewPeer(t *testing.T) {
+	a := NewPeer("a", p2p.Cap{Name: "echo", Version: 1})
+	b := NewPeer("b")
+	if a.ID() == b.ID() {
+		t.Fatal("两个节点的 ID 相同")
+	}
+	if caps := a.Caps(); a.Name() != "a" || len(caps) != 1 || caps[0] != (p2p.Cap{Name: "echo", Version: 1}) {
+		t.Fatalf("节点 = %v，caps = %v", a, a.Caps())
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 双机快速演示：一台机器以 -pair host 启动，打印一个编码了本节点 enode 的配对码；
+// 另一台机器以 -pair <配对码> 启动，把对方作为静态节点直接拨号。两边都关闭节点发现、
+// 不使用引导节点，只和对方连接。
+//
+// 配对码是 base32 编码的 版本(1) | 压缩公钥(33) | TCP 端口(2) | IP(4 或 16) | 校验(1)，
+// 每 6 个字符用 - 分隔，IPv4 时约 70 个字符，比 enode URL 短一半，读出来也能抄对。
+// host 模式同时把 enode URL 画成二维码（终端和 RPC 地址上的 /pair 网页），另一台设备扫码后
+// 可以直接用 -pair enode://... 连接。
+const (
+	pairHost    = "host"
+	pairVersion = 1
+	pairGroup   = 6
+)
+
+var (
+	pairFlag = flag.String("pair", "", "双机快速演示: host 打印配对码并等待对方连接，<配对码> 直接连接打印配对码的节点；都会关闭节点发现")
+	pairQR   = flag.Bool("pair.qr", true, "host 模式下在终端打印 enode URL 的二维码，设置 -rpc.addr 时也可以在浏览器打开 /pair 扫码")
+)
+
+var pairEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encodePairCode 把节点的公钥和 TCP 端点编码为配对码
+func encodePairCode(n *enode.Node) (string, error) {
+	addr, ok := n.TCPEndpoint()
+	if !ok {
+		return "", errors.New("节点没有 TCP 端点")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(pairVersion)
+	buf.Write(crypto.CompressPubkey(n.Pubkey()))
+	binary.Write(&buf, binary.BigEndian, addr.Port())
+	buf.Write(addr.Addr().Unmap().AsSlice())
+	buf.WriteByte(crypto.Keccak256(buf.Bytes())[0])
+	code := strings.ToLower(pairEncoding.EncodeToString(buf.Bytes()))
+	var groups []string
+	for len(code) > pairGroup {
+		groups, code = append(groups, code[:pairGroup]), code[pairGroup:]
+	}
+	return strings.Join(append(groups, code), "-"), nil
+}
+
+// decodePairCode 解析配对码，忽略分隔符、空白和大小写；扫码得到的 enode URL 也可以直接使用
+func decodePairCode(code string) (*enode.Node, error) {
+	if strings.HasPrefix(code, "enode://") {
+		return enode.ParseV4(code)
+	}
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "", "\t", "").Replace(code))
+	b, err := pairEncoding.DecodeString(code)
+	if err != nil {
+		return nil, fmt.Errorf("配对码格式错误: %v", err)
+	}
+	if len(b) != 1+33+2+4+1 && len(b) != 1+33+2+16+1 {
+		return nil, errors.New("配对码长度不对，请检查是否抄漏了字符")
+	}
+	body, sum := b[:len(b)-1], b[len(b)-1]
+	if crypto.Keccak256(body)[0] != sum {
+		return nil, errors.New("配对码校验失败，请检查是否抄错了字符")
+	}
+	if body[0] != pairVersion {
+		return nil, fmt.Errorf("不支持的配对码版本 %d", body[0])
+	}
+	pub, err := crypto.DecompressPubkey(body[1:34])
+	if err != nil {
+		return nil, fmt.Errorf("配对码中的公钥无效: %v", err)
+	}
+	port := int(binary.BigEndian.Uint16(body[34:36]))
+	ip := net.IP(body[36:])
+	return enode.NewV4(pub, ip, port, port), nil
+}
+
+// pairAddr 选择写入配对码的 IP：节点记录中的非回环地址（例如 -nat extip:），
+// 其次是网卡上的地址，都没有时用回环地址，只能在同一台机器上配对
+func pairAddr(self *enode.Node) netip.Addr {
+	if ip, ok := netip.AddrFromSlice(self.IP()); ok && !ip.Unmap().IsLoopback() && !ip.IsUnspecified() {
+		return ip.Unmap()
+	}
+	if ip, ok := preferredAddr(nil, interfaceAddrs()); ok {
+		return ip
+	}
+	return netip.AddrFrom4([4]byte{127, 0, 0, 1})
+}
+
+// pairNode 返回写入配对码的本节点，listenAddr 是实际监听的地址
+func pairNode(self *enode.Node, listenAddr string) (*enode.Node, error) {
+	_, portStr, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	port, _ := strconv.Atoi(portStr)
+	return enode.NewV4(self.Pubkey(), pairAddr(self).AsSlice(), port, port), nil
+}
+
+// pairInfo 是 host 模式下展示给另一台设备的连接信息
+type pairInfo struct {
+	Enode string `json:"enode"`
+	Code  string `json:"code"`
+	qr    *qrCode
+}
+
+func newPairInfo(n *enode.Node) (*pairInfo, error) {
+	code, err := encodePairCode(n)
+	if err != nil {
+		return nil, err
+	}
+	info := &pairInfo{Enode: n.URLv4(), Code: code}
+	if info.qr, err = encodeQR([]byte(info.Enode)); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// page 是 RPC 地址上 /pair 的网页，手机扫码得到 enode URL
+func (p *pairInfo) page() string {
+	return `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width">` +
+		`<title>devp2p-demo 配对</title></head><body style="font-family:sans-serif;text-align:center">` +
+		p.qr.svg(6) +
+		`<p>扫码得到 enode URL，或在另一台机器上运行:</p><pre>go run . -pair ` + p.Code + `</pre>` +
+		`<p style="word-break:break-all;font-family:monospace">` + html.EscapeString(p.Enode) + `</p></body></html>`
+}
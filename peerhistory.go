@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 节点历史：记录每个节点 ID 第一次和最近一次连接的时间，区分从未连接过的新节点和
+// 已知节点，并按天统计连接过的不同节点数和其中的新节点数，用来衡量每天接触到多少
+// 新的网络。设置了 -peers.history 时保存到文件，重启后仍能认出以前连接过的节点。
+//
+// 历史中还记录每个节点最近的可拨号地址、累计连接时长、最长的会话和有用的会话数（见 dialreason.go），
+// 重启后据此先重拨以前最稳定的节点（见 affinity.go）。
+const (
+	peerHistoryDays    = 14 // 保留最近多少天的统计
+	peerHistoryDateFmt = "2006-01-02"
+)
+
+// peerHistoryEntry 是一个节点的连接历史
+type peerHistoryEntry struct {
+	First    time.Time     `json:"first"`
+	Last     time.Time     `json:"last"`
+	Sessions int           `json:"sessions"`
+	Node     *enode.Node   `json:"node,omitempty"`    // 最近的可拨号地址，入站节点没有告知监听端口时为空
+	Uptime   time.Duration `json:"uptime,omitempty"`  // 已结束会话的累计时长
+	Longest  time.Duration `json:"longest,omitempty"` // 最长的会话
+	Useful   int           `json:"useful,omitempty"`  // 有用的会话数
+}
+
+// peerDay 是一天（本地时间）的统计
+type peerDay struct {
+	Date   string `json:"date"`
+	Unique int    `json:"unique"` // 当天连接过的不同节点数
+	New    int    `json:"new"`    // 其中第一次连接的节点数
+}
+
+// peerHistoryReport 是 admin_peerHistory 的返回值
+type peerHistoryReport struct {
+	Known int       `json:"known"` // 连接过的不同节点总数
+	Days  []peerDay `json:"days"`  // 最近的日期在最后
+}
+
+type peerHistoryFile struct {
+	Peers map[enode.ID]*peerHistoryEntry `json:"peers"`
+	Days  []peerDay                      `json:"days"`
+}
+
+type peerHistory struct {
+	path string // 为空时只保存在内存中
+
+	mu    sync.Mutex
+	peers map[enode.ID]*peerHistoryEntry
+	days  []peerDay
+	dirty bool
+}
+
+// loadPeerHistory 读取历史文件，文件不存在时从空的历史开始
+func loadPeerHistory(path string) (*peerHistory, error) {
+	h := &peerHistory{path: path, peers: make(map[enode.ID]*peerHistoryEntry)}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f peerHistoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if f.Peers != nil {
+		h.peers = f.Peers
+	}
+	h.days = f.Days
+	return h, nil
+}
+
+// connected 记录一次连接，返回节点是否第一次连接以及这是它的第几次会话
+func (h *peerHistory) connected(id enode.ID, now time.Time) (first bool, sessions int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.peers[id]
+	if !ok {
+		e = &peerHistoryEntry{First: now}
+		h.peers[id] = e
+	}
+	day := h.day(now)
+	if !ok || e.Last.Format(peerHistoryDateFmt) != day.Date {
+		day.Unique++
+	}
+	if !ok {
+		day.New++
+	}
+	e.Last = now
+	e.Sessions++
+	h.dirty = true
+	return !ok, e.Sessions
+}
+
+// disconnected 记录一个会话的结束，n 为节点的可拨号地址，可以为 nil。h 可以为 nil
+func (h *peerHistory) disconnected(id enode.ID, n *enode.Node, session time.Duration, useful bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.peers[id]
+	if !ok {
+		return
+	}
+	if n != nil {
+		e.Node = n
+	}
+	e.Uptime += session
+	e.Longest = max(e.Longest, session)
+	if useful {
+		e.Useful++
+	}
+	h.dirty = true
+}
+
+// affinityEntry 是按亲和度排名的一个历史节点
+type affinityEntry struct {
+	ID enode.ID
+	peerHistoryEntry
+}
+
+// best 返回最近 maxAge 内连接过、有可拨号地址并且有过有用会话或足够长的会话的节点，
+// 有用的会话越多、累计连接越久越靠前，最多 n 个
+func (h *peerHistory) best(n int, maxAge time.Duration) []affinityEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var list []affinityEntry
+	for id, e := range h.peers {
+		if e.Node == nil || time.Since(e.Last) > maxAge {
+			continue
+		}
+		if e.Useful == 0 && e.Longest < peerHealthyMinSession {
+			continue
+		}
+		list = append(list, affinityEntry{id, *e})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Useful != b.Useful {
+			return a.Useful > b.Useful
+		}
+		return a.Uptime > b.Uptime
+	})
+	return list[:min(len(list), n)]
+}
+
+// day 返回 now 所在日期的统计，调用方必须持有 h.mu
+func (h *peerHistory) day(now time.Time) *peerDay {
+	date := now.Format(peerHistoryDateFmt)
+	if n := len(h.days); n == 0 || h.days[n-1].Date != date {
+		h.days = append(h.days, peerDay{Date: date})
+		if len(h.days) > peerHistoryDays {
+			h.days = h.days[len(h.days)-peerHistoryDays:]
+		}
+	}
+	return &h.days[len(h.days)-1]
+}
+
+func (h *peerHistory) report() peerHistoryReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return peerHistoryReport{Known: len(h.peers), Days: append([]peerDay(nil), h.days...)}
+}
+
+// save 在有变化时写入历史文件
+func (h *peerHistory) save() error {
+	h.mu.Lock()
+	if h.path == "" || !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(&peerHistoryFile{Peers: h.peers, Days: h.days})
+	h.dirty = false
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 节点备注：运营者可以给节点打标签、写备注或禁止连接（admin_setPeerNote）。设置了 -peers.notes 时
+// 保存到文件。设置 -peers.notes.sync 后，本节点写的备注用节点私钥签名，通过 gossip 的 peer-notes
+// 主题发给机群中的其他节点；只接受列表中的机群节点签名的备注，这样在一个探测节点上禁止的滥用节点
+// 会自动在其他节点上也被禁止。同一个节点的备注以更新时间最新的为准，删除备注也是一次更新。
+// 本节点写的备注每隔 peerNotesRepublish 重新发布一次，让期间不在线或新加入的节点也能收到。
+const (
+	topicPeerNotes     = "peer-notes"
+	peerNotesRepublish = 30 * time.Minute
+
+	peerNoteMaxTags = 16
+	peerNoteMaxTag  = 32
+	peerNoteMaxText = 512
+	peerNoteSkew    = time.Minute // 允许的更新时间偏差
+	evPeerNote      = "peer.note"
+)
+
+var errPeerNoteSigner = errors.New("备注不是由机群节点签名")
+
+// peerNote 是运营者对一个节点的备注
+type peerNote struct {
+	Target  enode.ID `json:"id"`
+	Tags    []string `json:"tags,omitempty"`
+	Note    string   `json:"note,omitempty"`
+	Ban     bool     `json:"ban,omitempty"`  // 拒绝与该节点连接
+	Updated uint64   `json:"updated"`        // Unix 毫秒
+	Author  enode.ID `json:"author" rlp:"-"` // 签名者，从签名中恢复
+	Sig     []byte   `json:"sig,omitempty"`
+}
+
+// peerNoteInput 是 admin_setPeerNote 的参数
+type peerNoteInput struct {
+	Tags []string `json:"tags"`
+	Note string   `json:"note"`
+	Ban  bool     `json:"ban"`
+}
+
+func (n *peerNote) sigHash() []byte {
+	payload, _ := rlp.EncodeToBytes([]any{n.Target, n.Tags, n.Note, n.Ban, n.Updated})
+	return crypto.Keccak256(payload)
+}
+
+// empty 判断备注是否已被删除
+func (n *peerNote) empty() bool {
+	return len(n.Tags) == 0 && n.Note == "" && !n.Ban
+}
+
+// newer 判断 n 是否应取代 old，更新时间相同时按签名者排序，保证各个节点得到相同的结果
+func (n *peerNote) newer(old *peerNote) bool {
+	if old == nil || n.Updated != old.Updated {
+		return old == nil || n.Updated > old.Updated
+	}
+	return strings.Compare(n.Author.String(), old.Author.String()) > 0
+}
+
+func (in *peerNoteInput) validate() error {
+	if len(in.Tags) > peerNoteMaxTags {
+		return fmt.Errorf("标签最多 %d 个", peerNoteMaxTags)
+	}
+	for _, t := range in.Tags {
+		if t == "" || len(t) > peerNoteMaxTag || strings.ContainsAny(t, ", \t\n") {
+			return fmt.Errorf("无效的标签 %q，不能为空、不能包含空白和逗号，最长 %d 字节", t, peerNoteMaxTag)
+		}
+	}
+	if len(in.Note) > peerNoteMaxText {
+		return fmt.Errorf("备注最长 %d 字节", peerNoteMaxText)
+	}
+	return nil
+}
+
+type peerNotesFile struct {
+	Notes []*peerNote `json:"notes"`
+}
+
+// peerNotes 保存节点备注，并在机群节点之间同步
+type peerNotes struct {
+	path   string // 为空时只保存在内存中
+	key    *ecdsa.PrivateKey
+	self   enode.ID
+	fleet  map[enode.ID]bool // 为空时不同步
+	gossip *gossipProtocol
+	events *eventBus
+	faults *faultLog // 记录保存备注文件的故障，可以为 nil
+
+	mu    sync.Mutex
+	notes map[enode.ID]*peerNote
+	// onBan 在节点被禁止时调用，用于断开已经建立的连接
+	onBan func(id enode.ID)
+}
+
+// loadPeerNotes 读取备注文件，文件不存在时从空的备注开始
+func loadPeerNotes(path string, key *ecdsa.PrivateKey, events *eventBus) (*peerNotes, error) {
+	pn := &peerNotes{
+		path:   path,
+		key:    key,
+		self:   enode.PubkeyToIDV4(&key.PublicKey),
+		events: events,
+		notes:  make(map[enode.ID]*peerNote),
+	}
+	if path == "" {
+		return pn, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return pn, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f peerNotesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, n := range f.Notes {
+		pn.notes[n.Target] = n
+	}
+	return pn, nil
+}
+
+// startSync 开始与 fleet 中的节点同步备注
+func (pn *peerNotes) startSync(fleet []enode.ID, gossip *gossipProtocol) {
+	pn.fleet = make(map[enode.ID]bool, len(fleet)+1)
+	pn.fleet[pn.self] = true
+	for _, id := range fleet {
+		pn.fleet[id] = true
+	}
+	pn.gossip = gossip
+	gossip.subscribe(topicPeerNotes, pn.handleGossip)
+}
+
+// set 更新本节点对 id 的备注，in 为 nil 时删除备注
+func (pn *peerNotes) set(id enode.ID, in *peerNoteInput) (*peerNote, error) {
+	n := &peerNote{Target: id, Updated: uint64(time.Now().UnixMilli())}
+	if in != nil {
+		if err := in.validate(); err != nil {
+			return nil, err
+		}
+		n.Tags, n.Note, n.Ban = slices.Compact(slices.Sorted(slices.Values(in.Tags))), in.Note, in.Ban
+	}
+	pn.mu.Lock()
+	// 保证更新时间单调递增，同一毫秒内的两次修改也能区分先后
+	if old := pn.notes[id]; old != nil && old.Updated >= n.Updated {
+		n.Updated = old.Updated + 1
+	}
+	pn.mu.Unlock()
+	sig, err := crypto.Sign(n.sigHash(), pn.key)
+	if err != nil {
+		return nil, err
+	}
+	n.Sig, n.Author = sig, pn.self
+	pn.mu.Lock()
+	pn.notes[id] = n
+	pn.mu.Unlock()
+	pn.applied(n, true)
+	pn.publish(n)
+	return n, nil
+}
+
+func (pn *peerNotes) publish(n *peerNote) {
+	if pn.gossip == nil {
+		return
+	}
+	payload, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		return
+	}
+	pn.gossip.publish(topicPeerNotes, payload)
+}
+
+func (pn *peerNotes) handleGossip(from enode.ID, msg *gossipMessage) {
+	var n peerNote
+	if err := rlp.DecodeBytes(msg.Payload, &n); err != nil {
+		log.Printf("收到无效的节点备注 (来自 %s): %v", from.TerminalString(), err)
+		return
+	}
+	if err := pn.merge(&n); err != nil {
+		log.Printf("拒绝节点 %s 的备注 (来自 %s): %v", n.Target.TerminalString(), from.TerminalString(), err)
+	}
+}
+
+// merge 校验其他机群节点发来的备注，比本地的新时替换
+func (pn *peerNotes) merge(n *peerNote) error {
+	pub, err := crypto.SigToPub(n.sigHash(), n.Sig)
+	if err != nil {
+		return fmt.Errorf("无效的备注签名: %v", err)
+	}
+	n.Author = enode.PubkeyToIDV4(pub)
+	if !pn.fleet[n.Author] {
+		return errPeerNoteSigner
+	}
+	if time.UnixMilli(int64(n.Updated)).After(time.Now().Add(peerNoteSkew)) {
+		return fmt.Errorf("备注的更新时间 %v 晚于当前时间", time.UnixMilli(int64(n.Updated)))
+	}
+	if err := (&peerNoteInput{Tags: n.Tags, Note: n.Note}).validate(); err != nil {
+		return err
+	}
+	pn.mu.Lock()
+	if !n.newer(pn.notes[n.Target]) {
+		pn.mu.Unlock()
+		return nil
+	}
+	pn.notes[n.Target] = n
+	pn.mu.Unlock()
+	pn.applied(n, false)
+	return nil
+}
+
+// applied 在备注更新后保存文件、记录事件，并断开被禁止的节点
+func (pn *peerNotes) applied(n *peerNote, local bool) {
+	if err := pn.save(); err != nil {
+		log.Printf("保存节点备注失败: %v", err)
+		pn.faults.fail("peers.notes", failStorage, err)
+	} else {
+		pn.faults.ok("peers.notes")
+	}
+	detail := fmt.Sprintf("tags=%s ban=%v author=%s", strings.Join(n.Tags, ","), n.Ban, n.Author.TerminalString())
+	pn.events.emit(evPeerNote, n.Target, detail)
+	if !local {
+		log.Printf("机群节点 %s 更新了节点 %s 的备注: %s", n.Author.TerminalString(), n.Target.TerminalString(), detail)
+	}
+	if n.Ban && n.Target != pn.self && pn.onBan != nil {
+		pn.onBan(n.Target)
+	}
+}
+
+// banned 判断节点是否被备注禁止连接。pn 可以为 nil
+func (pn *peerNotes) banned(id enode.ID) bool {
+	if pn == nil {
+		return false
+	}
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	n := pn.notes[id]
+	return n != nil && n.Ban && id != pn.self
+}
+
+// get 返回节点的备注，没有备注时返回 nil。pn 可以为 nil
+func (pn *peerNotes) get(id enode.ID) *peerNote {
+	if pn == nil {
+		return nil
+	}
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	if n := pn.notes[id]; n != nil && !n.empty() {
+		cp := *n
+		return &cp
+	}
+	return nil
+}
+
+// list 返回所有没有被删除的备注，tag 不为空时只返回带这个标签的节点
+func (pn *peerNotes) list(tag string) []peerNote {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	list := []peerNote{}
+	for _, n := range pn.notes {
+		if !n.empty() && (tag == "" || slices.Contains(n.Tags, tag)) {
+			list = append(list, *n)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated > list[j].Updated })
+	return list
+}
+
+// run 定期重新发布本节点写的备注（包括删除），直到 ctx 结束
+func (pn *peerNotes) run(ctx context.Context) {
+	tick := time.NewTicker(peerNotesRepublish)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			pn.mu.Lock()
+			var own []*peerNote
+			for _, n := range pn.notes {
+				if n.Author == pn.self {
+					own = append(own, n)
+				}
+			}
+			pn.mu.Unlock()
+			for _, n := range own {
+				pn.publish(n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (pn *peerNotes) save() error {
+	if pn.path == "" {
+		return nil
+	}
+	pn.mu.Lock()
+	f := peerNotesFile{Notes: make([]*peerNote, 0, len(pn.notes))}
+	for _, n := range pn.notes {
+		f.Notes = append(f.Notes, n)
+	}
+	sort.Slice(f.Notes, func(i, j int) bool { return f.Notes[i].Target.String() < f.Notes[j].Target.String() })
+	data, err := json.MarshalIndent(&f, "", "  ")
+	pn.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := pn.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pn.path)
+}
+
+// parseFleetIDs 解析 -peers.notes.sync 中逗号分隔的节点 ID 或 enode URL
+func parseFleetIDs(s string) ([]enode.ID, error) {
+	var ids []enode.ID
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		id, err := parseNodeID(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的机群节点 %q: %v", item, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// disconnectPeer 断开被备注禁止的已连接节点
+func disconnectPeer(srv *p2p.Server, id enode.ID) {
+	for _, p := range srv.Peers() {
+		if p.ID() == id {
+			log.Printf("断开运营者备注中禁止的节点 %s", id.TerminalString())
+			p.Disconnect(p2p.DiscRequested)
+		}
+	}
+}
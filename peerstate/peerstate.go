@@ -0,0 +1,159 @@
+// Package peerstate 为子协议提供按对等节点保存的类型化状态。
+//
+// 每个协议通常都要维护一个 "节点 ID -> 协议状态" 的映射，并自己处理加锁、
+// 握手时创建和断开时清理。Set 把这些样板代码集中到一处：用 Set.Run 包装协议的
+// Run 函数后，状态在握手阶段创建、在连接断开时自动移除，其余代码可以并发安全地查询。
+// Set 同时跟踪每个节点在协议状态机中的阶段（见 Phase），用于诊断和生成状态转换图。
+package peerstate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// InitFunc 在协议握手阶段调用，返回该节点的协议状态。返回错误会断开连接。
+type InitFunc[T any] func(p *p2p.Peer, rw p2p.MsgReadWriter) (T, error)
+
+// RunFunc 是协议的主循环。ctx 在连接断开（RunFunc 返回）时取消，
+// 可以通过 PeerFromContext 取回对应的节点。
+type RunFunc[T any] func(ctx context.Context, p *p2p.Peer, rw p2p.MsgReadWriter, state T) error
+
+type entry[T any] struct {
+	peer  *p2p.Peer
+	state T
+	ctx   context.Context
+}
+
+// Set 保存某个协议所有活跃节点的状态，可以并发使用。
+type Set[T any] struct {
+	mu     sync.RWMutex
+	peers  map[enode.ID]*entry[T]
+	phases map[enode.ID]*phaseState // 包括仍在握手的节点
+	edges  map[Edge]uint64
+}
+
+// New 创建一个空的状态集合。
+func New[T any]() *Set[T] {
+	return &Set[T]{
+		peers:  make(map[enode.ID]*entry[T]),
+		phases: make(map[enode.ID]*phaseState),
+		edges:  make(map[Edge]uint64),
+	}
+}
+
+// Run 把 init 和 run 组合成 p2p.Protocol.Run 所需的函数。
+func (s *Set[T]) Run(init InitFunc[T], run RunFunc[T]) func(*p2p.Peer, p2p.MsgReadWriter) error {
+	return func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		ps := s.enter(p.ID())
+		defer s.move(p.ID(), ps, PhaseClosed)
+		state, err := init(p, rw)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(WithPeer(context.Background(), p))
+		defer cancel()
+
+		e := &entry[T]{peer: p, state: state, ctx: ctx}
+		s.mu.Lock()
+		s.peers[p.ID()] = e
+		s.moveLocked(ps, PhaseActive)
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			if s.peers[p.ID()] == e {
+				delete(s.peers, p.ID())
+			}
+			s.mu.Unlock()
+		}()
+		return run(ctx, p, rw, state)
+	}
+}
+
+// Get 返回节点的协议状态。
+func (s *Set[T]) Get(id enode.ID) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.peers[id]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return e.state, true
+}
+
+// Peer 返回节点对应的 *p2p.Peer。
+func (s *Set[T]) Peer(id enode.ID) *p2p.Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if e, ok := s.peers[id]; ok {
+		return e.peer
+	}
+	return nil
+}
+
+// Context 返回节点会话的 context，连接断开后会被取消。
+func (s *Set[T]) Context(id enode.ID) (context.Context, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if e, ok := s.peers[id]; ok {
+		return e.ctx, true
+	}
+	return nil, false
+}
+
+// Len 返回当前活跃节点数量。
+func (s *Set[T]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.peers)
+}
+
+// Range 对所有节点调用 fn，fn 返回 false 时停止。
+// 遍历的是调用时的快照（状态在持有读锁时复制，不受之后的 Update 影响），
+// fn 中可以安全地再次访问 Set。
+func (s *Set[T]) Range(fn func(p *p2p.Peer, state T) bool) {
+	type item struct {
+		peer  *p2p.Peer
+		state T
+	}
+	s.mu.RLock()
+	list := make([]item, 0, len(s.peers))
+	for _, e := range s.peers {
+		list = append(list, item{e.peer, e.state})
+	}
+	s.mu.RUnlock()
+	for _, it := range list {
+		if !fn(it.peer, it.state) {
+			return
+		}
+	}
+}
+
+// Update 在持有写锁的情况下用 fn 的返回值替换节点状态，
+// 适用于 T 是值类型的情况。节点不存在时返回 false。
+func (s *Set[T]) Update(id enode.ID, fn func(T) T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.peers[id]
+	if !ok {
+		return false
+	}
+	e.state = fn(e.state)
+	return true
+}
+
+type peerKey struct{}
+
+// WithPeer 返回携带节点的 context。
+func WithPeer(ctx context.Context, p *p2p.Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext 取回 WithPeer 保存的节点。
+func PeerFromContext(ctx context.Context) (*p2p.Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*p2p.Peer)
+	return p, ok
+}
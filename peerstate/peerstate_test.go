@@ -0,0 +1,173 @@
+package peerstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+type counter struct{ n int }
+
+// runPeer 在后台运行 Set.Run 包装的协议，返回节点和结束会话的函数（返回 Run 的错误）
+func runPeer(t *testing.T, s *Set[*counter], init InitFunc[*counter]) (*p2p.Peer, func() error) {
+	t.Helper()
+	p := p2p.NewPeer(enode.ID{byte(s.Len() + 1)}, "test", nil)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	started := make(chan struct{})
+	run := s.Run(init, func(ctx context.Context, _ *p2p.Peer, _ p2p.MsgReadWriter, _ *counter) error {
+		close(started)
+		<-stop
+		return nil
+	})
+	go func() { done <- run(p, nil) }()
+	select {
+	case <-started:
+	case err := <-done:
+		return p, func() error { return err }
+	case <-time.After(time.Second):
+		t.Fatal("协议没有进入主循环")
+	}
+	return p, func() error {
+		close(stop)
+		return <-done
+	}
+}
+
+func newCounter(*p2p.Peer, p2p.MsgReadWriter) (*counter, error) { return &counter{}, nil }
+
+func TestSetLifecycle(t *testing.T) {
+	s := New[*counter]()
+	p, stop := runPeer(t, s, newCounter)
+
+	st, ok := s.Get(p.ID())
+	if !ok || st == nil {
+		t.Fatal("握手后没有节点状态")
+	}
+	if s.Len() != 1 || s.Peer(p.ID()) != p {
+		t.Fatalf("Len = %d，Peer = %v", s.Len(), s.Peer(p.ID()))
+	}
+	if info, ok := s.PhaseOf(p.ID()); !ok || info.Phase != PhaseActive {
+		t.Fatalf("阶段 = %v，应为 active", info.Phase)
+	}
+	ctx, ok := s.Context(p.ID())
+	if !ok {
+		t.Fatal("没有会话 context")
+	}
+	if got, _ := PeerFromContext(ctx); got != p {
+		t.Fatal("context 中的节点不一致")
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(p.ID()); ok || s.Len() != 0 {
+		t.Fatal("断开后状态没有被清理")
+	}
+	if _, ok := s.PhaseOf(p.ID()); ok {
+		t.Fatal("断开后仍在跟踪阶段")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("断开后 context 没有被取消")
+	}
+	observed := map[Edge]uint64{}
+	for _, e := range s.Observed() {
+		observed[e.Edge] = e.Count
+	}
+	if observed[Edge{PhaseHandshaking, PhaseActive}] != 1 || observed[Edge{PhaseActive, PhaseClosed}] != 1 {
+		t.Fatalf("阶段转换 = %v", observed)
+	}
+}
+
+func TestSetInitError(t *testing.T) {
+	s := New[*counter]()
+	errInit := errors.New("握手失败")
+	p, stop := runPeer(t, s, func(*p2p.Peer, p2p.MsgReadWriter) (*counter, error) { return nil, errInit })
+	if err := stop(); !errors.Is(err, errInit) {
+		t.Fatalf("Run 的错误 = %v", err)
+	}
+	if _, ok := s.Get(p.ID()); ok {
+		t.Fatal("握手失败的节点有状态")
+	}
+	for _, e := range s.Observed() {
+		want := uint64(0)
+		if e.Edge == (Edge{PhaseHandshaking, PhaseClosed}) {
+			want = 1
+		}
+		if e.Count != want {
+			t.Fatalf("转换 %v 的次数 = %d，应为 %d", e.Edge, e.Count, want)
+		}
+	}
+}
+
+func TestSetUpdateRange(t *testing.T) {
+	s := New[counter]()
+	p := p2p.NewPeer(enode.ID{1}, "test", nil)
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	run := s.Run(func(*p2p.Peer, p2p.MsgReadWriter) (counter, error) { return counter{}, nil },
+		func(context.Context, *p2p.Peer, p2p.MsgReadWriter, counter) error {
+			close(started)
+			<-stop
+			return nil
+		})
+	go func() { done <- run(p, nil) }()
+	<-started
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for range 3 {
+		if !s.Update(p.ID(), func(c counter) counter { c.n++; return c }) {
+			t.Fatal("Update 没有找到节点")
+		}
+	}
+	if s.Update(enode.ID{2}, func(c counter) counter { return c }) {
+		t.Fatal("不存在的节点 Update 返回 true")
+	}
+	if c, _ := s.Get(p.ID()); c.n != 3 {
+		t.Fatalf("n = %d，应为 3", c.n)
+	}
+	// Range 遍历的是快照，回调中可以再次访问 Set
+	var seen int
+	s.Range(func(_ *p2p.Peer, c counter) bool {
+		s.Update(p.ID(), func(c counter) counter { c.n = 100; return c })
+		seen = c.n
+		return true
+	})
+	if seen != 3 {
+		t.Fatalf("Range 看到 n = %d，应为快照中的 3", seen)
+	}
+}
+
+func TestSetBusyDrain(t *testing.T) {
+	s := New[*counter]()
+	p, stop := runPeer(t, s, newCounter)
+	defer stop()
+
+	done1 := s.Busy(p.ID())
+	done2 := s.Busy(p.ID())
+	if info, _ := s.PhaseOf(p.ID()); info.Phase != PhaseSyncing {
+		t.Fatalf("阶段 = %v，应为 syncing", info.Phase)
+	}
+	done1()
+	if info, _ := s.PhaseOf(p.ID()); info.Phase != PhaseSyncing {
+		t.Fatalf("还有未结束的 Busy 时阶段 = %v", info.Phase)
+	}
+	done2()
+	if info, _ := s.PhaseOf(p.ID()); info.Phase != PhaseActive {
+		t.Fatalf("Busy 全部结束后阶段 = %v，应为 active", info.Phase)
+	}
+	s.Drain(p.ID())
+	done := s.Busy(p.ID())
+	done()
+	if info, _ := s.PhaseOf(p.ID()); info.Phase != PhaseDraining {
+		t.Fatalf("排空中的节点阶段 = %v，应保持 draining", info.Phase)
+	}
+}
@@ -0,0 +1,196 @@
+package peerstate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Phase 是节点在某个协议中所处的阶段。Set.Run 自动维护握手、活跃和关闭三个阶段，
+// 同步和排空由协议通过 Busy、Drain 标记。
+type Phase uint8
+
+const (
+	PhaseHandshaking Phase = iota // 正在执行协议握手
+	PhaseActive                   // 握手完成，正常收发消息
+	PhaseSyncing                  // 正在进行较长的数据交换（例如文件传输）
+	PhaseDraining                 // 一方即将下线，不再发起新的交换
+	PhaseClosed                   // 连接已断开
+)
+
+var phaseNames = [...]string{"handshaking", "active", "syncing", "draining", "closed"}
+
+func (p Phase) String() string {
+	if int(p) < len(phaseNames) {
+		return phaseNames[p]
+	}
+	return fmt.Sprintf("phase(%d)", p)
+}
+
+// MarshalText 使阶段在 JSON 中以名称表示。
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Edge 是阶段之间的一次转换。
+type Edge struct {
+	From Phase `json:"from"`
+	To   Phase `json:"to"`
+}
+
+// Edges 是状态机允许的全部转换，其他转换会被忽略。
+var Edges = []Edge{
+	{PhaseHandshaking, PhaseActive},
+	{PhaseHandshaking, PhaseClosed},
+	{PhaseActive, PhaseSyncing},
+	{PhaseSyncing, PhaseActive},
+	{PhaseActive, PhaseDraining},
+	{PhaseSyncing, PhaseDraining},
+	{PhaseActive, PhaseClosed},
+	{PhaseSyncing, PhaseClosed},
+	{PhaseDraining, PhaseClosed},
+}
+
+func allowed(from, to Phase) bool {
+	for _, e := range Edges {
+		if e.From == from && e.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// EdgeCount 是某个转换实际发生的次数。
+type EdgeCount struct {
+	Edge
+	Count uint64 `json:"count"`
+}
+
+// PhaseInfo 是节点当前的阶段及进入该阶段的时间。
+type PhaseInfo struct {
+	ID    enode.ID  `json:"id"`
+	Phase Phase     `json:"phase"`
+	Since time.Time `json:"since"`
+}
+
+type phaseState struct {
+	phase Phase
+	since time.Time
+	busy  int // 未结束的 Busy 调用数
+}
+
+// enter 开始跟踪一个新连接，返回的指针用于在连接结束时确认没有被同一节点的新连接替换
+func (s *Set[T]) enter(id enode.ID) *phaseState {
+	ps := &phaseState{phase: PhaseHandshaking, since: time.Now()}
+	s.mu.Lock()
+	s.phases[id] = ps
+	s.mu.Unlock()
+	return ps
+}
+
+// moveLocked 把阶段转换为 to，调用方必须持有写锁
+func (s *Set[T]) moveLocked(ps *phaseState, to Phase) bool {
+	if ps.phase == to || !allowed(ps.phase, to) {
+		return false
+	}
+	s.edges[Edge{ps.phase, to}]++
+	ps.phase, ps.since = to, time.Now()
+	return true
+}
+
+func (s *Set[T]) move(id enode.ID, ps *phaseState, to Phase) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moveLocked(ps, to)
+	if to == PhaseClosed && s.phases[id] == ps {
+		delete(s.phases, id)
+	}
+}
+
+// Busy 把节点标记为同步中，直到返回的函数被调用。可以嵌套调用，
+// 最后一个结束时节点回到活跃阶段（已经在排空的节点保持排空）。
+func (s *Set[T]) Busy(id enode.ID) (done func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps := s.phases[id]
+	if ps == nil {
+		return func() {}
+	}
+	ps.busy++
+	s.moveLocked(ps, PhaseSyncing)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ps.busy--; ps.busy == 0 {
+			s.moveLocked(ps, PhaseActive)
+		}
+	}
+}
+
+// Drain 把节点标记为排空中，通常在发送或收到下线通知时调用。
+func (s *Set[T]) Drain(id enode.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ps := s.phases[id]; ps != nil {
+		s.moveLocked(ps, PhaseDraining)
+	}
+}
+
+// PhaseOf 返回节点当前的阶段，包括仍在握手的节点。
+func (s *Set[T]) PhaseOf(id enode.ID) (PhaseInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ps, ok := s.phases[id]
+	if !ok {
+		return PhaseInfo{}, false
+	}
+	return PhaseInfo{ID: id, Phase: ps.phase, Since: ps.since}, true
+}
+
+// Phases 返回所有节点当前的阶段，按节点 ID 排序。
+func (s *Set[T]) Phases() []PhaseInfo {
+	s.mu.RLock()
+	list := make([]PhaseInfo, 0, len(s.phases))
+	for id, ps := range s.phases {
+		list = append(list, PhaseInfo{ID: id, Phase: ps.phase, Since: ps.since})
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.String() < list[j].ID.String() })
+	return list
+}
+
+// Observed 返回自创建以来每种转换发生的次数，按 Edges 中的顺序列出全部转换。
+func (s *Set[T]) Observed() []EdgeCount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make([]EdgeCount, len(Edges))
+	for i, e := range Edges {
+		counts[i] = EdgeCount{Edge: e, Count: s.edges[e]}
+	}
+	return counts
+}
+
+// Graph 以 Graphviz DOT 格式输出状态转换图。counts 为 nil 时只画出允许的转换，
+// 否则在每条边上标注发生次数。
+func Graph(name string, counts []EdgeCount) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", name)
+	b.WriteString("  rankdir=LR;\n  node [shape=box, style=rounded];\n")
+	fmt.Fprintf(&b, "  %s [shape=doublecircle];\n", PhaseClosed)
+	label := make(map[Edge]uint64)
+	for _, c := range counts {
+		label[c.Edge] = c.Count
+	}
+	for _, e := range Edges {
+		if counts == nil {
+			fmt.Fprintf(&b, "  %s -> %s;\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s [label=\"%d\"];\n", e.From, e.To, label[e])
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
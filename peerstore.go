@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// 断开后多久之内仍被视为可推荐的健康节点
+	peerHealthyRecent = 10 * time.Minute
+	// 已断开节点的上一个会话至少要持续这么久才被视为健康
+	peerHealthyMinSession = time.Minute
+	// 节点历史写入文件的间隔
+	peerHistorySaveInterval = time.Minute
+)
+
+// peerRecord 是节点在本地的历史记录
+type peerRecord struct {
+	ID          enode.ID      `json:"id"`
+	Node        *enode.Node   `json:"-"` // 可拨号的地址，入站节点在握手前未知
+	Name        string        `json:"name"`
+	FirstSeen   time.Time     `json:"firstSeen"`
+	LastSeen    time.Time     `json:"lastSeen"`
+	Sessions    int           `json:"sessions"`
+	Connected   bool          `json:"connected"`
+	ConnectedAt time.Time     `json:"connectedAt,omitzero"`
+	LastSession time.Duration `json:"lastSession"`
+	LastError   string        `json:"lastError,omitempty"`
+	Reason      string        `json:"reason,omitempty"` // 本次（或上次）会话的拨号来源，见 dialreason.go
+}
+
+// peerStore 记录见过的所有节点及其会话情况
+type peerStore struct {
+	mu      sync.Mutex
+	peers   map[enode.ID]*peerRecord
+	history *peerHistory
+	guard   *impersonationGuard // 检查可拨号端点是否属于另一个静态节点，可以为 nil
+	reasons *dialReasons        // 按拨号来源统计会话，可以为 nil
+	notes   *peerNotes          // 节点连接时在日志中带上运营者的标签，可以为 nil
+	faults  *faultLog           // 记录保存节点历史的故障，可以为 nil
+}
+
+func newPeerStore(history *peerHistory) *peerStore {
+	return &peerStore{peers: make(map[enode.ID]*peerRecord), history: history}
+}
+
+func (s *peerStore) record(id enode.ID) *peerRecord {
+	r, ok := s.peers[id]
+	if !ok {
+		r = &peerRecord{ID: id, FirstSeen: time.Now()}
+		s.peers[id] = r
+	}
+	return r
+}
+
+// connected 记录新的会话，返回节点是否第一次连接（包括本次运行之前）、这是它的第几次会话以及拨号来源
+func (s *peerStore) connected(p *p2p.Peer) (first bool, sessions int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	first, sessions = s.history.connected(p.ID(), now)
+	r := s.record(p.ID())
+	r.Name = p.Fullname()
+	r.LastSeen = now
+	r.Sessions++
+	r.Connected = true
+	r.ConnectedAt = now
+	r.Reason = s.reasons.started(p)
+	reason = r.Reason
+	if !p.Inbound() {
+		// 主动拨出的连接，远端地址就是可拨号地址
+		r.Node = p.Node()
+	}
+	return first, sessions, reason
+}
+
+func (s *peerStore) disconnected(id enode.ID, err string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.peers[id]
+	if !ok || !r.Connected {
+		return
+	}
+	now := time.Now()
+	r.LastSeen = now
+	r.Connected = false
+	r.LastSession = now.Sub(r.ConnectedAt)
+	r.LastError = err
+	useful := s.reasons.ended(id)
+	s.history.disconnected(id, r.Node, r.LastSession, useful)
+}
+
+// closeSessions 在服务器停止后结束所有仍在进行的会话，使最后一次保存的历史包含它们
+func (s *peerStore) closeSessions() {
+	s.mu.Lock()
+	var ids []enode.ID
+	for id, r := range s.peers {
+		if r.Connected {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.disconnected(id, "节点关闭")
+	}
+}
+
+// setDialable 记录节点的可拨号地址（例如入站节点在协议握手中告知的监听端口）
+func (s *peerStore) setDialable(n *enode.Node) {
+	s.guard.dialable(n)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(n.ID()).Node = n
+}
+
+func (s *peerStore) get(id enode.ID) (peerRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.peers[id]
+	if !ok {
+		return peerRecord{}, false
+	}
+	return *r, true
+}
+
+// healthy 返回最多 max 个可以推荐给其他节点的健康节点：
+// 先是当前已连接的节点（会话越久越靠前），然后是最近断开、上个会话足够长的节点。
+func (s *peerStore) healthy(exclude enode.ID, max int) []*enode.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var list []*peerRecord
+	for _, r := range s.peers {
+		if r.ID == exclude || r.Node == nil {
+			continue
+		}
+		if r.Connected || (now.Sub(r.LastSeen) < peerHealthyRecent && r.LastSession >= peerHealthyMinSession) {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Connected != b.Connected {
+			return a.Connected
+		}
+		if a.Connected {
+			return a.ConnectedAt.Before(b.ConnectedAt)
+		}
+		return a.LastSession > b.LastSession
+	})
+	nodes := make([]*enode.Node, 0, min(len(list), max))
+	for _, r := range list {
+		if len(nodes) == max {
+			break
+		}
+		nodes = append(nodes, r.Node)
+	}
+	return nodes
+}
+
+// dialable 返回当前未连接、地址已知的历史节点，最近见过的排在前面
+func (s *peerStore) dialable() []*enode.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*peerRecord
+	for _, r := range s.peers {
+		if !r.Connected && r.Node != nil {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	nodes := make([]*enode.Node, len(list))
+	for i, r := range list {
+		nodes[i] = r.Node
+	}
+	return nodes
+}
+
+// track 根据服务器的对等节点事件更新记录，连接的日志和事件标明是新节点还是已知节点
+func (s *peerStore) track(srv *p2p.Server, events *eventBus) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	save := time.NewTicker(peerHistorySaveInterval)
+	defer save.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				for _, p := range srv.Peers() {
+					if p.ID() != ev.Peer {
+						continue
+					}
+					first, sessions, reason := s.connected(p)
+					if reason != "" {
+						reason = " reason=" + reason
+					}
+					if note := s.notes.get(p.ID()); note != nil && len(note.Tags) > 0 {
+						reason += " tags=" + strings.Join(note.Tags, ",")
+					}
+					if first {
+						log.Printf("新节点连接: %s %s%s", p.ID().TerminalString(), p.Fullname(), reason)
+						events.emit(evPeerNew, p.ID(), p.Fullname()+reason)
+					} else {
+						log.Printf("已知节点连接: %s %s (第 %d 次会话)%s", p.ID().TerminalString(), p.Fullname(), sessions, reason)
+						events.emit(evPeerKnown, p.ID(), fmt.Sprintf("session=%d %s%s", sessions, p.Fullname(), reason))
+					}
+				}
+			case p2p.PeerEventTypeDrop:
+				s.disconnected(ev.Peer, ev.Error)
+			}
+		case <-save.C:
+			if err := s.history.save(); err != nil {
+				log.Printf("保存节点历史失败: %v", err)
+				s.faults.fail("peers.history", failStorage, err)
+			} else {
+				s.faults.ok("peers.history")
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	peerTargetInterval = 5 * time.Second
+	// 每轮最多主动拨号的节点数
+	peerTargetDialBatch = 4
+	// 每轮从节点发现中读取随机节点的最长时间
+	peerTargetDiscoverTimeout = 2 * time.Second
+	// 刚连接的节点在这段时间内不会被断开，给协议握手和交换数据留出时间
+	peerTargetShedGrace = time.Minute
+)
+
+var errPeerTarget = errors.New("已达到目标连接数")
+
+// peerTarget 维护目标连接数，低水位 target-hysteresis，高水位 target+hysteresis：
+//
+//   - 低于低水位时主动拨号（历史节点优先，然后是节点发现中的随机节点）
+//   - 达到目标后暂停调度器的动态拨号，直到连接数回落到低水位以下
+//   - 开启 shed 时，超过高水位会断开价值最低的节点直到回到目标
+//
+// MaxPeers 仍然是硬上限。
+type peerTarget struct {
+	srv        *p2p.Server
+	dialer     p2p.NodeDialer
+	store      *peerStore
+	usage      *usageTracker
+	target     int
+	hysteresis int
+	shed       bool
+
+	mu      sync.Mutex
+	dialing bool // 为 false 时拒绝调度器的动态拨号
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// peerTargetStatus 是 admin_peerTarget 返回的状态
+type peerTargetStatus struct {
+	Target  int  `json:"target"`
+	Low     int  `json:"low"`
+	High    int  `json:"high"`
+	Peers   int  `json:"peers"`
+	Dialing bool `json:"dialing"`
+	Shed    bool `json:"shed"`
+}
+
+func newPeerTarget(target, hysteresis int, shed bool, dialer p2p.NodeDialer, store *peerStore, usage *usageTracker) *peerTarget {
+	return &peerTarget{
+		dialer:     dialer,
+		store:      store,
+		usage:      usage,
+		target:     target,
+		hysteresis: hysteresis,
+		shed:       shed,
+		dialing:    true,
+		quit:       make(chan struct{}),
+	}
+}
+
+func (t *peerTarget) low() int  { return max(t.target-t.hysteresis, 0) }
+func (t *peerTarget) high() int { return t.target + t.hysteresis }
+
+func (t *peerTarget) start(srv *p2p.Server) {
+	t.srv = srv
+	t.wg.Add(1)
+	go t.loop()
+}
+
+func (t *peerTarget) stop() {
+	close(t.quit)
+	t.wg.Wait()
+}
+
+// checkDial 在达到目标连接数后拒绝调度器发起的动态拨号
+func (t *peerTarget) checkDial() error {
+	if t == nil || t.target == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dialing {
+		return errPeerTarget
+	}
+	return nil
+}
+
+func (t *peerTarget) status() peerTargetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return peerTargetStatus{
+		Target:  t.target,
+		Low:     t.low(),
+		High:    t.high(),
+		Peers:   t.srv.PeerCount(),
+		Dialing: t.dialing,
+		Shed:    t.shed,
+	}
+}
+
+func (t *peerTarget) loop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(peerTargetInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.check()
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+func (t *peerTarget) check() {
+	count := t.srv.PeerCount()
+
+	t.mu.Lock()
+	was := t.dialing
+	switch {
+	case count >= t.target:
+		t.dialing = false
+	case count < t.low():
+		t.dialing = true
+	}
+	now := t.dialing
+	t.mu.Unlock()
+	if was != now {
+		if now {
+			log.Printf("连接数 %d 低于低水位 %d，恢复动态拨号", count, t.low())
+		} else {
+			log.Printf("连接数 %d 已达到目标 %d，暂停动态拨号", count, t.target)
+		}
+	}
+
+	switch {
+	case count < t.low():
+		t.dialMore(t.target - count)
+	case t.shed && count > t.high():
+		t.shedPeers(count - t.target)
+	}
+}
+
+// dialMore 主动拨号以尽快回到目标连接数
+func (t *peerTarget) dialMore(want int) {
+	want = min(want, peerTargetDialBatch)
+	connected := make(map[enode.ID]bool)
+	for _, p := range t.srv.Peers() {
+		connected[p.ID()] = true
+	}
+	self := t.srv.Self().ID()
+	var candidates []*enode.Node
+	for _, n := range t.store.dialable() {
+		if len(candidates) == want {
+			break
+		}
+		if !connected[n.ID()] && n.ID() != self {
+			connected[n.ID()] = true
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) < want {
+		if disc := t.srv.DiscoveryV4(); disc != nil {
+			it := disc.RandomNodes()
+			timer := time.AfterFunc(peerTargetDiscoverTimeout, it.Close)
+			for len(candidates) < want && it.Next() {
+				n := it.Node()
+				if _, ok := n.TCPEndpoint(); ok && !connected[n.ID()] && n.ID() != self {
+					connected[n.ID()] = true
+					candidates = append(candidates, n)
+				}
+			}
+			timer.Stop()
+			it.Close()
+		}
+	}
+	for _, n := range candidates {
+		go t.dial(n)
+	}
+}
+
+func (t *peerTarget) dial(n *enode.Node) {
+	ctx, cancel := context.WithTimeout(withDirectDial(context.Background(), dialTarget), defaultDialTimeout)
+	defer cancel()
+	fd, err := t.dialer.Dial(ctx, n)
+	if err == nil {
+		err = t.srv.SetupConn(fd, reconnectConnFlags, n)
+	}
+	if err != nil {
+		log.Printf("主动拨号 %s 失败: %v", n.ID().TerminalString(), err)
+	}
+}
+
+// shedPeers 断开 n 个价值最低的节点：协议会话越少、累计流量越少价值越低，
+// 刚连接的节点和受信任的节点不会被断开
+func (t *peerTarget) shedPeers(n int) {
+	type candidate struct {
+		peer  *p2p.Peer
+		value uint64
+		since time.Duration
+	}
+	var list []candidate
+	for _, p := range t.srv.Peers() {
+		since := time.Duration(0)
+		if r, ok := t.store.get(p.ID()); ok && r.Connected {
+			since = time.Since(r.ConnectedAt)
+		}
+		if since < peerTargetShedGrace || p.Info().Network.Trusted {
+			continue
+		}
+		list = append(list, candidate{peer: p, value: t.usage.value(p.ID()), since: since})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].value != list[j].value {
+			return list[i].value < list[j].value
+		}
+		return list[i].since < list[j].since
+	})
+	for _, c := range list[:min(n, len(list))] {
+		log.Printf("连接数超过高水位 %d，断开价值最低的节点 %s", t.high(), c.peer.ID().TerminalString())
+		c.peer.Disconnect(p2p.DiscTooManyPeers)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/cuiweixie/devp2p-demo/peerstate"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// phaseTracker 是 peerstate.Set 中与协议状态机相关的部分
+type phaseTracker interface {
+	Phases() []peerstate.PhaseInfo
+	Observed() []peerstate.EdgeCount
+	Drain(id enode.ID)
+}
+
+// protocolPhases 按协议名保存各协议的状态机
+type protocolPhases map[string]phaseTracker
+
+// peerPhase 是节点在某个协议中的阶段
+type peerPhase struct {
+	Protocol string `json:"protocol"`
+	peerstate.PhaseInfo
+}
+
+// list 返回所有协议中节点的阶段，id 不为空时只返回该节点的
+func (pp protocolPhases) list(id *enode.ID) []peerPhase {
+	var list []peerPhase
+	for name, t := range pp {
+		for _, info := range t.Phases() {
+			if id == nil || info.ID == *id {
+				list = append(list, peerPhase{Protocol: name, PhaseInfo: info})
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID.String() < list[j].ID.String()
+		}
+		return list[i].Protocol < list[j].Protocol
+	})
+	return list
+}
+
+// drainAll 在关闭节点前把所有连接标记为排空
+func (pp protocolPhases) drainAll(srv *p2p.Server) {
+	for _, p := range srv.Peers() {
+		for _, t := range pp {
+			t.Drain(p.ID())
+		}
+	}
+}
+
+// graph 返回协议 name 的状态转换图，边上标注实际发生的转换次数
+func (pp protocolPhases) graph(name string) (string, error) {
+	t, ok := pp[name]
+	if !ok {
+		return "", fmt.Errorf("未知的协议 %q", name)
+	}
+	return peerstate.Graph(name, t.Observed()), nil
+}
+
+func stateGraphCmd(args []string) {
+	fs := flag.NewFlagSet("state-graph", flag.ExitOnError)
+	out := fs.String("out", "", "把 DOT 格式的状态转换图写入文件（默认输出到标准输出）")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	dot := peerstate.Graph("devp2p-demo", nil)
+	if *out == "" {
+		fmt.Print(dot)
+		return
+	}
+	if err := os.WriteFile(*out, []byte(dot), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// discv4 数据包头：32 字节哈希 + 65 字节签名，之后是 1 字节类型
+const (
+	discv4HeadSize = 32 + 65
+	// 请求类数据包 (ping/findnode/enrrequest) 的类型，其余是响应
+	discv4Ping       = 1
+	discv4Findnode   = 3
+	discv4ENRRequest = 5
+
+	// 每个节点的令牌桶在这么久没有使用后被清理
+	politeIdleExpiry = 10 * time.Minute
+)
+
+// tokenBucket 是简单的令牌桶限速器，rate 为每秒补充的令牌数
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take 取出一个令牌，令牌不足时预支并返回需要等待的时间
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// tryTake 在有令牌时取出一个并返回 true，不会预支
+func (b *tokenBucket) tryTake(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// politeConn 包装节点发现使用的 UDP 连接，限制爬取的激进程度：
+//
+//   - 全局每秒发送的数据包数超过上限时阻塞发送，对整个节点发现形成背压
+//   - 发往同一节点的 findnode 查询超过每节点速率时直接丢弃（对方看来只是一次超时），
+//     ping 和 enrrequest 只受全局限速，响应不受影响
+//   - 发往已排除节点（ENR 中要求不被爬取）的请求全部丢弃
+type politeConn struct {
+	discover.UDPConn
+	global    *tokenBucket // 为 nil 时不限制
+	nodeRate  float64      // 每个节点每秒的请求数，0 表示不限制
+	nodeBurst float64
+
+	mu       sync.Mutex
+	nodes    map[netip.AddrPort]*tokenBucket
+	excluded map[netip.AddrPort]bool
+	lastGC   time.Time
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	waited  atomic.Int64 // 因全局限速累计等待的纳秒数
+}
+
+func newPoliteConn(conn discover.UDPConn, pps, nodeRate, nodeBurst float64) *politeConn {
+	c := &politeConn{
+		UDPConn:   conn,
+		nodeRate:  nodeRate,
+		nodeBurst: max(nodeBurst, 1),
+		nodes:     make(map[netip.AddrPort]*tokenBucket),
+		excluded:  make(map[netip.AddrPort]bool),
+		lastGC:    time.Now(),
+	}
+	if pps > 0 {
+		c.global = newTokenBucket(pps, max(pps/10, 1))
+	}
+	return c
+}
+
+// exclude 不再向 addr 发送任何请求
+func (c *politeConn) exclude(addr netip.AddrPort) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.excluded[addr] = true
+}
+
+func (c *politeConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	var kind byte
+	if len(b) > discv4HeadSize {
+		kind = b[discv4HeadSize]
+	}
+	request := kind == discv4Ping || kind == discv4Findnode || kind == discv4ENRRequest
+
+	c.mu.Lock()
+	now := time.Now()
+	if request && c.excluded[addr] || kind == discv4Findnode && !c.allowNode(addr, now) {
+		c.mu.Unlock()
+		c.dropped.Add(1)
+		// 假装发送成功，由上层按超时处理
+		return len(b), nil
+	}
+	var wait time.Duration
+	if c.global != nil {
+		wait = c.global.take(now)
+	}
+	c.mu.Unlock()
+
+	if wait > 0 {
+		c.waited.Add(int64(wait))
+		time.Sleep(wait)
+	}
+	c.sent.Add(1)
+	return c.UDPConn.WriteToUDPAddrPort(b, addr)
+}
+
+// allowNode 检查发往 addr 的查询是否在每节点速率内，调用方必须持有 c.mu
+func (c *politeConn) allowNode(addr netip.AddrPort, now time.Time) bool {
+	if c.nodeRate <= 0 {
+		return true
+	}
+	if now.Sub(c.lastGC) > politeIdleExpiry {
+		for a, b := range c.nodes {
+			if now.Sub(b.last) > politeIdleExpiry {
+				delete(c.nodes, a)
+			}
+		}
+		c.lastGC = now
+	}
+	b, ok := c.nodes[addr]
+	if !ok {
+		b = newTokenBucket(c.nodeRate, c.nodeBurst)
+		c.nodes[addr] = b
+	}
+	return b.tryTake(now)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const probeTimeout = 5 * time.Second
+
+// probeListen 检查 addr 的 TCP 和 UDP 端口能否绑定
+func probeListen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("TCP: %w", err)
+	}
+	l.Close()
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("UDP: %w", err)
+	}
+	c.Close()
+	return nil
+}
+
+// probeBootnode 检查引导节点：先通过临时的 discv4 监听器发送 ping，再建立一次 TCP 连接。
+// 返回 ping 的往返时间。
+func probeBootnode(key *ecdsa.PrivateKey, n *enode.Node) (time.Duration, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return 0, err
+	}
+	db, err := enode.OpenDB("")
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	defer db.Close()
+	ln := enode.NewLocalNode(db, key)
+	disc, err := discover.ListenV4(conn, ln, discover.Config{PrivateKey: key})
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	defer disc.Close()
+
+	start := time.Now()
+	if _, err := disc.Ping(n); err != nil {
+		return 0, fmt.Errorf("discv4 ping: %w", err)
+	}
+	rtt := time.Since(start)
+	if addr, ok := n.TCPEndpoint(); ok {
+		fd, err := net.DialTimeout("tcp", addr.String(), probeTimeout)
+		if err != nil {
+			return rtt, fmt.Errorf("TCP: %w", err)
+		}
+		fd.Close()
+	}
+	return rtt, nil
+}
+
+// probeClock 向 NTP 服务器查询一次时间，返回本地时钟的偏差（正数表示本地时钟偏快）
+func probeClock(server string) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, probeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+
+	// SNTP 请求只需设置版本 (3) 和客户端模式 (3)
+	req := make([]byte, 48)
+	req[0] = 3<<3 | 3
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 48)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(sent)
+
+	// 回复中的发送时间戳：自 1900 年起的秒数和 2^-32 秒为单位的小数部分
+	sec := binary.BigEndian.Uint32(reply[40:])
+	frac := binary.BigEndian.Uint32(reply[44:])
+	nanos := uint64(sec)*1e9 + (uint64(frac)*1e9)>>32
+	t := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(nanos))
+	return sent.Add(elapsed / 2).Sub(t), nil
+}
@@ -0,0 +1,6 @@
+//go:build !minimal
+
+package main
+
+// buildProfile 是当前二进制的构建配置，使用 -tags minimal 构建精简版本
+const buildProfile = "full"
@@ -0,0 +1,8 @@
+//go:build minimal
+
+package main
+
+// buildProfile 是当前二进制的构建配置。minimal 构建不包含 Prometheus 指标后端、
+// 管理 RPC 及依赖 RPC 的子命令、ASN/GeoIP 数据库 (-asn.db)、zstd 载荷压缩和 vectors 子命令，
+// 适合嵌入式探针使用。goleveldb 仍然会被编译进来，go-ethereum 的节点数据库依赖它。
+const buildProfile = "minimal"
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 最小的二维码编码器，用于把 enode URL 显示在终端和网页上，让另一台设备扫码加入。
+// 只实现需要的部分：字节模式、纠错等级 M、版本 1-13（最多 331 字节，足够放下带 IPv6 地址的 enode URL）。
+// 参考 ISO/IEC 18004 和 https://www.nayuki.io/page/qr-code-generator-library 的实现。
+
+// qrVersion 是一个版本在纠错等级 M 下的分块
+type qrVersion struct {
+	ec     int    // 每块的纠错码字数
+	blocks [2]int // 两组的块数，第二组每块多一个数据码字
+	data   int    // 第一组每块的数据码字数
+	align  []int  // 校正图形的中心坐标
+}
+
+var qrVersions = []qrVersion{
+	1:  {ec: 10, blocks: [2]int{1, 0}, data: 16},
+	2:  {ec: 16, blocks: [2]int{1, 0}, data: 28, align: []int{6, 18}},
+	3:  {ec: 26, blocks: [2]int{1, 0}, data: 44, align: []int{6, 22}},
+	4:  {ec: 18, blocks: [2]int{2, 0}, data: 32, align: []int{6, 26}},
+	5:  {ec: 24, blocks: [2]int{2, 0}, data: 43, align: []int{6, 30}},
+	6:  {ec: 16, blocks: [2]int{4, 0}, data: 27, align: []int{6, 34}},
+	7:  {ec: 18, blocks: [2]int{4, 0}, data: 31, align: []int{6, 22, 38}},
+	8:  {ec: 22, blocks: [2]int{2, 2}, data: 38, align: []int{6, 24, 42}},
+	9:  {ec: 22, blocks: [2]int{3, 2}, data: 36, align: []int{6, 26, 46}},
+	10: {ec: 26, blocks: [2]int{4, 1}, data: 43, align: []int{6, 28, 50}},
+	11: {ec: 30, blocks: [2]int{1, 4}, data: 50, align: []int{6, 30, 54}},
+	12: {ec: 22, blocks: [2]int{6, 2}, data: 36, align: []int{6, 32, 58}},
+	13: {ec: 22, blocks: [2]int{8, 1}, data: 37, align: []int{6, 34, 62}},
+}
+
+func (v qrVersion) dataCodewords() int {
+	return v.blocks[0]*v.data + v.blocks[1]*(v.data+1)
+}
+
+// qrCode 是生成的二维码，modules[y][x] 为 true 表示深色模块
+type qrCode struct {
+	size    int
+	modules [][]bool
+	fixed   [][]bool // 定位图形、时序图形等功能区，不放数据、不加掩码
+}
+
+var errQRTooLong = errors.New("内容太长，无法编码为二维码")
+
+// encodeQR 用能放下内容的最小版本编码 data，选择惩罚分最低的掩码
+func encodeQR(data []byte) (*qrCode, error) {
+	ver := 0
+	for v := 1; v < len(qrVersions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrVersions[v].dataCodewords()*8 {
+			ver = v
+			break
+		}
+	}
+	if ver == 0 {
+		return nil, errQRTooLong
+	}
+	codewords := qrCodewords(qrVersions[ver], ver, data)
+
+	var best *qrCode
+	bestPenalty := 0
+	for mask := 0; mask < 8; mask++ {
+		q := newQRCode(ver)
+		q.place(codewords)
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); best == nil || p < bestPenalty {
+			best, bestPenalty = q, p
+		}
+	}
+	return best, nil
+}
+
+// qrCodewords 生成数据码字，按版本分块计算纠错码字并交错排列
+func qrCodewords(v qrVersion, ver int, data []byte) []byte {
+	var bits qrBits
+	bits.append(0b0100, 4) // 字节模式
+	if ver >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := v.dataCodewords() * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	buf := bits.bytes()
+	for pad := byte(0xec); len(buf) < v.dataCodewords(); pad ^= 0xec ^ 0x11 {
+		buf = append(buf, pad)
+	}
+
+	divisor := rsDivisor(v.ec)
+	var dataBlocks, ecBlocks [][]byte
+	for g, n := range v.blocks {
+		for range n {
+			size := v.data + g
+			block := buf[:size]
+			buf = buf[size:]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+	var out []byte
+	for i := 0; i <= v.data; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ec; i++ {
+		for _, block := range ecBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+type qrBits []bool
+
+func (b *qrBits) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, val>>i&1 == 1)
+	}
+}
+
+func (b qrBits) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// gfMul 是 GF(2^8) 上的乘法，本原多项式 x^8+x^4+x^3+x^2+1
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x1d
+		z ^= (y >> i & 1) * x
+	}
+	return z
+}
+
+// rsDivisor 返回 degree 次 Reed-Solomon 生成多项式的系数（不含最高次项）
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode 画出版本 ver 的功能区
+func newQRCode(ver int) *qrCode {
+	size := ver*4 + 17
+	q := &qrCode{size: size, modules: make([][]bool, size), fixed: make([][]bool, size)}
+	for i := range size {
+		q.modules[i] = make([]bool, size)
+		q.fixed[i] = make([]bool, size)
+	}
+	// 时序图形
+	for i := range size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// 三个定位图形和分隔符
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	// 校正图形，跳过和定位图形重叠的三个角
+	align := qrVersions[ver].align
+	last := len(align) - 1
+	for i, ay := range align {
+		for j, ax := range align {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(ax+dx, ay+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// 先占住格式信息的位置，选好掩码后再写入
+	q.drawFormat(0)
+	// 版本 7 及以上的版本信息
+	if ver >= 7 {
+		rem := ver
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		bits := ver<<12 | rem
+		for i := range 18 {
+			bit := bits>>i&1 == 1
+			a, b := size-11+i%3, i/3
+			q.set(a, b, bit)
+			q.set(b, a, bit)
+		}
+	}
+	return q
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// set 设置一个功能区模块
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.fixed[y][x] = true
+}
+
+// drawFormat 写入纠错等级 M 和掩码编号的格式信息
+func (q *qrCode) drawFormat(mask int) {
+	data := 0b00<<3 | mask // 纠错等级 M 的编码是 00
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	size := q.size
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, size-15+i, bit(i))
+	}
+	q.set(8, size-8, true) // 固定的深色模块
+}
+
+// place 从右下角开始按两列一组的之字形放置码字
+func (q *qrCode) place(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range q.size {
+			y := vert
+			if upward {
+				y = q.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if !q.fixed[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := range q.size {
+		for x := range q.size {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !q.fixed[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按标准的四条规则计算惩罚分：连续同色、2x2 同色块、类似定位图形的序列、深浅比例
+func (q *qrCode) penalty() int {
+	n := q.size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	score := 0
+	for _, t := range []bool{false, true} {
+		for y := range n {
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, t) == at(x-1, y, t) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			// 1:1:3:1:1 的图形，一侧有 4 个浅色模块
+			for x := 0; x+7 <= n; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, t) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (q.light(x-4, x, y, t, at) || q.light(x+7, x+11, y, t, at)) {
+					score += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := range n {
+		for x := range n {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	score += abs(dark*20-n*n*10) / (n * n) * 10
+	return score
+}
+
+// light 判断一行中 [from, to) 的模块是否都是浅色，码外的静区算作浅色
+func (q *qrCode) light(from, to, y int, t bool, at func(x, y int, t bool) bool) bool {
+	for x := from; x < to; x++ {
+		if x >= 0 && x < q.size && at(x, y, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// qrQuiet 是二维码四周静区的模块数，标准要求 4 个
+const qrQuiet = 4
+
+// terminal 用半高方块字符渲染二维码，每个字符表示上下两个模块。
+// 浅色模块画成方块，适合深色背景的终端
+func (q *qrCode) terminal() string {
+	dark := func(x, y int) bool {
+		x, y = x-qrQuiet, y-qrQuiet
+		return x >= 0 && x < q.size && y >= 0 && y < q.size && q.modules[y][x]
+	}
+	total := q.size + 2*qrQuiet
+	var sb strings.Builder
+	for y := 0; y < total; y += 2 {
+		for x := range total {
+			top, bottom := !dark(x, y), y+1 < total && !dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// svg 把二维码渲染为 SVG 图片，每个模块 scale 像素
+func (q *qrCode) svg(scale int) string {
+	total := q.size + 2*qrQuiet
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, total, total, total*scale, total*scale)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, total, total)
+	for y := range q.size {
+		for x := range q.size {
+			if q.modules[y][x] {
+				fmt.Fprintf(&sb, "M%d %dh1v1h-1z", x+qrQuiet, y+qrQuiet)
+			}
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return sb.String()
+}
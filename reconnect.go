@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	reconnectBaseDelay = 5 * time.Second
+	reconnectMaxDelay  = 5 * time.Minute
+
+	// 自行拨号的连接不设置任何 connFlag：不占用动态拨号名额，也不计入入站连接
+	reconnectConnFlags = 0
+)
+
+// reconnector 负责在重要节点断开后自动重拨。
+// 与静态节点不同，重要节点在运行时标记：运营者通过 admin_markImportant 标记，协议在依赖某个节点期间
+// （例如从它下载文件）通过 hold 标记，重拨使用带抖动的指数退避。
+type reconnector struct {
+	srv    *p2p.Server
+	events *eventBus
+	dialer p2p.NodeDialer
+	store  *peerStore // 查找协议依赖的节点的可拨号地址，为 nil 时 hold 不起作用
+
+	mu        sync.Mutex
+	important map[enode.ID]*importantPeer
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type importantPeer struct {
+	node     *enode.Node
+	attempts int
+	timer    *time.Timer
+	marked   bool // 运营者标记
+	holds    int  // 协议持有的标记数
+}
+
+// importantStatus 是 admin_importantPeers 中的一个重要节点
+type importantStatus struct {
+	ID        enode.ID `json:"id"`
+	Node      string   `json:"node"`
+	Marked    bool     `json:"marked"`          // 运营者通过 admin_markImportant 标记
+	Holds     int      `json:"holds,omitempty"` // 依赖它的协议操作数（例如进行中的下载）
+	Connected bool     `json:"connected"`
+	Attempts  int      `json:"attempts,omitempty"` // 本次断开后的重拨次数
+}
+
+func newReconnector(srv *p2p.Server, dialer p2p.NodeDialer, events *eventBus) *reconnector {
+	return &reconnector{
+		srv:       srv,
+		events:    events,
+		dialer:    dialer,
+		important: make(map[enode.ID]*importantPeer),
+		quit:      make(chan struct{}),
+	}
+}
+
+func (r *reconnector) start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+func (r *reconnector) stop() {
+	close(r.quit)
+	r.mu.Lock()
+	for _, ip := range r.important {
+		if ip.timer != nil {
+			ip.timer.Stop()
+		}
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// markImportant 把节点标记为重要节点。如果当前未连接，会立即安排一次拨号。
+func (r *reconnector) markImportant(n *enode.Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entry(n).marked = true
+}
+
+// unmarkImportant 取消运营者的重要标记，不会断开已有连接。协议仍然依赖这个节点时继续重拨，
+// 节点没有被运营者标记时返回 false
+func (r *reconnector) unmarkImportant(id enode.ID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ip, ok := r.important[id]
+	if !ok || !ip.marked {
+		return false
+	}
+	ip.marked = false
+	r.removeUnused(id, ip)
+	return true
+}
+
+// hold 在协议依赖节点 id 期间把它标记为重要节点，返回的函数取消标记。
+// 不知道节点的可拨号地址时不做标记。r 可以为 nil
+func (r *reconnector) hold(id enode.ID) (release func()) {
+	if r == nil || r.store == nil {
+		return func() {}
+	}
+	rec, ok := r.store.get(id)
+	if !ok || rec.Node == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	ip := r.entry(rec.Node)
+	ip.holds++
+	r.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			ip.holds--
+			if r.important[id] == ip {
+				r.removeUnused(id, ip)
+			}
+		})
+	}
+}
+
+// entry 返回节点的记录，没有时创建并在未连接时立即安排拨号，调用方必须持有 r.mu
+func (r *reconnector) entry(n *enode.Node) *importantPeer {
+	if ip, ok := r.important[n.ID()]; ok {
+		return ip
+	}
+	ip := &importantPeer{node: n}
+	r.important[n.ID()] = ip
+	if !r.connected(n.ID()) {
+		r.schedule(ip, 0)
+	}
+	return ip
+}
+
+// removeUnused 在节点既没有运营者标记也没有协议依赖时删除记录，调用方必须持有 r.mu
+func (r *reconnector) removeUnused(id enode.ID, ip *importantPeer) {
+	if ip.marked || ip.holds > 0 {
+		return
+	}
+	if ip.timer != nil {
+		ip.timer.Stop()
+	}
+	delete(r.important, id)
+}
+
+// status 返回所有重要节点，按节点 ID 排列
+func (r *reconnector) status() []importantStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]importantStatus, 0, len(r.important))
+	for id, ip := range r.important {
+		list = append(list, importantStatus{ID: id, Node: ip.node.URLv4(), Marked: ip.marked, Holds: ip.holds, Connected: r.connected(id), Attempts: ip.attempts})
+	}
+	sort.Slice(list, func(i, j int) bool { return bytes.Compare(list[i].ID[:], list[j].ID[:]) < 0 })
+	return list
+}
+
+func (r *reconnector) connected(id enode.ID) bool {
+	for _, p := range r.srv.Peers() {
+		if p.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reconnector) loop() {
+	defer r.wg.Done()
+
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := r.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			r.mu.Lock()
+			if ip, ok := r.important[ev.Peer]; ok {
+				switch ev.Type {
+				case p2p.PeerEventTypeAdd:
+					ip.attempts = 0
+					if ip.timer != nil {
+						ip.timer.Stop()
+						ip.timer = nil
+					}
+				case p2p.PeerEventTypeDrop:
+					r.schedule(ip, backoffDelay(ip.attempts))
+				}
+			}
+			r.mu.Unlock()
+		case <-sub.Err():
+			return
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// schedule 在 delay 之后重拨节点，调用方必须持有 r.mu
+func (r *reconnector) schedule(ip *importantPeer, delay time.Duration) {
+	if ip.timer != nil {
+		ip.timer.Stop()
+	}
+	id := ip.node.ID()
+	ip.timer = time.AfterFunc(delay, func() { r.redial(id) })
+	r.events.emit(evReconnectScheduled, id, fmt.Sprintf("attempt=%d delay=%v", ip.attempts+1, delay.Round(time.Millisecond)))
+}
+
+func (r *reconnector) redial(id enode.ID) {
+	select {
+	case <-r.quit:
+		return
+	default:
+	}
+	r.mu.Lock()
+	ip, ok := r.important[id]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	ip.timer = nil
+	ip.attempts++
+	node, attempt := ip.node, ip.attempts
+	r.mu.Unlock()
+
+	// 多次失败后通过节点发现获取最新的记录，以便跟随节点的地址变更
+	if attempt > 1 {
+		if disc := r.srv.DiscoveryV4(); disc != nil {
+			node = disc.Resolve(node)
+		}
+	}
+	r.events.emit(evReconnectAttempt, id, fmt.Sprintf("attempt=%d", attempt))
+	err := r.dial(node)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.important[id]; !ok {
+		return
+	}
+	if node.Seq() > ip.node.Seq() {
+		ip.node = node
+	}
+	if err != nil {
+		log.Printf("重连重要节点失败 %s (第 %d 次): %v", node.ID().TerminalString(), attempt, err)
+		r.events.emit(evReconnectFailed, id, err.Error())
+		r.schedule(ip, backoffDelay(ip.attempts))
+		return
+	}
+	log.Printf("已重连重要节点 %s (第 %d 次)", node.ID().TerminalString(), attempt)
+	r.events.emit(evReconnected, id, fmt.Sprintf("attempt=%d", attempt))
+}
+
+func (r *reconnector) dial(n *enode.Node) error {
+	ctx, cancel := context.WithTimeout(withDirectDial(context.Background(), dialReconnect), defaultDialTimeout)
+	defer cancel()
+	fd, err := r.dialer.Dial(ctx, n)
+	if err != nil {
+		return err
+	}
+	return r.srv.SetupConn(fd, reconnectConnFlags, n)
+}
+
+// backoffDelay 计算第 attempts 次失败后的等待时间：指数增长并带 ±50% 抖动
+func backoffDelay(attempts int) time.Duration {
+	d := reconnectBaseDelay
+	for i := 0; i < attempts && d < reconnectMaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, reconnectMaxDelay)
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
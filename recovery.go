@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 网络中断后的恢复：短时间内几乎所有节点同时断开（上游路由抖动等），或者某个网卡断开时
+// （见 ifaceWatch）记为一次中断，统计之后恢复到第一个节点、原有连接数的一半和 90% 各用了多久，
+// 同时导出 demo/recovery/* 指标。开启 -recovery.redial 后立即按退避重拨中断前连接的节点，
+// 而不是等拨号调度器从节点发现中慢慢找回来。
+const (
+	evOutage   = "net.outage"
+	evRecovery = "net.recovered"
+
+	recoveryBurst     = 10 * time.Second // 在这段时间内断开的节点算作同一次中断
+	recoveryMinPeers  = 2                // 中断前至少有这么多节点才记录
+	recoveryDropShare = 0.75             // 断开的节点占比达到这个值算作中断
+	recoveryHistory   = 20
+	// 加速恢复的重拨间隔从 recoveryRedialBase 开始翻倍，持续 recoveryRedialFor
+	recoveryRedialBase = time.Second
+	recoveryRedialMax  = 15 * time.Second
+	recoveryRedialFor  = 5 * time.Minute
+)
+
+// outage 是 admin_recovery 中的一次中断
+type outage struct {
+	Start     time.Time     `json:"start"`
+	Reason    string        `json:"reason"`
+	Before    int           `json:"before"` // 中断前的连接数
+	FirstPeer time.Duration `json:"firstPeer,omitempty"`
+	Half      time.Duration `json:"half,omitempty"`
+	Full      time.Duration `json:"full,omitempty"` // 恢复到中断前 90% 的时间
+	Recovered bool          `json:"recovered"`
+	Redialed  int           `json:"redialed"` // 加速恢复重拨成功的节点数
+
+	nodes []*enode.Node // 中断前连接的可拨号节点
+}
+
+type recoveryDrop struct {
+	id   enode.ID
+	time time.Time
+}
+
+type recoveryMetrics struct {
+	outages               metrics.Counter
+	firstPeer, half, full metrics.Histogram
+}
+
+// recoveryTracker 检测中断并统计恢复时间
+type recoveryTracker struct {
+	srv    *p2p.Server
+	dialer p2p.NodeDialer
+	store  *peerStore
+	events *eventBus
+	redial bool
+	m      recoveryMetrics
+
+	mu      sync.Mutex
+	drops   []recoveryDrop
+	current *outage
+	history []outage
+}
+
+func newRecoveryTracker(srv *p2p.Server, dialer p2p.NodeDialer, store *peerStore, events *eventBus, redial bool, m metrics.Metrics) *recoveryTracker {
+	return &recoveryTracker{
+		srv:    srv,
+		dialer: dialer,
+		store:  store,
+		events: events,
+		redial: redial,
+		m: recoveryMetrics{
+			outages:   m.Counter("demo/recovery/outages"),
+			firstPeer: m.Histogram("demo/recovery/first_peer"),
+			half:      m.Histogram("demo/recovery/half"),
+			full:      m.Histogram("demo/recovery/full"),
+		},
+	}
+}
+
+// dropped 记录一次断开，断开的节点足够多时开始一次中断，调用方必须持有 r.mu
+func (r *recoveryTracker) dropped(id enode.ID, now time.Time, count int) *outage {
+	cutoff := now.Add(-recoveryBurst)
+	i := 0
+	for i < len(r.drops) && r.drops[i].time.Before(cutoff) {
+		i++
+	}
+	// 同一个节点反复断开只算一次
+	r.drops = slices.DeleteFunc(r.drops[i:], func(d recoveryDrop) bool { return d.id == id })
+	r.drops = append(r.drops, recoveryDrop{id: id, time: now})
+	if r.current != nil {
+		return nil
+	}
+	before := count + len(r.drops)
+	if before < recoveryMinPeers || float64(len(r.drops)) < recoveryDropShare*float64(before) {
+		return nil
+	}
+	return r.begin(now, "mass-drop", before)
+}
+
+// begin 开始一次中断，调用方必须持有 r.mu
+func (r *recoveryTracker) begin(now time.Time, reason string, before int) *outage {
+	o := &outage{Start: now, Reason: reason, Before: before}
+	if len(r.drops) > 0 {
+		o.Start = r.drops[0].time
+	}
+	for _, d := range r.drops {
+		if rec, ok := r.store.get(d.id); ok && rec.Node != nil {
+			o.nodes = append(o.nodes, rec.Node)
+		}
+	}
+	r.drops = nil
+	r.current = o
+	return o
+}
+
+// outage 由其他检测器（例如网卡变化）报告一次中断。r 可以为 nil
+func (r *recoveryTracker) outage(reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.current != nil {
+		r.mu.Unlock()
+		return
+	}
+	before := r.srv.PeerCount() + len(r.drops)
+	if before < recoveryMinPeers {
+		r.mu.Unlock()
+		return
+	}
+	o := r.begin(time.Now(), reason, before)
+	r.mu.Unlock()
+	r.started(o)
+}
+
+func (r *recoveryTracker) started(o *outage) {
+	r.m.outages.Inc(1)
+	log.Printf("检测到网络中断 (%s)：%d 个节点中的绝大部分已断开", o.Reason, o.Before)
+	r.events.emit(evOutage, enode.ID{}, fmt.Sprintf("reason=%s before=%d", o.Reason, o.Before))
+	if r.redial && len(o.nodes) > 0 {
+		go r.redialLoop(o)
+	}
+}
+
+// added 在恢复过程中记录各个阶段的用时，调用方必须持有 r.mu。返回完成恢复的中断
+func (r *recoveryTracker) added(now time.Time, count int) *outage {
+	o := r.current
+	if o == nil {
+		return nil
+	}
+	elapsed := now.Sub(o.Start)
+	if o.FirstPeer == 0 {
+		o.FirstPeer = elapsed
+		r.m.firstPeer.Observe(elapsed.Milliseconds())
+	}
+	if o.Half == 0 && 2*count >= o.Before {
+		o.Half = elapsed
+		r.m.half.Observe(elapsed.Milliseconds())
+	}
+	if 10*count >= 9*o.Before {
+		o.Full = elapsed
+		o.Recovered = true
+		r.m.full.Observe(elapsed.Milliseconds())
+		r.current = nil
+		if len(r.history) == recoveryHistory {
+			r.history = r.history[1:]
+		}
+		r.history = append(r.history, *o)
+		return o
+	}
+	return nil
+}
+
+func (r *recoveryTracker) recovering(o *outage) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current == o
+}
+
+// redialLoop 按退避重拨中断前连接的节点，直到恢复或超时
+func (r *recoveryTracker) redialLoop(o *outage) {
+	delay := recoveryRedialBase
+	deadline := time.Now().Add(recoveryRedialFor)
+	for r.recovering(o) && time.Now().Before(deadline) {
+		connected := make(map[enode.ID]bool)
+		for _, p := range r.srv.Peers() {
+			connected[p.ID()] = true
+		}
+		var wg sync.WaitGroup
+		for _, n := range o.nodes {
+			if connected[n.ID()] {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if r.dial(n) == nil {
+					r.mu.Lock()
+					o.Redialed++
+					r.mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		time.Sleep(delay)
+		delay = min(2*delay, recoveryRedialMax)
+	}
+}
+
+func (r *recoveryTracker) dial(n *enode.Node) error {
+	ctx, cancel := context.WithTimeout(withDirectDial(context.Background(), dialRecovery), defaultDialTimeout)
+	defer cancel()
+	fd, err := r.dialer.Dial(ctx, n)
+	if err != nil {
+		return err
+	}
+	return r.srv.SetupConn(fd, reconnectConnFlags, n)
+}
+
+func (r *recoveryTracker) report() []outage {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := append([]outage{}, r.history...)
+	if r.current != nil {
+		list = append(list, *r.current)
+	}
+	return list
+}
+
+func (r *recoveryTracker) run() {
+	ch := make(chan *p2p.PeerEvent, 64)
+	sub := r.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			now := time.Now()
+			count := r.srv.PeerCount()
+			r.mu.Lock()
+			var begun, done *outage
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				done = r.added(now, count)
+			case p2p.PeerEventTypeDrop:
+				begun = r.dropped(ev.Peer, now, count)
+			}
+			r.mu.Unlock()
+			if begun != nil {
+				r.started(begun)
+			}
+			if done != nil {
+				log.Printf("网络中断后已恢复：第一个节点 %v，一半 %v，%d 个节点中的 90%% %v，加速重拨 %d 个",
+					done.FirstPeer.Round(time.Millisecond), done.Half.Round(time.Millisecond), done.Before, done.Full.Round(time.Millisecond), done.Redialed)
+				r.events.emit(evRecovery, enode.ID{}, fmt.Sprintf("before=%d full=%v", done.Before, done.Full.Round(time.Millisecond)))
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// adminAPI 是以 admin_ 为前缀的管理 RPC 接口
+type adminAPI struct {
+	srv       *p2p.Server
+	gater     *gater
+	chat      *chatProtocol
+	usage     *usageTracker
+	files     *fileProtocol
+	content   *contentIndex
+	target    *peerTarget
+	events    *eventBus
+	features  *featureSet
+	phases    protocolPhases
+	stalls    *stallTracker
+	codec     *payloadCodec
+	gossip    *gossipProtocol
+	control   *controlHandler
+	remote    *remoteConfig
+	history   *peerHistory
+	pinner    *capPinner
+	upgrade   *upgradeController
+	asn       *asnTracker
+	blackhole *blackholeWatch
+	ab        *abExperiment
+	stability *stabilityTracker
+	summary   *summaryCollector
+	observer  *observer
+	guard     *impersonationGuard
+	recovery  *recoveryTracker
+	iface     *ifaceWatch
+	bandwidth *bandwidthGovernor
+	enr       *enrWatcher
+	dialer    *nodeDialer
+	reasons   *dialReasons
+	metered   *meteredMode
+	pace      *dialPacer
+	slo       *sloTracker
+	pair      *pairInfo
+	notes     *peerNotes
+	setup     *setupTracker
+	port      *listenPortInfo
+	local     *localityPolicy
+	conform   *conformTracker
+	faults    *faultLog
+	affinity  *peerAffinity
+	reconn    *reconnector
+}
+
+// Compression 返回各协议载荷压缩的实际效果，gossip/delta 是 gossip 差量编码的效果
+func (api *adminAPI) Compression() map[string]compressStats {
+	report := api.codec.report()
+	if report == nil {
+		report = make(map[string]compressStats)
+	}
+	if len(api.gossip.deltaTopics) > 0 {
+		report["gossip/delta"] = api.gossip.deltaReport()
+	}
+	return report
+}
+
+// GossipExpiry 返回各 gossip 主题的 TTL 和过期消息统计，未配置 -gossip.ttl 时返回 nil
+func (api *adminAPI) GossipExpiry() map[string]expiryStats {
+	return api.gossip.expiry.report()
+}
+
+// GossipPriority 返回配置了优先级的 gossip 主题的转发统计，未配置 -gossip.priority 时返回 nil
+func (api *adminAPI) GossipPriority() map[string]priorityStats {
+	return api.gossip.priorities.report()
+}
+
+// GossipInterest 返回各节点通告的 gossip 主题兴趣，以及因此少发送的消息副本数
+func (api *adminAPI) GossipInterest() interestReport {
+	return api.gossip.interestReport()
+}
+
+// Control 在本节点执行并向全网发布 control 子命令签发的控制命令，返回命令的摘要
+func (api *adminAPI) Control(cmd string) (string, error) {
+	return api.control.publish(cmd)
+}
+
+// FleetConfig 返回当前应用的机群配置，未启用远程配置时返回 nil
+func (api *adminAPI) FleetConfig() *fleetConfigStatus {
+	return api.remote.status()
+}
+
+// PeerHistory 返回连接过的不同节点总数，以及最近每天连接的不同节点数和新节点数
+func (api *adminAPI) PeerHistory() peerHistoryReport {
+	return api.history.report()
+}
+
+// CapPins 返回能力版本要求及因此断开的节点数
+func (api *adminAPI) CapPins() capPinStatus {
+	return api.pinner.status()
+}
+
+// SetCapPins 替换能力版本要求（格式同 -caps.min，空字符串表示取消），已连接的节点立即按新要求检查
+func (api *adminAPI) SetCapPins(spec string) (capPinStatus, error) {
+	pins, err := parseCapPins(spec)
+	if err != nil {
+		return capPinStatus{}, err
+	}
+	api.pinner.set(pins)
+	return api.pinner.status(), nil
+}
+
+// Upgrade 返回滚动升级的版本分布和进度，未设置 -upgrade 时返回 nil
+func (api *adminAPI) Upgrade() *upgradeStatus {
+	return api.upgrade.status()
+}
+
+// UpgradeFlip 不等待宽限期和阈值，立即切换为只接受新版本
+func (api *adminAPI) UpgradeFlip() (*upgradeStatus, error) {
+	if api.upgrade == nil {
+		return nil, errors.New("没有设置 -upgrade")
+	}
+	api.upgrade.flip("运营者手动切换")
+	return api.upgrade.status(), nil
+}
+
+// AsnStats 返回按远端 ASN 汇总的传输统计，错误率高的排在前面；未设置 -asn.db 时返回 nil
+func (api *adminAPI) AsnStats() []asnStat {
+	return api.asn.report()
+}
+
+// DiscoveryHealth 返回 UDP 黑洞检测的状态；-disc.blackhole 为 0 时返回 nil
+func (api *adminAPI) DiscoveryHealth() *blackholeStatus {
+	return api.blackhole.status()
+}
+
+// AbTest 返回 A/B 接纳实验中两个身份的对比；未设置 -ab.addr 时返回 nil
+func (api *adminAPI) AbTest() []abArmStats {
+	return api.ab.report()
+}
+
+// Stability 返回当前节点集合的稳定性分数、会话时长分布和最近反复断开的节点
+func (api *adminAPI) Stability() *stabilityStatus {
+	return api.stability.status()
+}
+
+// Summary 返回当前周期到目前为止的摘要；未设置 -report.dir 或 -report.webhook 时返回 nil
+func (api *adminAPI) Summary() *summaryReport {
+	return api.summary.current()
+}
+
+// Observer 返回观察模式下收到的和被拦截的消息数；未设置 -observe 时返回 nil
+func (api *adminAPI) Observer() *observerStatus {
+	return api.observer.status()
+}
+
+// Impersonation 返回最近的冒充告警：同一 ID 出现在多个地址上，或静态节点的端点上出现了另一个 ID
+func (api *adminAPI) Impersonation() []guardAlert {
+	return api.guard.report()
+}
+
+// Recovery 返回最近的网络中断及恢复到第一个节点、一半和 90% 连接数的用时，未恢复的中断排在最后
+func (api *adminAPI) Recovery() []outage {
+	return api.recovery.report()
+}
+
+// Interfaces 返回各网卡的地址、最近一次地址变化和当前公告的端点
+func (api *adminAPI) Interfaces() *ifaceStatus {
+	return api.iface.status()
+}
+
+// Bandwidth 返回实测的可用带宽和各协议按带宽规则的启用状态
+func (api *adminAPI) Bandwidth() *bwStatus {
+	return api.bandwidth.status()
+}
+
+// FileFairness 返回 file 协议公平调度的状态：发送名额和每个节点已发送、等待中的数据块
+func (api *adminAPI) FileFairness() *fileSchedStats {
+	return api.files.sched.stats()
+}
+
+// FileBalances 返回 file 协议中每个节点的收支，欠我们最多的排在前面
+func (api *adminAPI) FileBalances() []ledgerEntry {
+	return api.files.ledger.balances()
+}
+
+// FileCorruption 返回发送过校验失败数据的节点和它们的坏数据分数，分数最高的排在前面
+func (api *adminAPI) FileCorruption() []corruptStats {
+	return api.files.corrupt.report()
+}
+
+// WatchEnr 通过定期重新解析监视节点记录的属性，变化时记录 enr.changed 事件。
+// node 为 enode URL、ENR 或节点 ID，attrs 为空表示所有属性，返回节点当前的状态
+func (api *adminAPI) WatchEnr(node string, attrs []string) (*enrWatchStatus, error) {
+	sub, err := api.enr.watch(node, attrs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return api.enr.subStatus(sub), nil
+}
+
+// UnwatchEnr 删除 admin_watchEnr 对节点添加的监视，WebSocket 订阅不受影响
+func (api *adminAPI) UnwatchEnr(node string) (bool, error) {
+	id, err := parseNodeID(node)
+	if err != nil {
+		return false, err
+	}
+	return api.enr.unwatchNode(id), nil
+}
+
+// EnrWatches 返回被监视的节点、当前的属性值和订阅者数
+func (api *adminAPI) EnrWatches() []enrWatchStatus {
+	return api.enr.status()
+}
+
+// Dial 立即拨号一个节点（enode URL 或 ENR），拨号来源记为 rpc
+func (api *adminAPI) Dial(ctx context.Context, node string) error {
+	n, err := enode.Parse(enode.ValidSchemes, node)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(withDirectDial(ctx, dialRPC), defaultDialTimeout)
+	defer cancel()
+	fd, err := api.dialer.Dial(ctx, n)
+	if err != nil {
+		return err
+	}
+	return api.srv.SetupConn(fd, reconnectConnFlags, n)
+}
+
+// MarkImportant 把节点（enode URL 或 ENR）标记为重要节点：断开后按退避自动重拨，当前未连接时立即拨号
+func (api *adminAPI) MarkImportant(node string) error {
+	n, err := enode.Parse(enode.ValidSchemes, node)
+	if err != nil {
+		return err
+	}
+	api.reconn.markImportant(n)
+	return nil
+}
+
+// UnmarkImportant 取消节点的重要标记，不断开已有连接
+func (api *adminAPI) UnmarkImportant(peer string) error {
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return err
+	}
+	if !api.reconn.unmarkImportant(id) {
+		return errors.New("节点没有被标记为重要节点")
+	}
+	return nil
+}
+
+// ImportantPeers 返回断开后会自动重拨的重要节点：运营者标记的和协议正在依赖的
+func (api *adminAPI) ImportantPeers() []importantStatus {
+	return api.reconn.status()
+}
+
+// DialReasons 按拨号来源返回拨号次数、建立的会话、长连接数和平均会话时长
+func (api *adminAPI) DialReasons() []dialReasonStats {
+	return api.reasons.report()
+}
+
+// Metered 返回按流量计费模式下本月的流量、上限和排队的动态拨号数，未开启时返回 null
+func (api *adminAPI) Metered() *meteredStatus {
+	return api.metered.status()
+}
+
+// DialPacing 返回 -dial.pace 跟踪的路由表验证状态和按验证状态统计的拨号成功率，未开启时返回 null
+func (api *adminAPI) DialPacing() *dialPaceStatus {
+	return api.pace.status()
+}
+
+// LatencySLO 返回各请求类型的延迟目标和每个节点的达标情况，违约的节点排在前面，-slo 为空时返回 null
+func (api *adminAPI) LatencySLO() *sloStatus {
+	return api.slo.status()
+}
+
+// Pairing 返回 -pair host 模式下给另一台设备的 enode URL 和配对码，没有开启时返回 null
+func (api *adminAPI) Pairing() *pairInfo {
+	return api.pair
+}
+
+// SetPeerNote 设置本节点对 peer 的标签、备注和是否禁止连接，开启 -peers.notes.sync 时同步到机群
+func (api *adminAPI) SetPeerNote(peer string, note peerNoteInput) (*peerNote, error) {
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return nil, err
+	}
+	return api.notes.set(id, &note)
+}
+
+// RemovePeerNote 删除 peer 的备注（同时解除备注中的禁止），开启同步时机群中的其他节点也会删除
+func (api *adminAPI) RemovePeerNote(peer string) error {
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return err
+	}
+	_, err = api.notes.set(id, nil)
+	return err
+}
+
+// PeerNotes 返回所有节点备注，tag 不为空时只返回带这个标签的节点
+func (api *adminAPI) PeerNotes(tag string) []peerNote {
+	return api.notes.list(tag)
+}
+
+// SetupPhases 返回连接建立各阶段（tcp、auth、hello、handshake/<协议>）最近的耗时分位数和失败次数
+func (api *adminAPI) SetupPhases() []setupPhaseStats {
+	return api.setup.report()
+}
+
+// ListenPort 返回实际监听的端口，-addr.fallback 回退到随机端口时同时返回原因
+func (api *adminAPI) ListenPort() *listenPortInfo {
+	return api.port
+}
+
+// Locality 返回就近连接的名额使用情况和每个已连接节点的建连时间、国家
+func (api *adminAPI) Locality() *localityStatus {
+	return api.local.status()
+}
+
+// Peers 返回已连接的节点（与 geth 的 admin_peers 相同），附带协议一致性检查的徽章，
+// 不支持 conf 协议的节点没有 conformance 字段
+func (api *adminAPI) Peers() []adminPeer {
+	list := []adminPeer{}
+	for _, info := range api.srv.PeersInfo() {
+		id, _ := enode.ParseID(info.ID)
+		list = append(list, adminPeer{PeerInfo: info, Conformance: api.conform.result(id)})
+	}
+	return list
+}
+
+// Health 返回节点的健康状况：status 为 degraded 时 faults 中有未恢复的故障，错误代码见 failure.go
+func (api *adminAPI) Health() *healthReport {
+	return api.faults.health(api.srv)
+}
+
+// Affinity 返回重启后重拨历史节点的结果，没有设置 -peers.history 或 -peers.affinity 为 0 时为 null
+func (api *adminAPI) Affinity() *affinityReport {
+	return api.affinity.status()
+}
+
+// Stalls 返回拖住我们写入的节点（慢消费者）：停滞分数、各协议被阻塞的次数和时长
+func (api *adminAPI) Stalls() []stallReport {
+	return api.stalls.report()
+}
+
+// PeerStates 返回节点在各协议中所处的阶段（handshaking、active、syncing、draining），
+// peer 为空时返回所有节点
+func (api *adminAPI) PeerStates(peer string) ([]peerPhase, error) {
+	if peer == "" {
+		return api.phases.list(nil), nil
+	}
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return nil, err
+	}
+	return api.phases.list(&id), nil
+}
+
+// StateGraph 返回协议的状态转换图（Graphviz DOT），边上标注本节点实际发生的转换次数
+func (api *adminAPI) StateGraph(protocol string) (string, error) {
+	return api.phases.graph(protocol)
+}
+
+// Features 返回可选子系统的编译和启用状态
+func (api *adminAPI) Features() []feature {
+	return api.features.list()
+}
+
+// SetFeature 在运行时启用或关闭 metrics、trace、gossip.relay
+func (api *adminAPI) SetFeature(name string, enabled bool) error {
+	return api.features.set(name, enabled)
+}
+
+// RecentEvents 返回内存中保留的最近事件，filter 可以为空
+func (api *adminAPI) RecentEvents(filter *eventFilter) []nodeEvent {
+	if filter == nil {
+		filter = new(eventFilter)
+	}
+	return api.events.recent(*filter)
+}
+
+// PeerTarget 返回目标连接数管理的状态，未启用时返回 nil
+func (api *adminAPI) PeerTarget() *peerTargetStatus {
+	if api.target == nil {
+		return nil
+	}
+	s := api.target.status()
+	return &s
+}
+
+// FindProviders 在网络中查找提供内容 hash 的节点
+func (api *adminAPI) FindProviders(ctx context.Context, hash common.Hash) []providerRecord {
+	return api.content.findProviders(ctx, hash)
+}
+
+// ListFiles 获取节点共享目录的签名清单
+func (api *adminAPI) ListFiles(ctx context.Context, peer string) (*fileManifest, error) {
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return nil, err
+	}
+	return api.files.list(ctx, id)
+}
+
+// FetchFile 通过 file 协议从节点下载 path，保存到下载目录，返回本地路径
+func (api *adminAPI) FetchFile(ctx context.Context, peer string, path string) (string, error) {
+	id, err := parseNodeID(peer)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(*fileDownloads, 0755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(*fileDownloads, filepath.Base(filepath.FromSlash(path)))
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	n, err := api.files.download(ctx, id, path, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	log.Printf("已从 %s 下载 %s (%d 字节)", id.TerminalString(), path, n)
+	return dest, nil
+}
+
+// Usage 返回每个节点的协议资源消耗和配额状态
+func (api *adminAPI) Usage() []usageReport {
+	return api.usage.report()
+}
+
+// Chat 向所有 chat 节点广播文本消息，返回收到消息的节点数
+func (api *adminAPI) Chat(text string) int {
+	return api.chat.broadcast(text)
+}
+
+// AddGateRule 添加一条门控规则，返回规则 ID
+func (api *adminAPI) AddGateRule(rule gateRule) (int, error) {
+	return api.gater.addRule(rule)
+}
+
+// RemoveGateRule 删除门控规则
+func (api *adminAPI) RemoveGateRule(id int) bool {
+	return api.gater.removeRule(id)
+}
+
+// GateRules 列出所有门控规则
+func (api *adminAPI) GateRules() []gateRule {
+	return api.gater.list()
+}
+
+// GateStatus 返回当前各方向是否放行以及是否处于维护模式
+func (api *adminAPI) GateStatus() map[string]bool {
+	now := time.Now()
+	paused, pausedInbound := api.gater.isPaused()
+	return map[string]bool{
+		gateInbound:     api.gater.allowed(gateInbound, now),
+		gateDial:        api.gater.allowed(gateDial, now),
+		"paused":        paused,
+		"pausedInbound": pausedInbound,
+	}
+}
+
+// Pause 进入维护模式：停止拨号，stopInbound 为 true 时同时拒绝新的入站连接。
+// 已建立的会话和节点发现保持运行。
+func (api *adminAPI) Pause(stopInbound *bool) bool {
+	inbound := stopInbound != nil && *stopInbound
+	api.gater.pause(inbound)
+	log.Printf("进入维护模式 (拒绝入站: %v)", inbound)
+	return true
+}
+
+// Resume 退出维护模式
+func (api *adminAPI) Resume() bool {
+	api.gater.resume()
+	log.Println("退出维护模式")
+	return true
+}
+
+// AnnounceNextEndpoint 在节点记录中公告迁移目标端点 "ip:port"
+func (api *adminAPI) AnnounceNextEndpoint(addr string) (string, error) {
+	ep, err := parseEndpoint(addr)
+	if err != nil {
+		return "", err
+	}
+	ln := api.srv.LocalNode()
+	announceNextEndpoint(ln, ep)
+	return ln.Node().String(), nil
+}
+
+// ClearNextEndpoint 撤销公告的迁移目标
+func (api *adminAPI) ClearNextEndpoint() string {
+	ln := api.srv.LocalNode()
+	clearNextEndpoint(ln)
+	return ln.Node().String()
+}
+
+// SwitchEndpoint 把公告的迁移目标切换为主端点，返回新的节点记录
+func (api *adminAPI) SwitchEndpoint() (string, error) {
+	ln := api.srv.LocalNode()
+	if _, err := switchEndpoint(ln); err != nil {
+		return "", err
+	}
+	return ln.Node().String(), nil
+}
+
+// SwarmDownload 从所有共享了内容 hash 的节点并行下载，保存到下载目录
+func (api *adminAPI) SwarmDownload(ctx context.Context, hash common.Hash) (*swarmResult, error) {
+	if err := os.MkdirAll(*fileDownloads, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(*fileDownloads, ".swarm-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	res, err := api.files.swarmDownload(ctx, hash, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return res, err
+	}
+	dest := filepath.Join(*fileDownloads, filepath.Base(filepath.FromSlash(res.Path)))
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return res, err
+	}
+	res.Path = dest
+	log.Printf("已从 %d 个节点下载 %s (%d 字节, 用时 %s)", len(res.Providers), dest, res.Size, res.Elapsed)
+	return res, nil
+}
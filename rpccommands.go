@@ -0,0 +1,94 @@
+//go:build !minimal
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 通过管理 RPC 操作本地节点的子命令，minimal 构建不包含 RPC
+func init() {
+	commands["find-providers"] = command{"通过本地节点的 RPC 在网络中查找提供某个内容哈希的节点", findProvidersCmd}
+	commands["files"] = command{"通过本地节点的 RPC 浏览 (ls) 和下载 (get) 其他节点共享的文件", filesCmd}
+}
+
+func filesCmd(args []string) {
+	fs := flag.NewFlagSet("files", flag.ExitOnError)
+	endpoint := fs.String("rpc", "http://127.0.0.1:8545", "本地节点的 RPC 地址")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法: files [-rpc URL] ls <节点 ID>")
+		fmt.Fprintln(stderr, "      files [-rpc URL] get <节点 ID> <路径>")
+		fmt.Fprintln(stderr, "      files [-rpc URL] swarm <内容哈希>")
+		fs.PrintDefaults()
+	}
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	client, err := rpc.Dial(*endpoint)
+	if err != nil {
+		log.Fatalf("连接 RPC 失败: %v", err)
+	}
+	defer client.Close()
+
+	switch {
+	case fs.NArg() == 2 && fs.Arg(0) == "ls":
+		var m fileManifest
+		if err := client.Call(&m, "admin_listFiles", fs.Arg(1)); err != nil {
+			log.Fatalf("获取文件清单失败: %v", err)
+		}
+		for _, e := range m.Entries {
+			fmt.Fprintf(stdout, "%12d  %x  %s\n", e.Size, e.Hash[:8], e.Path)
+		}
+		fmt.Fprintf(stdout, "共 %d 个文件，清单生成于 %s\n", len(m.Entries), time.Unix(int64(m.Created), 0).Format(time.RFC3339))
+	case fs.NArg() == 3 && fs.Arg(0) == "get":
+		var dest string
+		if err := client.Call(&dest, "admin_fetchFile", fs.Arg(1), fs.Arg(2)); err != nil {
+			log.Fatalf("下载失败: %v", err)
+		}
+		fmt.Println(dest)
+	case fs.NArg() == 2 && fs.Arg(0) == "swarm":
+		var res swarmResult
+		if err := client.Call(&res, "admin_swarmDownload", fs.Arg(1)); err != nil {
+			log.Fatalf("下载失败: %v", err)
+		}
+		fmt.Fprintf(stdout, "%s (%d 字节, %d 个数据块, 本地 %d, 用时 %s)\n", res.Path, res.Size, res.Chunks, res.Local, res.Elapsed)
+		for _, p := range res.Providers {
+			fmt.Fprintf(stdout, "  %s  块 %-5d 失败 %-3d 平均 %dms dropped=%v\n", p.ID.TerminalString(), p.Chunks, p.Failures, p.AvgLatency, p.Dropped)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func findProvidersCmd(args []string) {
+	fs := flag.NewFlagSet("find-providers", flag.ExitOnError)
+	endpoint := fs.String("rpc", "http://127.0.0.1:8545", "本地节点的 RPC 地址")
+	localizeFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "用法: find-providers [-rpc URL] <内容哈希>")
+		os.Exit(2)
+	}
+
+	client, err := rpc.Dial(*endpoint)
+	if err != nil {
+		log.Fatalf("连接 RPC 失败: %v", err)
+	}
+	defer client.Close()
+
+	var recs []providerRecord
+	if err := client.Call(&recs, "admin_findProviders", fs.Arg(0)); err != nil {
+		log.Fatalf("查询失败: %v", err)
+	}
+	for _, r := range recs {
+		fmt.Fprintf(stdout, "%s  (剩余 %v)\n", r.Node, time.Duration(r.TTL)*time.Second)
+	}
+	fmt.Fprintf(stdout, "共 %d 个提供者\n", len(recs))
+}
@@ -0,0 +1,136 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const rpcCompiled = true
+
+// 启动 HTTP JSON-RPC 服务，返回停止服务的函数。同一个地址上的 WebSocket 连接用于订阅，
+// -pair host 模式下 GET /pair 返回显示二维码的网页，GET /health 返回 admin_health 的结果，
+// 有未恢复的核心故障时状态码为 503，便于编排系统用作就绪检查；只有可选组件降级时仍为 200
+func startRPC(addr string, api *adminAPI) (func(), error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("admin", api); err != nil {
+		return nil, err
+	}
+	// 在返回之前绑定地址，端口被占用时启动失败而不是只记录日志
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ws := server.WebsocketHandler(nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "websocket" {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/pair" && api.pair != nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, api.pair.page())
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/health" {
+			h := api.Health()
+			w.Header().Set("Content-Type", "application/json")
+			if h.Status == "failing" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			json.NewEncoder(w).Encode(h)
+			return
+		}
+		server.ServeHTTP(w, r)
+	})
+	go func() {
+		log.Printf("RPC 服务监听: http://%s (WebSocket: ws://%s)", addr, addr)
+		if err := http.Serve(l, handler); err != nil {
+			log.Printf("RPC 服务退出: %v", err)
+		}
+	}()
+	return func() {
+		l.Close()
+		server.Stop()
+	}, nil
+}
+
+// EnrChanges 订阅节点记录属性的变化，通过 WebSocket 调用
+// admin_subscribe ["enrChanges", node, attrs]，attrs 为空表示所有属性
+func (api *adminAPI) EnrChanges(ctx context.Context, node string, attrs []string) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	ch := make(chan enrChange, enrNotifyBuffer)
+	id, err := api.enr.watch(node, attrs, ch)
+	if err != nil {
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		defer api.enr.unwatch(id)
+		for {
+			select {
+			case c := <-ch:
+				notifier.Notify(sub.ID, c)
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// firehoseAPI 是 bootnode 子命令 -firehose.addr 上的 discv4 命名空间
+type firehoseAPI struct {
+	f *firehose
+}
+
+// Packets 订阅解析后的节点发现数据包，通过 WebSocket 调用
+// discv4_subscribe ["packets", types]，types 为空表示所有类型
+func (api *firehoseAPI) Packets(ctx context.Context, types []string) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	id, ch, err := api.f.subscribe(types)
+	if err != nil {
+		return nil, err
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		defer api.f.unsubscribe(id)
+		for {
+			select {
+			case p := <-ch:
+				notifier.Notify(sub.ID, p)
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// startFirehose 在 addr 上启动只提供 WebSocket 订阅的 RPC 服务，返回停止服务的函数
+func startFirehose(addr string, f *firehose) (func(), error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("discv4", &firehoseAPI{f}); err != nil {
+		return nil, err
+	}
+	go func() {
+		log.Printf("节点发现数据包推送监听: ws://%s", addr)
+		if err := http.ListenAndServe(addr, server.WebsocketHandler(nil)); err != nil {
+			log.Printf("节点发现数据包推送退出: %v", err)
+		}
+	}()
+	return server.Stop, nil
+}
@@ -0,0 +1,15 @@
+//go:build minimal
+
+package main
+
+import "errors"
+
+const rpcCompiled = false
+
+func startRPC(addr string, api *adminAPI) (func(), error) {
+	return nil, errors.New("minimal 构建不包含管理 RPC")
+}
+
+func startFirehose(addr string, f *firehose) (func(), error) {
+	return nil, errors.New("minimal 构建不包含节点发现数据包推送")
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/rlpx"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// devp2p 基础协议的消息代码
+	baseHelloMsg      = 0x00
+	baseDisconnectMsg = 0x01
+	basePingMsg       = 0x02
+
+	scanDialTimeout = 5 * time.Second
+	// 等待对方先发送 Hello 的时间，超时后由我们先发送
+	scanHelloWait = 500 * time.Millisecond
+	// 发送 Hello 之后观察对方下一条消息的时间
+	scanObserveWait = time.Second
+)
+
+// scanHello 与 p2p 包中的 protoHandshake 编码相同
+type scanHello struct {
+	Version    uint64
+	Name       string
+	Caps       []p2p.Cap
+	ListenPort uint64
+	ID         []byte
+	Rest       []rlp.RawValue `rlp:"tail"`
+}
+
+// handshakeTraits 是从一次握手中观察到的实现特征，不包含可以随意伪造的客户端名称
+type handshakeTraits struct {
+	Version    uint64   `json:"version"`    // 基础协议版本，>= 5 表示支持 snappy
+	Caps       []string `json:"caps"`       // 按对方发送的顺序
+	CapsSorted bool     `json:"capsSorted"` // 对方是否按名称和版本排序
+	ListenPort bool     `json:"listenPort"` // 是否填写了监听端口
+	IDLen      int      `json:"idLen"`
+	RestFields int      `json:"restFields"` // Hello 中额外的字段数
+	HelloFirst bool     `json:"helloFirst"` // 是否不等我们就先发送了 Hello
+	// 收到我们不带任何能力的 Hello 之后的反应：disconnect:<原因>、disconnect-bytes:<原因>、ping、msg:<代码> 或 none
+	Reaction string `json:"reaction"`
+}
+
+// fingerprint 返回特征的短哈希，特征相同的节点很可能是同一种实现（及版本）
+func (t *handshakeTraits) fingerprint() string {
+	data, _ := json.Marshal(t)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// scanResult 是扫描单个节点的结果
+type scanResult struct {
+	ID          enode.ID         `json:"id"`
+	Addr        string           `json:"addr"`
+	Name        string           `json:"name,omitempty"`
+	Traits      *handshakeTraits `json:"traits,omitempty"`
+	Fingerprint string           `json:"fingerprint,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// scanNode 与节点完成 RLPx 握手和 Hello 交换后立即断开，不运行任何子协议
+func scanNode(key *ecdsa.PrivateKey, n *enode.Node) (res scanResult) {
+	res.ID = n.ID()
+	addr, ok := n.TCPEndpoint()
+	if !ok {
+		res.Error = "节点没有 TCP 端点"
+		return res
+	}
+	res.Addr = addr.String()
+	fd, err := net.DialTimeout("tcp", res.Addr, scanDialTimeout)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	conn := rlpx.NewConn(fd, n.Pubkey())
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scanDialTimeout))
+	if _, err := conn.Handshake(key); err != nil {
+		res.Error = fmt.Sprintf("RLPx 握手失败: %v", err)
+		return res
+	}
+
+	traits := new(handshakeTraits)
+	var hello scanHello
+	readHello := func(deadline time.Duration) error {
+		conn.SetReadDeadline(time.Now().Add(deadline))
+		code, data, _, err := conn.Read()
+		if err != nil {
+			return err
+		}
+		if code != baseHelloMsg {
+			return fmt.Errorf("期望 Hello，收到消息 %d", code)
+		}
+		return rlp.DecodeBytes(data, &hello)
+	}
+	sendHello := func() error {
+		ours := scanHello{Version: 5, Name: "devp2p-demo-scan", ID: crypto.FromECDSAPub(&key.PublicKey)[1:]}
+		data, _ := rlp.EncodeToBytes(&ours)
+		conn.SetWriteDeadline(time.Now().Add(scanDialTimeout))
+		_, err := conn.Write(baseHelloMsg, data)
+		return err
+	}
+
+	err = readHello(scanHelloWait)
+	var netErr net.Error
+	switch {
+	case err == nil:
+		traits.HelloFirst = true
+		err = sendHello()
+	case errors.As(err, &netErr) && netErr.Timeout():
+		if err = sendHello(); err == nil {
+			err = readHello(scanDialTimeout)
+		}
+	}
+	if err != nil {
+		res.Error = fmt.Sprintf("Hello 交换失败: %v", err)
+		return res
+	}
+	if hello.Version >= 5 {
+		conn.SetSnappy(true)
+	}
+
+	res.Name = hello.Name
+	traits.Version = hello.Version
+	for _, c := range hello.Caps {
+		traits.Caps = append(traits.Caps, c.String())
+	}
+	traits.CapsSorted = slices.IsSortedFunc(hello.Caps, func(a, b p2p.Cap) int { return a.Cmp(b) })
+	traits.ListenPort = hello.ListenPort != 0
+	traits.IDLen = len(hello.ID)
+	traits.RestFields = len(hello.Rest)
+	traits.Reaction = observeReaction(conn)
+	res.Traits = traits
+	res.Fingerprint = traits.fingerprint()
+
+	// 礼貌地断开
+	data, _ := rlp.EncodeToBytes([]uint{uint(p2p.DiscRequested)})
+	conn.Write(baseDisconnectMsg, data)
+	return res
+}
+
+// observeReaction 记录对方在收到我们 Hello 之后的第一条消息
+func observeReaction(conn *rlpx.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(scanObserveWait))
+	code, data, _, err := conn.Read()
+	if err != nil {
+		return "none"
+	}
+	switch code {
+	case baseDisconnectMsg:
+		// 原因应编码为列表，一些实现曾误把它编码为字节串，这同样是一个特征
+		var reason []uint
+		if rlp.DecodeBytes(data, &reason) == nil && len(reason) > 0 {
+			return fmt.Sprintf("disconnect:%d", reason[0])
+		}
+		var legacy []byte
+		if rlp.DecodeBytes(data, &legacy) == nil && len(legacy) > 0 {
+			return fmt.Sprintf("disconnect-bytes:%d", legacy[0])
+		}
+		return "disconnect"
+	case basePingMsg:
+		return "ping"
+	default:
+		return fmt.Sprintf("msg:%d", code)
+	}
+}
+
+// fingerprintCluster 是特征相同的一组节点
+type fingerprintCluster struct {
+	Fingerprint string           `json:"fingerprint"`
+	Traits      *handshakeTraits `json:"traits"`
+	Nodes       int              `json:"nodes"`
+	Names       map[string]int   `json:"names"` // 同一指纹下出现的客户端名称，多个名称可能意味着伪造
+}
+
+func clusterResults(results []scanResult) []*fingerprintCluster {
+	byFP := make(map[string]*fingerprintCluster)
+	for _, r := range results {
+		if r.Traits == nil {
+			continue
+		}
+		c, ok := byFP[r.Fingerprint]
+		if !ok {
+			c = &fingerprintCluster{Fingerprint: r.Fingerprint, Traits: r.Traits, Names: make(map[string]int)}
+			byFP[r.Fingerprint] = c
+		}
+		c.Nodes++
+		name := r.Name
+		if name == "" {
+			name = "(空)"
+		}
+		c.Names[name]++
+	}
+	clusters := make([]*fingerprintCluster, 0, len(byFP))
+	for _, c := range byFP {
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Nodes > clusters[j].Nodes })
+	return clusters
+}
+
+// loadScanTargets 从 crawl 子命令的结果文件或 enode URL 列表读取扫描目标
+func loadScanTargets(file string, urls []string) ([]*enode.Node, error) {
+	var nodes []*enode.Node
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var records map[enode.ID]*crawlRecord
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for _, r := range records {
+			n, err := enode.Parse(enode.ValidSchemes, r.Record)
+			if err != nil {
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	for _, url := range urls {
+		n, err := enode.Parse(enode.ValidSchemes, url)
+		if err != nil {
+			return nil, fmt.Errorf("无效的节点 %q: %v", url, err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func scanCmd(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	nodesFile := fs.String("nodes", "", "crawl 子命令生成的节点文件")
+	out := fs.String("out", "", "把每个节点的扫描结果写入 JSON 文件")
+	workers := fs.Int("workers", 16, "同时扫描的节点数")
+	interval := fs.Duration("interval", 20*time.Millisecond, "两次建立连接之间的最小间隔")
+	budgetMax := fs.Int("budget", 5, "每个节点在 -budget.window 内最多连接的次数，0 表示不限制")
+	budgetWindow := fs.Duration("budget.window", time.Hour, "连接预算的统计窗口")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法: scan [-nodes nodes.json] [参数] [enode URL...]")
+		fs.PrintDefaults()
+	}
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	targets, err := loadScanTargets(*nodesFile, fs.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(targets) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	budget := newDialBudget(*budgetMax, *budgetWindow)
+	log.Printf("扫描 %d 个节点的握手特征", len(targets))
+	var (
+		mu      sync.Mutex
+		results []scanResult
+		wg      sync.WaitGroup
+		queue   = make(chan *enode.Node)
+	)
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				r := scanNode(key, n)
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, n := range targets {
+		// 同一节点在目标列表中重复出现时也受预算限制
+		if budget.take(n.ID()) != nil {
+			continue
+		}
+		queue <- n
+		time.Sleep(*interval)
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	fmt.Fprintf(stdout, "完成握手 %d 个，失败 %d 个\n", len(results)-failed, failed)
+	for _, c := range clusterResults(results) {
+		var names []string
+		for name, count := range c.Names {
+			names = append(names, fmt.Sprintf("%s ×%d", name, count))
+		}
+		sort.Strings(names)
+		t := c.Traits
+		fmt.Fprintf(stdout, "\n%s  %d 个节点  p2p/%d snappy=%v caps=[%s] sorted=%v listenPort=%v helloFirst=%v reaction=%s\n",
+			c.Fingerprint, c.Nodes, t.Version, t.Version >= 5, strings.Join(t.Caps, ","), t.CapsSorted, t.ListenPort, t.HelloFirst, t.Reaction)
+		for _, name := range names {
+			fmt.Fprintf(stdout, "    %s\n", name)
+		}
+	}
+
+	if *out != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("写入结果失败: %v", err)
+		}
+	}
+}
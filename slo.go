@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 请求/响应协议的延迟 SLO：-slo 为每种请求定义目标，例如 file/chunk=95%<500ms 表示 95% 的
+// 数据块请求应在 500ms 内收到第一条响应。按节点、按请求类型保留最近 -slo.window 次请求的延迟
+// （超时计为一次超出目标的请求），样本数达到 sloMinSamples 后达标率低于目标即为违约。
+// 违约的节点在连接已满时优先被驱逐（见 evict.go），设置 -slo.drop 后持续违约超过这个时间的
+// 节点被断开，拨号调度器会用其他节点补上它的位置。
+//
+// 目前的请求类型：file/get（按路径下载的第一块数据）、file/chunk（按哈希请求数据块）、file/list（共享清单）。
+const (
+	evSLOViolated  = "slo.violated"
+	evSLORecovered = "slo.recovered"
+
+	sloMinSamples = 10
+	sloCheckEvery = 30 * time.Second
+)
+
+var sloKinds = []string{"file/get", "file/chunk", "file/list"}
+
+// sloTarget 是一种请求的延迟目标
+type sloTarget struct {
+	Kind    string        `json:"kind"`
+	Percent float64       `json:"percent"` // 至少这个比例的请求
+	Within  time.Duration `json:"within"`  // 在这个时间内收到响应
+}
+
+func (t sloTarget) String() string {
+	return fmt.Sprintf("%s=%s%%<%v", t.Kind, strconv.FormatFloat(t.Percent, 'f', -1, 64), t.Within)
+}
+
+// parseSLOTargets 解析 -slo 参数，格式为 kind=percent%<duration,...
+func parseSLOTargets(s string) ([]sloTarget, error) {
+	var list []sloTarget
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		kind, rest, ok := strings.Cut(item, "=")
+		pct, within, ok2 := strings.Cut(rest, "%<")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("无效的 SLO %q，格式为 kind=percent%%<duration，例如 file/chunk=95%%<500ms", item)
+		}
+		if !slices.Contains(sloKinds, kind) {
+			return nil, fmt.Errorf("未知的请求类型 %q，可选: %s", kind, strings.Join(sloKinds, ","))
+		}
+		t := sloTarget{Kind: kind}
+		var err error
+		if t.Percent, err = strconv.ParseFloat(pct, 64); err != nil || t.Percent <= 0 || t.Percent > 100 {
+			return nil, fmt.Errorf("SLO %q: 百分比应在 0-100 之间", item)
+		}
+		if t.Within, err = time.ParseDuration(within); err != nil || t.Within <= 0 {
+			return nil, fmt.Errorf("SLO %q: 无效的时间 %q", item, within)
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// sloSeries 是一个节点一种请求最近的延迟样本
+type sloSeries struct {
+	samples []time.Duration // 环形缓冲区
+	next    int
+	total   uint64
+}
+
+func (s *sloSeries) add(d time.Duration, window int) {
+	if len(s.samples) < window {
+		s.samples = append(s.samples, d)
+	} else {
+		s.samples[s.next] = d
+		s.next = (s.next + 1) % window
+	}
+	s.total++
+}
+
+// compliance 返回在 within 内完成的样本比例（百分比）
+func (s *sloSeries) compliance(within time.Duration) float64 {
+	ok := 0
+	for _, d := range s.samples {
+		if d <= within {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(s.samples)) * 100
+}
+
+type sloPeer struct {
+	series    map[string]*sloSeries
+	violating map[string]bool
+	since     time.Time // 开始违约的时间，没有违约时为零值
+}
+
+// sloPeerStatus 是 admin_slo 中一个节点一种请求的情况
+type sloPeerStatus struct {
+	ID         enode.ID      `json:"id"`
+	Kind       string        `json:"kind"`
+	Samples    int           `json:"samples"`
+	Total      uint64        `json:"total"`
+	P50        time.Duration `json:"p50"`
+	P95        time.Duration `json:"p95"`
+	Compliance float64       `json:"compliance"` // 在目标时间内完成的百分比
+	Violating  bool          `json:"violating"`
+	Since      time.Time     `json:"since,omitzero"`
+}
+
+// sloStatus 是 admin_slo 的返回值
+type sloStatus struct {
+	Targets []sloTarget     `json:"targets"`
+	Drop    time.Duration   `json:"drop,omitempty"`
+	Dropped uint64          `json:"dropped"`
+	Peers   []sloPeerStatus `json:"peers"`
+}
+
+// sloTracker 按节点跟踪请求延迟是否达到 SLO
+type sloTracker struct {
+	targets map[string]sloTarget
+	window  int
+	drop    time.Duration // 持续违约超过这个时间时断开，0 表示不断开
+	events  *eventBus
+	m       metrics.Metrics
+
+	mu      sync.Mutex
+	peers   map[enode.ID]*sloPeer
+	dropped uint64
+}
+
+func newSLOTracker(targets []sloTarget, window int, drop time.Duration, events *eventBus, m metrics.Metrics) *sloTracker {
+	t := &sloTracker{targets: make(map[string]sloTarget), window: window, drop: drop, events: events, m: m, peers: make(map[enode.ID]*sloPeer)}
+	for _, target := range targets {
+		t.targets[target.Kind] = target
+	}
+	return t
+}
+
+// observe 记录一次请求从发出到收到第一条响应的延迟。t 可以为 nil
+func (t *sloTracker) observe(id enode.ID, kind string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	target, ok := t.targets[kind]
+	if !ok {
+		return
+	}
+	t.m.Histogram("demo/slo/" + kind + "/latency").Observe(d.Milliseconds())
+	if d > target.Within {
+		t.m.Counter("demo/slo/" + kind + "/missed").Inc(1)
+	}
+	t.mu.Lock()
+	p := t.peers[id]
+	if p == nil {
+		p = &sloPeer{series: make(map[string]*sloSeries), violating: make(map[string]bool)}
+		t.peers[id] = p
+	}
+	s := p.series[kind]
+	if s == nil {
+		s = new(sloSeries)
+		p.series[kind] = s
+	}
+	s.add(d, t.window)
+	was := p.violating[kind]
+	now := len(s.samples) >= sloMinSamples && s.compliance(target.Within) < target.Percent
+	p.violating[kind] = now
+	compliance := s.compliance(target.Within)
+	if now && p.since.IsZero() {
+		p.since = time.Now()
+	}
+	if !p.isViolating() {
+		p.since = time.Time{}
+	}
+	t.mu.Unlock()
+
+	switch {
+	case now && !was:
+		log.Printf("节点 %s 的 %s 请求未达到 SLO %v: 达标率 %.1f%%", id.TerminalString(), kind, target, compliance)
+		t.events.emit(evSLOViolated, id, fmt.Sprintf("kind=%s compliance=%.1f target=%s", kind, compliance, target))
+	case !now && was:
+		t.events.emit(evSLORecovered, id, fmt.Sprintf("kind=%s compliance=%.1f", kind, compliance))
+	}
+}
+
+func (p *sloPeer) isViolating() bool {
+	for _, v := range p.violating {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+// violating 返回节点当前是否违约。t 可以为 nil
+func (t *sloTracker) violating(id enode.ID) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.peers[id]
+	return p != nil && p.isViolating()
+}
+
+// run 清理断开的节点，设置了 -slo.drop 时断开持续违约的节点
+func (t *sloTracker) run(srv *p2p.Server) {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	tick := time.NewTicker(sloCheckEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			// 违约的节点断开后保留样本，重新连接时仍按以前的延迟判断，
+			// 但违约时长从重新连接时算起，给它 -slo.drop 的时间恢复
+			t.mu.Lock()
+			if p := t.peers[ev.Peer]; p != nil {
+				switch {
+				case ev.Type == p2p.PeerEventTypeDrop && !p.isViolating():
+					delete(t.peers, ev.Peer)
+				case ev.Type == p2p.PeerEventTypeAdd && p.isViolating():
+					p.since = time.Now()
+				}
+			}
+			t.mu.Unlock()
+		case <-tick.C:
+			if t.drop > 0 {
+				t.enforce(srv)
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+func (t *sloTracker) enforce(srv *p2p.Server) {
+	now := time.Now()
+	for _, peer := range srv.Peers() {
+		if peer.Info().Network.Trusted {
+			continue
+		}
+		t.mu.Lock()
+		p := t.peers[peer.ID()]
+		drop := p != nil && !p.since.IsZero() && now.Sub(p.since) >= t.drop
+		var kinds []string
+		if drop {
+			for kind, v := range p.violating {
+				if v {
+					kinds = append(kinds, kind)
+				}
+			}
+			t.dropped++
+		}
+		t.mu.Unlock()
+		if drop {
+			sort.Strings(kinds)
+			log.Printf("节点 %s 持续 %v 未达到 %s 的延迟 SLO，断开连接", peer.ID().TerminalString(), t.drop, strings.Join(kinds, ","))
+			t.m.Counter("demo/slo/dropped").Inc(1)
+			peer.Disconnect(p2p.DiscUselessPeer)
+		}
+	}
+}
+
+func (t *sloTracker) status() *sloStatus {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := &sloStatus{Drop: t.drop, Dropped: t.dropped, Peers: []sloPeerStatus{}}
+	for _, target := range t.targets {
+		st.Targets = append(st.Targets, target)
+	}
+	sort.Slice(st.Targets, func(i, j int) bool { return st.Targets[i].Kind < st.Targets[j].Kind })
+	for id, p := range t.peers {
+		for kind, s := range p.series {
+			sorted := append([]time.Duration(nil), s.samples...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			ps := sloPeerStatus{
+				ID:         id,
+				Kind:       kind,
+				Samples:    len(sorted),
+				Total:      s.total,
+				P50:        sorted[len(sorted)/2],
+				P95:        sorted[min(len(sorted)-1, len(sorted)*95/100)],
+				Compliance: float64(int(s.compliance(t.targets[kind].Within)*10)) / 10,
+				Violating:  p.violating[kind],
+			}
+			if ps.Violating {
+				ps.Since = p.since
+			}
+			st.Peers = append(st.Peers, ps)
+		}
+	}
+	// 违约的节点排在前面，其余按达标率从低到高
+	sort.Slice(st.Peers, func(i, j int) bool {
+		a, b := st.Peers[i], st.Peers[j]
+		if a.Violating != b.Violating {
+			return a.Violating
+		}
+		if a.Compliance != b.Compliance {
+			return a.Compliance < b.Compliance
+		}
+		return a.ID.String()+a.Kind < b.ID.String()+b.Kind
+	})
+	return st
+}
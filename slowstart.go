@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// 慢启动：启动后的一段时间内限制同时进行的出站拨号数和拨号速率，并随时间线性放宽到
+// p2p.Server 的默认并发上限，避免重启时瞬间发起大量连接触发云厂商的入侵检测或限速。
+// 节点发现的查询由拨号调度器按需拉取候选节点驱动，拨号受限时查询速度也随之降低。
+const (
+	slowStartMaxDials = 50 // p2p.Server 默认的最大并发拨号数
+	slowStartPoll     = 100 * time.Millisecond
+)
+
+type slowStart struct {
+	start   time.Time
+	ramp    time.Duration
+	initial int // 启动时允许的并发拨号数，也是每秒最多开始的拨号数
+
+	mu     sync.Mutex
+	active int
+	last   time.Time // 上一次开始拨号的时间
+}
+
+// newSlowStart 创建慢启动限制，ramp 为 0 时返回 nil（不限制）
+func newSlowStart(ramp time.Duration, initial int) *slowStart {
+	if ramp <= 0 {
+		return nil
+	}
+	s := &slowStart{start: time.Now(), ramp: ramp, initial: max(initial, 1)}
+	log.Printf("慢启动：%v 内并发拨号数从 %d 逐步放宽到 %d", ramp, s.initial, slowStartMaxDials)
+	time.AfterFunc(ramp, func() { log.Printf("慢启动结束，不再限制拨号速率") })
+	return s
+}
+
+// limit 返回当前允许的并发拨号数，0 表示不再限制
+func (s *slowStart) limit(now time.Time) int {
+	elapsed := now.Sub(s.start)
+	if elapsed >= s.ramp {
+		return 0
+	}
+	return s.initial + int(int64(slowStartMaxDials-s.initial)*int64(elapsed)/int64(s.ramp))
+}
+
+// acquire 等待拨号额度，返回的函数在拨号结束后调用。s 可以为 nil
+func (s *slowStart) acquire(ctx context.Context) (release func(), err error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		limit := s.limit(now)
+		wait := slowStartPoll
+		if limit == 0 {
+			s.mu.Unlock()
+			return func() {}, nil
+		}
+		if s.active < limit {
+			spacing := time.Second / time.Duration(limit)
+			gap := now.Sub(s.last)
+			if gap >= spacing {
+				s.active++
+				s.last = now
+				s.mu.Unlock()
+				return s.release, nil
+			}
+			wait = spacing - gap
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *slowStart) release() {
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+}
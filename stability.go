@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 节点集合稳定性：根据当前会话时长的分布和最近的断开频率计算 0 到 100 的稳定性分数，
+// 并找出最近反复断开重连的不稳定节点。开启 -stability.rebalance 后，在一段时间没有断开的
+// 平静期内主动替换最不稳定的节点：先与一个上次会话足够长的健康历史节点建立 TCP 连接，
+// 再断开不稳定的节点并完成新节点的握手，而不是等它自己掉线后再被动补充。
+const (
+	evPeerRebalanced = "peer.rebalanced"
+
+	stabilityWindow = time.Hour // 统计断开次数的窗口
+	// 会话时长中位数达到这个值时时长部分得满分
+	stabilityMatureAge = time.Hour
+	// 窗口内断开这么多次的已连接节点被视为不稳定
+	stabilityFlakyDrops = 2
+	// 刚连接的节点不会被替换
+	stabilityGrace    = time.Minute
+	stabilityMaxFlaky = 10 // admin_stability 最多列出的不稳定节点数
+	// 等待被替换的节点断开的最长时间
+	stabilityDropWait = 3 * time.Second
+)
+
+// flakyPeer 是 admin_stability 中的一个不稳定节点
+type flakyPeer struct {
+	ID    enode.ID      `json:"id"`
+	Name  string        `json:"name"`
+	Drops int           `json:"drops"` // 窗口内的断开次数
+	Age   time.Duration `json:"age"`   // 当前会话时长
+}
+
+// stabilityStatus 是 admin_stability 的返回值
+type stabilityStatus struct {
+	Score        float64       `json:"score"`
+	Peers        int           `json:"peers"`
+	MedianAge    time.Duration `json:"medianAge"`
+	P10Age       time.Duration `json:"p10Age"`
+	Drops        int           `json:"drops"`        // 窗口内的断开次数
+	ChurnPerPeer float64       `json:"churnPerPeer"` // 窗口内平均每个连接位置的断开次数
+	LastDrop     time.Time     `json:"lastDrop,omitzero"`
+	Flaky        []flakyPeer   `json:"flaky"`
+	Rebalance    bool          `json:"rebalance"`
+	Replaced     uint64        `json:"replaced"`
+}
+
+type stabilityConfig struct {
+	Rebalance bool
+	Interval  time.Duration // 检查是否需要替换的间隔
+	Calm      time.Duration // 这么长时间没有断开才算平静期
+}
+
+// stabilityTracker 统计会话时长和断开频率
+type stabilityTracker struct {
+	cfg    stabilityConfig
+	srv    *p2p.Server
+	dialer p2p.NodeDialer
+	store  *peerStore
+	events *eventBus
+
+	mu       sync.Mutex
+	started  map[enode.ID]time.Time
+	drops    []time.Time              // 窗口内所有断开的时间
+	peerDrop map[enode.ID][]time.Time // 每个节点窗口内的断开时间
+	replaced uint64
+}
+
+func newStabilityTracker(cfg stabilityConfig, srv *p2p.Server, dialer p2p.NodeDialer, store *peerStore, events *eventBus) *stabilityTracker {
+	return &stabilityTracker{
+		cfg:      cfg,
+		srv:      srv,
+		dialer:   dialer,
+		store:    store,
+		events:   events,
+		started:  make(map[enode.ID]time.Time),
+		peerDrop: make(map[enode.ID][]time.Time),
+	}
+}
+
+// expire 删除窗口外的断开记录，调用方必须持有 s.mu
+func (s *stabilityTracker) expire(now time.Time) {
+	cutoff := now.Add(-stabilityWindow)
+	i := sort.Search(len(s.drops), func(i int) bool { return s.drops[i].After(cutoff) })
+	s.drops = s.drops[i:]
+	for id, times := range s.peerDrop {
+		j := sort.Search(len(times), func(i int) bool { return times[i].After(cutoff) })
+		if j == len(times) {
+			delete(s.peerDrop, id)
+		} else {
+			s.peerDrop[id] = times[j:]
+		}
+	}
+}
+
+func (s *stabilityTracker) track() {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := s.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			now := time.Now()
+			s.mu.Lock()
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				s.started[ev.Peer] = now
+			case p2p.PeerEventTypeDrop:
+				if _, ok := s.started[ev.Peer]; ok {
+					delete(s.started, ev.Peer)
+					s.drops = append(s.drops, now)
+					s.peerDrop[ev.Peer] = append(s.peerDrop[ev.Peer], now)
+				}
+			}
+			s.mu.Unlock()
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// stabilityScore 由会话时长中位数和平均每个位置的断开次数组成，各占一半
+func stabilityScore(median time.Duration, churnPerPeer float64) float64 {
+	age := min(1, float64(median)/float64(stabilityMatureAge))
+	churn := 1 / (1 + churnPerPeer)
+	return math.Round(100*(age+churn)/2*10) / 10
+}
+
+func (s *stabilityTracker) status() *stabilityStatus {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	names := make(map[enode.ID]string)
+	for _, p := range s.srv.Peers() {
+		names[p.ID()] = p.Fullname()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	st := &stabilityStatus{Rebalance: s.cfg.Rebalance, Replaced: s.replaced, Drops: len(s.drops), Flaky: []flakyPeer{}}
+	var ages []time.Duration
+	for id, t := range s.started {
+		age := now.Sub(t)
+		ages = append(ages, age)
+		if n := len(s.peerDrop[id]); n >= stabilityFlakyDrops {
+			st.Flaky = append(st.Flaky, flakyPeer{ID: id, Name: names[id], Drops: n, Age: age.Round(time.Second)})
+		}
+	}
+	slices.Sort(ages)
+	st.Peers = len(ages)
+	if len(ages) > 0 {
+		st.MedianAge = ages[len(ages)/2].Round(time.Second)
+		st.P10Age = ages[len(ages)/10].Round(time.Second)
+	}
+	if len(s.drops) > 0 {
+		st.LastDrop = s.drops[len(s.drops)-1]
+	}
+	st.ChurnPerPeer = float64(len(s.drops)) / float64(max(len(ages), 1))
+	st.Score = stabilityScore(st.MedianAge, st.ChurnPerPeer)
+	sort.Slice(st.Flaky, func(i, j int) bool {
+		if st.Flaky[i].Drops != st.Flaky[j].Drops {
+			return st.Flaky[i].Drops > st.Flaky[j].Drops
+		}
+		return st.Flaky[i].Age < st.Flaky[j].Age
+	})
+	if len(st.Flaky) > stabilityMaxFlaky {
+		st.Flaky = st.Flaky[:stabilityMaxFlaky]
+	}
+	return st
+}
+
+// calm 返回最近 cfg.Calm 内是否没有断开
+func (s *stabilityTracker) calm(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.drops) == 0 || now.Sub(s.drops[len(s.drops)-1]) >= s.cfg.Calm
+}
+
+// replacement 返回一个当前未连接、上次会话足够长的健康历史节点
+func (s *stabilityTracker) replacement(connected map[enode.ID]bool) *enode.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range s.store.healthy(enode.ID{}, math.MaxInt) {
+		if !connected[n.ID()] && len(s.peerDrop[n.ID()]) < stabilityFlakyDrops {
+			return n
+		}
+	}
+	return nil
+}
+
+// rebalance 在平静期内用健康节点替换最不稳定的一个节点
+func (s *stabilityTracker) rebalance() {
+	if !s.calm(time.Now()) {
+		return
+	}
+	st := s.status()
+	if len(st.Flaky) == 0 {
+		return
+	}
+	peers := make(map[enode.ID]*p2p.Peer)
+	connected := make(map[enode.ID]bool)
+	for _, p := range s.srv.Peers() {
+		peers[p.ID()] = p
+		connected[p.ID()] = true
+	}
+	var victim *p2p.Peer
+	var flaky flakyPeer
+	for _, f := range st.Flaky {
+		if p := peers[f.ID]; p != nil && f.Age >= stabilityGrace && !p.Info().Network.Trusted {
+			victim, flaky = p, f
+			break
+		}
+	}
+	if victim == nil {
+		return
+	}
+	next := s.replacement(connected)
+	if next == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(withDirectDial(context.Background(), dialRebalance), defaultDialTimeout)
+	defer cancel()
+	fd, err := s.dialer.Dial(ctx, next)
+	if err != nil {
+		log.Printf("稳定性调整：替换节点 %s 不可达: %v", next.ID().TerminalString(), err)
+		return
+	}
+	log.Printf("稳定性调整：节点 %s 在 %v 内断开了 %d 次，替换为 %s", victim.ID().TerminalString(), stabilityWindow, flaky.Drops, next.ID().TerminalString())
+	victim.Disconnect(p2p.DiscRequested)
+	for deadline := time.Now().Add(stabilityDropWait); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		s.mu.Lock()
+		_, still := s.started[victim.ID()]
+		s.mu.Unlock()
+		if !still {
+			break
+		}
+	}
+	if err := s.srv.SetupConn(fd, reconnectConnFlags, next); err != nil {
+		log.Printf("稳定性调整：与替换节点 %s 握手失败: %v", next.ID().TerminalString(), err)
+		return
+	}
+	s.mu.Lock()
+	s.replaced++
+	s.mu.Unlock()
+	s.events.emit(evPeerRebalanced, victim.ID(), fmt.Sprintf("drops=%d replacement=%s", flaky.Drops, next.ID().TerminalString()))
+}
+
+func (s *stabilityTracker) run() {
+	go s.track()
+	if !s.cfg.Rebalance {
+		return
+	}
+	tick := time.NewTicker(s.cfg.Interval)
+	defer tick.Stop()
+	for range tick.C {
+		s.rebalance()
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// 停滞分数的半衰期：分数约等于最近一段时间内写入被阻塞的秒数
+	stallHalfLife = 5 * time.Minute
+	// 发送队列满而丢弃一条消息计入的分数
+	stallDropScore = 0.1
+	// 超过这个时间的停滞记入事件
+	stallEventMin = time.Second
+	// 分数衰减到这个值以下且没有连接的节点不再保留
+	stallForgetScore = 0.01
+)
+
+// stallStats 是一个协议上的写入停滞统计
+type stallStats struct {
+	Stalls     uint64        `json:"stalls"`     // 超过阈值的写入次数
+	Deadlines  uint64        `json:"deadlines"`  // 因写超时失败的次数
+	QueueDrops uint64        `json:"queueDrops"` // 发送队列满而丢弃的消息数
+	Total      time.Duration `json:"total"`
+	Max        time.Duration `json:"max"`
+	Last       time.Time     `json:"last,omitempty"`
+}
+
+type peerStalls struct {
+	score     float64
+	scoreAt   time.Time
+	protocols map[string]*stallStats
+	writing   map[string]time.Time // 正在进行的写入的开始时间，按协议
+	active    int
+}
+
+// stallReport 是 admin_stalls 返回的单个节点的停滞情况
+type stallReport struct {
+	ID        enode.ID                 `json:"id"`
+	Score     float64                  `json:"score"`
+	Protocols map[string]stallStats    `json:"protocols"`
+	Blocked   map[string]time.Duration `json:"blocked,omitempty"` // 当前被阻塞超过阈值的写入
+}
+
+// stallTracker 检测读取过慢、拖住我们写入的节点（慢消费者）。
+// 同一连接上的所有协议共用一个 RLPx 写入通道，对一个节点的文件传输被阻塞时，
+// 发给它的 chat 消息也会排队，所以停滞按节点计分，并记录是哪个协议被阻塞。
+type stallTracker struct {
+	threshold time.Duration
+	events    *eventBus
+
+	mu    sync.Mutex
+	peers map[enode.ID]*peerStalls
+}
+
+func newStallTracker(threshold time.Duration, events *eventBus) *stallTracker {
+	return &stallTracker{threshold: threshold, events: events, peers: make(map[enode.ID]*peerStalls)}
+}
+
+// protocol 包装协议的 Run 函数，测量每次写入的耗时
+func (t *stallTracker) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	name := proto.Name
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		t.attach(p.ID())
+		defer t.detach(p.ID())
+		return run(p, &stallRW{MsgReadWriter: rw, t: t, id: p.ID(), proto: name})
+	}
+	return proto
+}
+
+func (t *stallTracker) attach(id enode.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ps := t.peers[id]
+	if ps == nil {
+		ps = &peerStalls{scoreAt: time.Now(), protocols: make(map[string]*stallStats), writing: make(map[string]time.Time)}
+		t.peers[id] = ps
+	}
+	ps.active++
+}
+
+func (t *stallTracker) detach(id enode.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ps := t.peers[id]; ps != nil {
+		ps.active--
+	}
+}
+
+// decay 把分数衰减到 now，调用方必须持有 t.mu
+func (ps *peerStalls) decay(now time.Time) float64 {
+	ps.score *= math.Pow(0.5, float64(now.Sub(ps.scoreAt))/float64(stallHalfLife))
+	ps.scoreAt = now
+	return ps.score
+}
+
+func (ps *peerStalls) proto(name string) *stallStats {
+	s := ps.protocols[name]
+	if s == nil {
+		s = new(stallStats)
+		ps.protocols[name] = s
+	}
+	return s
+}
+
+// wrote 记录一次写入的耗时和结果
+func (t *stallTracker) wrote(id enode.ID, proto string, d time.Duration, err error) {
+	deadline := isTimeout(err)
+	if d < t.threshold && !deadline {
+		return
+	}
+	t.mu.Lock()
+	ps := t.peers[id]
+	if ps == nil {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	s := ps.proto(proto)
+	s.Stalls++
+	s.Total += d
+	s.Max = max(s.Max, d)
+	s.Last = now
+	if deadline {
+		s.Deadlines++
+	}
+	ps.decay(now)
+	ps.score += d.Seconds()
+	t.mu.Unlock()
+
+	if d >= stallEventMin || deadline {
+		t.events.emit(evPeerStalled, id, fmt.Sprintf("proto=%s blocked=%v timeout=%v", proto, d.Round(time.Millisecond), deadline))
+	}
+}
+
+// dropped 记录因发送队列满而丢弃的消息
+func (t *stallTracker) dropped(id enode.ID, proto string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ps := t.peers[id]
+	if ps == nil {
+		return
+	}
+	now := time.Now()
+	s := ps.proto(proto)
+	s.QueueDrops++
+	s.Last = now
+	ps.decay(now)
+	ps.score += stallDropScore
+}
+
+// score 返回节点当前的停滞分数
+func (t *stallTracker) score(id enode.ID) float64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ps := t.peers[id]
+	if ps == nil {
+		return 0
+	}
+	score := ps.decay(time.Now())
+	// 正在被阻塞的写入也计入分数，否则一次很长的停滞要等写入结束才会被发现
+	for _, start := range ps.writing {
+		if d := time.Since(start); d >= t.threshold {
+			score += d.Seconds()
+		}
+	}
+	return score
+}
+
+func (t *stallTracker) report() []stallReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	var list []stallReport
+	for id, ps := range t.peers {
+		score := ps.decay(now)
+		if ps.active == 0 && score < stallForgetScore {
+			delete(t.peers, id)
+			continue
+		}
+		r := stallReport{ID: id, Protocols: make(map[string]stallStats, len(ps.protocols))}
+		for name, s := range ps.protocols {
+			r.Protocols[name] = *s
+		}
+		for name, start := range ps.writing {
+			if d := now.Sub(start); d >= t.threshold {
+				if r.Blocked == nil {
+					r.Blocked = make(map[string]time.Duration)
+				}
+				r.Blocked[name] = d
+				score += d.Seconds()
+			}
+		}
+		r.Score = score
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Score > list[j].Score })
+	return list
+}
+
+// begin 记录一次写入开始。同一协议上可能有多个 goroutine 并发写入（例如 file 协议同时服务多个请求），
+// 正在进行的写入只跟踪最早开始的一次
+func (t *stallTracker) begin(id enode.ID, proto string) time.Time {
+	now := time.Now()
+	t.mu.Lock()
+	if ps := t.peers[id]; ps != nil {
+		if _, ok := ps.writing[proto]; !ok {
+			ps.writing[proto] = now
+		}
+	}
+	t.mu.Unlock()
+	return now
+}
+
+func (t *stallTracker) end(id enode.ID, proto string, start time.Time) {
+	t.mu.Lock()
+	if ps := t.peers[id]; ps != nil && ps.writing[proto].Equal(start) {
+		delete(ps.writing, proto)
+	}
+	t.mu.Unlock()
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ne net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+}
+
+// stallRW 测量写入耗时。p2p 包中同一连接的所有协议轮流使用一个写入槽，
+// 所以一个协议被阻塞时，其他协议的写入也会表现为停滞
+type stallRW struct {
+	p2p.MsgReadWriter
+	t     *stallTracker
+	id    enode.ID
+	proto string
+}
+
+func (rw *stallRW) WriteMsg(msg p2p.Msg) error {
+	start := rw.t.begin(rw.id, rw.proto)
+	err := rw.MsgReadWriter.WriteMsg(msg)
+	rw.t.end(rw.id, rw.proto, start)
+	rw.t.wrote(rw.id, rw.proto, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// 定期摘要报告：每个 -report.every 周期（按整点对齐）汇总见过的节点、不同节点 ID 数、
+// 收发流量、最常见的客户端和断开原因、各拨号来源的有效性（见 dialreason.go），以 JSON 和 Markdown 写入 -report.dir，
+// 或以 JSON POST 到 -report.webhook，让没有完整监控系统的运营者也能定期看到节点概况。
+// 退出时写出当前周期的部分报告。
+const (
+	summaryTopN           = 10
+	summaryWebhookTimeout = 10 * time.Second
+)
+
+// summaryCount 是客户端或断开原因及其出现次数
+type summaryCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// summaryReport 是一个周期的摘要
+type summaryReport struct {
+	Node       enode.ID       `json:"node"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Partial    bool           `json:"partial,omitempty"` // 周期未结束（节点退出或通过 RPC 查询）
+	PeersNow   int            `json:"peersNow"`
+	PeerPeak   int            `json:"peerPeak"`
+	Sessions   int            `json:"sessions"`
+	Unique     int            `json:"unique"`   // 不同的节点 ID 数
+	Inbound    int            `json:"inbound"`  // 入站会话数
+	Dropped    int            `json:"dropped"`  // 结束的会话数
+	BytesIn    uint64         `json:"bytesIn"`  // 协议消息的接收字节数
+	BytesOut   uint64         `json:"bytesOut"` // 协议消息的发送字节数
+	TopClients []summaryCount `json:"topClients"`
+	Errors     []summaryCount `json:"errors"`
+	// 本周期各拨号来源的成功率、会话时长和有效性评分，评分从高到低
+	Sources []dialReasonStats `json:"sources"`
+}
+
+type summaryConfig struct {
+	Every   time.Duration
+	Dir     string
+	Webhook string
+}
+
+// summaryCollector 按周期收集摘要数据
+type summaryCollector struct {
+	cfg     summaryConfig
+	srv     *p2p.Server
+	usage   *usageTracker
+	reasons *dialReasons // 可以为 nil
+	faults  *faultLog    // 记录写入报告的故障，可以为 nil
+	http    http.Client
+
+	mu       sync.Mutex
+	start    time.Time
+	base     protoUsage // 周期开始时的累计用量
+	sessions int
+	inbound  int
+	dropped  int
+	peak     int
+	unique   map[enode.ID]bool
+	clients  map[string]int
+	errors   map[string]int
+	sources  map[string]dialReasonStats // 周期开始时各拨号来源的累计统计
+}
+
+func newSummaryCollector(cfg summaryConfig, srv *p2p.Server, usage *usageTracker, reasons *dialReasons) *summaryCollector {
+	s := &summaryCollector{cfg: cfg, srv: srv, usage: usage, reasons: reasons, http: http.Client{Timeout: summaryWebhookTimeout}}
+	s.reset(time.Now())
+	return s
+}
+
+// reset 开始新的周期，调用方必须持有 s.mu（构造时除外）
+func (s *summaryCollector) reset(now time.Time) {
+	s.start = now
+	s.base = s.usage.totals()
+	s.sessions, s.inbound, s.dropped = 0, 0, 0
+	s.peak = s.srv.PeerCount()
+	s.unique = make(map[enode.ID]bool)
+	s.clients = make(map[string]int)
+	s.errors = make(map[string]int)
+	s.sources = s.reasons.counters()
+}
+
+// clientName 返回客户端名称中版本号之前的部分，例如 Geth/v1.15.7-stable/linux-amd64 → Geth
+func clientName(fullname string) string {
+	name, _, _ := strings.Cut(fullname, "/")
+	if name == "" {
+		return "(unknown)"
+	}
+	return name
+}
+
+func (s *summaryCollector) track() {
+	ch := make(chan *p2p.PeerEvent, 16)
+	sub := s.srv.SubscribeEvents(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			var peer *p2p.Peer
+			if ev.Type == p2p.PeerEventTypeAdd {
+				for _, p := range s.srv.Peers() {
+					if p.ID() == ev.Peer {
+						peer = p
+					}
+				}
+			}
+			count := s.srv.PeerCount()
+			s.mu.Lock()
+			switch ev.Type {
+			case p2p.PeerEventTypeAdd:
+				s.sessions++
+				s.unique[ev.Peer] = true
+				s.peak = max(s.peak, count)
+				if peer != nil {
+					s.clients[clientName(peer.Fullname())]++
+					if peer.Inbound() {
+						s.inbound++
+					}
+				}
+			case p2p.PeerEventTypeDrop:
+				s.dropped++
+				if ev.Error != "" {
+					s.errors[ev.Error]++
+				}
+			}
+			s.mu.Unlock()
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+func topCounts(m map[string]int) []summaryCount {
+	list := make([]summaryCount, 0, len(m))
+	for name, n := range m {
+		list = append(list, summaryCount{Name: name, Count: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list[:min(len(list), summaryTopN)]
+}
+
+// snapshot 返回当前周期到 now 为止的摘要，调用方必须持有 s.mu
+func (s *summaryCollector) snapshot(now time.Time) *summaryReport {
+	u := s.usage.totals()
+	return &summaryReport{
+		Node:       s.srv.Self().ID(),
+		Start:      s.start,
+		End:        now,
+		PeersNow:   s.srv.PeerCount(),
+		PeerPeak:   s.peak,
+		Sessions:   s.sessions,
+		Unique:     len(s.unique),
+		Inbound:    s.inbound,
+		Dropped:    s.dropped,
+		BytesIn:    u.BytesIn - s.base.BytesIn,
+		BytesOut:   u.BytesOut - s.base.BytesOut,
+		TopClients: topCounts(s.clients),
+		Errors:     topCounts(s.errors),
+		Sources:    scoreReasons(s.reasons.counters(), s.sources),
+	}
+}
+
+// current 返回当前周期到目前为止的摘要。s 可以为 nil
+func (s *summaryCollector) current() *summaryReport {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.snapshot(time.Now())
+	r.Partial = true
+	return r
+}
+
+// rotate 结束当前周期并返回它的摘要
+func (s *summaryCollector) rotate(now time.Time, partial bool) *summaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.snapshot(now)
+	r.Partial = partial
+	s.reset(now)
+	return r
+}
+
+func (r *summaryReport) markdown() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# 节点摘要 %s – %s\n\n", r.Start.UTC().Format("2006-01-02 15:04"), r.End.UTC().Format("2006-01-02 15:04 MST"))
+	if r.Partial {
+		b.WriteString("（周期未结束，只包含部分数据）\n\n")
+	}
+	fmt.Fprintf(&b, "- 节点: `%s`\n", r.Node)
+	fmt.Fprintf(&b, "- 当前连接 %d 个，峰值 %d 个\n", r.PeersNow, r.PeerPeak)
+	fmt.Fprintf(&b, "- 会话 %d 次（入站 %d），不同节点 %d 个，结束 %d 次\n", r.Sessions, r.Inbound, r.Unique, r.Dropped)
+	fmt.Fprintf(&b, "- 流量: 接收 %d 字节，发送 %d 字节\n\n", r.BytesIn, r.BytesOut)
+	for _, sec := range []struct {
+		title string
+		list  []summaryCount
+	}{{"客户端", r.TopClients}, {"断开原因", r.Errors}} {
+		fmt.Fprintf(&b, "## %s\n\n", sec.title)
+		if len(sec.list) == 0 {
+			b.WriteString("无\n\n")
+			continue
+		}
+		b.WriteString("| 名称 | 次数 |\n|---|---|\n")
+		for _, c := range sec.list {
+			fmt.Fprintf(&b, "| %s | %d |\n", strings.ReplaceAll(c.Name, "|", `\|`), c.Count)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("## 拨号来源\n\n")
+	if len(r.Sources) == 0 {
+		b.WriteString("无\n\n")
+		return b.Bytes()
+	}
+	b.WriteString("| 来源 | 拨号 | 成功率 | 会话 | 平均时长 | 长连接 | 有用 | 评分 |\n|---|---|---|---|---|---|---|---|\n")
+	for _, c := range r.Sources {
+		fmt.Fprintf(&b, "| %s | %d | %.0f%% | %d | %v | %d | %d | %.1f |\n", c.Reason, c.Dials, 100*c.SuccessRate, c.Sessions, c.AvgSession, c.LongLived, c.Useful, c.Score)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// publish 把摘要写入目录并发送到 webhook
+func (s *summaryCollector) publish(r *summaryReport) {
+	body, _ := json.MarshalIndent(r, "", "  ")
+	if s.cfg.Dir != "" {
+		name := filepath.Join(s.cfg.Dir, "summary-"+r.Start.UTC().Format("20060102T1504"))
+		err := os.WriteFile(name+".json", append(body, '\n'), 0o644)
+		if err == nil {
+			err = os.WriteFile(name+".md", r.markdown(), 0o644)
+		}
+		if err != nil {
+			log.Printf("写入摘要报告失败: %v", err)
+			s.faults.fail("summary", failStorage, err)
+		} else {
+			log.Printf("已写入摘要报告 %s.{json,md}", name)
+			s.faults.ok("summary")
+		}
+	}
+	if s.cfg.Webhook != "" {
+		if err := s.post(body); err != nil {
+			log.Printf("发送摘要报告失败: %v", err)
+		}
+	}
+}
+
+func (s *summaryCollector) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), summaryWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// run 在每个周期结束时发布摘要，ctx 结束时发布当前周期的部分摘要
+func (s *summaryCollector) run(ctx context.Context) {
+	go s.track()
+	for {
+		now := time.Now()
+		next := now.Truncate(s.cfg.Every).Add(s.cfg.Every)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+			s.publish(s.rotate(next, false))
+		case <-ctx.Done():
+			timer.Stop()
+			s.publish(s.rotate(time.Now(), true))
+			return
+		}
+	}
+}
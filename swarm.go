@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// 向每个提供者同时请求的数据块数，与对方的 fileMaxServing 一致
+	swarmPeerConcurrency = fileMaxServing
+	// 连续失败这么多次后不再向该提供者请求
+	swarmMaxFailures = 3
+	// 查询各节点清单的超时时间
+	swarmListTimeout = 10 * time.Second
+)
+
+var errNoProviders = errors.New("没有节点提供该内容")
+
+// swarmPeerStats 是一次多节点下载中单个提供者的表现
+type swarmPeerStats struct {
+	ID         enode.ID `json:"id"`
+	Chunks     int      `json:"chunks"`
+	Bytes      int64    `json:"bytes"`
+	Failures   int      `json:"failures"`
+	Corrupt    int      `json:"corrupt"` // 校验失败的数据块数
+	AvgLatency int64    `json:"avgLatencyMs"`
+	Dropped    bool     `json:"dropped"`
+
+	latency time.Duration
+	streak  int // 连续失败次数
+}
+
+// swarmResult 是多节点下载的结果
+type swarmResult struct {
+	Path      string            `json:"path"`
+	Size      uint64            `json:"size"`
+	Chunks    int               `json:"chunks"`
+	Local     int               `json:"local"`
+	Providers []*swarmPeerStats `json:"providers"`
+	Elapsed   string            `json:"elapsed"`
+}
+
+// findProviders 向所有已连接的 file 节点查询清单，返回共享了内容 hash 的节点，跳过坏数据源
+func (f *fileProtocol) findProviders(ctx context.Context, hash common.Hash) map[enode.ID]manifestEntry {
+	ctx, cancel := context.WithTimeout(ctx, swarmListTimeout)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		providers = make(map[enode.ID]manifestEntry)
+	)
+	f.peers.Range(func(p *p2p.Peer, fp *filePeer) bool {
+		if f.corrupt.offender(p.ID()) {
+			return true
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := f.list(ctx, p.ID())
+			if err != nil {
+				return
+			}
+			for _, e := range m.Entries {
+				if e.Hash == hash {
+					mu.Lock()
+					providers[p.ID()] = e
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+	return providers
+}
+
+// swarmDownload 从所有提供内容 hash 的节点并行下载不同的数据块写入 out。
+// 快的节点自然会取走更多数据块；失败或校验不通过的数据块重新排队交给其他节点，
+// 连续失败的节点和成为坏数据源的节点被剔除。
+func (f *fileProtocol) swarmDownload(ctx context.Context, hash common.Hash, out *os.File) (*swarmResult, error) {
+	start := time.Now()
+	providers := f.findProviders(ctx, hash)
+	if len(providers) == 0 {
+		return nil, errNoProviders
+	}
+	var (
+		entry manifestEntry
+		owner enode.ID // entry 来自哪个节点的清单
+	)
+	for id, e := range providers {
+		entry, owner = e, id
+		break
+	}
+	res := &swarmResult{Path: entry.Path, Size: entry.Size, Chunks: len(entry.Chunks)}
+
+	// 本地已有的数据块直接写入，其余放入队列
+	queue := make(chan int, len(entry.Chunks))
+	for i, ch := range entry.Chunks {
+		if data, err := f.localChunk(ch); err == nil {
+			if _, err := out.WriteAt(data, int64(i)*fileChunkSize); err != nil {
+				return nil, err
+			}
+			res.Local++
+			continue
+		}
+		queue <- i
+	}
+
+	var (
+		remaining = len(entry.Chunks) - res.Local
+		mu        sync.Mutex
+		done      = make(chan struct{})
+		wg        sync.WaitGroup
+		writeErr  error
+	)
+	if remaining == 0 {
+		close(done)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for id := range providers {
+		stats := &swarmPeerStats{ID: id}
+		res.Providers = append(res.Providers, stats)
+		for w := 0; w < swarmPeerConcurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					var idx int
+					select {
+					case idx = <-queue:
+					case <-done:
+						return
+					case <-ctx.Done():
+						return
+					}
+					t := time.Now()
+					data, err := f.fetchChunk(ctx, id, entry.Chunks[idx])
+					if err == nil {
+						_, err = out.WriteAt(data, int64(idx)*fileChunkSize)
+						if err != nil {
+							mu.Lock()
+							writeErr = err
+							mu.Unlock()
+							cancel()
+							return
+						}
+					}
+
+					mu.Lock()
+					if err != nil {
+						stats.Failures++
+						stats.streak++
+						queue <- idx
+						if errors.Is(err, errChunkHash) {
+							stats.Corrupt++
+						}
+						if stats.streak >= swarmMaxFailures || f.corrupt.offender(id) {
+							stats.Dropped = true
+						}
+						dropped := stats.Dropped
+						mu.Unlock()
+						if dropped {
+							return
+						}
+						continue
+					}
+					stats.Chunks++
+					stats.Bytes += int64(len(data))
+					stats.latency += time.Since(t)
+					stats.streak = 0
+					remaining--
+					if remaining == 0 {
+						close(done)
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, s := range res.Providers {
+		if s.Chunks > 0 {
+			s.AvgLatency = (s.latency / time.Duration(s.Chunks)).Milliseconds()
+		}
+	}
+	sort.Slice(res.Providers, func(i, j int) bool { return res.Providers[i].Chunks > res.Providers[j].Chunks })
+	res.Elapsed = time.Since(start).Round(time.Millisecond).String()
+
+	switch {
+	case writeErr != nil:
+		return res, writeErr
+	case remaining > 0 && ctx.Err() != nil:
+		return res, ctx.Err()
+	case remaining > 0:
+		return res, fmt.Errorf("所有提供者都失败，剩余 %d 个数据块", remaining)
+	}
+	if err := verifyFileHash(out, hash, entry.Size); err != nil {
+		// 数据块都校验通过，是提供数据块列表的节点的清单有问题
+		f.corrupt.badFile(owner, fmt.Sprintf("内容 %x", hash[:8]))
+		return res, err
+	}
+	return res, nil
+}
+
+func verifyFileHash(f *os.File, hash common.Hash, size uint64) error {
+	h := sha256.New()
+	n, err := io.Copy(h, io.NewSectionReader(f, 0, int64(size)+1))
+	if err != nil {
+		return err
+	}
+	if uint64(n) != size || common.BytesToHash(h.Sum(nil)) != hash {
+		return errors.New("文件校验失败")
+	}
+	return nil
+}
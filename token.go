@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	errTokenMissing = errors.New("缺少访问令牌")
+	errTokenExpired = errors.New("访问令牌已过期")
+	errTokenHolder  = errors.New("访问令牌不属于该节点")
+	errTokenIssuer  = errors.New("访问令牌不是由本节点运营者签发")
+)
+
+// accessToken 是节点运营者签发的文件下载授权。
+// 令牌绑定持有者的节点 ID，而 RLPx 握手已经认证了对方身份，因此被截获的令牌无法被他人使用。
+type accessToken struct {
+	Holder enode.ID
+	Expiry uint64 // unix 秒
+	Sig    []byte
+}
+
+func (t *accessToken) sigHash() []byte {
+	payload, _ := rlp.EncodeToBytes([]interface{}{t.Holder, t.Expiry})
+	return crypto.Keccak256(payload)
+}
+
+// issueToken 用运营者私钥为 holder 签发有效期为 ttl 的令牌，返回文本形式
+func issueToken(key *ecdsa.PrivateKey, holder enode.ID, ttl time.Duration) (string, error) {
+	t := accessToken{Holder: holder, Expiry: uint64(time.Now().Add(ttl).Unix())}
+	sig, err := crypto.Sign(t.sigHash(), key)
+	if err != nil {
+		return "", err
+	}
+	t.Sig = sig
+	b, err := rlp.EncodeToBytes(&t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeToken 解析文本形式的令牌，得到握手中发送的原始字节
+func decodeToken(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("无效的令牌编码: %v", err)
+	}
+	var t accessToken
+	if err := rlp.DecodeBytes(b, &t); err != nil {
+		return nil, fmt.Errorf("无效的令牌: %v", err)
+	}
+	return b, nil
+}
+
+// tokenVerifier 校验令牌是否由指定的签发者为指定节点签发
+type tokenVerifier struct {
+	issuer enode.ID
+}
+
+func (v *tokenVerifier) verify(raw []byte, holder enode.ID, now time.Time) error {
+	if len(raw) == 0 {
+		return errTokenMissing
+	}
+	var t accessToken
+	if err := rlp.DecodeBytes(raw, &t); err != nil {
+		return fmt.Errorf("无效的令牌: %v", err)
+	}
+	pub, err := crypto.SigToPub(t.sigHash(), t.Sig)
+	if err != nil {
+		return fmt.Errorf("无效的令牌签名: %v", err)
+	}
+	if enode.PubkeyToIDV4(pub) != v.issuer {
+		return errTokenIssuer
+	}
+	if t.Holder != holder {
+		return errTokenHolder
+	}
+	if uint64(now.Unix()) >= t.Expiry {
+		return errTokenExpired
+	}
+	return nil
+}
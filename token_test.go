@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestTokenVerify(t *testing.T) {
+	issuer, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	holder := enode.ID{1}
+	v := &tokenVerifier{issuer: enode.PubkeyToIDV4(&issuer.PublicKey)}
+	now := time.Now()
+
+	raw := func(key *ecdsa.PrivateKey, ttl time.Duration) []byte {
+		t.Helper()
+		s, err := issueToken(key, holder, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := decodeToken(s + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	valid := raw(issuer, time.Hour)
+	if err := v.verify(valid, holder, now); err != nil {
+		t.Fatalf("有效令牌校验失败: %v", err)
+	}
+	tests := []struct {
+		name   string
+		raw    []byte
+		holder enode.ID
+		now    time.Time
+		want   error
+	}{
+		{"缺少令牌", nil, holder, now, errTokenMissing},
+		{"他人签发", raw(other, time.Hour), holder, now, errTokenIssuer},
+		{"持有者不符", valid, enode.ID{2}, now, errTokenHolder},
+		{"已过期", valid, holder, now.Add(2 * time.Hour), errTokenExpired},
+	}
+	for _, tt := range tests {
+		if err := v.verify(tt.raw, tt.holder, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: 错误 = %v，应为 %v", tt.name, err, tt.want)
+		}
+	}
+
+	// 延长有效期后签名对应的公钥不再是签发者
+	var tok accessToken
+	if err := rlp.DecodeBytes(valid, &tok); err != nil {
+		t.Fatal(err)
+	}
+	tok.Expiry += 3600
+	tampered, _ := rlp.EncodeToBytes(&tok)
+	if err := v.verify(tampered, holder, now); !errors.Is(err, errTokenIssuer) {
+		t.Fatalf("篡改的令牌: 错误 = %v，应为 %v", err, errTokenIssuer)
+	}
+	if err := v.verify([]byte{0xff}, holder, now); err == nil {
+		t.Fatal("无法解码的令牌通过了校验")
+	}
+	if _, err := decodeToken("不是令牌"); err == nil {
+		t.Fatal("无效的文本令牌被解析")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// 滚动协议升级：节点同时提供一个协议的新旧版本（连接时自动使用双方都支持的最高版本），
+// -upgrade 指定要推广的新版本后，升级控制器统计已连接节点中各版本的占比；
+// 宽限期 -upgrade.grace 结束、并且支持新版本的节点占比达到 -upgrade.threshold 时切换为
+// 只接受新版本：只支持旧版本的节点被断开，之后也无法再连接（见 capspin.go），旧版本的会话在握手前被拒绝，
+// 不支持该协议的节点不受影响。Hello 中通告的能力在运行中无法修改，切换后仍然包含旧版本，
+// 切换也只在本次运行中有效：升级完成后应改为 -caps.min 新版本+?，重启后不再通告和提供旧版本。
+const (
+	upgradeCheckInterval  = 10 * time.Second
+	upgradeReportInterval = 10 * time.Minute
+)
+
+// servedVersions 是本节点提供的每个协议的版本
+func servedVersions() map[string][]uint {
+	return map[string][]uint{"chat": chatVersions, "file": {fileVersion}, "gossip": {gossipVersion}}
+}
+
+var errUpgradeFlipped = errors.New("不再提供旧版本")
+
+type upgradeConfig struct {
+	Name      string
+	Version   uint
+	Grace     time.Duration
+	Threshold float64 // 0 到 1
+	MinPeers  int     // 支持该协议的节点少于这个数时不切换
+}
+
+// parseUpgrade 解析 "chat/2"，要求本节点同时提供这个版本和至少一个更低的版本
+func parseUpgrade(spec string) (name string, version uint, err error) {
+	name, ver, ok := strings.Cut(spec, "/")
+	v, perr := strconv.ParseUint(ver, 10, 32)
+	if !ok || name == "" || perr != nil {
+		return "", 0, fmt.Errorf("无效的升级目标 %q，格式为 协议/版本", spec)
+	}
+	versions, known := servedVersions()[name]
+	if !known {
+		return "", 0, fmt.Errorf("本节点不提供 %s 协议", name)
+	}
+	if !slices.Contains(versions, uint(v)) || slices.Min(versions) >= uint(v) {
+		return "", 0, fmt.Errorf("本节点提供的 %s 版本为 %v，需要同时提供 %d 和更低的版本", name, versions, v)
+	}
+	return name, uint(v), nil
+}
+
+// upgradeStatus 是 admin_upgrade 的返回值
+type upgradeStatus struct {
+	Protocol  string        `json:"protocol"`
+	Version   uint          `json:"version"`
+	Mix       map[uint]int  `json:"mix"` // 节点通告的最高版本 → 节点数
+	Adoption  float64       `json:"adoption"`
+	Threshold float64       `json:"threshold"`
+	GraceLeft time.Duration `json:"graceLeft"`
+	Flipped   bool          `json:"flipped"`
+	FlippedAt time.Time     `json:"flippedAt,omitzero"`
+}
+
+// upgradeController 统计版本占比并在条件满足时切换为只接受新版本
+type upgradeController struct {
+	cfg     upgradeConfig
+	srv     *p2p.Server
+	pinner  *capPinner
+	started time.Time
+
+	mu        sync.Mutex
+	flippedAt time.Time
+}
+
+func newUpgradeController(cfg upgradeConfig, srv *p2p.Server, pinner *capPinner) *upgradeController {
+	return &upgradeController{cfg: cfg, srv: srv, pinner: pinner, started: time.Now()}
+}
+
+// mix 按已连接节点通告的最高版本分组，不支持该协议的节点不计入
+func (u *upgradeController) mix() (mix map[uint]int, adoption float64) {
+	mix = make(map[uint]int)
+	var total, upgraded int
+	for _, p := range u.srv.Peers() {
+		var best uint
+		for _, c := range p.Caps() {
+			if c.Name == u.cfg.Name && c.Version > best {
+				best = c.Version
+			}
+		}
+		if best == 0 {
+			continue
+		}
+		mix[best]++
+		total++
+		if best >= u.cfg.Version {
+			upgraded++
+		}
+	}
+	if total > 0 {
+		adoption = float64(upgraded) / float64(total)
+	}
+	return mix, adoption
+}
+
+func (u *upgradeController) status() *upgradeStatus {
+	if u == nil {
+		return nil
+	}
+	mix, adoption := u.mix()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return &upgradeStatus{
+		Protocol:  u.cfg.Name,
+		Version:   u.cfg.Version,
+		Mix:       mix,
+		Adoption:  adoption,
+		Threshold: u.cfg.Threshold,
+		GraceLeft: max(0, u.cfg.Grace-time.Since(u.started)).Round(time.Second),
+		Flipped:   !u.flippedAt.IsZero(),
+		FlippedAt: u.flippedAt,
+	}
+}
+
+// check 在宽限期结束且占比达到阈值时切换，返回是否已经切换
+func (u *upgradeController) check() bool {
+	if u.flipped() {
+		return true
+	}
+	if time.Since(u.started) < u.cfg.Grace {
+		return false
+	}
+	mix, adoption := u.mix()
+	total := 0
+	for _, n := range mix {
+		total += n
+	}
+	if total < u.cfg.MinPeers || adoption < u.cfg.Threshold {
+		return false
+	}
+	u.flip(fmt.Sprintf("%.0f%% 的 %d 个节点已支持新版本", adoption*100, total))
+	return true
+}
+
+// protocol 包装旧版本协议的 Run 函数，切换后拒绝旧版本的会话。u 为 nil 时原样返回
+func (u *upgradeController) protocol(proto p2p.Protocol) p2p.Protocol {
+	if u == nil || proto.Name != u.cfg.Name || proto.Version >= u.cfg.Version {
+		return proto
+	}
+	run := proto.Run
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		if u.flipped() {
+			return fmt.Errorf("%w: 已切换为只接受 %s/%d", errUpgradeFlipped, u.cfg.Name, u.cfg.Version)
+		}
+		return run(p, rw)
+	}
+	return proto
+}
+
+func (u *upgradeController) flipped() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.flippedAt.IsZero()
+}
+
+// flip 切换为只接受新版本
+func (u *upgradeController) flip(why string) {
+	u.mu.Lock()
+	if !u.flippedAt.IsZero() {
+		u.mu.Unlock()
+		return
+	}
+	u.flippedAt = time.Now()
+	u.mu.Unlock()
+	log.Printf("协议升级：%s，切换为只接受 %s/%d，重启前旧版本仍出现在通告的能力中，重启时加上 -caps.min %s/%d+?", why, u.cfg.Name, u.cfg.Version, u.cfg.Name, u.cfg.Version)
+	u.pinner.add(capPin{Name: u.cfg.Name, Version: u.cfg.Version, IfPresent: true})
+}
+
+func (u *upgradeController) run() {
+	log.Printf("协议升级：推广 %s/%d，宽限期 %v，阈值 %.0f%%", u.cfg.Name, u.cfg.Version, u.cfg.Grace, u.cfg.Threshold*100)
+	check := time.NewTicker(upgradeCheckInterval)
+	defer check.Stop()
+	report := time.NewTicker(upgradeReportInterval)
+	defer report.Stop()
+	for {
+		select {
+		case <-check.C:
+			if u.check() {
+				return
+			}
+		case <-report.C:
+			mix, adoption := u.mix()
+			log.Printf("协议升级：%s 版本分布 %v，新版本占比 %.0f%%", u.cfg.Name, mix, adoption*100)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// 超出配额后每条消息额外等待的时间
+	quotaThrottleDelay = 500 * time.Millisecond
+	// 断开超过这个时间的节点不再出现在用量报告中
+	usageRetention = 24 * time.Hour
+	// 节点断开时最多每隔这么久清理一次过期的记录
+	usagePruneInterval = 10 * time.Minute
+)
+
+// quotaConfig 是每个节点在一个统计窗口内允许消耗的资源，0 表示不限制
+type quotaConfig struct {
+	Window   time.Duration
+	MaxMsgs  uint64 // 收到（需要我们处理）的消息数
+	MaxBytes uint64 // 发送给对方的字节数
+}
+
+// protoUsage 是单个协议上的累计用量
+type protoUsage struct {
+	MsgsIn   uint64 `json:"msgsIn"`
+	MsgsOut  uint64 `json:"msgsOut"`
+	BytesIn  uint64 `json:"bytesIn"`
+	BytesOut uint64 `json:"bytesOut"`
+}
+
+type peerUsage struct {
+	total     protoUsage
+	protocols map[string]*protoUsage
+
+	windowStart time.Time
+	windowMsgs  uint64
+	windowBytes uint64
+	throttled   uint64
+
+	active     int // 正在运行的协议数
+	lastActive time.Time
+}
+
+// usageReport 是 admin_usage 返回的单个节点用量
+type usageReport struct {
+	ID          enode.ID              `json:"id"`
+	Active      bool                  `json:"active"`
+	Total       protoUsage            `json:"total"`
+	Protocols   map[string]protoUsage `json:"protocols"`
+	WindowMsgs  uint64                `json:"windowMsgs"`
+	WindowBytes uint64                `json:"windowBytes"`
+	OverQuota   bool                  `json:"overQuota"`
+	Throttled   uint64                `json:"throttled"`
+}
+
+// usageTracker 统计每个节点的协议资源消耗，并对超出配额的节点限速
+type usageTracker struct {
+	cfg       quotaConfig
+	throttled metrics.Counter
+
+	mu     sync.Mutex
+	peers  map[enode.ID]*peerUsage
+	all    protoUsage // 所有节点的累计用量，不随节点记录的清理而减少
+	pruned time.Time  // 上次清理过期记录的时间
+}
+
+func newUsageTracker(cfg quotaConfig, m metrics.Metrics) *usageTracker {
+	return &usageTracker{
+		cfg:       cfg,
+		throttled: m.Counter("demo/quota/throttled"),
+		peers:     make(map[enode.ID]*peerUsage),
+	}
+}
+
+// protocol 包装协议的 Run 函数，使其所有消息都被计量
+func (t *usageTracker) protocol(proto p2p.Protocol) p2p.Protocol {
+	run := proto.Run
+	name := proto.Name
+	proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		t.attach(p.ID())
+		defer t.detach(p.ID())
+		return run(p, &meteredRW{MsgReadWriter: rw, t: t, id: p.ID(), proto: name})
+	}
+	return proto
+}
+
+func (t *usageTracker) attach(id enode.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.peers[id]
+	if !ok {
+		u = &peerUsage{protocols: make(map[string]*protoUsage), windowStart: time.Now()}
+		t.peers[id] = u
+	}
+	u.active++
+	u.lastActive = time.Now()
+}
+
+func (t *usageTracker) detach(id enode.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if u, ok := t.peers[id]; ok {
+		u.active--
+		u.lastActive = now
+	}
+	if now.Sub(t.pruned) >= usagePruneInterval {
+		t.prune(now)
+	}
+}
+
+// prune 删除断开超过 usageRetention 的节点记录，调用方必须持有 t.mu
+func (t *usageTracker) prune(now time.Time) {
+	t.pruned = now
+	for id, u := range t.peers {
+		if u.active == 0 && now.Sub(u.lastActive) > usageRetention {
+			delete(t.peers, id)
+		}
+	}
+}
+
+// rollWindow 在统计窗口到期时清零窗口计数，调用方必须持有 t.mu
+func (t *usageTracker) rollWindow(u *peerUsage, now time.Time) {
+	if t.cfg.Window > 0 && now.Sub(u.windowStart) >= t.cfg.Window {
+		u.windowStart = now
+		u.windowMsgs = 0
+		u.windowBytes = 0
+	}
+}
+
+func (t *usageTracker) overQuota(u *peerUsage) bool {
+	return (t.cfg.MaxMsgs > 0 && u.windowMsgs > t.cfg.MaxMsgs) ||
+		(t.cfg.MaxBytes > 0 && u.windowBytes > t.cfg.MaxBytes)
+}
+
+// received 记录收到的消息，返回节点是否超出配额
+func (t *usageTracker) received(id enode.ID, proto string, size uint32) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.peers[id]
+	now := time.Now()
+	t.rollWindow(u, now)
+	pu := u.proto(proto)
+	pu.MsgsIn++
+	pu.BytesIn += uint64(size)
+	u.total.MsgsIn++
+	u.total.BytesIn += uint64(size)
+	t.all.MsgsIn++
+	t.all.BytesIn += uint64(size)
+	u.windowMsgs++
+	u.lastActive = now
+	if t.overQuota(u) {
+		u.throttled++
+		return true
+	}
+	return false
+}
+
+func (t *usageTracker) sent(id enode.ID, proto string, size uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.peers[id]
+	t.rollWindow(u, time.Now())
+	pu := u.proto(proto)
+	pu.MsgsOut++
+	pu.BytesOut += uint64(size)
+	u.total.MsgsOut++
+	u.total.BytesOut += uint64(size)
+	t.all.MsgsOut++
+	t.all.BytesOut += uint64(size)
+	u.windowBytes += uint64(size)
+}
+
+func (u *peerUsage) proto(name string) *protoUsage {
+	pu, ok := u.protocols[name]
+	if !ok {
+		pu = new(protoUsage)
+		u.protocols[name] = pu
+	}
+	return pu
+}
+
+// value 返回节点的累计流量（收发字节数之和），用于衡量连接的价值
+func (t *usageTracker) value(id enode.ID) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.peers[id]
+	if !ok {
+		return 0
+	}
+	return u.total.BytesIn + u.total.BytesOut
+}
+
+// totals 返回启动以来所有节点的累计用量
+func (t *usageTracker) totals() protoUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.all
+}
+
+// lastActive 返回节点最近一次收发消息的时间
+func (t *usageTracker) lastActive(id enode.ID) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.peers[id]; ok {
+		return u.lastActive
+	}
+	return time.Time{}
+}
+
+// report 返回所有节点的用量，按发送字节数从多到少排序
+func (t *usageTracker) report() []usageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	list := make([]usageReport, 0, len(t.peers))
+	for id, u := range t.peers {
+		if u.active == 0 && now.Sub(u.lastActive) > usageRetention {
+			// 等下一次 prune 删除
+			continue
+		}
+		t.rollWindow(u, now)
+		r := usageReport{
+			ID:          id,
+			Active:      u.active > 0,
+			Total:       u.total,
+			Protocols:   make(map[string]protoUsage, len(u.protocols)),
+			WindowMsgs:  u.windowMsgs,
+			WindowBytes: u.windowBytes,
+			OverQuota:   t.overQuota(u),
+			Throttled:   u.throttled,
+		}
+		for name, pu := range u.protocols {
+			r.Protocols[name] = *pu
+		}
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Total.BytesOut > list[j].Total.BytesOut })
+	return list
+}
+
+// meteredRW 在读写消息时记账，超出配额的节点在读取下一条消息前会被延迟
+type meteredRW struct {
+	p2p.MsgReadWriter
+	t     *usageTracker
+	id    enode.ID
+	proto string
+}
+
+func (rw *meteredRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err != nil {
+		return msg, err
+	}
+	if rw.t.received(rw.id, rw.proto, msg.Size) {
+		rw.t.throttled.Inc(1)
+		time.Sleep(quotaThrottleDelay)
+	}
+	return msg, nil
+}
+
+func (rw *meteredRW) WriteMsg(msg p2p.Msg) error {
+	size := msg.Size
+	if err := rw.MsgReadWriter.WriteMsg(msg); err != nil {
+		return err
+	}
+	rw.t.sent(rw.id, rw.proto, size)
+	return nil
+}
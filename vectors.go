@@ -0,0 +1,295 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/cuiweixie/devp2p-demo/metrics"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 测试向量中有 zstd 压缩的载荷，minimal 构建不包含 zstd，也不提供这个子命令
+func init() {
+	commands["vectors"] = command{"输出或校验所有协议消息的标准 RLP 编码（供其他语言的实现做兼容性测试）", vectorsCmd}
+}
+
+// 生成测试向量用的固定私钥种子，其他语言的实现可以用同一把私钥复现签名
+const vectorKeySeed = "devp2p-demo test vectors"
+
+// wireVector 是一条消息的标准编码。Value 是与语言无关的 JSON 形式：
+// 字节串写成 0x 开头的十六进制，结构体写成以字段名为键的对象，字段在 RLP 列表中的顺序以协议定义为准。
+type wireVector struct {
+	Protocol string          `json:"protocol"`
+	Version  uint            `json:"version"`
+	Code     *uint64         `json:"code,omitempty"`  // 协议消息代码，gossip 载荷和令牌没有
+	Topic    string          `json:"topic,omitempty"` // gossip 载荷所属的主题
+	Name     string          `json:"name"`
+	Comment  string          `json:"comment,omitempty"`
+	Value    json.RawMessage `json:"value"`
+	RLP      hexutil.Bytes   `json:"rlp"`
+}
+
+type vectorFile struct {
+	Generator string       `json:"generator"`
+	Key       string       `json:"key"` // 签名用的私钥（十六进制），仅用于测试
+	Vectors   []wireVector `json:"vectors"`
+}
+
+// vectorCase 描述一条测试向量：value 是要编码的值，decode 返回用于解码的同类型零值指针
+type vectorCase struct {
+	protocol string
+	version  uint
+	code     *uint64
+	topic    string
+	name     string
+	comment  string
+	value    any
+	decode   func() any
+}
+
+func msgCode(c uint64) *uint64 { return &c }
+
+// vectorCases 列出所有演示协议消息的测试向量，值必须是确定的
+func vectorCases() []vectorCase {
+	key, _ := crypto.ToECDSA(crypto.Keccak256([]byte(vectorKeySeed)))
+	self := enode.PubkeyToIDV4(&key.PublicKey)
+	selfURL := enode.NewV4(&key.PublicKey, []byte{127, 0, 0, 1}, 30303, 30303).URLv4()
+	h1 := crypto.Keccak256Hash([]byte("chunk-1"))
+	h2 := crypto.Keccak256Hash([]byte("chunk-2"))
+
+	token := accessToken{Holder: self, Expiry: 1700000000}
+	token.Sig, _ = crypto.Sign(token.sigHash(), key)
+	tokenBytes, _ := rlp.EncodeToBytes(&token)
+	ctl := controlCommand{Action: ctlDropPeer, Target: self, Ban: 3600, Issued: 1700000000, Expiry: 1700000600, Nonce: 1}
+	ctlHash := ctl.sigHash()
+	ctl.Sig, _ = crypto.Sign(ctlHash[:], key)
+
+	manifest := &fileManifest{Created: 1700000000, Entries: []manifestEntry{
+		{Path: "a.txt", Size: 5, Hash: crypto.Keccak256Hash([]byte("hello")), Chunks: []common.Hash{h1}},
+		{Path: "dir/b.bin", Size: fileChunkSize + 1, Hash: crypto.Keccak256Hash([]byte("b")), Chunks: []common.Hash{h1, h2}},
+	}}
+	manifest.sign(key)
+
+	// 带有未知尾部字段的握手消息，用于检查实现是否忽略将来新增的字段
+	extra, _ := rlp.EncodeToBytes("future")
+
+	announce := providerRecord{Hash: h1, Node: selfURL, TTL: uint64(providerTTL.Seconds())}
+	find := contentFind{QueryID: 7, Hash: h1}
+	found := contentFound{QueryID: 7, Providers: []providerRecord{announce}}
+	announcePayload, _ := rlp.EncodeToBytes(&announce)
+
+	// zstd 压缩的载荷。其他实现的压缩结果不要求逐字节相同，解压后与原文一致即可
+	codec, _ := newPayloadCodec(codecZstd, 0, fileMaxMsgSize, metrics.Noop)
+	compressed, _ := codec.compress("vectors", bytes.Repeat([]byte("devp2p "), 64))
+	// 差量编码：基准为同一主题、同一来源 Seq=41 的 {"cpu":10,"peers":3}，还原后为 {"cpu":12,"peers":3}
+	delta := gossipDelta{Base: 41, Len: 20, Patches: []deltaPatch{{Offset: 8, Data: []byte("2")}}}
+	deltaPayload, _ := rlp.EncodeToBytes(&delta)
+
+	return []vectorCase{
+		{"chat", chatVersion, msgCode(chatStatusMsg), "", "status", "握手消息", &chatStatus{Version: chatVersion, Name: "node1", ListenPort: 30303}, func() any { return new(chatStatus) }},
+		{"chat", 1, msgCode(chatTextMsg), "", "text", "包含非 ASCII 字符的文本", &chatText{Text: "你好, devp2p"}, func() any { return new(chatText) }},
+		{"chat", 1, msgCode(chatTextMsg), "", "text-empty", "空文本", &chatText{}, func() any { return new(chatText) }},
+		{"chat", 2, msgCode(chatTextMsg), "", "text-v2", "带有发送时间 (Unix 毫秒) 的文本", &chatTextV2{Text: "你好, devp2p", Sent: 1700000000000}, func() any { return new(chatTextV2) }},
+		{"chat", chatVersion, msgCode(chatGoAwayMsg), "", "goaway", "下线通知及推荐节点", &chatGoAway{Reason: "shutdown", Alternatives: []string{selfURL}}, func() any { return new(chatGoAway) }},
+
+		{"gossip", gossipVersion, msgCode(gossipStatusMsg), "", "status", "握手消息", &gossipStatus{Version: gossipVersion}, func() any { return new(gossipStatus) }},
+		{"gossip", gossipVersion, msgCode(gossipStatusMsg), "", "status-extra", "带有未知尾部字段，解码时必须忽略", &gossipStatus{Version: gossipVersion, Rest: []rlp.RawValue{extra}}, func() any { return new(gossipStatus) }},
+		{"gossip", gossipVersion, msgCode(gossipStatusMsg), "", "status-compress", "声明支持 zstd 载荷压缩", &gossipStatus{Version: gossipVersion, Compress: codecZstd}, func() any { return new(gossipStatus) }},
+		{"gossip", gossipVersion, msgCode(gossipMsg), "", "message-zstd", "协商压缩后的消息，Payload 解压后为 \"devp2p \" 重复 64 次", &gossipMessage{Topic: "chat", Origin: self, Seq: 43, Payload: compressed, Codec: codecZstd}, func() any { return new(gossipMessage) }},
+		{"gossip", gossipVersion, msgCode(gossipStatusMsg), "", "status-interest", "声明支持兴趣传播", &gossipStatus{Version: gossipVersion, Interest: gossipInterestVersion}, func() any { return new(gossipStatus) }},
+		{"gossip", gossipVersion, msgCode(gossipInterestMsg), "", "interest", "兴趣通告：自己订阅的主题距离为 0，为其他节点转发的主题距离大于 0", &gossipInterest{Version: 3, Topics: []interestTopic{{topicContentAnnounce, 0}, {"telemetry", 2}}}, func() any { return new(gossipInterest) }},
+		{"gossip", gossipVersion, msgCode(gossipMsg), "", "message-delta", "差量编码的消息，Payload 为 delta 向量", &gossipMessage{Topic: "telemetry", Origin: self, Seq: 42, Payload: deltaPayload, Codec: codecDelta}, func() any { return new(gossipMessage) }},
+		{"gossip", gossipVersion, nil, "", "delta", "差量编码消息的 Payload", &delta, func() any { return new(gossipDelta) }},
+		{"gossip", gossipVersion, msgCode(gossipMsg), "", "message-time", "带有发布时间的消息，Codec 为空时仍需编码以保持字段位置", &gossipMessage{Topic: "chat", Origin: self, Seq: 44, Payload: []byte("hi"), Time: 1700000000000}, func() any { return new(gossipMessage) }},
+		{"gossip", gossipVersion, msgCode(gossipMsg), "", "message", "转发中的消息（Hops=2）", &gossipMessage{Topic: topicContentAnnounce, Origin: self, Seq: 42, Hops: 2, Payload: announcePayload}, func() any { return new(gossipMessage) }},
+
+		{"content", gossipVersion, nil, topicContentAnnounce, "announce", "gossip 载荷：提供者声明", &announce, func() any { return new(providerRecord) }},
+		{"content", gossipVersion, nil, topicContentFind, "find", "gossip 载荷：查询提供者", &find, func() any { return new(contentFind) }},
+		{"content", gossipVersion, nil, topicContentFound, "found", "gossip 载荷：查询结果", &found, func() any { return new(contentFound) }},
+
+		{"file", fileVersion, msgCode(fileHelloMsg), "", "hello", "握手消息，携带下载令牌", &fileHello{Version: fileVersion, Token: tokenBytes}, func() any { return new(fileHello) }},
+		{"file", fileVersion, msgCode(fileHelloMsg), "", "hello-notoken", "握手消息，没有令牌", &fileHello{Version: fileVersion}, func() any { return new(fileHello) }},
+		{"file", fileVersion, msgCode(fileHelloMsg), "", "hello-compress", "握手消息，声明支持 zstd 载荷压缩", &fileHello{Version: fileVersion, Compress: codecZstd}, func() any { return new(fileHello) }},
+		{"file", fileVersion, msgCode(fileGetMsg), "", "get", "按路径请求文件", &fileGet{ReqID: 1, Path: "dir/b.bin"}, func() any { return new(fileGet) }},
+		{"file", fileVersion, msgCode(fileDataMsg), "", "data", "文件数据", &fileData{ReqID: 1, Data: []byte("hello")}, func() any { return new(fileData) }},
+		{"file", fileVersion, msgCode(fileDataMsg), "", "data-zstd", "协商压缩后的文件数据，Data 解压后为 \"devp2p \" 重复 64 次", &fileData{ReqID: 1, Data: compressed, EOF: true, Codec: codecZstd}, func() any { return new(fileData) }},
+		{"file", fileVersion, msgCode(fileDataMsg), "", "data-error", "请求失败时的最后一条响应", &fileData{ReqID: 1, EOF: true, Error: "同时进行的请求过多"}, func() any { return new(fileData) }},
+		{"file", fileVersion, msgCode(fileListMsg), "", "list", "请求文件清单", &fileList{ReqID: 2}, func() any { return new(fileList) }},
+		{"file", fileVersion, msgCode(fileManifestMsg), "", "manifest", "签名的文件清单", &fileManifestResp{ReqID: 2, Manifest: manifest}, func() any { return new(fileManifestResp) }},
+		{"file", fileVersion, msgCode(fileManifestMsg), "", "manifest-error", "没有清单时 Manifest 编码为空列表", &fileManifestResp{ReqID: 2, Error: "未共享文件"}, func() any { return new(fileManifestResp) }},
+		{"file", fileVersion, msgCode(fileGetChunkMsg), "", "getchunk", "按哈希请求数据块", &fileGetChunk{ReqID: 3, Hash: h2}, func() any { return new(fileGetChunk) }},
+
+		{"conf", confVersion, msgCode(confStatusMsg), "", "status", "握手消息", &confStatus{Version: confVersion}, func() any { return new(confStatus) }},
+		{"conf", confVersion, msgCode(confPingMsg), "", "ping", "一致性检查的 ping，对方用相同的 Nonce 应答 pong", &confPing{Nonce: 0x0102030405060708}, func() any { return new(confPing) }},
+		{"conf", confVersion, msgCode(confPingMsg), "", "ping-extra", "带有未知尾部字段的 ping，必须忽略尾部字段照常应答", &confPing{Nonce: 1, Rest: []rlp.RawValue{extra}}, func() any { return new(confPing) }},
+		{"conf", confVersion, msgCode(confPongMsg), "", "pong", "ping 的应答", &confPong{Nonce: 0x0102030405060708}, func() any { return new(confPong) }},
+
+		{"control", gossipVersion, nil, topicControl, "command", "gossip 载荷：运营者控制命令（control 子命令输出的 base64url 解码后）", &ctl, func() any { return new(controlCommand) }},
+		{"token", 1, nil, "", "access-token", "文件下载令牌（issue-token 输出的 base64url 解码后）", &token, func() any { return new(accessToken) }},
+	}
+}
+
+// buildVectors 编码所有测试向量
+func buildVectors() (*vectorFile, error) {
+	key, _ := crypto.ToECDSA(crypto.Keccak256([]byte(vectorKeySeed)))
+	f := &vectorFile{
+		Generator: "devp2p-demo " + nodeVersion,
+		Key:       hexutil.Encode(crypto.FromECDSA(key)),
+	}
+	for _, c := range vectorCases() {
+		enc, err := rlp.EncodeToBytes(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %v", c.protocol, c.name, err)
+		}
+		value, err := json.Marshal(vectorValue(reflect.ValueOf(c.value)))
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %v", c.protocol, c.name, err)
+		}
+		f.Vectors = append(f.Vectors, wireVector{
+			Protocol: c.protocol, Version: c.version, Code: c.code, Topic: c.topic,
+			Name: c.name, Comment: c.comment, Value: value, RLP: enc,
+		})
+	}
+	return f, nil
+}
+
+// vectorValue 把值转换为与语言无关的 JSON 形式
+func vectorValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return vectorValue(v.Elem())
+	case reflect.Struct:
+		obj := make(map[string]any)
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			if !f.IsExported() || f.Tag.Get("rlp") == "-" {
+				continue
+			}
+			if f.Tag.Get("rlp") == "tail" && v.Field(i).Len() == 0 {
+				continue
+			}
+			obj[f.Name] = vectorValue(v.Field(i))
+		}
+		return obj
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return hexutil.Encode(b)
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = vectorValue(v.Index(i))
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+// verifyVectors 检查文件中的每条向量：能按对应类型解码，重新编码后字节不变，并且与当前代码生成的编码一致。
+// 返回失败的向量数。
+func verifyVectors(f *vectorFile) int {
+	cases := make(map[string]vectorCase)
+	for _, c := range vectorCases() {
+		cases[c.protocol+"/"+c.name] = c
+	}
+	current, err := buildVectors()
+	if err != nil {
+		log.Fatal(err)
+	}
+	want := make(map[string][]byte)
+	for _, v := range current.Vectors {
+		want[v.Protocol+"/"+v.Name] = v.RLP
+	}
+
+	failed := 0
+	seen := make(map[string]bool)
+	for _, v := range f.Vectors {
+		name := v.Protocol + "/" + v.Name
+		seen[name] = true
+		c, ok := cases[name]
+		var problem string
+		switch {
+		case !ok:
+			problem = "未知的向量"
+		case v.Version != c.version:
+			problem = fmt.Sprintf("协议版本 %d，当前为 %d", v.Version, c.version)
+		default:
+			val := c.decode()
+			if err := rlp.DecodeBytes(v.RLP, val); err != nil {
+				problem = fmt.Sprintf("解码失败: %v", err)
+			} else if enc, _ := rlp.EncodeToBytes(val); !bytes.Equal(enc, v.RLP) {
+				problem = "重新编码后字节不同（不是标准编码）"
+			} else if !bytes.Equal(v.RLP, want[name]) {
+				problem = fmt.Sprintf("与当前实现的编码不同，当前为 %s", hexutil.Encode(want[name]))
+			}
+		}
+		if problem != "" {
+			failed++
+			fmt.Fprintf(stdout, "FAIL %-22s %s\n", name, problem)
+		} else {
+			fmt.Fprintf(stdout, "ok   %s\n", name)
+		}
+	}
+	for _, v := range current.Vectors {
+		if name := v.Protocol + "/" + v.Name; !seen[name] {
+			fmt.Fprintf(stdout, "MISS %s\n", name)
+		}
+	}
+	return failed
+}
+
+func vectorsCmd(args []string) {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	out := fs.String("out", "", "把测试向量写入文件（默认输出到标准输出）")
+	verify := fs.String("verify", "", "校验测试向量文件，有失败时退出码为 1")
+	localizeFlags(fs)
+	fs.Parse(args)
+
+	if *verify != "" {
+		data, err := os.ReadFile(*verify)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var f vectorFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			log.Fatalf("无效的测试向量文件: %v", err)
+		}
+		if failed := verifyVectors(&f); failed > 0 {
+			fmt.Fprintf(stdout, "%d 条向量校验失败\n", failed)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "全部 %d 条向量校验通过\n", len(f.Vectors))
+		return
+	}
+
+	f, err := buildVectors()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, _ := json.MarshalIndent(f, "", "  ")
+	data = append(data, '\n')
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("已写入 %d 条测试向量到 %s", len(f.Vectors), *out)
+}
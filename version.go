@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+const nodeVersion = "0.1.0"
+
+// printVersion 打印版本信息，verbose 时同时列出可选子系统的状态
+func printVersion(verbose bool, features *featureSet) {
+	fmt.Fprintf(stdout, "devp2p-demo %s (%s)\n", nodeVersion, buildProfile)
+	fmt.Fprintf(stdout, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				fmt.Fprintf(stdout, "%s: %s\n", s.Key, s.Value)
+			}
+		}
+	}
+	if !verbose {
+		return
+	}
+	fmt.Fprintln(stdout, "features:")
+	for _, f := range features.list() {
+		state := "disabled"
+		switch {
+		case !f.Compiled:
+			state = "not compiled"
+		case f.Enabled:
+			state = "enabled"
+		}
+		toggle := ""
+		if f.Toggleable {
+			toggle = " (runtime toggle)"
+		}
+		fmt.Fprintf(stdout, "  %-13s %s%s\n", f.Name, state, toggle)
+	}
+}